@@ -0,0 +1,186 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/pappasjfed/chkiso/internal/i18n"
+	"github.com/pappasjfed/chkiso/pkg/manifest"
+)
+
+// associationClass is the registry class .sha and .sha256 files are
+// associated with by `chkiso associate`.
+const associationClass = "chkiso.checksum"
+
+// associatedExtensions are the extensions `chkiso associate` registers.
+// Files without an extension, such as SHA256SUMS, can still be opened with
+// chkiso through "Open with".
+var associatedExtensions = []string{".sha", ".sha256"}
+
+// imageOutcome is the result for one file listed in a checksum file.
+type imageOutcome struct {
+	Name     string
+	Failures []error
+}
+
+// verifyChecksumTarget verifies the files listed in the checksum file at
+// config.Path that are present in the same folder. This is what opening a
+// checksum file with chkiso does.
+func verifyChecksumTarget(config *Config) []error {
+	outcomes, failures := verifyListedFiles(config)
+	if len(outcomes) == 0 {
+		return failures
+	}
+
+	fmt.Printf("\n--- %s ---\n", i18n.T("Checksum File Summary"))
+	for _, o := range outcomes {
+		if len(o.Failures) == 0 {
+			fmt.Printf("  \033[32m%s\033[0m  %s\n", i18n.T("PASSED"), o.Name)
+		} else {
+			fmt.Printf("  \033[31m%s\033[0m  %s\n", i18n.T("FAILED"), o.Name)
+		}
+	}
+	return failures
+}
+
+// verifyListedFiles verifies each file listed in the checksum file at
+// config.Path that is present in the same folder, returning the outcome
+// for each along with all failures.
+func verifyListedFiles(config *Config) ([]imageOutcome, []error) {
+	if config.JSON || config.ReportFile != "" || config.Sha256Hash != "" || config.ShaFile != "" {
+		err := errors.New("-json, -report, -sha256 and -shafile cannot be used when the target is a checksum file")
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return nil, []error{err}
+	}
+
+	entries, err := manifest.ParseFile(config.Path)
+	if err != nil {
+		err = fmt.Errorf("could not read checksum file: %v", err)
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return nil, []error{err}
+	}
+
+	dir := filepath.Dir(config.Path)
+	fmt.Printf("Verifying files listed in %s\n", config.Path)
+
+	var failures []error
+	var outcomes []imageOutcome
+	for _, entry := range entries {
+		if entry.Algorithm != manifest.SHA256 {
+			fmt.Fprintf(os.Stderr, "Warning: Skipping %s: only SHA256 entries can be verified\n", entry.Path)
+			continue
+		}
+		// A checksum file only vouches for files in its own folder
+		if !filepath.IsLocal(filepath.FromSlash(strings.ReplaceAll(entry.Path, "\\", "/"))) {
+			fmt.Fprintf(os.Stderr, "Warning: Skipping %s: it is outside the folder of the checksum file\n", entry.Path)
+			continue
+		}
+		imagePath := ""
+		for _, name := range manifest.NameForms(entry.Path) {
+			candidate := filepath.Join(dir, filepath.FromSlash(name))
+			if _, err := os.Stat(candidate); err == nil {
+				imagePath = candidate
+				break
+			}
+		}
+		if imagePath == "" {
+			fmt.Printf("Not present in this folder, skipping: %s\n", entry.Path)
+			continue
+		}
+
+		fmt.Printf("\n=== %s ===\n", entry.Path)
+		image := *config
+		image.Path = imagePath
+		image.Sha256Hash = entry.Hash
+		image.started = time.Now()
+		// Only images have contents with checksum files of their own
+		if ext := strings.ToLower(filepath.Ext(imagePath)); ext != ".iso" && ext != ".zip" {
+			image.NoVerify = true
+		}
+		imageFailures := verifyPath(&image)
+		failures = append(failures, imageFailures...)
+		outcomes = append(outcomes, imageOutcome{entry.Path, imageFailures})
+	}
+
+	if len(outcomes) == 0 {
+		err := fmt.Errorf("none of the files listed in %s were found in %s", filepath.Base(config.Path), dir)
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		failures = append(failures, err)
+	}
+	return outcomes, failures
+}
+
+// runAssociate implements `chkiso associate [-remove]`, which registers
+// chkiso for the current user as the program that opens .sha and .sha256
+// files on Windows.
+func runAssociate(args []string) error {
+	remove := false
+	for _, arg := range args {
+		switch arg {
+		case "-remove", "--remove":
+			remove = true
+		default:
+			return fmt.Errorf("unknown associate option: %s", arg)
+		}
+	}
+	if runtime.GOOS != "windows" {
+		return errors.New("file associations can only be registered on Windows; use your desktop's \"Open With\" to open checksum files with chkiso")
+	}
+
+	classes := `HKCU\Software\Classes\`
+	if remove {
+		for _, ext := range associatedExtensions {
+			// Only undo associations that still point at chkiso
+			out, err := exec.Command("reg", "query", classes+ext, "/ve").CombinedOutput()
+			if err == nil && strings.Contains(string(out), associationClass) {
+				if err := reg("delete", classes+ext, "/f"); err != nil {
+					return err
+				}
+			}
+		}
+		// Removing an association that is already gone succeeds
+		if exec.Command("reg", "query", classes+associationClass).Run() != nil {
+			fmt.Println("chkiso is not registered to open checksum files.")
+			return nil
+		}
+		if err := reg("delete", classes+associationClass, "/f"); err != nil {
+			return err
+		}
+		fmt.Println("Removed the chkiso file association.")
+		return nil
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	command := fmt.Sprintf(`"%s" "%%1" -pause`, exe)
+	if err := reg("add", classes+associationClass, "/ve", "/d", "Checksum file", "/f"); err != nil {
+		return err
+	}
+	if err := reg("add", classes+associationClass+`\shell\open\command`, "/ve", "/d", command, "/f"); err != nil {
+		return err
+	}
+	for _, ext := range associatedExtensions {
+		if err := reg("add", classes+ext, "/ve", "/d", associationClass, "/f"); err != nil {
+			return err
+		}
+	}
+	fmt.Printf("Registered chkiso to open %s files.\n", strings.Join(associatedExtensions, " and "))
+	return nil
+}
+
+// reg runs reg.exe with args.
+func reg(args ...string) error {
+	out, err := exec.Command("reg", args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("reg %s failed: %v: %s", args[0], err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
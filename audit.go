@@ -0,0 +1,169 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/pappasjfed/chkiso/pkg/verify"
+)
+
+// AuditRecord is one line of the -audit-log file. Every record of a run
+// shares its RunID, so log pipelines can group them.
+type AuditRecord struct {
+	Time      time.Time `json:"time"`
+	RunID     string    `json:"run_id"`
+	Event     string    `json:"event"` // run_start, step_start, step_end, file, warning, run_end
+	Target    string    `json:"target"`
+	Operator  string    `json:"operator,omitempty"`
+	Host      string    `json:"host,omitempty"`
+	Version   string    `json:"version,omitempty"`
+	Step      string    `json:"step,omitempty"`
+	File      string    `json:"file,omitempty"`
+	Manifest  string    `json:"manifest,omitempty"`
+	Algorithm string    `json:"algorithm,omitempty"`
+	Status    string    `json:"status,omitempty"`
+	Detail    string    `json:"detail,omitempty"`
+	SHA256    string    `json:"sha256,omitempty"`
+	Failures  []string  `json:"failures,omitempty"`
+}
+
+// auditLog appends AuditRecords to a JSONL file. The file is only ever
+// appended to, one complete line per write.
+type auditLog struct {
+	file   *os.File
+	runID  string
+	target string
+}
+
+func openAuditLog(path string, target string) (*auditLog, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("could not open audit log: %v", err)
+	}
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &auditLog{file: file, runID: hex.EncodeToString(id), target: target}, nil
+}
+
+func (a *auditLog) write(rec AuditRecord) {
+	rec.Time = time.Now().UTC()
+	rec.RunID = a.runID
+	rec.Target = a.target
+	line, err := json.Marshal(rec)
+	if err == nil {
+		_, err = a.file.Write(append(line, '\n'))
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: Could not write audit log: %v\n", err)
+	}
+}
+
+func (a *auditLog) start() {
+	host, _ := os.Hostname()
+	a.write(AuditRecord{Event: "run_start", Operator: operator(), Host: host, Version: VERSION})
+}
+
+// progress records the verifier events that matter for an audit trail.
+func (a *auditLog) progress(ev verify.Progress) {
+	switch ev.Phase {
+	case "begin":
+		a.write(AuditRecord{Event: "step_start", Step: ev.Item})
+	case "end":
+		rec := AuditRecord{Event: "step_end", Step: ev.Item, Status: "completed"}
+		if err := ev.Result.Err(ev.Item); err != nil {
+			rec.Status = "error"
+			rec.Detail = err.Error()
+		}
+		switch ev.Item {
+		case verify.StepLabel:
+			if l := ev.Result.Label; l != nil {
+				rec.Status = passFail(l.Match)
+				rec.Detail = l.Found
+			}
+		case verify.StepSize:
+			if sz := ev.Result.Size; sz != nil {
+				rec.Status = passFail(sz.Match())
+				rec.Detail = fmt.Sprintf("%d bytes, expected %d", sz.Found, sz.Expected)
+			}
+		case verify.StepSha256:
+			rec.SHA256 = ev.Result.Sha256
+			if ev.Result.Hash != nil {
+				rec.Status = passFail(ev.Result.Hash.Match)
+				if ev.Result.Hash.Match && len(ev.Result.Hash.Candidates) > 1 {
+					rec.Detail = "matched " + ev.Result.Hash.Expected
+				}
+			} else if ev.Result.ImageMD5 != nil {
+				rec.Status = passFail(ev.Result.ImageMD5.Match)
+				rec.Detail = ev.Result.ImageMD5.Calculated
+			}
+		case verify.StepMD5:
+			if ev.Result.MD5 != nil {
+				rec.Status = passFail(ev.Result.MD5.IsIntegrityOK)
+				rec.Detail = ev.Result.MD5.CalculatedMD5
+			}
+		case verify.StepDMG:
+			if ev.Result.DMG != nil {
+				rec.Status = passFail(ev.Result.DMG.OK())
+			}
+		case verify.StepWIM:
+			if ev.Result.WIM != nil {
+				rec.Status = passFail(ev.Result.WIM.OK())
+			}
+		case verify.StepJigdo:
+			if j := ev.Result.Jigdo; j != nil {
+				rec.Status = passFail(j.OK())
+				rec.Detail = fmt.Sprintf("%d of %d package files failed", len(j.Failures), j.Components)
+			}
+		case verify.StepContents:
+			if c := ev.Result.Contents; c != nil {
+				rec.Status = passFail(c.Failed == 0 && c.Total > 0)
+				rec.Detail = fmt.Sprintf("%d of %d files failed", c.Failed, c.Total)
+			}
+		}
+		a.write(rec)
+	case "warning":
+		a.write(AuditRecord{Event: "warning", Detail: ev.Item})
+	case "contents":
+		if ev.File == nil {
+			return
+		}
+		rec := AuditRecord{
+			Event:     "file",
+			File:      ev.File.Name,
+			Manifest:  ev.File.ChecksumFile,
+			Status:    string(ev.File.Status),
+			Algorithm: ev.File.Algorithm,
+		}
+		if ev.File.Err != nil {
+			rec.Detail = ev.File.Err.Error()
+		}
+		a.write(rec)
+	}
+}
+
+// finish records the outcome of the run and closes the log.
+func (a *auditLog) finish(sha256 string, failures []error) {
+	rec := AuditRecord{Event: "run_end", Status: passFail(len(failures) == 0), SHA256: sha256}
+	for _, err := range failures {
+		rec.Failures = append(rec.Failures, err.Error())
+	}
+	a.write(rec)
+	if err := a.file.Sync(); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: Could not write audit log: %v\n", err)
+	}
+	a.file.Close()
+}
+
+func passFail(ok bool) string {
+	if ok {
+		return "PASSED"
+	}
+	return "FAILED"
+}
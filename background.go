@@ -0,0 +1,19 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// backgroundNice is the CPU priority -background runs at on Unix-like
+// systems: the lowest, as with nice -n 19.
+const backgroundNice = 19
+
+// enterBackground lowers chkiso's CPU and I/O priority for -background, so
+// that verifying a large archive does not slow down interactive use of the
+// computer. A failure only costs the lower priority, so it is a warning.
+func enterBackground() {
+	if err := lowerPriority(); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: could not lower priority for -background: %v\n", err)
+	}
+}
@@ -0,0 +1,22 @@
+//go:build darwin
+
+package main
+
+import "syscall"
+
+// setpriority(2) arguments from <sys/resource.h> that put a process in the
+// background band, which lowers its CPU priority and throttles its disk and
+// network I/O, as taskpolicy -b does.
+const (
+	prioDarwinProcess = 4
+	prioDarwinBG      = 0x1000
+)
+
+// lowerPriority moves chkiso to the background band, falling back to the
+// lowest CPU priority.
+func lowerPriority() error {
+	if err := syscall.Setpriority(prioDarwinProcess, 0, prioDarwinBG); err == nil {
+		return nil
+	}
+	return syscall.Setpriority(syscall.PRIO_PROCESS, 0, backgroundNice)
+}
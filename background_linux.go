@@ -0,0 +1,42 @@
+//go:build linux
+
+package main
+
+import (
+	"os"
+	"strconv"
+	"syscall"
+)
+
+// ioprio_set(2) arguments: the lowest best-effort I/O priority, as with
+// ionice -c 2 -n 7. The idle class is not used because a scheduled check on
+// a busy disk would never finish.
+const (
+	ioprioWhoProcess = 1
+	ioprioClassBE    = 2
+	ioprioClassShift = 13
+	ioprioLowest     = 7
+)
+
+// lowerPriority gives chkiso the lowest CPU (nice 19) and best-effort I/O
+// priority. Linux keeps both per thread, so every thread of the process is
+// changed; threads started later inherit them.
+func lowerPriority() error {
+	tids, err := os.ReadDir("/proc/self/task")
+	if err != nil {
+		return err
+	}
+	for _, entry := range tids {
+		tid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		if err := syscall.Setpriority(syscall.PRIO_PROCESS, tid, backgroundNice); err != nil {
+			return err
+		}
+		if _, _, errno := syscall.Syscall(syscall.SYS_IOPRIO_SET, ioprioWhoProcess, uintptr(tid), ioprioClassBE<<ioprioClassShift|ioprioLowest); errno != 0 {
+			return errno
+		}
+	}
+	return nil
+}
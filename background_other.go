@@ -0,0 +1,11 @@
+//go:build !windows && !linux && !darwin
+
+package main
+
+import "syscall"
+
+// lowerPriority gives chkiso the lowest CPU priority. There is no portable
+// way to lower its I/O priority as well.
+func lowerPriority() error {
+	return syscall.Setpriority(syscall.PRIO_PROCESS, 0, backgroundNice)
+}
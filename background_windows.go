@@ -0,0 +1,23 @@
+//go:build windows
+
+package main
+
+import "syscall"
+
+// processModeBackgroundBegin is PROCESS_MODE_BACKGROUND_BEGIN, which lowers
+// the CPU, I/O and memory priority of the current process.
+const processModeBackgroundBegin = 0x00100000
+
+var procSetPriorityClass = syscall.NewLazyDLL("kernel32.dll").NewProc("SetPriorityClass")
+
+// lowerPriority puts chkiso in background processing mode.
+func lowerPriority() error {
+	process, err := syscall.GetCurrentProcess()
+	if err != nil {
+		return err
+	}
+	if ok, _, err := procSetPriorityClass.Call(uintptr(process), processModeBackgroundBegin); ok == 0 {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"runtime"
+	"strconv"
+	"time"
+
+	"github.com/pappasjfed/chkiso/internal/hwhash"
+	"github.com/pappasjfed/chkiso/pkg/manifest"
+	"github.com/pappasjfed/chkiso/pkg/verify"
+)
+
+// benchBufferSizes are the read sizes `chkiso bench` compares. Hashing
+// reads 32 KiB at a time.
+var benchBufferSizes = []int{32 << 10, 1 << 20, 4 << 20}
+
+// benchHashTime is how long each hash algorithm is measured for.
+const benchHashTime = 500 * time.Millisecond
+
+// runBench measures how fast the target can be read and how fast this
+// computer hashes, and estimates how long verifying the target takes, so a
+// slow drive can be told from a slow CPU before a long run.
+func runBench(args []string) error {
+	path := ""
+	sample := int64(256) // MiB read per buffer size
+	for i := 0; i < len(args); i++ {
+		switch arg := args[i]; arg {
+		case "-size", "--size":
+			if i+1 >= len(args) {
+				return fmt.Errorf("%s requires a value", arg)
+			}
+			i++
+			n, err := strconv.ParseInt(args[i], 10, 64)
+			if err != nil || n <= 0 {
+				return fmt.Errorf("invalid -size value: %s", args[i])
+			}
+			sample = n
+		default:
+			if path != "" {
+				return fmt.Errorf("unknown bench option: %s", arg)
+			}
+			path = arg
+		}
+	}
+	sample <<= 20
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	var readRate float64
+	var size int64
+	if path != "" {
+		target, err := verify.NewTarget(path)
+		if err != nil {
+			return err
+		}
+		if target.IsDir {
+			return fmt.Errorf("%s is a directory; bench reads an image or device", target)
+		}
+		if size, err = target.RawSize(); err != nil {
+			return err
+		}
+		fmt.Printf("--- Read Throughput: %s (%s) ---\n", target, formatBytes(size))
+		fresh := int64(len(benchBufferSizes))*sample <= size
+		for i, bufferSize := range benchBufferSizes {
+			offset := int64(0)
+			if fresh {
+				// Each buffer size reads data not yet in the page cache
+				offset = int64(i) * sample
+			}
+			t, err := verify.BenchRead(ctx, target, offset, sample, bufferSize)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Buffer %8s: %10s/s  (%s in %s)\n", formatBytes(int64(bufferSize)), formatBytes(int64(t.PerSecond())), formatBytes(t.Bytes), t.Duration.Round(time.Microsecond))
+			if t.PerSecond() > readRate {
+				readRate = t.PerSecond()
+			}
+		}
+		if !fresh {
+			fmt.Println("The target is too small to read a separate part per buffer size; later results may come from the page cache.")
+		}
+		fmt.Println()
+	}
+
+	fmt.Printf("--- Hash Throughput (one core of %d, %s/%s) ---\n", runtime.NumCPU(), runtime.GOOS, runtime.GOARCH)
+	fmt.Printf("Hashing instructions: %s\n", hwhash.Describe())
+	features := hwhash.Detect()
+	data := make([]byte, 4<<20)
+	var sha256Rate float64
+	for _, algorithm := range verify.BenchAlgorithms {
+		t, err := verify.BenchHash(ctx, algorithm, data, benchHashTime)
+		if err != nil {
+			return err
+		}
+		accelerated := ""
+		if features.Accelerated(algorithm) {
+			accelerated = "  (hardware)"
+		}
+		fmt.Printf("%-8s %10s/s%s\n", algorithm, formatBytes(int64(t.PerSecond())), accelerated)
+		if algorithm == manifest.SHA256 {
+			sha256Rate = t.PerSecond()
+		}
+	}
+
+	if path == "" || readRate == 0 || sha256Rate == 0 {
+		return nil
+	}
+	rate, limit := readRate, "reading the target"
+	if sha256Rate < readRate {
+		rate, limit = sha256Rate, "SHA256 on this CPU"
+	}
+	estimate := time.Duration(float64(size) / rate * float64(time.Second))
+	fmt.Printf("\nHashing all %s with SHA256 should take about %s, limited by %s.\n", formatBytes(size), estimate.Round(time.Second), limit)
+	return nil
+}
+
+// formatBytes formats n bytes with a binary unit, e.g. "4.0 MiB".
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	value, exp := float64(n)/unit, 0
+	for value >= unit && exp < 4 {
+		value /= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", value, "KMGTP"[exp])
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+
+	"github.com/pappasjfed/chkiso/pkg/manifest"
+	"github.com/pappasjfed/chkiso/pkg/verify"
+)
+
+// Files `chkiso bundle` adds to the root of the staging directory. The
+// signature is a raw ed25519 signature of the manifest, which chkiso -pubkey
+// or OpenSSL checks. The public key is not put on the media: a key next to
+// the data it signs would vouch for whoever replaced both, so recipients
+// must get it some other way.
+const (
+	bundleManifest  = "SHA256SUMS"
+	bundleSignature = "SHA256SUMS.sig"
+	bundleAutorun   = "autorun.inf"
+	bundleToolDir   = "chkiso"
+)
+
+// runBundle prepares a staging directory for a disc or USB stick that can
+// verify itself on the machines it is sent to: it copies chkiso executables
+// onto it, writes an autorun.inf that offers to run the Windows one, lists
+// every file in a SHA256SUMS at the root, and signs that list when given a
+// key.
+func runBundle(args []string) error {
+	dir, keyFile, label := "", "", ""
+	var exes []string
+	for i := 0; i < len(args); i++ {
+		switch arg := args[i]; arg {
+		case "-key", "--key":
+			if i+1 >= len(args) {
+				return fmt.Errorf("%s requires a value", arg)
+			}
+			i++
+			keyFile = args[i]
+		case "-exe", "--exe":
+			if i+1 >= len(args) {
+				return fmt.Errorf("%s requires a value", arg)
+			}
+			i++
+			exes = append(exes, args[i])
+		case "-label", "--label":
+			if i+1 >= len(args) {
+				return fmt.Errorf("%s requires a value", arg)
+			}
+			i++
+			label = args[i]
+		default:
+			if dir != "" || strings.HasPrefix(arg, "-") {
+				return fmt.Errorf("unknown bundle option: %s", arg)
+			}
+			dir = arg
+		}
+	}
+	if dir == "" {
+		return fmt.Errorf("usage: chkiso bundle <staging-dir> [-key <file>] [-exe <file>]... [-label <text>]")
+	}
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return fmt.Errorf("not a directory: %s", dir)
+	}
+	var key ed25519.PrivateKey
+	if keyFile != "" {
+		var err error
+		if key, err = loadBundleKey(keyFile); err != nil {
+			return err
+		}
+	}
+	if len(exes) == 0 {
+		exe, err := os.Executable()
+		if err != nil {
+			return err
+		}
+		exes = []string{exe}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	toolDir := filepath.Join(dir, bundleToolDir)
+	if err := os.MkdirAll(toolDir, 0755); err != nil {
+		return err
+	}
+	windowsExe := ""
+	for _, exe := range exes {
+		name := filepath.Base(exe)
+		if err := copyExecutable(exe, filepath.Join(toolDir, name)); err != nil {
+			return fmt.Errorf("could not copy %s: %v", exe, err)
+		}
+		fmt.Printf("Copied %s to %s\n", name, toolDir)
+		if windowsExe == "" && strings.EqualFold(filepath.Ext(name), ".exe") {
+			windowsExe = name
+		}
+	}
+	if windowsExe != "" {
+		if err := os.WriteFile(filepath.Join(dir, bundleAutorun), autorunINF(windowsExe, label), 0644); err != nil {
+			return err
+		}
+		fmt.Printf("Wrote %s to run %s\\%s\n", bundleAutorun, bundleToolDir, windowsExe)
+	} else {
+		fmt.Println("No Windows executable (.exe) was bundled, so no autorun.inf was written; add one with -exe.")
+	}
+	// A signature left from an earlier run would not match
+	os.Remove(filepath.Join(dir, bundleSignature))
+
+	fmt.Printf("Hashing the files in %s...\n", dir)
+	entries, err := bundleEntries(ctx, dir)
+	if err != nil {
+		return err
+	}
+	var list bytes.Buffer
+	if err := manifest.WriteGNU(&list, entries); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, bundleManifest), list.Bytes(), 0644); err != nil {
+		return err
+	}
+	fmt.Printf("Listed %d files in %s\n", len(entries), bundleManifest)
+	if key != nil {
+		if err := os.WriteFile(filepath.Join(dir, bundleSignature), ed25519.Sign(key, list.Bytes()), 0644); err != nil {
+			return err
+		}
+		fmt.Printf("Signed it in %s with key %s\n", bundleSignature, hex.EncodeToString(key.Public().(ed25519.PublicKey)))
+	} else {
+		fmt.Println("\033[33mThe list is not signed; give a key with -key to sign it.\033[0m")
+	}
+
+	pubkey := ""
+	if key != nil {
+		pubkey = " -pubkey " + hex.EncodeToString(key.Public().(ed25519.PublicKey))
+	}
+	fmt.Println("\nRecipients can verify the media from its root with:")
+	if windowsExe != "" {
+		fmt.Printf("  %s\\%s -pause%s .      (Windows; AutoPlay offers it for discs)\n", bundleToolDir, windowsExe, pubkey)
+	}
+	for _, exe := range exes {
+		if name := filepath.Base(exe); !strings.EqualFold(filepath.Ext(name), ".exe") {
+			fmt.Printf("  %s/%s%s .\n", bundleToolDir, name, pubkey)
+		}
+	}
+	fmt.Printf("  sha256sum -c %s\n", bundleManifest)
+	if key != nil {
+		fmt.Println("\nThe signature only proves the media came from you if recipients get the public key")
+		fmt.Println("some other way than on the media, such as by email or on your web site, and give it")
+		fmt.Println("with -pubkey, as above; chkiso then fails if the signature does not match. The")
+		fmt.Println("bundled chkiso could itself have been replaced, so they should run their own copy.")
+	}
+	return nil
+}
+
+// loadBundleKey reads an ed25519 private key: a PKCS #8 PEM file, as
+// "openssl genpkey -algorithm ed25519" writes, or the hex seed printed by
+// "chkiso-sign -genkey".
+func loadBundleKey(path string) (ed25519.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if block, _ := pem.Decode(data); block != nil {
+		parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("could not read the key in %s: %v", path, err)
+		}
+		key, ok := parsed.(ed25519.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("the key in %s is not an ed25519 key", path)
+		}
+		return key, nil
+	}
+	text := strings.TrimPrefix(strings.TrimSpace(string(data)), "CHKISO_SIGNING_KEY=")
+	seed, err := hex.DecodeString(text)
+	if err != nil || len(seed) != ed25519.SeedSize {
+		return nil, fmt.Errorf("%s holds neither a PEM ed25519 private key nor a hex ed25519 seed", path)
+	}
+	return ed25519.NewKeyFromSeed(seed), nil
+}
+
+// copyExecutable copies the executable src to dst, unless they are the same
+// file, as when chkiso bundles the staging directory it runs from.
+func copyExecutable(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	srcInfo, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	if dstInfo, err := os.Stat(dst); err == nil && os.SameFile(srcInfo, dstInfo) {
+		return nil
+	}
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0755)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// autorunINF returns an autorun.inf that offers to verify the media with the
+// bundled Windows executable exe.
+func autorunINF(exe, label string) []byte {
+	var b strings.Builder
+	b.WriteString("[autorun]\r\n")
+	fmt.Fprintf(&b, "open=%s\\%s -pause .\r\n", bundleToolDir, exe)
+	b.WriteString("action=Verify this disc with chkiso\r\n")
+	if label != "" {
+		fmt.Fprintf(&b, "label=%s\r\n", label)
+	}
+	return []byte(b.String())
+}
+
+// bundleEntries hashes every file under dir except the manifest and its
+// signature, in the order a walk visits them.
+func bundleEntries(ctx context.Context, dir string) ([]manifest.Entry, error) {
+	var entries []manifest.Entry
+	err := fs.WalkDir(os.DirFS(dir), ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() || name == bundleManifest || name == bundleSignature {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		hash, err := verify.FileSha256(ctx, filepath.Join(dir, filepath.FromSlash(name)))
+		if err != nil {
+			return err
+		}
+		entries = append(entries, manifest.Entry{Algorithm: manifest.SHA256, Hash: hash, Path: name, Size: info.Size()})
+		return nil
+	})
+	return entries, err
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pappasjfed/chkiso/pkg/verify"
+)
+
+// discPollInterval is how often -wait-for-disc looks at the drive.
+const discPollInterval = 2 * time.Second
+
+// useSourceImage hashes the -source image, which the media was burned or
+// written from, and makes its SHA256 the expected hash. Its volume label
+// tells -wait-for-disc which disc to wait for.
+func useSourceImage(config *Config) error {
+	source, err := verify.NewTarget(config.Source)
+	if err != nil {
+		return err
+	}
+	if source.IsDir {
+		return fmt.Errorf("-source %s is a directory, not an image", config.Source)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	fmt.Printf("Hashing source image '%s'...\n", filepath.Base(source.ImagePath()))
+	hash, err := verify.Sha256(ctx, source, nil)
+	if err != nil {
+		return fmt.Errorf("could not hash the source image: %v", err)
+	}
+	fmt.Printf("Source SHA256: %s\n", hash)
+	config.Sha256Hash = hash
+	if label, err := verify.VolumeLabel(source); err == nil {
+		config.sourceLabel = strings.TrimSpace(label)
+	}
+	return nil
+}
+
+// waitForDisc waits until the drive holds a readable disc, which is what a
+// burning application leaves once it has finalized one. With -source the
+// disc must have the source image's label, so a disc left in the drive from
+// before is not verified in its place.
+func waitForDisc(config *Config) error {
+	t := config.target
+	if !t.IsDrive && !t.IsDevice {
+		return fmt.Errorf("-wait-for-disc needs a drive or device, not %s", t)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	if config.sourceLabel != "" {
+		fmt.Printf("Waiting for disc '%s' in %s (Ctrl+C to stop)...\n", config.sourceLabel, t)
+	} else {
+		fmt.Printf("Waiting for a disc in %s (Ctrl+C to stop)...\n", t)
+	}
+	label, err := verify.WaitForMedia(ctx, t, config.sourceLabel, discPollInterval, func(found string) {
+		fmt.Printf("%s holds disc '%s', not the one burned; waiting for it to be replaced...\n", t, strings.TrimSpace(found))
+	})
+	if err != nil {
+		if ctx.Err() != nil {
+			return fmt.Errorf("stopped waiting for a disc in %s", t)
+		}
+		return err
+	}
+	fmt.Printf("Found disc '%s' in %s\n", strings.TrimSpace(label), t)
+	return nil
+}
@@ -0,0 +1,344 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pappasjfed/chkiso/pkg/manifest"
+	"github.com/pappasjfed/chkiso/pkg/verify"
+)
+
+// catalogSchema creates the images table of the known-good catalog. An
+// image may be listed by several sources; adding it again from the same
+// source updates its entry. Columns are only ever added, so older catalogs
+// stay readable.
+const catalogSchema = `
+CREATE TABLE IF NOT EXISTS images (
+	id      INTEGER PRIMARY KEY AUTOINCREMENT,
+	sha256  TEXT    NOT NULL,
+	name    TEXT    NOT NULL,
+	version TEXT,
+	source  TEXT    NOT NULL DEFAULT '',
+	added   TEXT    NOT NULL,
+	updated TEXT    NOT NULL,
+	UNIQUE (sha256, source)
+);
+`
+
+// catalogEntry is an image the known-good catalog trusts.
+type catalogEntry struct {
+	SHA256  string    `json:"sha256"`
+	Name    string    `json:"name"`
+	Version string    `json:"version,omitempty"`
+	Source  string    `json:"source,omitempty"`
+	Added   time.Time `json:"added"`
+	Updated time.Time `json:"updated"`
+}
+
+// String names the image, as in "Ubuntu 24.04.1 desktop amd64", adding the
+// version when the name does not already hold it.
+func (e catalogEntry) String() string {
+	if e.Version != "" && !strings.Contains(e.Name, e.Version) {
+		return e.Name + " " + e.Version
+	}
+	return e.Name
+}
+
+// catalogPath returns the catalog to use: path if given, or else catalog.db
+// in the user's config directory.
+func catalogPath(path string) (string, error) {
+	if path != "" {
+		return path, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "chkiso", CATALOG_FILE), nil
+}
+
+// openCatalog opens the catalog at path, creating it and its schema if
+// needed.
+func openCatalog(path string) (*sql.DB, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec(catalogSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("could not initialize catalog %s: %v", path, err)
+	}
+	return db, nil
+}
+
+// catalogAdd adds entries to the catalog at path in one transaction. An
+// image its source already listed gets the new name and version, and its
+// updated time is set even if they did not change, recording that the
+// source still lists it. It returns how many entries were new and how many
+// were updated.
+func catalogAdd(path string, entries []catalogEntry) (added, updated int, err error) {
+	db, err := openCatalog(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, 0, err
+	}
+	defer tx.Rollback()
+	now := time.Now().UTC().Format(time.RFC3339Nano)
+	for _, entry := range entries {
+		result, err := tx.Exec(
+			`UPDATE images SET name = ?, version = ?, updated = ? WHERE sha256 = ? AND source = ?`,
+			entry.Name, entry.Version, now, entry.SHA256, entry.Source,
+		)
+		if err != nil {
+			return 0, 0, err
+		}
+		if n, _ := result.RowsAffected(); n > 0 {
+			updated++
+			continue
+		}
+		_, err = tx.Exec(
+			`INSERT INTO images (sha256, name, version, source, added, updated) VALUES (?, ?, ?, ?, ?, ?)`,
+			entry.SHA256, entry.Name, entry.Version, entry.Source, now, now,
+		)
+		if err != nil {
+			return 0, 0, err
+		}
+		added++
+	}
+	return added, updated, tx.Commit()
+}
+
+// catalogQuery returns the entries of the catalog at path that match where,
+// in the order they were added.
+func catalogQuery(path, where string, args ...interface{}) ([]catalogEntry, error) {
+	db, err := openCatalog(path)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	query := "SELECT sha256, name, version, source, added, updated FROM images"
+	if where != "" {
+		query += " WHERE " + where
+	}
+	rows, err := db.Query(query+" ORDER BY id", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []catalogEntry
+	for rows.Next() {
+		var entry catalogEntry
+		var version sql.NullString
+		var added, updated string
+		if err := rows.Scan(&entry.SHA256, &entry.Name, &version, &entry.Source, &added, &updated); err != nil {
+			return nil, err
+		}
+		entry.Version = version.String
+		entry.Added, _ = time.Parse(time.RFC3339Nano, added)
+		entry.Updated, _ = time.Parse(time.RFC3339Nano, updated)
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+// catalogLookup returns the catalog entries for an image's SHA256. A
+// catalog that does not exist yet lists nothing, and is not created.
+func catalogLookup(path, sha256 string) ([]catalogEntry, error) {
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	return catalogQuery(path, "sha256 = ?", strings.ToLower(sha256))
+}
+
+// catalogRemove deletes the entries for sha256 from the catalog at path,
+// only those of source if it is given, and returns how many it deleted.
+func catalogRemove(path, sha256, source string) (int64, error) {
+	db, err := openCatalog(path)
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+
+	query, args := "DELETE FROM images WHERE sha256 = ?", []interface{}{sha256}
+	if source != "" {
+		query += " AND source = ?"
+		args = append(args, source)
+	}
+	result, err := db.Exec(query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// runCatalog implements `chkiso catalog`, which maintains the local catalog
+// of known-good image hashes that verification looks computed hashes up in.
+func runCatalog(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: chkiso catalog add|import|list|remove [arguments]")
+	}
+	command, args := args[0], args[1:]
+	var path, filter, format string
+	var entry catalogEntry
+	var positional []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		value := func() string {
+			if i+1 >= len(args) {
+				fmt.Fprintf(os.Stderr, "Error: %s requires a value\n", arg)
+				os.Exit(1)
+			}
+			i++
+			return args[i]
+		}
+		switch {
+		case arg == "-catalog" || arg == "--catalog":
+			path = value()
+		case (arg == "-name" || arg == "--name") && command == "add":
+			entry.Name = value()
+		case (arg == "-version" || arg == "--version") && command == "add":
+			entry.Version = value()
+		case (arg == "-format" || arg == "--format") && command == "import":
+			format = value()
+		case arg == "-source" || arg == "--source":
+			entry.Source = value()
+		case strings.HasPrefix(arg, "-"):
+			return fmt.Errorf("unknown catalog %s option: %s", command, arg)
+		default:
+			positional = append(positional, arg)
+		}
+	}
+	path, err := catalogPath(path)
+	if err != nil {
+		return err
+	}
+
+	switch command {
+	case "add":
+		if len(positional) != 1 || entry.Name == "" {
+			return fmt.Errorf("usage: chkiso catalog add <sha256|image> -name <name> [-version <version>] [-source <source>]")
+		}
+		if verify.IsValidSha256(positional[0]) {
+			entry.SHA256 = strings.ToLower(positional[0])
+		} else {
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+			defer stop()
+			fmt.Printf("Hashing %s...\n", positional[0])
+			if entry.SHA256, err = verify.FileHash(ctx, positional[0], manifest.SHA256); err != nil {
+				return err
+			}
+		}
+		added, _, err := catalogAdd(path, []catalogEntry{entry})
+		if err != nil {
+			return err
+		}
+		if added > 0 {
+			fmt.Printf("Added %s: %s\n", entry.SHA256, entry)
+		} else {
+			fmt.Printf("Updated %s: %s\n", entry.SHA256, entry)
+		}
+	case "import":
+		if len(positional) != 1 {
+			return fmt.Errorf("usage: chkiso catalog import <file|url> [-format csv|json|sums] [-source <source>]")
+		}
+		return importCatalog(path, positional[0], format, entry.Source)
+	case "list":
+		if len(positional) > 1 {
+			return fmt.Errorf("usage: chkiso catalog list [<text>] [-source <source>]")
+		}
+		if len(positional) == 1 {
+			filter = positional[0]
+		}
+		var where []string
+		var args []interface{}
+		if filter != "" {
+			where = append(where, "(name LIKE ? OR version LIKE ? OR sha256 LIKE ?)")
+			like := "%" + filter + "%"
+			args = append(args, like, like, strings.ToLower(filter)+"%")
+		}
+		if entry.Source != "" {
+			where = append(where, "source = ?")
+			args = append(args, entry.Source)
+		}
+		entries, err := catalogQuery(path, strings.Join(where, " AND "), args...)
+		if err != nil {
+			return fmt.Errorf("failed to read catalog: %v", err)
+		}
+		printCatalog(entries)
+	case "remove":
+		if len(positional) != 1 || !verify.IsValidSha256(positional[0]) {
+			return fmt.Errorf("usage: chkiso catalog remove <sha256> [-source <source>]")
+		}
+		n, err := catalogRemove(path, strings.ToLower(positional[0]), entry.Source)
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return fmt.Errorf("%s is not in the catalog", positional[0])
+		}
+		fmt.Printf("Removed %d catalog entry(s).\n", n)
+	default:
+		return fmt.Errorf("unknown catalog command: %s (use add, import, list or remove)", command)
+	}
+	return nil
+}
+
+func printCatalog(entries []catalogEntry) {
+	if len(entries) == 0 {
+		fmt.Println("No images in the catalog.")
+		return
+	}
+
+	fmt.Println("--- Known-Good Catalog ---")
+	for _, entry := range entries {
+		fmt.Printf("%s  %s  (", entry.SHA256, entry)
+		if entry.Source != "" {
+			fmt.Printf("%s, ", entry.Source)
+		}
+		fmt.Printf("updated %s)\n", entry.Updated.Local().Format("2006-01-02"))
+	}
+}
+
+// showKnownGood looks the image's SHA256 up in the known-good catalog and
+// says which release it is if the catalog lists it. A failed lookup is a
+// warning; it never changes the exit code.
+func showKnownGood(config *Config, sha256 string) {
+	if sha256 == "" || config.Offset != 0 || config.Length != 0 || config.Partition != 0 {
+		return
+	}
+	path, err := catalogPath(config.Catalog)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: Could not locate the known-good catalog: %v\n", err)
+		return
+	}
+	entries, err := catalogLookup(path, sha256)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: Could not read the known-good catalog: %v\n", err)
+		return
+	}
+	config.knownGood = entries
+	for _, entry := range entries {
+		source := ""
+		if entry.Source != "" {
+			source = " (" + entry.Source + ")"
+		}
+		fmt.Printf("\033[32mMatches known-good: %s%s\033[0m\n", entry, source)
+	}
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/pappasjfed/chkiso/pkg/manifest"
+	"github.com/pappasjfed/chkiso/pkg/verify"
+)
+
+// Formats of the hash lists `chkiso catalog import` reads.
+const (
+	feedCSV  = "csv"  // A header row naming the columns, then one image per row
+	feedJSON = "json" // An array of objects, or an object with an "images" array
+	feedSums = "sums" // A checksum file such as SHA256SUMS; images are named by their file names
+)
+
+// maxFeed bounds a downloaded hash list.
+const maxFeed = 64 << 20
+
+// feedColumns maps the names vendor lists and inventories give their
+// columns, in lower case, to the catalog field they hold.
+var feedColumns = map[string]string{
+	"sha256":    "sha256",
+	"sha-256":   "sha256",
+	"sha256sum": "sha256",
+	"hash":      "sha256",
+	"checksum":  "sha256",
+	"digest":    "sha256",
+	"name":      "name",
+	"title":     "name",
+	"product":   "name",
+	"image":     "file",
+	"file":      "file",
+	"filename":  "file",
+	"file_name": "file",
+	"version":   "version",
+	"release":   "version",
+	"source":    "source",
+	"vendor":    "source",
+	"publisher": "source",
+}
+
+// readFeed reads a hash list from a file, or downloads it from an http or
+// https URL.
+func readFeed(ctx context.Context, location string) ([]byte, error) {
+	if !strings.HasPrefix(location, "https://") && !strings.HasPrefix(location, "http://") {
+		return os.ReadFile(location)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, location, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s returned %s", location, resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxFeed))
+}
+
+// parseFeed reads the images of a hash list in format, or in the format its
+// name and contents suggest if format is "". It returns the images and how
+// many records were skipped for lacking a SHA256 or a name.
+func parseFeed(name string, data []byte, format string) ([]catalogEntry, int, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	if format == "" {
+		trimmed := bytes.TrimSpace(data)
+		switch {
+		case strings.EqualFold(path.Ext(name), ".csv"):
+			format = feedCSV
+		case strings.EqualFold(path.Ext(name), ".json") || bytes.HasPrefix(trimmed, []byte("[")) || bytes.HasPrefix(trimmed, []byte("{")):
+			format = feedJSON
+		default:
+			format = feedSums
+		}
+	}
+
+	var records []map[string]string
+	switch format {
+	case feedCSV:
+		r := csv.NewReader(bytes.NewReader(data))
+		r.FieldsPerRecord = -1
+		r.TrimLeadingSpace = true
+		rows, err := r.ReadAll()
+		if err != nil {
+			return nil, 0, err
+		}
+		if len(rows) == 0 {
+			return nil, 0, nil
+		}
+		header := rows[0]
+		for _, row := range rows[1:] {
+			record := make(map[string]string)
+			for i, value := range row {
+				if i < len(header) {
+					record[header[i]] = value
+				}
+			}
+			records = append(records, record)
+		}
+	case feedJSON:
+		var list []map[string]interface{}
+		if err := json.Unmarshal(data, &list); err != nil {
+			var wrapped struct {
+				Images []map[string]interface{} `json:"images"`
+			}
+			if err := json.Unmarshal(data, &wrapped); err != nil {
+				return nil, 0, err
+			}
+			list = wrapped.Images
+		}
+		for _, object := range list {
+			record := make(map[string]string)
+			for key, value := range object {
+				if value != nil {
+					record[key] = fmt.Sprint(value)
+				}
+			}
+			records = append(records, record)
+		}
+	case feedSums:
+		entries, err := manifest.ParseNamed(path.Base(name), data)
+		if err != nil {
+			return nil, 0, err
+		}
+		for _, e := range entries {
+			if e.Algorithm == manifest.SHA256 {
+				records = append(records, map[string]string{"sha256": e.Hash, "file": path.Base(strings.ReplaceAll(e.Path, "\\", "/"))})
+			}
+		}
+	default:
+		return nil, 0, fmt.Errorf("unknown format %q (use csv, json or sums)", format)
+	}
+
+	var entries []catalogEntry
+	skipped := 0
+	for _, record := range records {
+		fields := make(map[string]string)
+		for key, value := range record {
+			if field, ok := feedColumns[strings.ToLower(strings.TrimSpace(key))]; ok && fields[field] == "" {
+				fields[field] = strings.TrimSpace(value)
+			}
+		}
+		entry := catalogEntry{
+			SHA256:  strings.ToLower(fields["sha256"]),
+			Name:    fields["name"],
+			Version: fields["version"],
+			Source:  fields["source"],
+		}
+		// Lists that only name the file, like SHA256SUMS, are named by it
+		if entry.Name == "" {
+			entry.Name = fields["file"]
+		}
+		if !verify.IsValidSha256(entry.SHA256) || entry.Name == "" {
+			skipped++
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, skipped, nil
+}
+
+// importCatalog adds the images of the hash list at location, a file or a
+// URL, to the catalog at path. Images are attributed to the source their
+// record names, or else to source, or else to the list itself.
+func importCatalog(path, location, format, source string) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	ctx, cancel := context.WithTimeout(ctx, fetchTimeout)
+	defer cancel()
+	data, err := readFeed(ctx, location)
+	if err != nil {
+		return err
+	}
+	entries, skipped, err := parseFeed(location, data, format)
+	if err != nil {
+		return fmt.Errorf("%s: %v", location, err)
+	}
+	if source == "" {
+		source = location
+		if !strings.Contains(location, "://") {
+			source = filepath.Base(location)
+		}
+	}
+	for i := range entries {
+		if entries[i].Source == "" {
+			entries[i].Source = source
+		}
+	}
+	if len(entries) == 0 {
+		return fmt.Errorf("%s lists no images with a SHA256 and a name", location)
+	}
+
+	added, updated, err := catalogAdd(path, entries)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Imported %d image(s) from %s: %d added, %d updated\n", len(entries), location, added, updated)
+	if skipped > 0 {
+		fmt.Printf("\033[33mSkipped %d record(s) without a SHA256 or a name.\033[0m\n", skipped)
+	}
+	return nil
+}
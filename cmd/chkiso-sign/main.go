@@ -0,0 +1,51 @@
+// Command chkiso-sign signs chkiso release binaries so that
+// `chkiso self-check` can detect later modification.
+//
+//	chkiso-sign -genkey             Print a new private seed and public key
+//	chkiso-sign <binary>...         Sign binaries with the seed in CHKISO_SIGNING_KEY
+//
+// The public key is built into chkiso with
+// -ldflags "-X main.signingPublicKey=<hex>".
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+
+	"github.com/pappasjfed/chkiso/internal/selfcheck"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprintf(os.Stderr, "Usage: chkiso-sign -genkey | chkiso-sign <binary>...\n")
+		os.Exit(1)
+	}
+
+	if os.Args[1] == "-genkey" {
+		pub, priv, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("CHKISO_SIGNING_KEY=%s\n", hex.EncodeToString(priv.Seed()))
+		fmt.Printf("Public key:        %s\n", hex.EncodeToString(pub))
+		return
+	}
+
+	seed, err := hex.DecodeString(os.Getenv("CHKISO_SIGNING_KEY"))
+	if err != nil || len(seed) != ed25519.SeedSize {
+		fmt.Fprintf(os.Stderr, "Error: CHKISO_SIGNING_KEY must hold a hex-encoded ed25519 seed\n")
+		os.Exit(1)
+	}
+	key := ed25519.NewKeyFromSeed(seed)
+	for _, path := range os.Args[1:] {
+		if err := selfcheck.Sign(path, key); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s: %v\n", path, err)
+			os.Exit(1)
+		}
+		fmt.Printf("Signed %s\n", path)
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/signal"
+
+	"github.com/pappasjfed/chkiso/internal/i18n"
+	"github.com/pappasjfed/chkiso/pkg/verify"
+)
+
+// runCompareTree compares two file trees file by file, such as a master
+// folder and the copy of it written to a USB stick, and reports the files
+// missing from the copy, the extra ones and those that differ. Either tree
+// may be the contents of an image, read in-process like content
+// verification does, to check an ISO against the directory it was mastered
+// from. It reports whether the trees hold the same files.
+func runCompareTree(args []string) (bool, error) {
+	if len(args) != 2 {
+		return false, fmt.Errorf("usage: chkiso compare-tree <dirA|image> <dirB|image>")
+	}
+	var trees [2]fs.FS
+	for i, path := range args {
+		target, err := verify.NewTarget(path)
+		if err != nil {
+			return false, err
+		}
+		fsys, closer, err := target.OpenFS()
+		if err != nil {
+			return false, fmt.Errorf("could not read the files of %s: %v", path, err)
+		}
+		defer closer.Close()
+		trees[i] = fsys
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	fmt.Printf("Comparing %s with %s...\n", args[0], args[1])
+	diff, err := verify.CompareTrees(ctx, trees[0], trees[1], nil)
+	if err != nil {
+		return false, err
+	}
+	printTreeDiff(diff, args[0], args[1])
+	if diff.OK() {
+		fmt.Printf("\033[32m%s\033[0m\n", i18n.T("SUCCESS: The trees hold the same files."))
+	} else {
+		fmt.Printf("\033[31m%s\033[0m\n", i18n.T("FAILURE: The trees differ."))
+	}
+	return diff.OK(), nil
+}
+
+// printTreeDiff prints the differences CompareTrees found between the trees
+// named a and b, and their counts.
+func printTreeDiff(diff *verify.TreeDiff, a, b string) {
+	if len(diff.Missing) > 0 {
+		fmt.Printf("\n--- Missing from %s ---\n", b)
+		for _, name := range diff.Missing {
+			fmt.Printf("  %s\n", name)
+		}
+	}
+	if len(diff.Extra) > 0 {
+		fmt.Printf("\n--- Not in %s ---\n", a)
+		for _, name := range diff.Extra {
+			fmt.Printf("  %s\n", name)
+		}
+	}
+	if len(diff.Different) > 0 {
+		fmt.Println("\n--- Different ---")
+		for _, f := range diff.Different {
+			if f.SizeA != f.SizeB {
+				fmt.Printf("  %s: %d bytes in %s, %d in %s\n", f.Name, f.SizeA, a, f.SizeB, b)
+			} else {
+				fmt.Printf("  %s: SHA256 %s in %s, %s in %s\n", f.Name, f.HashA, a, f.HashB, b)
+			}
+		}
+	}
+	if len(diff.Errors) > 0 {
+		fmt.Println("\n--- Could Not Compare ---")
+		for _, f := range diff.Errors {
+			fmt.Printf("  %s: %v\n", f.Name, f.Err)
+		}
+	}
+
+	fmt.Println()
+	fmt.Printf("Identical: %d, missing: %d, extra: %d, different: %d", diff.Same, len(diff.Missing), len(diff.Extra), len(diff.Different))
+	if len(diff.Errors) > 0 {
+		fmt.Printf(", errors: %d", len(diff.Errors))
+	}
+	fmt.Println()
+}
+
+// runCompareISO tells whether two ISO images are functionally identical,
+// ignoring the metadata that changes with every build, so that a rebuilt
+// image can be shown to reproduce the original. It reports whether they
+// are.
+func runCompareISO(args []string) (bool, error) {
+	if len(args) != 2 {
+		return false, fmt.Errorf("usage: chkiso compare-iso <imageA> <imageB>")
+	}
+	var targets [2]*verify.Target
+	for i, path := range args {
+		target, err := verify.NewTarget(path)
+		if err != nil {
+			return false, err
+		}
+		if target.IsDir {
+			return false, fmt.Errorf("%s is a directory; compare-iso compares images (use compare-tree for directories)", path)
+		}
+		targets[i] = target
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	fmt.Printf("Comparing %s with %s...\n", args[0], args[1])
+	c, err := verify.CompareImages(ctx, targets[0], targets[1], nil)
+	if err != nil {
+		return false, err
+	}
+	fmt.Printf("SHA256 of %s: %s\n", args[0], c.SHA256A)
+	fmt.Printf("SHA256 of %s: %s\n", args[1], c.SHA256B)
+	if c.Identical {
+		fmt.Printf("\n\033[32m%s\033[0m\n", i18n.T("SUCCESS: The images are identical bit for bit."))
+		return true, nil
+	}
+
+	if len(c.Volume) > 0 {
+		fmt.Println("\n--- Volume Differences ---")
+		for _, f := range c.Volume {
+			fmt.Printf("  %s: %q in %s, %q in %s\n", f.Field, f.A, args[0], f.B, args[1])
+		}
+	}
+	if len(c.Boot) > 0 {
+		fmt.Println("\n--- Boot Differences ---")
+		for _, d := range c.Boot {
+			fmt.Printf("  %s\n", d)
+		}
+	}
+	if len(c.Ignored) > 0 {
+		fmt.Println("\n--- Ignored (volatile metadata) ---")
+		for _, f := range c.Ignored {
+			if f.A == "" && f.B == "" {
+				fmt.Printf("  %s differs\n", f.Field)
+			} else {
+				fmt.Printf("  %s: %s, %s\n", f.Field, f.A, f.B)
+			}
+		}
+	}
+	printTreeDiff(c.Files, args[0], args[1])
+	if c.Equivalent() {
+		fmt.Printf("\033[32m%s\033[0m\n", i18n.T("SUCCESS: The images are functionally identical; they differ only in volatile metadata."))
+	} else {
+		fmt.Printf("\033[31m%s\033[0m\n", i18n.T("FAILURE: The images are not functionally identical."))
+	}
+	return c.Equivalent(), nil
+}
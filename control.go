@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pappasjfed/chkiso/pkg/verify"
+)
+
+// errControlCancel is why a run stopped when a -control client cancelled it.
+var errControlCancel = errors.New("cancelled through the control socket")
+
+// controlServer is the -control socket of a run. Connected clients receive
+// the run's progress as the JSON lines -progress json writes, and a final
+// "finished" record with the result; sending "cancel" stops the run.
+type controlServer struct {
+	listener net.Listener
+	target   string
+	cancel   context.CancelCauseFunc
+	records  *jsonProgress
+
+	mu      sync.Mutex
+	clients map[net.Conn]bool
+}
+
+// listenControl opens the control socket at path. It is a Unix domain
+// socket, which Windows 10 and later support as well; an existing file at
+// path is never replaced.
+func listenControl(path, target string, cancel context.CancelCauseFunc) (*controlServer, error) {
+	if _, err := os.Lstat(path); err == nil {
+		return nil, fmt.Errorf("-control: %s already exists", path)
+	}
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("-control: %v", err)
+	}
+	c := &controlServer{listener: listener, target: target, cancel: cancel, clients: make(map[net.Conn]bool)}
+	c.records = newJSONProgress(c)
+	go c.accept()
+	return c, nil
+}
+
+func (c *controlServer) accept() {
+	for {
+		conn, err := c.listener.Accept()
+		if err != nil {
+			return
+		}
+		c.mu.Lock()
+		c.clients[conn] = true
+		c.mu.Unlock()
+		go c.serve(conn)
+	}
+}
+
+// serve greets a client and carries out its commands, one per line.
+func (c *controlServer) serve(conn net.Conn) {
+	c.send(conn, progressRecord{Time: time.Now(), Phase: "connected", Item: c.target})
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		switch command := strings.TrimSpace(scanner.Text()); command {
+		case "":
+		case "cancel":
+			c.cancel(errControlCancel)
+			c.send(conn, progressRecord{Time: time.Now(), Phase: "cancelling"})
+		default:
+			c.send(conn, progressRecord{Time: time.Now(), Phase: "error", Item: "unknown command: " + command})
+		}
+	}
+	c.mu.Lock()
+	delete(c.clients, conn)
+	c.mu.Unlock()
+	conn.Close()
+}
+
+// event passes a progress event on to the clients.
+func (c *controlServer) event(ev verify.Progress) {
+	c.records.event(ev)
+}
+
+// finish tells the clients the run's result and closes the socket.
+func (c *controlServer) finish(failures []error) {
+	status := "PASSED"
+	if len(failures) > 0 {
+		status = "FAILED"
+	}
+	c.listener.Close()
+	c.mu.Lock()
+	clients := make([]net.Conn, 0, len(c.clients))
+	for conn := range c.clients {
+		clients = append(clients, conn)
+	}
+	c.mu.Unlock()
+	for _, conn := range clients {
+		c.send(conn, progressRecord{Time: time.Now(), Phase: "finished", Item: c.target, Status: status})
+		conn.Close()
+	}
+}
+
+func (c *controlServer) send(conn net.Conn, rec progressRecord) {
+	line, _ := json.Marshal(rec)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	conn.SetWriteDeadline(time.Now().Add(time.Second))
+	conn.Write(append(line, '\n'))
+}
+
+// Write sends p, one JSON line, to every client, dropping clients that do
+// not keep up rather than stalling the run.
+func (c *controlServer) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for conn := range c.clients {
+		conn.SetWriteDeadline(time.Now().Add(time.Second))
+		if _, err := conn.Write(p); err != nil {
+			conn.Close()
+			delete(c.clients, conn)
+		}
+	}
+	return len(p), nil
+}
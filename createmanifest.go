@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pappasjfed/chkiso/pkg/manifest"
+	"github.com/pappasjfed/chkiso/pkg/verify"
+)
+
+// runCreateManifest writes a native chkiso manifest of a directory tree or
+// of the files in an image or drive: each file's size, modification time
+// and hashes, and the tree hash. Verification reads it like any checksum
+// file, and checks sizes before hashing.
+func runCreateManifest(args []string) error {
+	path, output := "", ""
+	algorithms := []string{manifest.SHA256}
+	for i := 0; i < len(args); i++ {
+		switch arg := args[i]; arg {
+		case "-o", "-output", "--output":
+			if i+1 >= len(args) {
+				return fmt.Errorf("%s requires a value", arg)
+			}
+			i++
+			output = args[i]
+		case "-hashes", "--hashes":
+			if i+1 >= len(args) {
+				return fmt.Errorf("%s requires a value", arg)
+			}
+			i++
+			// SHA256 is always listed, for the tree hash
+			algorithms = []string{manifest.SHA256}
+			for _, algorithm := range strings.Split(strings.ToLower(args[i]), ",") {
+				switch algorithm = strings.TrimSpace(algorithm); algorithm {
+				case manifest.SHA256:
+				case manifest.MD5, manifest.SHA1, manifest.SHA512:
+					algorithms = append(algorithms, algorithm)
+				default:
+					return fmt.Errorf("unsupported -hashes algorithm %q (use md5, sha1, sha256 or sha512)", algorithm)
+				}
+			}
+		default:
+			if path != "" || strings.HasPrefix(arg, "-") {
+				return fmt.Errorf("unknown create-manifest option: %s", arg)
+			}
+			path = arg
+		}
+	}
+	if path == "" {
+		return fmt.Errorf("usage: chkiso create-manifest <dir|image|drive> [-o <file>] [-hashes sha256,sha512,...]")
+	}
+	target, err := verify.NewTarget(path)
+	if err != nil {
+		return err
+	}
+	if output == "" {
+		if !target.IsDir {
+			return fmt.Errorf("name the manifest of %s with -o", target)
+		}
+		output = filepath.Join(target.Path, "chkiso.json")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	fsys, closer, err := target.OpenFS()
+	if err != nil {
+		return err
+	}
+	defer closer.Close()
+	fmt.Printf("Hashing the files of %s (%s)...\n", target, strings.Join(algorithms, ", "))
+	m, err := verify.CreateManifest(ctx, fsys, algorithms)
+	if err != nil {
+		return err
+	}
+	host, _ := os.Hostname()
+	m.Tool = &manifest.JSONTool{Name: "chkiso", Version: VERSION, Created: time.Now().UTC(), Host: host}
+
+	var data bytes.Buffer
+	if err := manifest.WriteJSON(&data, m); err != nil {
+		return err
+	}
+	if err := os.WriteFile(output, data.Bytes(), 0644); err != nil {
+		return err
+	}
+	var total int64
+	for _, f := range m.Files {
+		total += *f.Size
+	}
+	fmt.Printf("Listed %d files (%s) in %s\n", len(m.Files), formatBytes(total), output)
+	fmt.Printf("Tree hash: %s\n", m.TreeHash)
+	return nil
+}
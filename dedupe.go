@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pappasjfed/chkiso/internal/decompress"
+	"github.com/pappasjfed/chkiso/pkg/verify"
+)
+
+// dedupeExtensions are the image types `chkiso dedupe` looks for, also when
+// compressed or split.
+var dedupeExtensions = map[string]bool{
+	".iso": true, ".img": true, ".raw": true, ".dmg": true,
+	".nrg": true, ".wim": true, ".esd": true,
+}
+
+// dedupeImage is an image found by `chkiso dedupe`.
+type dedupeImage struct {
+	target *verify.Target
+	name   string // Path relative to the directory searched
+	size   int64  // Bytes on disk, of every part of a split image
+	sha256 string // Of the image's contents, decompressed
+}
+
+// runDedupe hashes every image under a directory and reports those with the
+// same contents, so archivists can reclaim the space of extra copies and
+// spot copies saved under another name, which are often mislabeled. A
+// compressed image has the contents of the image it decompresses to, and a
+// split image those of the joined parts.
+func runDedupe(args []string) error {
+	dir := ""
+	for _, arg := range args {
+		if dir != "" || strings.HasPrefix(arg, "-") {
+			return fmt.Errorf("unknown dedupe option: %s", arg)
+		}
+		dir = arg
+	}
+	if dir == "" {
+		return fmt.Errorf("usage: chkiso dedupe <dir>")
+	}
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return fmt.Errorf("not a directory: %s", dir)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	images, err := findDedupeImages(dir)
+	if err != nil {
+		return err
+	}
+	if len(images) == 0 {
+		fmt.Printf("No images found under %s.\n", dir)
+		return nil
+	}
+
+	fmt.Printf("Hashing %d images under %s...\n", len(images), dir)
+	failed := 0
+	for i, image := range images {
+		fmt.Fprintf(os.Stderr, "[%d/%d] %s (%s)\n", i+1, len(images), image.name, formatBytes(image.size))
+		sum, err := verify.Sha256(ctx, image.target, nil)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: Could not hash %s: %v\n", image.name, err)
+			failed++
+			continue
+		}
+		image.sha256 = sum
+	}
+
+	bySum := make(map[string][]*dedupeImage)
+	var sums []string
+	for _, image := range images {
+		if image.sha256 == "" {
+			continue
+		}
+		if bySum[image.sha256] == nil {
+			sums = append(sums, image.sha256)
+		}
+		bySum[image.sha256] = append(bySum[image.sha256], image)
+	}
+	var copies, renamed [][]*dedupeImage
+	var reclaimable int64
+	for _, sum := range sums {
+		set := bySum[sum]
+		if len(set) < 2 {
+			continue
+		}
+		if sameBaseName(set) {
+			copies = append(copies, set)
+		} else {
+			renamed = append(renamed, set)
+		}
+		// Keeping the smallest copy frees the most space
+		sort.SliceStable(set, func(i, j int) bool { return set[i].size < set[j].size })
+		for _, image := range set[1:] {
+			reclaimable += image.size
+		}
+	}
+
+	if len(copies) > 0 {
+		fmt.Println("\n--- Duplicates ---")
+		printDedupeSets(copies)
+	}
+	if len(renamed) > 0 {
+		fmt.Println("\n--- Same Contents, Different Names ---")
+		printDedupeSets(renamed)
+	}
+	fmt.Println()
+	if len(copies)+len(renamed) == 0 {
+		fmt.Printf("No duplicates among %d images.\n", len(images)-failed)
+	} else {
+		sets := "sets"
+		if len(copies)+len(renamed) == 1 {
+			sets = "set"
+		}
+		fmt.Printf("%d %s of images with the same contents; keeping only the smallest copy of each would free %s.\n", len(copies)+len(renamed), sets, formatBytes(reclaimable))
+	}
+	if failed > 0 {
+		return fmt.Errorf("could not hash %d of %d images", failed, len(images))
+	}
+	return nil
+}
+
+// findDedupeImages returns the images under dir, sorted by path. A split
+// image is found once, by its first part.
+func findDedupeImages(dir string) ([]*dedupeImage, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	var images []*dedupeImage
+	err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		t, err := verify.NewTarget(path)
+		if err != nil {
+			return nil
+		}
+		if len(t.Parts) > 0 && t.Path != t.Parts[0] {
+			return nil
+		}
+		if !dedupeExtensions[strings.ToLower(filepath.Ext(decompress.TrimExt(t.ImagePath())))] {
+			return nil
+		}
+		size, err := t.RawSize()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+			return nil
+		}
+		name, err := filepath.Rel(dir, t.ImagePath())
+		if err != nil {
+			name = t.ImagePath()
+		}
+		images = append(images, &dedupeImage{target: t, name: name, size: size})
+		return nil
+	})
+	return images, err
+}
+
+// sameBaseName reports whether every image of set has the same file name,
+// apart from a compression extension.
+func sameBaseName(set []*dedupeImage) bool {
+	base := func(image *dedupeImage) string {
+		return strings.ToLower(filepath.Base(decompress.TrimExt(image.target.ImagePath())))
+	}
+	for _, image := range set[1:] {
+		if base(image) != base(set[0]) {
+			return false
+		}
+	}
+	return true
+}
+
+func printDedupeSets(sets [][]*dedupeImage) {
+	for _, set := range sets {
+		fmt.Printf("%s  %d copies\n", set[0].sha256, len(set))
+		for _, image := range set {
+			fmt.Printf("  %10s  %s\n", formatBytes(image.size), image.name)
+		}
+	}
+}
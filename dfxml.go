@@ -0,0 +1,171 @@
+package main
+
+import (
+	"encoding/xml"
+	"os"
+	"path"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/pappasjfed/chkiso/pkg/verify"
+)
+
+// DFXML namespaces. Verification outcomes, which DFXML has no elements
+// for, are in chkiso's own namespace.
+const (
+	dfxmlNamespace  = "http://www.forensicswiki.org/wiki/Category:Digital_Forensics_XML"
+	dcNamespace     = "http://purl.org/dc/elements/1.1/"
+	chkisoNamespace = "https://github.com/pappasjfed/chkiso"
+)
+
+// dfxmlDocument is the Digital Forensics XML record of a run, saved by
+// -dfxml for forensic tooling that reads DFXML hash lists.
+type dfxmlDocument struct {
+	XMLName   xml.Name      `xml:"dfxml"`
+	Version   string        `xml:"xmloutputversion,attr"`
+	Xmlns     string        `xml:"xmlns,attr"`
+	XmlnsDC   string        `xml:"xmlns:dc,attr"`
+	XmlnsTool string        `xml:"xmlns:chkiso,attr"`
+	Metadata  dfxmlMetadata `xml:"metadata"`
+	Creator   dfxmlCreator  `xml:"creator"`
+	Source    dfxmlSource   `xml:"source"`
+	Files     []dfxmlFile   `xml:"fileobject"`
+	Result    string        `xml:"chkiso:result"` // PASSED, FAILED or WEAK, as in reports
+	Failures  []string      `xml:"chkiso:failure,omitempty"`
+}
+
+type dfxmlMetadata struct {
+	Type string `xml:"dc:type"`
+}
+
+type dfxmlCreator struct {
+	Version     string `xml:"version,attr"`
+	Program     string `xml:"program"`
+	ToolVersion string `xml:"version"`
+	Compiler    string `xml:"build_environment>compiler"`
+	Sysname     string `xml:"execution_environment>os_sysname"`
+	Arch        string `xml:"execution_environment>arch"`
+	Host        string `xml:"execution_environment>host,omitempty"`
+	Username    string `xml:"execution_environment>username,omitempty"`
+	CommandLine string `xml:"execution_environment>command_line"`
+	StartTime   string `xml:"execution_environment>start_time"`
+}
+
+type dfxmlSource struct {
+	ImageFilename string        `xml:"image_filename"`
+	ImageSize     int64         `xml:"imagesize,omitempty"`
+	ByteRuns      *dfxmlRuns    `xml:"byte_runs"` // The bytes hashed, if not all of the image
+	Hashes        []dfxmlDigest `xml:"hashdigest"`
+}
+
+type dfxmlFile struct {
+	Filename     string        `xml:"filename"`
+	Filesize     *int64        `xml:"filesize"`
+	ByteRuns     *dfxmlRuns    `xml:"byte_runs"`
+	Hashes       []dfxmlDigest `xml:"hashdigest"`
+	ChecksumFile string        `xml:"chkiso:checksum_file"`
+	Status       string        `xml:"chkiso:status"`
+	Error        string        `xml:"chkiso:error,omitempty"`
+}
+
+type dfxmlRuns struct {
+	Runs []dfxmlRun `xml:"byte_run"`
+}
+
+type dfxmlRun struct {
+	ImgOffset int64 `xml:"img_offset,attr"`
+	Len       int64 `xml:"len,attr"`
+}
+
+type dfxmlDigest struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+// newDFXML assembles the DFXML record of a finished run from its report,
+// adding where each verified file lies in an ISO image.
+func newDFXML(config *Config, report *Report) *dfxmlDocument {
+	doc := &dfxmlDocument{
+		Version:   "1.2.0",
+		Xmlns:     dfxmlNamespace,
+		XmlnsDC:   dcNamespace,
+		XmlnsTool: chkisoNamespace,
+		Metadata:  dfxmlMetadata{Type: "Hash List"},
+		Creator: dfxmlCreator{
+			Version:     "1.0",
+			Program:     "chkiso",
+			ToolVersion: VERSION,
+			Compiler:    runtime.Version(),
+			Sysname:     runtime.GOOS,
+			Arch:        runtime.GOARCH,
+			Host:        report.Host,
+			Username:    report.Operator,
+			CommandLine: strings.Join(os.Args, " "),
+			StartTime:   config.started.UTC().Format(time.RFC3339),
+		},
+		Source:   dfxmlSource{ImageFilename: report.Target},
+		Result:   report.Result,
+		Failures: report.Failures,
+	}
+	if size, err := config.target.RawSize(); err == nil {
+		doc.Source.ImageSize = size
+	}
+	if r := report.Range; r != nil {
+		length := r.Length
+		if length == 0 {
+			length = doc.Source.ImageSize - r.Offset
+		}
+		doc.Source.ByteRuns = &dfxmlRuns{[]dfxmlRun{{ImgOffset: r.Offset, Len: length}}}
+	}
+	if report.SHA256 != "" {
+		doc.Source.Hashes = append(doc.Source.Hashes, dfxmlDigest{"sha256", report.SHA256})
+	}
+	if m := report.ImageMD5; m != nil {
+		doc.Source.Hashes = append(doc.Source.Hashes, dfxmlDigest{"md5", m.Calculated})
+	}
+
+	c := config.result.Contents
+	if c == nil {
+		return doc
+	}
+	names := make([]string, len(c.Files))
+	for i, f := range c.Files {
+		names[i] = path.Join(path.Dir(f.ChecksumFile), strings.ReplaceAll(f.Name, "\\", "/"))
+	}
+	extents, _ := verify.FileExtents(config.target, names)
+	base := int64(0)
+	if p := config.partition; p != nil {
+		base = p.Offset
+	}
+	for i, f := range c.Files {
+		file := dfxmlFile{Filename: names[i], ChecksumFile: f.ChecksumFile, Status: string(f.Status)}
+		if f.Size >= 0 {
+			size := f.Size
+			file.Filesize = &size
+		}
+		if e := extents[names[i]]; len(e) > 0 {
+			file.ByteRuns = &dfxmlRuns{}
+			for _, x := range e {
+				file.ByteRuns.Runs = append(file.ByteRuns.Runs, dfxmlRun{ImgOffset: base + x[0], Len: x[1]})
+			}
+		}
+		if f.Hash != "" {
+			file.Hashes = []dfxmlDigest{{f.Algorithm, f.Hash}}
+		}
+		if f.Err != nil {
+			file.Error = f.Err.Error()
+		}
+		doc.Files = append(doc.Files, file)
+	}
+	return doc
+}
+
+// writeDFXML saves doc to path.
+func writeDFXML(path string, doc *dfxmlDocument) error {
+	data, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append([]byte(xml.Header+string(data)), '\n'), 0644)
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pappasjfed/chkiso/pkg/verify"
+)
+
+// runDrives lists the optical and removable media that can be verified, so
+// users need not work out which device node a disc or USB stick received.
+func runDrives(args []string) error {
+	if len(args) > 0 {
+		return fmt.Errorf("unknown drives option: %s", args[0])
+	}
+	drives, err := verify.ListDrives(context.Background())
+	if err != nil {
+		return err
+	}
+	if len(drives) == 0 {
+		fmt.Println("No optical or removable drives found.")
+		return nil
+	}
+	fmt.Printf("%-14s %-10s %10s  %s\n", "TARGET", "KIND", "SIZE", "NAME")
+	for _, d := range drives {
+		size := "no media"
+		if d.Size > 0 {
+			size = fmt.Sprintf("%.1f GB", float64(d.Size)/1e9)
+		}
+		fmt.Printf("%-14s %-10s %10s  %s\n", d.Path, d.Kind, size, d.Name)
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+
+	"github.com/pappasjfed/chkiso/pkg/verify"
+)
+
+// checkDeviceAccess opens a drive or device target before any check runs.
+// When raw access is denied it says which checks need it and what becomes
+// of each, and on an interactive console offers to run again elevated with
+// the same arguments; if accepted, it exits with the elevated run's exit
+// code. Otherwise the run goes on without raw access: the informational
+// hash is skipped, and the checks that were asked for report the error.
+func checkDeviceAccess(config *Config) {
+	t := config.target
+	if !t.IsDrive && !t.IsDevice {
+		return
+	}
+	// The files of a mounted data volume are read through its file system
+	if volume := t.DataVolume(); volume != nil && volume.Root != "" {
+		return
+	}
+	err := verify.CheckAccess(t)
+	if err == nil || !errors.Is(err, fs.ErrPermission) {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "Warning: Reading %s needs %s rights: %v\n", t, elevatedName, err)
+	explainDeniedAccess(config)
+	descriptors := descriptorFlags(config)
+	if canElevate() && len(descriptors) > 0 {
+		fmt.Fprintf(os.Stderr, "chkiso cannot run itself again %s with %s: the elevated run would not get the descriptor.\n", elevateHow, strings.Join(descriptors, " and "))
+	}
+	if canElevate() && interactive(config) && len(descriptors) == 0 {
+		fmt.Fprintf(os.Stderr, "Run chkiso again %s? [y/N] ", elevateHow)
+		answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		if a := strings.ToLower(strings.TrimSpace(answer)); a == "y" || a == "yes" {
+			code, err := relaunchElevated(os.Args[1:])
+			if err == nil {
+				os.Exit(code)
+			}
+			fmt.Fprintf(os.Stderr, "Error: Could not run elevated: %v\n", err)
+		}
+	} else {
+		fmt.Fprintf(os.Stderr, "Run chkiso %s to do every check.\n", elevateHow)
+	}
+	config.noRawAccess = true
+}
+
+// descriptorFlags returns the options that name file descriptors above 2,
+// which an elevated run would not inherit: sudo closes them, and the UAC
+// prompt starts a process of its own.
+func descriptorFlags(config *Config) []string {
+	var flags []string
+	if config.ResultFD > 2 {
+		flags = append(flags, fmt.Sprintf("-result-fd %d", config.ResultFD))
+	}
+	if config.ProgressFD > 2 {
+		flags = append(flags, fmt.Sprintf("-progress-fd %d", config.ProgressFD))
+	}
+	return flags
+}
+
+// explainDeniedAccess lists, for a target that cannot be read raw, which of
+// the requested checks are skipped, which will fail and which still run.
+func explainDeniedAccess(config *Config) {
+	t := config.target
+	medium := "the drive"
+	if t.IsDevice {
+		medium = "the device"
+	}
+	var skipped, failing, fine []string
+
+	expected := config.Sha256Hash != "" || config.ShaFile != "" || config.Sha256File != "" || config.FetchChecksum
+	switch {
+	case config.Offset != 0 || config.Length != 0:
+		failing = append(failing, "hashing the byte range (-offset, -length)")
+	case expected:
+		failing = append(failing, "comparing the SHA256 of "+medium+" with the expected hash")
+	case config.WholeDevice:
+		failing = append(failing, "hashing all of "+medium+" (-whole-device)")
+	case !config.Incremental:
+		skipped = append(skipped, "the SHA256 of "+medium+", which is only informational without an expected hash")
+	}
+	if config.MD5Check {
+		failing = append(failing, "the implanted MD5 check (-md5)")
+	}
+	if config.Jigdo != "" {
+		failing = append(failing, "the jigdo check (-jigdo)")
+	}
+	if !config.NoVerify {
+		if t.IsDrive {
+			// Windows reads the files through the mounted file system
+			fine = append(fine, "verifying the files on "+medium+" against its checksum files")
+		} else {
+			failing = append(failing, "verifying the files on "+medium+", which are read from the device itself")
+		}
+	}
+
+	for _, c := range skipped {
+		fmt.Fprintf(os.Stderr, "  Skipped:       %s\n", c)
+	}
+	for _, c := range failing {
+		fmt.Fprintf(os.Stderr, "  Will fail:     %s\n", c)
+	}
+	for _, c := range fine {
+		fmt.Fprintf(os.Stderr, "  Still checked: %s\n", c)
+	}
+}
+
+// interactive reports whether a prompt can be answered: the console is a
+// terminal and neither the report nor the expected hash uses stdin or stdout.
+func interactive(config *Config) bool {
+	if config.JSON || config.SummaryOnly || config.Sha256Stdin {
+		return false
+	}
+	for _, f := range []*os.File{os.Stdin, os.Stderr} {
+		info, err := f.Stat()
+		if err != nil || info.Mode()&os.ModeCharDevice == 0 {
+			return false
+		}
+	}
+	return true
+}
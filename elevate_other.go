@@ -0,0 +1,37 @@
+//go:build !windows
+
+package main
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+)
+
+const (
+	elevatedName = "root"
+	elevateHow   = "with sudo"
+)
+
+// canElevate reports whether running elevated could help: not when chkiso
+// already runs as root.
+func canElevate() bool {
+	return os.Geteuid() != 0
+}
+
+// relaunchElevated runs chkiso with args under sudo on this terminal and
+// returns its exit code.
+func relaunchElevated(args []string) (int, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return 0, err
+	}
+	cmd := exec.Command("sudo", append([]string{"--", exe}, args...)...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	err = cmd.Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode(), nil
+	}
+	return 0, err
+}
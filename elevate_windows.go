@@ -0,0 +1,102 @@
+//go:build windows
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+const (
+	elevatedName = "administrator"
+	elevateHow   = "as administrator"
+)
+
+// ShellExecuteExW flags.
+const (
+	seeMaskNoCloseProcess = 0x00000040
+	seeMaskNoAsync        = 0x00000100
+	swShowNormal          = 1
+)
+
+// shellExecuteInfo is SHELLEXECUTEINFOW.
+type shellExecuteInfo struct {
+	size        uint32
+	mask        uint32
+	hwnd        uintptr
+	verb        *uint16
+	file        *uint16
+	parameters  *uint16
+	directory   *uint16
+	show        int32
+	instApp     uintptr
+	idList      uintptr
+	class       *uint16
+	keyClass    uintptr
+	hotKey      uint32
+	iconMonitor uintptr
+	process     syscall.Handle
+}
+
+var procShellExecuteEx = syscall.NewLazyDLL("shell32.dll").NewProc("ShellExecuteExW")
+
+// canElevate reports whether running elevated could help: not when chkiso
+// already runs with an elevated (administrator) token.
+func canElevate() bool {
+	return !windows.GetCurrentProcessToken().IsElevated()
+}
+
+// relaunchElevated runs chkiso with args through the UAC "runas" verb and
+// returns its exit code. The elevated run gets a console window of its own,
+// so it is told to -pause before closing it.
+func relaunchElevated(args []string) (int, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return 0, err
+	}
+	dir, err := os.Getwd()
+	if err != nil {
+		return 0, err
+	}
+	quoted := make([]string, 0, len(args)+1)
+	pause := false
+	for _, arg := range args {
+		quoted = append(quoted, syscall.EscapeArg(arg))
+		pause = pause || arg == "-pause" || arg == "--pause"
+	}
+	if !pause {
+		quoted = append(quoted, "-pause")
+	}
+
+	info := shellExecuteInfo{
+		mask:       seeMaskNoCloseProcess | seeMaskNoAsync,
+		verb:       syscall.StringToUTF16Ptr("runas"),
+		file:       syscall.StringToUTF16Ptr(exe),
+		parameters: syscall.StringToUTF16Ptr(strings.Join(quoted, " ")),
+		directory:  syscall.StringToUTF16Ptr(dir),
+		show:       swShowNormal,
+	}
+	info.size = uint32(unsafe.Sizeof(info))
+	if ok, _, err := procShellExecuteEx.Call(uintptr(unsafe.Pointer(&info))); ok == 0 {
+		// Also when the UAC prompt is declined
+		return 0, err
+	}
+	if info.process == 0 {
+		return 0, fmt.Errorf("the elevated process could not be followed")
+	}
+	defer syscall.CloseHandle(info.process)
+	fmt.Println("Running elevated in a new window...")
+	if _, err := syscall.WaitForSingleObject(info.process, syscall.INFINITE); err != nil {
+		return 0, err
+	}
+	var code uint32
+	if err := syscall.GetExitCodeProcess(info.process, &code); err != nil {
+		return 0, err
+	}
+	return int(code), nil
+}
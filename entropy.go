@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+
+	"github.com/pappasjfed/chkiso/pkg/verify"
+)
+
+// entropyBarWidth is the width of the bar drawn for 8 bits per byte.
+const entropyBarWidth = 32
+
+// runEntropy prints the entropy of each region of an image, so that
+// forensic and QA users can see at a glance where an image holds data,
+// blank padding, or a zero-filled tail left by a truncated copy.
+func runEntropy(args []string) error {
+	path := ""
+	regions := 64
+	for i := 0; i < len(args); i++ {
+		switch arg := args[i]; arg {
+		case "-regions", "--regions":
+			if i+1 >= len(args) {
+				return fmt.Errorf("%s requires a value", arg)
+			}
+			i++
+			n, err := strconv.Atoi(args[i])
+			if err != nil || n < 1 {
+				return fmt.Errorf("invalid -regions value: %s", args[i])
+			}
+			regions = n
+		default:
+			if path != "" || strings.HasPrefix(arg, "-") {
+				return fmt.Errorf("unknown entropy option: %s", arg)
+			}
+			path = arg
+		}
+	}
+	if path == "" {
+		return fmt.Errorf("usage: chkiso entropy <image> [-regions <n>]")
+	}
+	target, err := verify.NewTarget(path)
+	if err != nil {
+		return err
+	}
+	if target.IsDir {
+		return fmt.Errorf("%s is a directory; entropy reads an image or device", target)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	fmt.Printf("Reading %s...\n", target)
+	entropyMap, err := verify.EntropyMap(ctx, target, regions, nil)
+	if err != nil {
+		return err
+	}
+	if len(entropyMap) == 0 {
+		fmt.Println("The image is empty.")
+		return nil
+	}
+
+	fmt.Printf("\n--- Entropy Map (bits per byte) ---\n")
+	fmt.Printf("  %14s  %10s  %4s\n", "Offset", "Length", "Bits")
+	for _, r := range entropyMap {
+		bar := int(r.Entropy/8*entropyBarWidth + 0.5)
+		fmt.Printf("  %14d  %10s  %4.2f  %-*s  %s\n", r.Offset, formatBytes(r.Length), r.Entropy, entropyBarWidth, strings.Repeat("#", bar), entropyClass(r))
+	}
+
+	// A zero-filled tail is what a truncated copy padded to size looks like
+	tail := len(entropyMap)
+	for tail > 0 && entropyMap[tail-1].Zeros {
+		tail--
+	}
+	fmt.Println()
+	switch {
+	case tail == 0:
+		fmt.Println("\033[33mThe image holds only zero bytes.\033[0m")
+	case tail < len(entropyMap):
+		start := entropyMap[tail].Offset
+		last := entropyMap[len(entropyMap)-1]
+		fmt.Printf("\033[33mThe last %s (from offset %d) are zero bytes: padding, or a copy that was cut short.\033[0m\n", formatBytes(last.Offset+last.Length-start), start)
+	default:
+		fmt.Println("The image has no zero-filled tail.")
+	}
+	return nil
+}
+
+// entropyClass names what a region of the given entropy usually holds.
+func entropyClass(r verify.EntropyRegion) string {
+	switch {
+	case r.Zeros:
+		return "zero-filled"
+	case r.Entropy < 1:
+		return "blank or padding"
+	case r.Entropy < 6:
+		return "text, tables or sparse data"
+	case r.Entropy < 7.5:
+		return "executable or mixed data"
+	}
+	return "compressed or encrypted"
+}
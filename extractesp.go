@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/pappasjfed/chkiso/pkg/verify"
+)
+
+// runExtractESP copies the EFI System Partition of a hybrid ISO or disk
+// image to a file, which can then be mounted, inspected or compared with
+// the one of another release.
+func runExtractESP(args []string) error {
+	path, output := "", ""
+	for i := 0; i < len(args); i++ {
+		switch arg := args[i]; arg {
+		case "-o", "-output", "--output":
+			if i+1 >= len(args) {
+				return fmt.Errorf("%s requires a value", arg)
+			}
+			i++
+			output = args[i]
+		default:
+			if path != "" || strings.HasPrefix(arg, "-") {
+				return fmt.Errorf("unknown extract-esp option: %s", arg)
+			}
+			path = arg
+		}
+	}
+	if path == "" || output == "" {
+		return fmt.Errorf("usage: chkiso extract-esp <image|device> -o <file>")
+	}
+	target, err := verify.NewTarget(path)
+	if err != nil {
+		return err
+	}
+	if !target.HasESP() {
+		return fmt.Errorf("%s is not an image or device, so it has no EFI System Partition", target)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	out, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+	esp, err := verify.ExtractESP(ctx, target, out)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(output)
+		if errors.Is(err, verify.ErrNoESP) {
+			return fmt.Errorf("%s: %v", target, err)
+		}
+		return err
+	}
+	where := esp.Source
+	if esp.ISOFile != "" {
+		where += ", " + esp.ISOFile
+	}
+	fmt.Printf("Extracted the EFI System Partition (%s at offset %d, %s) to %s\n", where, esp.Offset, formatBytes(esp.Size), output)
+	fmt.Printf("SHA256: %s\n", esp.Sha256)
+	return nil
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// HistoryEntry is a single completed verification as stored in the history file.
+type HistoryEntry struct {
+	Timestamp  time.Time `json:"timestamp"`
+	Target     string    `json:"target"`
+	SHA256     string    `json:"sha256,omitempty"`
+	MD5        string    `json:"md5,omitempty"`
+	Result     string    `json:"result"`
+	Operator   string    `json:"operator,omitempty"`
+	DurationMS int64     `json:"duration_ms,omitempty"`
+}
+
+// historyFilter selects the entries `chkiso history` shows.
+type historyFilter struct {
+	Target     string // Only this target
+	FailedOnly bool   // Only failed verifications
+	Limit      int    // Only the most recent entries (0 = all)
+}
+
+func (f historyFilter) match(entry HistoryEntry) bool {
+	if f.Target != "" && entry.Target != f.Target {
+		return false
+	}
+	return !f.FailedOnly || entry.Result == "FAILED"
+}
+
+// historyPath returns the location of the history file in the user's config directory.
+func historyPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "chkiso", HISTORY_FILE), nil
+}
+
+// operator returns the name of the user running chkiso, for the audit trail.
+func operator() string {
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		return u.Username
+	}
+	if name := os.Getenv("USER"); name != "" {
+		return name
+	}
+	return os.Getenv("USERNAME")
+}
+
+// recordHistory appends a summary of this run to the history file, and to
+// the -db results database if one was given.
+// Failures are reported as warnings; they never change the exit code.
+func recordHistory(config *Config, passed bool) {
+	entry := HistoryEntry{
+		Timestamp:  config.started.UTC(),
+		Target:     config.target.String(),
+		SHA256:     config.calculatedSha256,
+		MD5:        config.calculatedMD5,
+		Result:     "PASSED",
+		Operator:   operator(),
+		DurationMS: time.Since(config.started).Milliseconds(),
+	}
+	if !passed {
+		entry.Result = "FAILED"
+	}
+
+	if config.Database != "" {
+		if err := recordHistoryDB(config.Database, entry); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: Could not record verification in results database: %v\n", err)
+		}
+	}
+
+	path, err := historyPath()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: Could not locate history file: %v\n", err)
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: Could not create history directory: %v\n", err)
+		return
+	}
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: Could not open history file: %v\n", err)
+		return
+	}
+	defer file.Close()
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: Could not encode history entry: %v\n", err)
+		return
+	}
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: Could not write history file: %v\n", err)
+	}
+}
+
+// loadHistory reads all entries from the history file, oldest first.
+// A missing history file is not an error.
+func loadHistory() ([]HistoryEntry, error) {
+	path, err := historyPath()
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var entries []HistoryEntry
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var entry HistoryEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			// Skip damaged lines rather than discarding the whole history
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
+
+// runHistory implements `chkiso history`, which lists recorded verifications
+// from the history file or, with -db, from the results database.
+func runHistory(args []string) error {
+	var filter historyFilter
+	var database string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		value := func() string {
+			if i+1 >= len(args) {
+				fmt.Fprintf(os.Stderr, "Error: %s requires a value\n", arg)
+				os.Exit(1)
+			}
+			i++
+			return args[i]
+		}
+		switch arg {
+		case "-db", "--db":
+			database = value()
+		case "-target", "--target":
+			filter.Target = value()
+			if abs, err := filepath.Abs(filter.Target); err == nil {
+				if _, err := os.Stat(abs); err == nil {
+					filter.Target = abs
+				}
+			}
+		case "-failed", "--failed":
+			filter.FailedOnly = true
+		case "-limit", "--limit":
+			n, err := strconv.Atoi(value())
+			if err != nil || n < 0 {
+				return fmt.Errorf("invalid -limit value: %s", args[i])
+			}
+			filter.Limit = n
+		default:
+			return fmt.Errorf("unknown history option: %s", arg)
+		}
+	}
+
+	var entries []HistoryEntry
+	var err error
+	if database != "" {
+		entries, err = queryHistoryDB(database, filter)
+	} else {
+		entries, err = loadHistory()
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read history: %v", err)
+	}
+
+	var matched []HistoryEntry
+	for _, entry := range entries {
+		if filter.match(entry) {
+			matched = append(matched, entry)
+		}
+	}
+	if filter.Limit > 0 && len(matched) > filter.Limit {
+		matched = matched[len(matched)-filter.Limit:]
+	}
+	printHistory(matched)
+	return nil
+}
+
+func printHistory(entries []HistoryEntry) {
+	if len(entries) == 0 {
+		fmt.Println("No verifications recorded yet.")
+		return
+	}
+
+	fmt.Println("--- Verification History ---")
+	for _, entry := range entries {
+		hash := entry.SHA256
+		if hash == "" {
+			hash = "-"
+		}
+		fmt.Printf("%s  %-6s  %s  %s", entry.Timestamp.Local().Format("2006-01-02 15:04:05"), entry.Result, hash, entry.Target)
+		if entry.Operator != "" {
+			fmt.Printf("  (%s, %s)", entry.Operator, (time.Duration(entry.DurationMS) * time.Millisecond).Round(time.Second/10))
+		}
+		fmt.Println()
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite" // Pure Go SQLite driver, keeps the binary dependency-free
+)
+
+// historySchema creates the verifications table of the -db results database.
+// Columns are only ever added, so older databases stay readable.
+const historySchema = `
+CREATE TABLE IF NOT EXISTS verifications (
+	id          INTEGER PRIMARY KEY AUTOINCREMENT,
+	timestamp   TEXT    NOT NULL,
+	target      TEXT    NOT NULL,
+	sha256      TEXT,
+	md5         TEXT,
+	result      TEXT    NOT NULL,
+	operator    TEXT,
+	duration_ms INTEGER,
+	version     TEXT
+);
+CREATE INDEX IF NOT EXISTS verifications_target ON verifications (target);
+`
+
+// openHistoryDB opens the SQLite results database at path, creating it and
+// its schema if needed.
+func openHistoryDB(path string) (*sql.DB, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec(historySchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("could not initialize results database %s: %v", path, err)
+	}
+	return db, nil
+}
+
+// recordHistoryDB inserts entry into the results database at path.
+func recordHistoryDB(path string, entry HistoryEntry) error {
+	db, err := openHistoryDB(path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	_, err = db.Exec(
+		`INSERT INTO verifications (timestamp, target, sha256, md5, result, operator, duration_ms, version)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		entry.Timestamp.UTC().Format(time.RFC3339Nano), entry.Target, entry.SHA256, entry.MD5,
+		entry.Result, entry.Operator, entry.DurationMS, VERSION,
+	)
+	return err
+}
+
+// queryHistoryDB returns the entries in the results database at path that
+// match filter, oldest first.
+func queryHistoryDB(path string, filter historyFilter) ([]HistoryEntry, error) {
+	db, err := openHistoryDB(path)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	var where []string
+	var args []interface{}
+	if filter.Target != "" {
+		where = append(where, "target = ?")
+		args = append(args, filter.Target)
+	}
+	if filter.FailedOnly {
+		where = append(where, "result = 'FAILED'")
+	}
+	query := "SELECT timestamp, target, sha256, md5, result, operator, duration_ms FROM verifications"
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY id"
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []HistoryEntry
+	for rows.Next() {
+		var entry HistoryEntry
+		var timestamp string
+		var sha256, md5, operator sql.NullString
+		var duration sql.NullInt64
+		if err := rows.Scan(&timestamp, &entry.Target, &sha256, &md5, &entry.Result, &operator, &duration); err != nil {
+			return nil, err
+		}
+		entry.Timestamp, _ = time.Parse(time.RFC3339Nano, timestamp)
+		entry.SHA256 = sha256.String
+		entry.MD5 = md5.String
+		entry.Operator = operator.String
+		entry.DurationMS = duration.Int64
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+
+	"github.com/pappasjfed/chkiso/pkg/verify"
+)
+
+// feedsPath returns the location of the list of hash feeds `chkiso
+// identify` queries by default, one file or URL per line.
+func feedsPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "chkiso", FEEDS_FILE), nil
+}
+
+// configuredFeeds reads the feeds listed in the feeds file, skipping blank
+// lines and # comments. A missing file lists none.
+func configuredFeeds() ([]string, error) {
+	path, err := feedsPath()
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var feeds []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			feeds = append(feeds, line)
+		}
+	}
+	return feeds, scanner.Err()
+}
+
+// runIdentify implements `chkiso identify`, which hashes an image of
+// unknown origin and looks it up in the known-good catalog and the
+// configured hash feeds, to tell what it most likely is. It reports whether
+// the image is a known one.
+func runIdentify(args []string) (bool, error) {
+	var path, catalog string
+	var feeds []string
+	noFeeds := false
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if (arg == "-catalog" || arg == "--catalog" || arg == "-feed" || arg == "--feed") && i+1 >= len(args) {
+			return false, fmt.Errorf("%s requires a value", arg)
+		}
+		switch arg {
+		case "-catalog", "--catalog":
+			i++
+			catalog = args[i]
+		case "-feed", "--feed":
+			i++
+			feeds = append(feeds, args[i])
+		case "-no-feeds", "--no-feeds":
+			noFeeds = true
+		default:
+			if path != "" || strings.HasPrefix(arg, "-") {
+				return false, fmt.Errorf("unknown identify option: %s", arg)
+			}
+			path = arg
+		}
+	}
+	if path == "" {
+		return false, fmt.Errorf("usage: chkiso identify <image|device> [-catalog <file>] [-feed <file|url>]... [-no-feeds]")
+	}
+	if !noFeeds {
+		configured, err := configuredFeeds()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: Could not read the configured feeds: %v\n", err)
+		}
+		feeds = append(configured, feeds...)
+	}
+	target, err := verify.NewTarget(path)
+	if err != nil {
+		return false, err
+	}
+	if target.IsDir {
+		return false, fmt.Errorf("%s is a directory; identify needs an image or a device", path)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	fmt.Println("--- Identify ---")
+	fmt.Printf("Image:  %s\n", target)
+	if label, err := verify.VolumeLabel(target); err == nil && label != "" {
+		fmt.Printf("Label:  %s\n", label)
+	}
+	fmt.Fprintf(os.Stderr, "Hashing %s...\n", target)
+	sum, err := verify.Sha256(ctx, target, nil)
+	if err != nil {
+		return false, err
+	}
+	fmt.Printf("SHA256: %s\n\n", sum)
+
+	known := false
+	catalogFile, err := catalogPath(catalog)
+	if err != nil {
+		return false, err
+	}
+	entries, err := catalogLookup(catalogFile, sum)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: Could not read the known-good catalog: %v\n", err)
+	}
+	for _, entry := range entries {
+		source := "catalog"
+		if entry.Source != "" {
+			source = entry.Source + ", catalog"
+		}
+		fmt.Printf("\033[32mKnown image: %s (%s)\033[0m\n", entry, source)
+		known = true
+	}
+	for _, feed := range feeds {
+		data, err := readFeed(ctx, feed)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: Could not read feed %s: %v\n", feed, err)
+			continue
+		}
+		listed, _, err := parseFeed(feed, data, "")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: Could not read feed %s: %v\n", feed, err)
+			continue
+		}
+		for _, entry := range listed {
+			if entry.SHA256 == sum {
+				fmt.Printf("\033[32mKnown image: %s (listed by %s)\033[0m\n", entry, feed)
+				known = true
+			}
+		}
+	}
+
+	// The volume label and file name only suggest what the image is; they
+	// are easily changed, unlike its hash
+	release := verify.Release(target)
+	switch {
+	case known && release != nil:
+		fmt.Printf("Its volume label and name also identify it as %s.\n", release)
+	case known:
+	case release != nil:
+		fmt.Printf("\033[33mLooks like %s by its volume label and name, but its hash is not in the catalog", release)
+		if len(feeds) > 0 {
+			fmt.Print(" or the feeds")
+		}
+		fmt.Println(".\nIt may be a modified image, or a release the catalog does not list yet; use\nchkiso -fetch-checksum to check it against the official checksums.\033[0m")
+	default:
+		fmt.Print("\033[33mUnknown image: its hash is not in the catalog")
+		if len(feeds) > 0 {
+			fmt.Print(" or the feeds")
+		}
+		fmt.Println(", and its volume label and name match no release chkiso recognizes.\033[0m")
+	}
+	return known, nil
+}
@@ -0,0 +1,35 @@
+// Package ctxio makes long-running reads cancellable through a context.
+package ctxio
+
+import (
+	"context"
+	"io"
+)
+
+type reader struct {
+	ctx   context.Context
+	r     io.Reader
+	limit *limiter
+}
+
+// NewReader returns a reader that fails with ctx.Err() once ctx is done.
+// The check happens before each Read, so cancellation takes effect within
+// one buffer's worth of data. If ctx carries a maximum rate (WithMaxRate),
+// reads are paced to it.
+func NewReader(ctx context.Context, r io.Reader) io.Reader {
+	limit, _ := ctx.Value(rateKey{}).(*limiter)
+	return &reader{ctx: ctx, r: r, limit: limit}
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	n, err := r.r.Read(p)
+	if r.limit != nil && n > 0 {
+		if waitErr := r.limit.wait(r.ctx, n); waitErr != nil {
+			return n, waitErr
+		}
+	}
+	return n, err
+}
@@ -0,0 +1,48 @@
+package ctxio
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type rateKey struct{}
+
+// limiter paces reads to a number of bytes per second. It is shared by
+// every reader of a context, so reads made at the same time share the rate.
+type limiter struct {
+	mu   sync.Mutex
+	rate float64   // Bytes per second
+	next time.Time // When the bytes read so far are paid for
+}
+
+// WithMaxRate returns a context whose readers (see NewReader) read at most
+// bytesPerSecond bytes per second between them. Reads are not split: a read
+// completes, then its reader waits until the rate allows it.
+func WithMaxRate(ctx context.Context, bytesPerSecond int64) context.Context {
+	if bytesPerSecond <= 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, rateKey{}, &limiter{rate: float64(bytesPerSecond)})
+}
+
+// wait blocks until n more bytes fit in the rate, or ctx is done.
+func (l *limiter) wait(ctx context.Context, n int) error {
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	l.next = l.next.Add(time.Duration(float64(n) / l.rate * float64(time.Second)))
+	delay := l.next.Sub(now)
+	l.mu.Unlock()
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,68 @@
+// Package decompress reads compressed images (.gz, .xz, .zst, .bz2) as
+// streams, so they can be verified without writing a decompressed copy.
+package decompress
+
+import (
+	"compress/bzip2"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+// Compression formats, named by their usual file extension.
+const (
+	Gzip  = "gzip"
+	XZ    = "xz"
+	Zstd  = "zstd"
+	Bzip2 = "bzip2"
+)
+
+var extensions = map[string]string{
+	".gz":  Gzip,
+	".xz":  XZ,
+	".zst": Zstd,
+	".bz2": Bzip2,
+}
+
+// Format returns the compression format path's extension names, or "".
+func Format(path string) string {
+	return extensions[strings.ToLower(filepath.Ext(path))]
+}
+
+// TrimExt returns path without its compression extension.
+func TrimExt(path string) string {
+	if Format(path) == "" {
+		return path
+	}
+	return strings.TrimSuffix(path, filepath.Ext(path))
+}
+
+// NewReader returns the decompressed stream of r, which holds data in
+// format. Closing it does not close r.
+func NewReader(format string, r io.Reader) (io.ReadCloser, error) {
+	switch format {
+	case Gzip:
+		return gzip.NewReader(r)
+	case XZ:
+		x, err := xz.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return io.NopCloser(x), nil
+	case Zstd:
+		// A single decoder goroutine keeps memory use predictable
+		d, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		return d.IOReadCloser(), nil
+	case Bzip2:
+		return io.NopCloser(bzip2.NewReader(r)), nil
+	}
+	return nil, fmt.Errorf("unsupported compression format %q", format)
+}
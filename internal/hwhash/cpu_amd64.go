@@ -0,0 +1,23 @@
+package hwhash
+
+// godebugOption names the GODEBUG cpu.<option> that turns off the
+// instructions for each algorithm.
+var godebugOption = map[string]string{"sha1": "sha", "sha256": "sha"}
+
+// cpuid executes the CPUID instruction; see cpu_amd64.s.
+func cpuid(eaxArg, ecxArg uint32) (eax, ebx, ecx, edx uint32)
+
+// detect looks for the SHA extensions (leaf 7, EBX bit 29), which Go uses
+// together with SSSE3 and SSE4.1 (leaf 1, ECX bits 9 and 19).
+func detect() *Features {
+	maxLeaf, _, _, _ := cpuid(0, 0)
+	if maxLeaf < 7 {
+		return nil
+	}
+	_, _, ecx1, _ := cpuid(1, 0)
+	_, ebx7, _, _ := cpuid(7, 0)
+	if ebx7&(1<<29) == 0 || ecx1&(1<<9) == 0 || ecx1&(1<<19) == 0 {
+		return nil
+	}
+	return &Features{Name: "SHA-NI", Algorithms: []string{"sha1", "sha256"}}
+}
@@ -0,0 +1,30 @@
+package hwhash
+
+import (
+	"runtime"
+
+	"golang.org/x/sys/cpu"
+)
+
+// godebugOption names the GODEBUG cpu.<option> that turns off the
+// instructions for each algorithm.
+var godebugOption = map[string]string{"sha1": "sha1", "sha256": "sha2", "sha512": "sha512"}
+
+// detect reads the ARMv8 cryptographic extensions. Every Apple silicon CPU
+// has them, though macOS does not report them the way Linux does.
+func detect() *Features {
+	var algorithms []string
+	if cpu.ARM64.HasSHA1 || runtime.GOOS == "darwin" {
+		algorithms = append(algorithms, "sha1")
+	}
+	if cpu.ARM64.HasSHA2 || runtime.GOOS == "darwin" {
+		algorithms = append(algorithms, "sha256")
+	}
+	if cpu.ARM64.HasSHA512 || runtime.GOOS == "darwin" {
+		algorithms = append(algorithms, "sha512")
+	}
+	if len(algorithms) == 0 {
+		return nil
+	}
+	return &Features{Name: "ARMv8 crypto extensions", Algorithms: algorithms}
+}
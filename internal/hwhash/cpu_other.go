@@ -0,0 +1,10 @@
+//go:build !amd64 && !arm64
+
+package hwhash
+
+var godebugOption = map[string]string{}
+
+// detect knows no hashing instructions on this architecture.
+func detect() *Features {
+	return nil
+}
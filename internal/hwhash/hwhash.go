@@ -0,0 +1,83 @@
+// Package hwhash reports which hash algorithms the CPU has dedicated
+// instructions for. Go's crypto packages use those instructions by
+// themselves whenever the CPU has them and fall back to portable code
+// otherwise; this package only tells the user which case applies, since
+// verifying large images is often bound by hashing speed.
+package hwhash
+
+import (
+	"os"
+	"strings"
+)
+
+// Features are the hashing instructions of a CPU.
+type Features struct {
+	Name       string   // Instruction set extension, e.g. "SHA-NI"
+	Algorithms []string // Manifest algorithm names it accelerates
+	// Disabled lists the algorithms whose instructions GODEBUG turned off,
+	// e.g. with GODEBUG=cpu.sha=off.
+	Disabled []string
+}
+
+// Detect returns the hashing instructions of this CPU, or nil if it has
+// none chkiso knows about.
+func Detect() *Features {
+	f := detect()
+	if f == nil {
+		return nil
+	}
+	for _, algorithm := range f.Algorithms {
+		if disabled(godebugOption[algorithm]) {
+			f.Disabled = append(f.Disabled, algorithm)
+		}
+	}
+	return f
+}
+
+// Accelerated reports whether algorithm runs on dedicated instructions.
+func (f *Features) Accelerated(algorithm string) bool {
+	if f == nil {
+		return false
+	}
+	return contains(f.Algorithms, algorithm) && !contains(f.Disabled, algorithm)
+}
+
+// Describe summarizes the CPU's hashing instructions for --version and
+// `chkiso bench`, e.g. "SHA-NI (sha1, sha256)".
+func Describe() string {
+	f := Detect()
+	if f == nil {
+		return "no hashing instructions; portable implementations are used"
+	}
+	s := f.Name + " (" + strings.Join(f.Algorithms, ", ") + ")"
+	if len(f.Disabled) > 0 {
+		s += "; turned off by GODEBUG for " + strings.Join(f.Disabled, ", ")
+	}
+	return s
+}
+
+// disabled reports whether GODEBUG turns off the CPU feature option, as the
+// Go runtime reads it: cpu.<option>=off or cpu.all=off.
+func disabled(option string) bool {
+	if option == "" {
+		return false
+	}
+	off := false
+	for _, setting := range strings.Split(os.Getenv("GODEBUG"), ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(setting), "=")
+		if !ok || (key != "cpu.all" && key != "cpu."+option) {
+			continue
+		}
+		off = value == "off"
+	}
+	return off
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
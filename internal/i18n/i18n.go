@@ -0,0 +1,98 @@
+// Package i18n translates the verdicts and summaries chkiso prints. Messages
+// are looked up by their English text, as with gettext, in the catalogs
+// under locales/: one JSON object per language, mapping each English message
+// to its translation. A message a catalog lacks is printed in English, so a
+// catalog can be added to, or started, one message at a time.
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+//go:embed locales/*.json
+var locales embed.FS
+
+// English is the language the messages are written in; it needs no catalog.
+const English = "en"
+
+// current is the catalog of the selected language, or nil for English.
+var current map[string]string
+
+// Languages returns the codes of the languages there are catalogs for,
+// English included.
+func Languages() []string {
+	langs := []string{English}
+	entries, _ := locales.ReadDir("locales")
+	for _, e := range entries {
+		langs = append(langs, strings.TrimSuffix(e.Name(), ".json"))
+	}
+	sort.Strings(langs)
+	return langs
+}
+
+// Select makes lang the language of T. lang is a language code such as
+// "de", or a locale such as "de_DE.UTF-8" or "de-DE"; "", "C" and "POSIX"
+// select English.
+func Select(lang string) error {
+	code := languageCode(lang)
+	if code == English {
+		current = nil
+		return nil
+	}
+	data, err := locales.ReadFile(path.Join("locales", code+".json"))
+	if err != nil {
+		return fmt.Errorf("unsupported language %q (available: %s)", lang, strings.Join(Languages(), ", "))
+	}
+	var catalog map[string]string
+	if err := json.Unmarshal(data, &catalog); err != nil {
+		return fmt.Errorf("invalid message catalog %s.json: %v", code, err)
+	}
+	current = catalog
+	return nil
+}
+
+// Detect returns the operator's language: that of the first locale
+// variable set of LC_ALL, LC_MESSAGES and LANG, or else the user's display
+// language on Windows. It returns English if none is set.
+func Detect() string {
+	for _, name := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		if value := os.Getenv(name); value != "" {
+			return languageCode(value)
+		}
+	}
+	if lang := systemLanguage(); lang != "" {
+		return languageCode(lang)
+	}
+	return English
+}
+
+// T returns the translation of the English message format, formatted with
+// args as fmt.Sprintf does.
+func T(format string, args ...interface{}) string {
+	if translated, ok := current[format]; ok {
+		format = translated
+	}
+	if len(args) == 0 {
+		return format
+	}
+	return fmt.Sprintf(format, args...)
+}
+
+// languageCode returns the language of a locale name: "de" for
+// "de_DE.UTF-8@euro" or "de-DE".
+func languageCode(locale string) string {
+	code := strings.ToLower(locale)
+	if i := strings.IndexAny(code, "_-.@"); i >= 0 {
+		code = code[:i]
+	}
+	if code == "" || code == "c" || code == "posix" {
+		return English
+	}
+	return code
+}
@@ -0,0 +1,9 @@
+//go:build !windows
+
+package i18n
+
+// systemLanguage returns "": elsewhere the locale variables name the
+// language.
+func systemLanguage() string {
+	return ""
+}
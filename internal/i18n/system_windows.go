@@ -0,0 +1,13 @@
+package i18n
+
+import "golang.org/x/sys/windows"
+
+// systemLanguage returns the user's preferred display language, such as
+// "de-DE", since Windows does not set the locale variables.
+func systemLanguage() string {
+	langs, err := windows.GetUserPreferredUILanguages(windows.MUI_LANGUAGE_NAME)
+	if err != nil || len(langs) == 0 {
+		return ""
+	}
+	return langs[0]
+}
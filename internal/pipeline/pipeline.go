@@ -0,0 +1,99 @@
+// Package pipeline copies data from a slow reader into a hash with reading
+// and hashing done at the same time, so a drive keeps reading while the CPU
+// hashes what it last read.
+package pipeline
+
+import (
+	"context"
+	"io"
+)
+
+// BufferSize is the size of each read. Optical drives and USB sticks are
+// at their fastest with reads of 1 MiB or more (see `chkiso bench`).
+const BufferSize = 1 << 20
+
+// Copy copies src to dst until EOF or an error, like io.Copy, and returns
+// the number of bytes written. Reads happen in a goroutine filling one
+// buffer while dst consumes the other, so reads of src and writes to dst
+// (usually hashing) overlap instead of taking turns.
+//
+// Copy returns ctx.Err() as soon as ctx is done, even while a read of src
+// hangs, as reads of a dying drive or an unreachable network share do.
+// Reads of src are made from the goroutine, and Copy does not wait for one
+// in progress when it stops early: src may be closed once Copy returns, but
+// must not be read by anything else.
+func Copy(ctx context.Context, dst io.Writer, src io.Reader) (int64, error) {
+	return CopyAhead(ctx, dst, src, 1)
+}
+
+// CopyAhead is Copy with a read-ahead queue: src is read up to ahead
+// buffers (of BufferSize bytes) ahead of dst. A deep queue keeps a drive
+// reading through pauses in hashing, such as a slow progress update, which
+// matters for optical drives: once they stop being asked for data they slow
+// the disc down, and take seconds to get back to speed.
+func CopyAhead(ctx context.Context, dst io.Writer, src io.Reader, ahead int) (int64, error) {
+	if ahead < 1 {
+		ahead = 1
+	}
+	return copyBuffers(ctx, dst, src, ahead+1, BufferSize)
+}
+
+// copyBuffers is Copy with count buffers of size bytes. The reader can get
+// up to count-1 buffers ahead of dst.
+func copyBuffers(ctx context.Context, dst io.Writer, src io.Reader, count, size int) (int64, error) {
+	free := make(chan []byte, count)
+	for i := 0; i < count; i++ {
+		free <- make([]byte, size)
+	}
+	full := make(chan []byte, count)
+	stop := make(chan struct{})
+	var readErr error // Set before full is closed
+
+	go func() {
+		defer close(full)
+		for {
+			var buf []byte
+			select {
+			case <-stop:
+				return
+			case buf = <-free:
+			}
+			n, err := io.ReadFull(src, buf)
+			if n > 0 {
+				full <- buf[:n]
+			}
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return
+			}
+			if err != nil {
+				readErr = err
+				return
+			}
+		}
+	}()
+
+	var written int64
+	for {
+		var buf []byte
+		var ok bool
+		select {
+		case <-ctx.Done():
+			close(stop)
+			return written, ctx.Err()
+		case buf, ok = <-full:
+		}
+		if !ok {
+			return written, readErr
+		}
+		n, err := dst.Write(buf)
+		written += int64(n)
+		if err == nil && n < len(buf) {
+			err = io.ErrShortWrite
+		}
+		if err != nil {
+			close(stop)
+			return written, err
+		}
+		free <- buf[:cap(buf)]
+	}
+}
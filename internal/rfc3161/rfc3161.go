@@ -0,0 +1,192 @@
+// Package rfc3161 obtains trusted timestamp tokens from an RFC 3161 time
+// stamping authority (TSA) and reads the time and message imprint they
+// attest to. It does not check the TSA's signature; tokens are standard
+// DER-encoded TimeStampTokens that tools such as `openssl ts -verify` can
+// validate against the TSA's certificate chain.
+package rfc3161
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"time"
+)
+
+var (
+	oidSHA256     = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidSignedData = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidTSTInfo    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 1, 4}
+)
+
+// maxResponseSize bounds how much of a TSA response is read.
+const maxResponseSize = 1 << 20
+
+type algorithmIdentifier struct {
+	Algorithm  asn1.ObjectIdentifier
+	Parameters asn1.RawValue `asn1:"optional"`
+}
+
+type messageImprint struct {
+	HashAlgorithm algorithmIdentifier
+	HashedMessage []byte
+}
+
+type timeStampReq struct {
+	Version        int
+	MessageImprint messageImprint
+	Nonce          *big.Int `asn1:"optional"`
+	CertReq        bool     `asn1:"optional"`
+}
+
+type pkiStatusInfo struct {
+	Status       int
+	StatusString []asn1.RawValue `asn1:"optional"`
+	FailInfo     asn1.BitString  `asn1:"optional"`
+}
+
+type timeStampResp struct {
+	Status         pkiStatusInfo
+	TimeStampToken asn1.RawValue `asn1:"optional"`
+}
+
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"explicit,tag:0"`
+}
+
+type encapContentInfo struct {
+	EContentType asn1.ObjectIdentifier
+	EContent     []byte `asn1:"explicit,tag:0"`
+}
+
+type signedData struct {
+	Version          int
+	DigestAlgorithms asn1.RawValue
+	EncapContentInfo encapContentInfo
+}
+
+type accuracy struct {
+	Seconds int `asn1:"optional"`
+	Millis  int `asn1:"optional,tag:0"`
+	Micros  int `asn1:"optional,tag:1"`
+}
+
+type tstInfo struct {
+	Version        int
+	Policy         asn1.ObjectIdentifier
+	MessageImprint messageImprint
+	SerialNumber   *big.Int
+	GenTime        time.Time `asn1:"generalized"`
+	Accuracy       accuracy  `asn1:"optional"`
+	Ordering       bool      `asn1:"optional"`
+	Nonce          *big.Int  `asn1:"optional"`
+}
+
+// Info is what a timestamp token attests: that a SHA256 digest existed at Time.
+type Info struct {
+	Time   time.Time
+	SHA256 []byte
+	Serial *big.Int
+	nonce  *big.Int
+}
+
+// Timestamp asks the TSA at url for a timestamp token over a SHA256 digest
+// and returns the DER-encoded token with the time it attests.
+func Timestamp(ctx context.Context, url string, digest []byte) ([]byte, *Info, error) {
+	if len(digest) != 32 {
+		return nil, nil, errors.New("timestamp digest must be a SHA256 digest")
+	}
+	nonce, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 64))
+	if err != nil {
+		return nil, nil, err
+	}
+	req, err := asn1.Marshal(timeStampReq{
+		Version: 1,
+		MessageImprint: messageImprint{
+			HashAlgorithm: algorithmIdentifier{Algorithm: oidSHA256, Parameters: asn1.NullRawValue},
+			HashedMessage: digest,
+		},
+		Nonce:   nonce,
+		CertReq: true,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(req))
+	if err != nil {
+		return nil, nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/timestamp-query")
+	resp, err := http.DefaultClient.Do(httpReq)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("time stamping authority returned %s", resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var tsResp timeStampResp
+	if _, err := asn1.Unmarshal(body, &tsResp); err != nil {
+		return nil, nil, fmt.Errorf("invalid time stamp response: %v", err)
+	}
+	// 0 is granted, 1 is granted with modifications
+	if tsResp.Status.Status > 1 {
+		return nil, nil, fmt.Errorf("time stamping authority rejected the request (status %d)", tsResp.Status.Status)
+	}
+	token := tsResp.TimeStampToken.FullBytes
+	info, err := Parse(token)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !bytes.Equal(info.SHA256, digest) {
+		return nil, nil, errors.New("time stamp token does not cover the requested digest")
+	}
+	if info.nonce == nil || info.nonce.Cmp(nonce) != 0 {
+		return nil, nil, errors.New("time stamp token nonce does not match the request")
+	}
+	return token, info, nil
+}
+
+// Parse reads the time and SHA256 digest attested by a DER-encoded
+// TimeStampToken.
+func Parse(token []byte) (*Info, error) {
+	var ci contentInfo
+	if _, err := asn1.Unmarshal(token, &ci); err != nil {
+		return nil, fmt.Errorf("invalid time stamp token: %v", err)
+	}
+	if !ci.ContentType.Equal(oidSignedData) {
+		return nil, errors.New("invalid time stamp token: not a signed data structure")
+	}
+	var sd signedData
+	if _, err := asn1.Unmarshal(ci.Content.Bytes, &sd); err != nil {
+		return nil, fmt.Errorf("invalid time stamp token: %v", err)
+	}
+	if !sd.EncapContentInfo.EContentType.Equal(oidTSTInfo) {
+		return nil, errors.New("invalid time stamp token: no TSTInfo content")
+	}
+	var tst tstInfo
+	if _, err := asn1.Unmarshal(sd.EncapContentInfo.EContent, &tst); err != nil {
+		return nil, fmt.Errorf("invalid time stamp token: %v", err)
+	}
+	if !tst.MessageImprint.HashAlgorithm.Algorithm.Equal(oidSHA256) {
+		return nil, errors.New("time stamp token does not use SHA256")
+	}
+	return &Info{
+		Time:   tst.GenTime,
+		SHA256: tst.MessageImprint.HashedMessage,
+		Serial: tst.SerialNumber,
+		nonce:  tst.Nonce,
+	}, nil
+}
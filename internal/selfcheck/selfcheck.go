@@ -0,0 +1,136 @@
+// Package selfcheck signs chkiso executables and verifies them at run time.
+//
+// A signed executable carries a trailer after its normal contents:
+//
+//	payload | ed25519 signature (64 bytes) | payload length (8 bytes, little-endian) | Magic
+//
+// The signature covers the SHA256 of the payload. Executable formats ignore
+// data appended this way, so signing does not change how the binary runs.
+package selfcheck
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Magic ends the trailer of a signed executable.
+const Magic = "CHKISO-SIG1"
+
+const trailerSize = ed25519.SignatureSize + 8 + len(Magic)
+
+// signingContext separates these signatures from any other use of the key.
+const signingContext = "chkiso executable v1\x00"
+
+var (
+	// ErrUnsigned means the executable carries no signature trailer.
+	ErrUnsigned = errors.New("executable is not signed")
+	// ErrTampered means the signature does not match the executable.
+	ErrTampered = errors.New("executable does not match its signature")
+)
+
+// Result describes a checked executable.
+type Result struct {
+	Path   string
+	SHA256 string // Hash of the executable without its signature trailer
+}
+
+// ParsePublicKey decodes a hex-encoded ed25519 public key.
+func ParsePublicKey(s string) (ed25519.PublicKey, error) {
+	key, err := hex.DecodeString(s)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return nil, errors.New("invalid ed25519 public key")
+	}
+	return ed25519.PublicKey(key), nil
+}
+
+// Check verifies the signature trailer of the executable at path against
+// key. It returns ErrUnsigned or ErrTampered when the check fails, along
+// with the Result so the hash can still be reported.
+func Check(path string, key ed25519.PublicKey) (*Result, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	payload, sig, signed := split(data)
+	sum := sha256.Sum256(payload)
+	result := &Result{Path: path, SHA256: hex.EncodeToString(sum[:])}
+	if !signed {
+		return result, ErrUnsigned
+	}
+	if !ed25519.Verify(key, message(sum[:]), sig) {
+		return result, ErrTampered
+	}
+	return result, nil
+}
+
+// Sign appends a signature trailer to the executable at path, replacing an
+// existing one.
+func Sign(path string, key ed25519.PrivateKey) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	payload, _, _ := split(data)
+	sum := sha256.Sum256(payload)
+	sig := ed25519.Sign(key, message(sum[:]))
+
+	var trailer bytes.Buffer
+	trailer.Write(sig)
+	binary.Write(&trailer, binary.LittleEndian, uint64(len(payload)))
+	trailer.WriteString(Magic)
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_TRUNC, info.Mode())
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(payload); err != nil {
+		f.Close()
+		return err
+	}
+	if _, err := io.Copy(f, &trailer); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// split separates a signed executable into its payload and signature.
+func split(data []byte) (payload, sig []byte, signed bool) {
+	if len(data) < trailerSize || !bytes.HasSuffix(data, []byte(Magic)) {
+		return data, nil, false
+	}
+	trailer := data[len(data)-trailerSize:]
+	length := binary.LittleEndian.Uint64(trailer[ed25519.SignatureSize:])
+	if length != uint64(len(data)-trailerSize) {
+		return data, nil, false
+	}
+	return data[:length], trailer[:ed25519.SignatureSize], true
+}
+
+func message(sum []byte) []byte {
+	return append([]byte(signingContext), sum...)
+}
+
+// Describe explains the outcome of Check for users.
+func Describe(err error) string {
+	switch {
+	case err == nil:
+		return "the executable matches its signature"
+	case errors.Is(err, ErrUnsigned):
+		return "the executable carries no signature"
+	case errors.Is(err, ErrTampered):
+		return "the executable has been modified since it was signed"
+	}
+	return fmt.Sprintf("could not check the executable: %v", err)
+}
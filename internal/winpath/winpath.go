@@ -0,0 +1,35 @@
+// Package winpath converts Windows paths to their extended-length form, so
+// that media with paths longer than MAX_PATH (260 characters) can be read.
+package winpath
+
+import (
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// maxShort is the longest path Windows reliably accepts without the
+// extended-length prefix (MAX_PATH less room for an 8.3 name).
+const maxShort = 247
+
+// Long returns path with the \\?\ (or \\?\UNC\) prefix on Windows when it is
+// too long for the classic APIs. Go adds the prefix itself for long absolute
+// drive paths, but not for relative or UNC paths in the versions chkiso
+// supports. Device paths such as \\.\E: and paths on other systems are
+// returned unchanged.
+func Long(path string) string {
+	if runtime.GOOS != "windows" || strings.HasPrefix(path, `\\?\`) || strings.HasPrefix(path, `\\.\`) {
+		return path
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil || len(abs) <= maxShort {
+		return path
+	}
+	// Extended-length paths are passed to the file system as is, so they
+	// must use backslashes and must not contain "." or ".." elements;
+	// filepath.Abs has already cleaned them away.
+	if strings.HasPrefix(abs, `\\`) {
+		return `\\?\UNC\` + abs[2:]
+	}
+	return `\\?\` + abs
+}
@@ -2,118 +2,705 @@ package main
 
 import (
 	"bufio"
-	"crypto/md5"
-	"crypto/sha256"
-	"encoding/hex"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"math"
 	"os"
-	"os/exec"
+	"os/signal"
 	"path/filepath"
-	"regexp"
 	"runtime"
+	"strconv"
 	"strings"
-)
+	"time"
 
-const (
-	PVD_OFFSET          = 32768
-	PVD_SIZE            = 2048
-	APP_USE_OFFSET      = 883
-	APP_USE_SIZE        = 512
-	SECTOR_SIZE         = 2048
-	SPACE_CHAR          = 0x20  // Space character used for neutralizing PVD
-	VERSION             = "2.0.0"
+	"github.com/pappasjfed/chkiso/internal/hwhash"
+	"github.com/pappasjfed/chkiso/internal/i18n"
+	"github.com/pappasjfed/chkiso/pkg/jigdo"
+	"github.com/pappasjfed/chkiso/pkg/manifest"
+	"github.com/pappasjfed/chkiso/pkg/partition"
+	"github.com/pappasjfed/chkiso/pkg/policy"
+	"github.com/pappasjfed/chkiso/pkg/verify"
+	"github.com/pappasjfed/chkiso/pkg/wim"
 )
 
-var (
-	hasErrors = false
+const (
+	VERSION      = "2.0.0"
+	HISTORY_FILE = "history.jsonl"
+	CACHE_FILE   = "cache.json"
+	CATALOG_FILE = "catalog.db"
+	FEEDS_FILE   = "feeds.txt"
 )
 
 type Config struct {
-	Path               string
-	Sha256Hash         string
-	ShaFile            string
-	NoVerify           bool
-	MD5Check           bool
-	Dismount           bool
-	isDrive            bool
-	driveLetter        string
-	mountedISO         bool   // Track if we mounted the ISO (vs user-mounted)
-	mountedDriveLetter string // Drive letter where we mounted the ISO
+	Path             string
+	Sha256Hash       string
+	AlternateSha256  []string // Further accepted hashes, from repeated -sha256
+	ShaFile          string
+	NoVerify         bool
+	MD5Check         bool
+	Dismount         bool
+	NoHistory        bool
+	Stamp            bool // Record the verification in the verified files' extended attributes
+	Timeout          time.Duration
+	FileTimeout      time.Duration
+	NotifyAfter      time.Duration
+	Manifests        []string // Checksum files to verify instead of searching
+	RootOnly         bool     // Only search the media root for checksum files
+	MaxDepth         int      // Directory levels to search below the root (0 = no limit)
+	Strict           bool     // Fail when content verification has nothing to verify
+	FIPS             bool     // Only use FIPS approved hash algorithms
+	WholeDevice      bool     // Hash all of a drive, not just its ISO data area
+	Partition        int      // Partition of a raw disk image to verify (0 = whole image)
+	Offset           int64    // Start of the byte range to hash
+	Length           int64    // Length of the byte range to hash (0 = to the end)
+	WeakEvidence     string   // "warn" or "fail" when only MD5-class evidence passed
+	ExpectLabel      string   // Volume label the media must have
+	LabelMismatch    string   // "warn" or "fail" (the default) when the label differs
+	ExpectSize       int64    // Bytes the image must have as stored (0 = not checked)
+	ScanDamage       bool     // Look for runs of zeros or repeated sectors while hashing
+	Source           string   // Image the media was burned from, whose SHA256 is the expected one
+	WaitForDisc      bool     // Wait for a disc to appear in the drive before verifying
+	PolicyFile       string   // Policy file the run must comply with
+	PublicKey        string   // Trusted key for checksum file signatures: hex, or a PEM file
+	PublicKeyCreated string   // When PublicKey was made (YYYY-MM-DD), for policies limiting its age
+	Incremental      bool     // Only re-hash files changed since the last run
+	Database         string   // SQLite results database to record the run in
+	AuditLog         string   // JSONL file to append audit records to
+	ReportFile       string   // Where to save the JSON report
+	DFXMLFile        string   // Where to save the DFXML record
+	TSA              string   // RFC 3161 time stamping authority for the report
+	JSON             bool     // Print the report as JSON instead of console output
+	Sha256Stdin      bool     // Read the expected SHA256 from standard input
+	Sha256File       string   // Read the expected SHA256 from this file
+	Pause            bool     // Wait for Enter before exiting (file association)
+	NoSidecar        bool     // Do not look for hash files next to the image or hashes in its name
+	FetchChecksum    bool     // Download the official checksum file of a recognized distribution
+	Jigdo            string   // .jigdo file to verify the image against
+	ESP              bool     // Check the EFI System Partition of a hybrid ISO or disk image
+	BootConfig       bool     // Check the files the boot loader configuration names
+	Kernels          bool     // List and hash the kernels and initrds on the media
+	KernelSums       string   // Published checksums of the kernels and initrds
+	HashSet          string   // Reference hash set of known software, such as the NSRL RDS
+	Progress         string   // Machine-readable progress format ("json"), or "" for none
+	ProgressFD       int      // File descriptor for progress records (0 = stderr)
+	Control          string   // Socket to serve progress and accept cancellation on
+	Background       bool     // Run at low CPU and I/O priority
+	MaxRate          int64    // Bytes per second to read at most (0 = no limit)
+	Jobs             int      // Files on the media hashed at once
+	Unordered        bool     // Print file results as they finish rather than in listed order
+	SummaryOnly      bool     // Print only one line per target: path, SHA256 and verdict
+	ResultFile       string   // Where to write the final JSON verdict
+	ResultFD         int      // File descriptor to write the final JSON verdict to
+	ShowReport       bool     // Open the verdict as a web page when the run is done
+	Notify           bool     // Show a desktop notification when a long run is done
+	Lang             string   // Language of the verdicts, overriding the locale
+	Catalog          string   // Known-good catalog to look the image up in, instead of the default
+	VirusTotal       bool     // Look the image's SHA256 up on VirusTotal
+	target           *verify.Target
+	mountedISO       bool   // An ISO we mounted is still mounted
+	calculatedSha256 string // SHA256 computed during this run, if any
+	calculatedMD5    string // Implanted MD5 computed during this run, if any
+	started          time.Time
+	audit            *auditLog
+	result           *verify.Result
+	jsonOut          *os.File             // Real stdout while -json silences console output
+	weak             bool                 // -weak-evidence warn downgraded the result
+	partition        *partition.Partition // The selected partition, with -partition
+	sidecar          string               // Hash file found next to the image
+	sourceLabel      string               // Volume label of the -source image
+	hashInName       bool                 // The expected hash came from the image's file name
+	release          string               // Distribution release identified in the image
+	checksumURL      string               // Official checksum file downloaded with -fetch-checksum
+	expectedMD5      string               // MD5 of the image from a hash file offering no SHA256
+	progressOut      io.Writer            // Where -progress records go
+	control          *controlServer       // The -control socket while a run is in progress
+	deadline         time.Time            // When -timeout ends the run
+	verdicts         *[]TargetVerdict     // Outcome of each target, with -result-file or -result-fd
+	noRawAccess      bool                 // The drive or device cannot be read raw
+	knownGood        []catalogEntry       // Known-good catalog entries matching the image's SHA256
+	virusTotal       *virusTotal          // What VirusTotal knows about the image's SHA256, with -vt
+}
+
+// subcommand runs a chkiso subcommand with the arguments that follow its
+// name. It returns false without an error when it ran but found a problem,
+// such as a mismatch, that it has already reported.
+type subcommand func(args []string) (ok bool, err error)
+
+// plain adapts a subcommand that only fails with an error.
+func plain(run func(args []string) error) subcommand {
+	return func(args []string) (bool, error) {
+		return true, run(args)
+	}
+}
+
+// subcommands are the commands chkiso runs instead of verifying a target
+// when the first argument names one.
+var subcommands = map[string]subcommand{
+	"history":         plain(runHistory),
+	"catalog":         plain(runCatalog),
+	"identify":        runIdentify,
+	"associate":       plain(runAssociate),
+	"schedule":        plain(runSchedule),
+	"bench":           plain(runBench),
+	"entropy":         plain(runEntropy),
+	"dedupe":          plain(runDedupe),
+	"compare-tree":    runCompareTree,
+	"compare-iso":     runCompareISO,
+	"rip":             runRip,
+	"write":           runWrite,
+	"bundle":          plain(runBundle),
+	"create-manifest": plain(runCreateManifest),
+	"extract-esp":     plain(runExtractESP),
+	"stamps":          runStamps,
+	"drives":          plain(runDrives),
+	"powershell-module": plain(func(args []string) error {
+		if len(args) != 1 {
+			return errors.New("usage: chkiso powershell-module <directory>")
+		}
+		return writePowerShellModule(args[0])
+	}),
+	"self-check": plain(func(args []string) error {
+		return runSelfCheck()
+	}),
+	"check-report": plain(func(args []string) error {
+		if len(args) != 1 {
+			return errors.New("usage: chkiso check-report <report.json>")
+		}
+		return checkReport(args[0])
+	}),
 }
 
 func main() {
+	if len(os.Args) > 1 {
+		if run, found := subcommands[os.Args[1]]; found {
+			// Subcommands take no -lang; their verdicts follow the locale
+			i18n.Select(i18n.Detect())
+			ok, err := run(os.Args[2:])
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			if !ok {
+				os.Exit(1)
+			}
+			os.Exit(0)
+		}
+	}
+
 	config := parseFlags()
-	
+	config.started = time.Now()
+	warnIfTampered()
+	if config.Background {
+		enterBackground()
+	}
+	var watchdog *time.Timer
+	if config.Timeout > 0 {
+		config.deadline = config.started.Add(config.Timeout)
+		watchdog = startWatchdog(config.Timeout)
+	}
+
+	// With -json only the report goes to stdout, and with -summary-only only
+	// the summary lines; warnings and errors stay on stderr
+	config.jsonOut = os.Stdout
+	if config.JSON || config.SummaryOnly {
+		devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		os.Stdout = devNull
+	}
+
+	var failures []error
+	if manifest.IsChecksumFile(filepath.Base(config.Path)) {
+		failures = verifyChecksumTarget(config)
+	} else {
+		failures = verifyPath(config)
+	}
+
+	if watchdog != nil {
+		watchdog.Stop()
+	}
+	if config.verdicts != nil && (config.ResultFile != "" || config.ResultFD != 0) {
+		if err := writeVerdict(config, failures); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			failures = append(failures, err)
+		}
+	}
+	if config.Notify {
+		notifyDone(config, failures)
+	}
+	if config.ShowReport {
+		if err := showReport(config, failures); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: Could not open the report page: %v\n", err)
+		}
+	}
+	if config.Pause {
+		fmt.Print("\nPress Enter to close...")
+		bufio.NewReader(os.Stdin).ReadString('\n')
+	}
+
+	// Exit with proper code based on whether errors occurred
+	if len(failures) > 0 {
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+// verifyPath verifies the image or drive at config.Path, writes whatever
+// reports were requested, and records the run in the history.
+func verifyPath(config *Config) (failures []error) {
+	defer func() {
+		if config.SummaryOnly {
+			printSummaryLine(config, failures)
+		}
+		addVerdict(config, failures)
+	}()
 	// Validate and resolve the path
-	if err := validatePath(config); err != nil {
+	target, err := verify.NewTarget(config.Path)
+	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
+		return []error{err}
 	}
-	
-	// Execute checks based on provided parameters
-	if config.ShaFile != "" {
-		verifyPathAgainstHashFile(config)
+	config.target = target
+	if config.Source != "" {
+		if err := useSourceImage(config); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return []error{err}
+		}
 	}
-	if config.Sha256Hash != "" {
-		verifyPathAgainstHashString(config)
+	if config.WaitForDisc {
+		if err := waitForDisc(config); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return []error{err}
+		}
 	}
-	// If neither Sha256Hash nor ShaFile is provided, display SHA256 for informational purposes
-	if config.Sha256Hash == "" && config.ShaFile == "" {
-		displaySha256Hash(config)
+	if target.IsDir {
+		if err := checkDirectoryOptions(config); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return []error{err}
+		}
 	}
-	if config.MD5Check {
-		verifyImplantedMD5(config)
+	checkDeviceAccess(config)
+	if config.Partition > 0 {
+		if target.IsDrive {
+			err := fmt.Errorf("-partition only applies to disk image files, not drive letters")
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return []error{err}
+		}
+		target.Partition = config.Partition
 	}
-	// Run VerifyContents by default unless -NoVerify is specified
-	if !config.NoVerify {
-		verifyContents(config)
+	if config.Partition > 0 || target.IsDiskImage() {
+		if err := showPartitionTable(config); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return []error{err}
+		}
+	}
+
+	// Without its audit trail a run must not count as verified
+	if config.AuditLog != "" {
+		config.audit, err = openAuditLog(config.AuditLog, target.String())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return []error{err}
+		}
+		config.audit.start()
+	}
+
+	failures = run(config)
+	if config.control != nil {
+		config.control.finish(failures)
+	}
+	if config.ReportFile != "" && config.result != nil {
+		report := newReport(config, config.result, failures)
+		if err := writeReport(config.ReportFile, report, config.TSA); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: Could not save report: %v\n", err)
+			failures = append(failures, err)
+		} else {
+			fmt.Printf("\nReport saved to: %s\n", config.ReportFile)
+		}
+	}
+	if config.DFXMLFile != "" && config.result != nil {
+		doc := newDFXML(config, newReport(config, config.result, failures))
+		if err := writeDFXML(config.DFXMLFile, doc); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: Could not save DFXML: %v\n", err)
+			failures = append(failures, err)
+		} else {
+			fmt.Printf("DFXML saved to: %s\n", config.DFXMLFile)
+		}
+	}
+	if config.JSON && config.result != nil {
+		enc := json.NewEncoder(config.jsonOut)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(newReport(config, config.result, failures)); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		}
+	}
+	if config.audit != nil {
+		config.audit.finish(config.calculatedSha256, failures)
+	}
+
+	if config.Stamp && config.result != nil {
+		stampVerified(config, config.result)
 	}
-	
 	if config.Dismount {
 		handleDismount(config)
 	}
-	
-	// Exit with proper code based on whether errors occurred
-	if hasErrors {
-		os.Exit(1)
+
+	if !config.NoHistory {
+		recordHistory(config, len(failures) == 0)
 	}
-	os.Exit(0)
+	return failures
+}
+
+// printSummaryLine prints the -summary-only line of a target: its path, the
+// SHA256 calculated ("-" if none was) and PASSED or FAILED, separated by
+// tabs, to the real stdout.
+func printSummaryLine(config *Config, failures []error) {
+	sha256 := config.calculatedSha256
+	if sha256 == "" {
+		sha256 = "-"
+	}
+	fmt.Fprintf(config.jsonOut, "%s\t%s\t%s\n", config.Path, sha256, passFail(len(failures) == 0))
+}
+
+// checkDirectoryOptions rejects options that need an image when the target
+// is a directory tree, whose files are only verified against their
+// checksum files.
+func checkDirectoryOptions(config *Config) error {
+	var option string
+	switch {
+	case config.Sha256Hash != "" || config.ShaFile != "":
+		option = "an expected SHA256"
+	case config.FetchChecksum:
+		option = "-fetch-checksum"
+	case config.MD5Check:
+		option = "-md5"
+	case config.Jigdo != "":
+		option = "-jigdo"
+	case config.ESP:
+		option = "-esp"
+	case config.VirusTotal:
+		option = "-vt"
+	case config.Partition > 0:
+		option = "-partition"
+	case config.WholeDevice:
+		option = "-whole-device"
+	case config.Offset != 0 || config.Length != 0:
+		option = "a byte range"
+	case config.NoVerify:
+		option = "-noverify"
+	default:
+		return nil
+	}
+	return fmt.Errorf("%s needs an image or drive; %s is a directory, whose contents are verified against its checksum files", option, config.target.Path)
+}
+
+// showPartitionTable prints the partition table of a raw disk image and
+// finds the partition selected with -partition. Only a missing table or
+// partition is an error, and only when a partition was selected.
+func showPartitionTable(config *Config) error {
+	table, err := verify.PartitionTable(config.target)
+	if err != nil {
+		if config.Partition > 0 {
+			return fmt.Errorf("cannot select partition %d: %v", config.Partition, err)
+		}
+		if !errors.Is(err, partition.ErrNoTable) {
+			fmt.Fprintf(os.Stderr, "Warning: Could not read the partition table: %v\n", err)
+		}
+		return nil
+	}
+
+	fmt.Printf("\n--- Partition Table (%s) ---\n", strings.ToUpper(table.Scheme))
+	for _, p := range table.Partitions {
+		marker := " "
+		if p.Index == config.Partition {
+			marker = "*"
+		}
+		name := ""
+		if p.Name != "" {
+			name = fmt.Sprintf(" \"%s\"", p.Name)
+		}
+		boot := ""
+		if p.Bootable {
+			boot = " (bootable)"
+		}
+		fmt.Printf("%s %2d  offset %-12d size %-12d %s%s%s\n", marker, p.Index, p.Offset, p.Size, p.Type, name, boot)
+	}
+	for _, problem := range table.Problems {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", problem)
+	}
+	if config.Partition == 0 {
+		fmt.Println("Verifying the whole image (use -partition <n> to verify one partition).")
+		return nil
+	}
+	config.partition = table.Find(config.Partition)
+	if config.partition == nil {
+		return fmt.Errorf("the image has no partition %d", config.Partition)
+	}
+	fmt.Printf("Verifying partition %d only.\n", config.Partition)
+	return nil
+}
+
+// run performs the requested checks and returns every failure encountered,
+// so the exit code is derived from results rather than shared state.
+func run(config *Config) []error {
+	var failures []error
+
+	// A hash file supplies the expected hash
+	if config.ShaFile != "" {
+		expectedHash, err := resolveHashFile(config)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			failures = append(failures, err)
+		}
+		config.Sha256Hash = expectedHash
+	} else if config.FetchChecksum {
+		if err := useOfficialChecksum(config); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			failures = append(failures, err)
+		}
+	} else if config.Sha256Hash == "" && !config.NoSidecar {
+		useSidecar(config)
+	}
+	if config.Sha256Hash == "" && config.expectedMD5 == "" && !config.FetchChecksum {
+		showRelease(config)
+	}
+
+	// Run VerifyContents by default unless -NoVerify is specified
+	opts := verify.Options{
+		ExpectedSha256: config.Sha256Hash,
+		ExpectedMD5:    config.expectedMD5,
+		ImplantedMD5:   config.MD5Check,
+		Contents:       !config.NoVerify,
+		Manifests:      config.Manifests,
+		RootOnly:       config.RootOnly,
+		MaxDepth:       config.MaxDepth,
+		Strict:         config.Strict,
+		FIPS:           config.FIPS,
+		WholeDevice:    config.WholeDevice,
+		Offset:         config.Offset,
+		Length:         config.Length,
+		Progress:       cliProgress(config),
+	}
+	opts.AlternateSha256 = config.AlternateSha256
+	opts.ExpectedFromName = config.hashInName
+	opts.ExpectLabel = config.ExpectLabel
+	opts.LabelWarnOnly = config.LabelMismatch == "warn"
+	opts.ExpectSize = config.ExpectSize
+	opts.ScanDamage = config.ScanDamage
+	opts.Jigdo = config.Jigdo
+	opts.ESP = config.ESP
+	opts.BootConfig = config.BootConfig
+	opts.Kernels = config.Kernels || config.KernelSums != ""
+	opts.KernelSums = config.KernelSums
+	opts.HashSet = config.HashSet
+	opts.MaxRate = config.MaxRate
+	opts.FileTimeout = config.FileTimeout
+	opts.Jobs = config.Jobs
+	opts.Unordered = config.Unordered
+	if config.noRawAccess {
+		// Only the informational hash; an expected one still fails
+		opts.SkipImageHash = true
+	}
+	if config.audit != nil {
+		render := opts.Progress
+		opts.Progress = func(ev verify.Progress) {
+			render(ev)
+			config.audit.progress(ev)
+		}
+	}
+	if config.progressOut != nil {
+		render, records := opts.Progress, newJSONProgress(config.progressOut)
+		opts.Progress = func(ev verify.Progress) {
+			render(ev)
+			records.event(ev)
+		}
+	}
+
+	// Incremental runs reuse the hashes of unchanged files, and skip the
+	// informational whole-image hash that would read everything anyway
+	var cache *verify.Cache
+	if config.Incremental {
+		var err error
+		cache, err = loadCache()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v; verifying all files\n", err)
+		} else {
+			opts.Cache = cache
+			opts.SkipImageHash = true
+		}
+	}
+
+	// Signatures of checksum files are checked against a key from outside
+	// the media
+	key, created, err := trustedSigningKey(config)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return append(failures, err)
+	}
+	opts.SigningKey = key
+	opts.SigningKeyCreated = created
+
+	// A policy turns on the checks it needs results from
+	var pol *policy.Policy
+	if config.PolicyFile != "" {
+		var err error
+		pol, err = policy.Load(config.PolicyFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return append(failures, err)
+		}
+		pol.Apply(&opts)
+		if config.FIPS && opts.ImplantedMD5 {
+			err := fmt.Errorf("policy %s requires the implanted MD5, which is not available with -fips", config.PolicyFile)
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return append(failures, err)
+		}
+	}
+
+	// Ctrl+C cancels the run, and so may a -control client; cleanup such as
+	// unmounting still happens
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	if !config.deadline.IsZero() {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadlineCause(ctx, config.deadline, fmt.Errorf("the run took longer than -timeout %s", config.Timeout))
+		defer cancel()
+	}
+	if config.Control != "" {
+		var cancel context.CancelCauseFunc
+		ctx, cancel = context.WithCancelCause(ctx)
+		defer cancel(nil)
+		control, err := listenControl(config.Control, config.target.String(), cancel)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return append(failures, err)
+		}
+		config.control = control
+		render := opts.Progress
+		opts.Progress = func(ev verify.Progress) {
+			render(ev)
+			control.event(ev)
+		}
+	}
+
+	verifier := verify.New(opts)
+	result, err := verifier.Run(ctx, config.target)
+	if err != nil {
+		if cause := context.Cause(ctx); cause != nil {
+			err = cause
+		}
+		fmt.Fprintf(os.Stderr, "\nVerification cancelled: %v\n", err)
+		failures = append(failures, err)
+	}
+	config.result = result
+	// A partial or partition hash is not the image's hash, so keep it out
+	// of the history
+	if config.Offset == 0 && config.Length == 0 && config.Partition == 0 {
+		config.calculatedSha256 = result.Sha256
+	}
+	config.mountedISO = result.MountedISO
+	if result.MD5 != nil {
+		config.calculatedMD5 = result.MD5.CalculatedMD5
+	}
+	if cache != nil {
+		if err := cache.Save(); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: Could not save verification cache: %v\n", err)
+		}
+	}
+	failures = append(failures, result.Failures()...)
+
+	if pol != nil {
+		report := pol.Evaluate(result)
+		printPolicyReport(config, report)
+		failures = append(failures, report.Failures()...)
+	}
+
+	if config.WeakEvidence != "" && len(failures) == 0 && result.Evidence() == verify.EvidenceWeak {
+		failures = append(failures, checkWeakEvidence(config)...)
+	}
+	return failures
+}
+
+// errWeakEvidence is the failure -weak-evidence fail records.
+var errWeakEvidence = errors.New("only weak (MD5, CRC32 or file name hash) integrity evidence is available")
+
+// checkWeakEvidence explains a passing run whose only evidence is MD5-class
+// hashes and downgrades or fails it as -weak-evidence asks.
+func checkWeakEvidence(config *Config) []error {
+	fmt.Printf("\n--- %s ---\n", i18n.T("Evidence Strength"))
+	if config.hashInName {
+		fmt.Println("The expected SHA256 came from the image's own file name, which whoever named")
+		fmt.Println("the file chose: a match shows the image is intact, but not where it came from.")
+	} else {
+		fmt.Println("The only integrity evidence is the implanted MD5 or MD5/CRC32 checksum files.")
+		fmt.Println("These detect accidental corruption, but not deliberate tampering: MD5 collisions")
+		fmt.Println("can be constructed.")
+	}
+	fmt.Println("Verify against an expected SHA256 from a trusted source for stronger evidence.")
+	if config.WeakEvidence == "fail" {
+		fmt.Printf("\033[31m%s\033[0m\n", i18n.T("Result: FAILURE - Only weak verification evidence is available."))
+		return []error{errWeakEvidence}
+	}
+	if config.hashInName {
+		fmt.Printf("\033[33m%s\033[0m\n", i18n.T("Result: WEAK VERIFICATION - Passed on a hash from the file name only."))
+	} else {
+		fmt.Printf("\033[33m%s\033[0m\n", i18n.T("Result: WEAK VERIFICATION - Passed on MD5-class evidence only."))
+	}
+	config.weak = true
+	config.result.Warnings = append(config.result.Warnings, "Weak verification: "+errWeakEvidence.Error())
+	return nil
+}
+
+// loadCache opens the per-file hash cache used by -incremental.
+func loadCache() (*verify.Cache, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return nil, err
+	}
+	return verify.LoadCache(filepath.Join(dir, "chkiso", CACHE_FILE))
 }
 
 func parseFlags() *Config {
 	config := &Config{}
-	
+
 	// Manual argument parsing for better flexibility
 	var args []string
 	i := 1
 	for i < len(os.Args) {
 		arg := os.Args[i]
-		
+
 		switch {
 		case arg == "-version" || arg == "--version":
 			fmt.Printf("chkiso version %s\n", VERSION)
 			fmt.Printf("Platform: %s/%s\n", runtime.GOOS, runtime.GOARCH)
+			fmt.Printf("Hashing instructions: %s\n", hwhash.Describe())
 			os.Exit(0)
 		case arg == "-help" || arg == "--help" || arg == "-h":
 			printUsage()
 			os.Exit(0)
-		case arg == "-sha256" || arg == "--sha256" || arg == "-sha256sum" || arg == "--sha256sum" || arg == "-sha" || arg == "--sha":
-			if i+1 < len(os.Args) {
-				config.Sha256Hash = os.Args[i+1]
-				i += 2
-			} else {
-				fmt.Fprintf(os.Stderr, "Error: %s requires an argument\n", arg)
+		case arg == "-history" || arg == "--history":
+			if err := runHistory(nil); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 				os.Exit(1)
 			}
+			os.Exit(0)
+		case arg == "-sha256" || arg == "--sha256" || arg == "-sha256sum" || arg == "--sha256sum" || arg == "-sha" || arg == "--sha":
+			config.addSha256(flagValue(i))
+			i += 2
 		case arg == "-shafile" || arg == "--shafile":
-			if i+1 < len(os.Args) {
-				config.ShaFile = os.Args[i+1]
-				i += 2
-			} else {
-				fmt.Fprintf(os.Stderr, "Error: %s requires an argument\n", arg)
-				os.Exit(1)
-			}
+			config.ShaFile = flagValue(i)
+			i += 2
+		case arg == "-sha256-stdin" || arg == "--sha256-stdin":
+			config.Sha256Stdin = true
+			i++
+		case arg == "-sha256-file" || arg == "--sha256-file":
+			config.Sha256File = flagValue(i)
+			i += 2
 		case arg == "-noverify" || arg == "--noverify":
 			config.NoVerify = true
 			i++
@@ -123,44 +710,601 @@ func parseFlags() *Config {
 		case arg == "-dismount" || arg == "--dismount" || arg == "-eject" || arg == "--eject":
 			config.Dismount = true
 			i++
+		case arg == "-nohistory" || arg == "--nohistory":
+			config.NoHistory = true
+			i++
+		case arg == "-stamp" || arg == "--stamp":
+			config.Stamp = true
+			i++
+		case arg == "-no-sidecar" || arg == "--no-sidecar":
+			config.NoSidecar = true
+			i++
+		case arg == "-fetch-checksum" || arg == "--fetch-checksum":
+			config.FetchChecksum = true
+			i++
+		case arg == "-jigdo" || arg == "--jigdo":
+			config.Jigdo = flagValue(i)
+			i += 2
+		case arg == "-esp" || arg == "--esp":
+			config.ESP = true
+			i++
+		case arg == "-boot-config" || arg == "--boot-config":
+			config.BootConfig = true
+			i++
+		case arg == "-kernels" || arg == "--kernels":
+			config.Kernels = true
+			i++
+		case arg == "-kernel-sums" || arg == "--kernel-sums":
+			config.KernelSums = flagValue(i)
+			i += 2
+		case arg == "-hashset" || arg == "--hashset" || arg == "-nsrl" || arg == "--nsrl":
+			config.HashSet = flagValue(i)
+			i += 2
+		case arg == "-manifest" || arg == "--manifest":
+			config.Manifests = append(config.Manifests, flagValue(i))
+			i += 2
+		case arg == "-strict" || arg == "--strict":
+			config.Strict = true
+			i++
+		case arg == "-offset" || arg == "--offset" || arg == "-length" || arg == "--length":
+			// Base prefixes are accepted, e.g. 0x8000
+			n, err := strconv.ParseInt(flagValue(i), 0, 64)
+			if err != nil || n < 0 {
+				fmt.Fprintf(os.Stderr, "Error: %s requires a non-negative number of bytes\n", arg)
+				os.Exit(1)
+			}
+			if strings.HasSuffix(arg, "offset") {
+				config.Offset = n
+			} else {
+				config.Length = n
+			}
+			i += 2
+		case arg == "-partition" || arg == "--partition":
+			n, err := strconv.Atoi(flagValue(i))
+			if err != nil || n < 1 {
+				fmt.Fprintf(os.Stderr, "Error: %s requires a partition number (1 or more)\n", arg)
+				os.Exit(1)
+			}
+			config.Partition = n
+			i += 2
+		case arg == "-whole-device" || arg == "--whole-device":
+			config.WholeDevice = true
+			i++
+		case arg == "-fips" || arg == "--fips":
+			config.FIPS = true
+			i++
+		case arg == "-weak-evidence" || arg == "--weak-evidence":
+			config.WeakEvidence = flagValue(i)
+			if config.WeakEvidence != "warn" && config.WeakEvidence != "fail" {
+				fmt.Fprintf(os.Stderr, "Error: %s must be warn or fail\n", arg)
+				os.Exit(1)
+			}
+			i += 2
+		case arg == "-expect-label" || arg == "--expect-label":
+			config.ExpectLabel = flagValue(i)
+			i += 2
+		case arg == "-scan-damage" || arg == "--scan-damage":
+			config.ScanDamage = true
+			i++
+		case arg == "-source" || arg == "--source":
+			config.Source = flagValue(i)
+			i += 2
+		case arg == "-wait-for-disc" || arg == "--wait-for-disc":
+			config.WaitForDisc = true
+			i++
+		case arg == "-expect-size" || arg == "--expect-size":
+			size, err := parseSize(flagValue(i))
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %s: %v\n", arg, err)
+				os.Exit(1)
+			}
+			config.ExpectSize = size
+			i += 2
+		case arg == "-label-mismatch" || arg == "--label-mismatch":
+			config.LabelMismatch = flagValue(i)
+			if config.LabelMismatch != "warn" && config.LabelMismatch != "fail" {
+				fmt.Fprintf(os.Stderr, "Error: %s must be warn or fail\n", arg)
+				os.Exit(1)
+			}
+			i += 2
+		case arg == "-audit-log" || arg == "--audit-log":
+			config.AuditLog = flagValue(i)
+			i += 2
+		case arg == "-pause" || arg == "--pause":
+			config.Pause = true
+			i++
+		case arg == "-background" || arg == "--background":
+			config.Background = true
+			i++
+		case arg == "-max-rate" || arg == "--max-rate":
+			rate, err := parseRate(flagValue(i))
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %s: %v\n", arg, err)
+				os.Exit(1)
+			}
+			config.MaxRate = rate
+			i += 2
+		case arg == "-jobs" || arg == "--jobs":
+			n, err := strconv.Atoi(flagValue(i))
+			if err != nil || n < 1 {
+				fmt.Fprintf(os.Stderr, "Error: %s requires a number of files (1 or more)\n", arg)
+				os.Exit(1)
+			}
+			config.Jobs = n
+			i += 2
+		case arg == "-unordered" || arg == "--unordered":
+			config.Unordered = true
+			i++
+		case arg == "-timeout" || arg == "--timeout":
+			config.Timeout = durationFlag(i)
+			i += 2
+		case arg == "-file-timeout" || arg == "--file-timeout":
+			config.FileTimeout = durationFlag(i)
+			i += 2
+		case arg == "-progress" || arg == "--progress":
+			config.Progress = flagValue(i)
+			i += 2
+		case strings.HasPrefix(arg, "-progress=") || strings.HasPrefix(arg, "--progress="):
+			config.Progress = arg[strings.Index(arg, "=")+1:]
+			i++
+		case arg == "-progress-fd" || arg == "--progress-fd":
+			fd, err := strconv.Atoi(flagValue(i))
+			if err != nil || fd < 0 {
+				fmt.Fprintf(os.Stderr, "Error: %s requires a file descriptor number\n", arg)
+				os.Exit(1)
+			}
+			config.ProgressFD = fd
+			i += 2
+		case arg == "-control" || arg == "--control":
+			config.Control = flagValue(i)
+			i += 2
+		case arg == "-json" || arg == "--json":
+			config.JSON = true
+			i++
+		case arg == "-summary-only" || arg == "--summary-only":
+			config.SummaryOnly = true
+			i++
+		case arg == "-result-file" || arg == "--result-file":
+			config.ResultFile = flagValue(i)
+			i += 2
+		case arg == "-result-fd" || arg == "--result-fd":
+			fd, err := strconv.Atoi(flagValue(i))
+			if err != nil || fd < 3 {
+				fmt.Fprintf(os.Stderr, "Error: %s requires a file descriptor number of 3 or more\n", arg)
+				os.Exit(1)
+			}
+			config.ResultFD = fd
+			i += 2
+		case arg == "-lang" || arg == "--lang":
+			config.Lang = flagValue(i)
+			i += 2
+		case arg == "-notify" || arg == "--notify":
+			config.Notify = true
+			i++
+		case arg == "-notify-after" || arg == "--notify-after":
+			config.Notify = true
+			config.NotifyAfter = durationFlag(i)
+			i += 2
+		case arg == "-show-report" || arg == "--show-report":
+			config.ShowReport = true
+			i++
+		case arg == "-report" || arg == "--report":
+			config.ReportFile = flagValue(i)
+			i += 2
+		case arg == "-dfxml" || arg == "--dfxml":
+			config.DFXMLFile = flagValue(i)
+			i += 2
+		case arg == "-tsa" || arg == "--tsa":
+			config.TSA = flagValue(i)
+			i += 2
+		case arg == "-db" || arg == "--db":
+			config.Database = flagValue(i)
+			i += 2
+		case arg == "-catalog" || arg == "--catalog":
+			config.Catalog = flagValue(i)
+			i += 2
+		case arg == "-vt" || arg == "--vt":
+			config.VirusTotal = true
+			i++
+		case arg == "-incremental" || arg == "--incremental":
+			config.Incremental = true
+			i++
+		case arg == "-policy" || arg == "--policy":
+			config.PolicyFile = flagValue(i)
+			i += 2
+		case arg == "-pubkey" || arg == "--pubkey":
+			config.PublicKey = flagValue(i)
+			i += 2
+		case arg == "-pubkey-created" || arg == "--pubkey-created":
+			config.PublicKeyCreated = flagValue(i)
+			i += 2
+		case arg == "-rootonly" || arg == "--rootonly":
+			config.RootOnly = true
+			i++
+		case arg == "-maxdepth" || arg == "--maxdepth":
+			depth, err := strconv.Atoi(flagValue(i))
+			if err != nil || depth < 0 {
+				fmt.Fprintf(os.Stderr, "Error: %s requires a non-negative number\n", arg)
+				os.Exit(1)
+			}
+			// -maxdepth 0 means the root only, as with find(1); a larger
+			// depth leaves -rootonly, given before or after it, in force
+			config.MaxDepth = depth
+			if depth == 0 {
+				config.RootOnly = true
+			}
+			i += 2
 		default:
 			// Positional argument
 			args = append(args, arg)
 			i++
 		}
 	}
-	
+
 	if len(args) < 1 {
 		fmt.Fprintf(os.Stderr, "Error: path argument is required\n\n")
 		printUsage()
 		os.Exit(1)
 	}
-	
+
+	if config.VirusTotal && os.Getenv(virusTotalKeyVar) == "" {
+		fmt.Fprintf(os.Stderr, "Error: -vt needs a VirusTotal API key in the %s environment variable\n", virusTotalKeyVar)
+		os.Exit(1)
+	}
+	if config.TSA != "" && config.ReportFile == "" {
+		fmt.Fprintf(os.Stderr, "Error: -tsa requires -report\n")
+		os.Exit(1)
+	}
+	if config.ResultFile != "" && config.ResultFD != 0 {
+		fmt.Fprintf(os.Stderr, "Error: give either -result-file or -result-fd\n")
+		os.Exit(1)
+	}
+	if config.ResultFD != 0 {
+		if _, err := os.NewFile(uintptr(config.ResultFD), "").Stat(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: -result-fd %d is not open: %v\n", config.ResultFD, err)
+			os.Exit(1)
+		}
+	}
+	if config.ResultFile != "" || config.ResultFD != 0 || config.ShowReport || config.Notify {
+		config.verdicts = &[]TargetVerdict{}
+	}
+	if config.Lang != "" {
+		if err := i18n.Select(config.Lang); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	} else {
+		// A locale chkiso has no catalog for leaves the verdicts in English
+		i18n.Select(i18n.Detect())
+	}
+	if config.SummaryOnly && config.JSON {
+		fmt.Fprintf(os.Stderr, "Error: -summary-only cannot be used with -json\n")
+		os.Exit(1)
+	}
+	if config.Unordered && config.Jobs < 2 {
+		fmt.Fprintf(os.Stderr, "Error: -unordered needs -jobs 2 or more\n")
+		os.Exit(1)
+	}
+	if config.FIPS && config.MD5Check {
+		fmt.Fprintf(os.Stderr, "Error: -md5 cannot be used with -fips; MD5 is not FIPS approved\n")
+		os.Exit(1)
+	}
+
 	config.Path = args[0]
-	
-	// Support positional sha256 hash (second argument)
-	if len(args) >= 2 && config.Sha256Hash == "" {
-		config.Sha256Hash = args[1]
+
+	// Support positional sha256 hashes (second argument on)
+	for _, hash := range args[1:] {
+		config.addSha256(hash)
+	}
+
+	if config.FetchChecksum && (config.Sha256Hash != "" || config.ShaFile != "" || config.Sha256Stdin || config.Sha256File != "") {
+		fmt.Fprintf(os.Stderr, "Error: -fetch-checksum cannot be used with an expected hash or hash file\n")
+		os.Exit(1)
+	}
+
+	switch {
+	case config.Progress == "json":
+		if config.JSON && config.ProgressFD == 1 {
+			fmt.Fprintf(os.Stderr, "Error: -progress-fd 1 cannot be used with -json, which writes the report to stdout\n")
+			os.Exit(1)
+		}
+		out, err := openProgressOutput(config.ProgressFD)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		config.progressOut = out
+	case config.Progress != "":
+		fmt.Fprintf(os.Stderr, "Error: unknown -progress format %q (use json)\n", config.Progress)
+		os.Exit(1)
+	case config.ProgressFD != 0:
+		fmt.Fprintf(os.Stderr, "Error: -progress-fd needs -progress json\n")
+		os.Exit(1)
+	}
+
+	if config.Source != "" && (config.Sha256Hash != "" || config.ShaFile != "" || config.Sha256Stdin || config.Sha256File != "") {
+		fmt.Fprintf(os.Stderr, "Error: -source supplies the expected hash; do not also give one with -sha256, -shafile, -sha256-stdin or -sha256-file\n")
+		os.Exit(1)
+	}
+
+	// Hashes read from stdin or a file stay out of shell history and
+	// process listings
+	if config.Sha256Stdin || config.Sha256File != "" {
+		if config.Sha256Hash != "" || config.ShaFile != "" || (config.Sha256Stdin && config.Sha256File != "") {
+			fmt.Fprintf(os.Stderr, "Error: give the expected hash only once (-sha256, -shafile, -sha256-stdin or -sha256-file)\n")
+			os.Exit(1)
+		}
+		if config.Sha256Stdin && config.Pause {
+			fmt.Fprintf(os.Stderr, "Error: -sha256-stdin cannot be used with -pause, which also reads standard input\n")
+			os.Exit(1)
+		}
+		var hash string
+		var err error
+		if config.Sha256Stdin {
+			hash, err = readExpectedHash(os.Stdin, "standard input")
+		} else {
+			f, openErr := os.Open(config.Sha256File)
+			if openErr != nil {
+				err = fmt.Errorf("could not read the expected hash: %v", openErr)
+			} else {
+				hash, err = readExpectedHash(f, config.Sha256File)
+				f.Close()
+			}
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		config.Sha256Hash = hash
 	}
-	
+
 	return config
 }
 
+// addSha256 accepts the comma-separated hashes in value, any of which the
+// target may match. The first becomes the expected hash.
+func (config *Config) addSha256(value string) {
+	for _, hash := range strings.Split(value, ",") {
+		if hash = strings.TrimSpace(hash); hash == "" {
+			continue
+		}
+		if config.Sha256Hash == "" {
+			config.Sha256Hash = hash
+		} else {
+			config.AlternateSha256 = append(config.AlternateSha256, hash)
+		}
+	}
+}
+
+// readExpectedHash reads an expected SHA256 from r: the first word, so that
+// a line of sha256sum output works as well as a bare digest.
+func readExpectedHash(r io.Reader, source string) (string, error) {
+	data, err := io.ReadAll(io.LimitReader(r, 64*1024))
+	if err != nil {
+		return "", fmt.Errorf("could not read the expected hash from %s: %v", source, err)
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return "", fmt.Errorf("no expected hash in %s", source)
+	}
+	hash := strings.ToLower(fields[0])
+	if len(hash) != 64 || strings.Trim(hash, "0123456789abcdef") != "" {
+		return "", fmt.Errorf("%s does not start with a SHA256 hash (64 hexadecimal digits)", source)
+	}
+	return hash, nil
+}
+
+// parseRate parses a -max-rate value: bytes per second, optionally with a
+// K, M or G suffix for KiB, MiB or GiB, such as 500K or 20M. A trailing
+// "B", "iB" or "/s" is allowed, so 20MiB/s works as well.
+func parseRate(s string) (int64, error) {
+	value, multiplier := byteSuffix(strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(s)), "/S"))
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil || number <= 0 {
+		return 0, fmt.Errorf("invalid rate %q (use bytes per second, or a number with K, M or G such as 20M)", s)
+	}
+	rate := int64(number * float64(multiplier))
+	if rate < 1 {
+		return 0, fmt.Errorf("rate %q is less than one byte per second", s)
+	}
+	return rate, nil
+}
+
+// parseSize parses an -expect-size value: a whole number of bytes,
+// optionally with a K, M or G suffix for KiB, MiB or GiB, such as 4G.
+func parseSize(s string) (int64, error) {
+	value, multiplier := byteSuffix(strings.ToUpper(strings.TrimSpace(s)))
+	number, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || number <= 0 || number > math.MaxInt64/multiplier {
+		return 0, fmt.Errorf("invalid size %q (use bytes, or a whole number with K, M or G such as 4G)", s)
+	}
+	return number * multiplier, nil
+}
+
+// byteSuffix removes a trailing "B" or "iB" and a K, M or G suffix from an
+// upper case value, and returns the number left with the multiplier the
+// suffix stands for.
+func byteSuffix(value string) (string, int64) {
+	value = strings.TrimSuffix(strings.TrimSuffix(value, "B"), "I")
+	multiplier := int64(1)
+	if n := len(value); n > 0 {
+		switch value[n-1] {
+		case 'K':
+			multiplier = 1 << 10
+		case 'M':
+			multiplier = 1 << 20
+		case 'G':
+			multiplier = 1 << 30
+		}
+		if multiplier > 1 {
+			value = value[:n-1]
+		}
+	}
+	return value, multiplier
+}
+
+// timeoutGrace is how long a run may take to stop after -timeout, for
+// example to unmount an image, before chkiso exits without it.
+const timeoutGrace = 10 * time.Second
+
+// startWatchdog exits chkiso if it is still running timeoutGrace after
+// -timeout. The run is cancelled when the timeout passes, but a call
+// blocked in the operating system, such as opening a file on a share that
+// no longer answers, cannot be interrupted.
+func startWatchdog(timeout time.Duration) *time.Timer {
+	return time.AfterFunc(timeout+timeoutGrace, func() {
+		fmt.Fprintf(os.Stderr, "\nError: the run took longer than -timeout %s and did not stop; exiting\n", timeout)
+		os.Exit(1)
+	})
+}
+
+// durationFlag returns the duration following the flag at os.Args[i], such
+// as 90s, 30m or 2h, exiting with an error if it is missing or invalid.
+func durationFlag(i int) time.Duration {
+	d, err := time.ParseDuration(flagValue(i))
+	if err != nil || d <= 0 {
+		fmt.Fprintf(os.Stderr, "Error: %s requires a duration such as 90s, 30m or 2h\n", os.Args[i])
+		os.Exit(1)
+	}
+	return d
+}
+
+// flagValue returns the argument following the flag at os.Args[i],
+// exiting with an error if it is missing.
+func flagValue(i int) string {
+	if i+1 >= len(os.Args) {
+		fmt.Fprintf(os.Stderr, "Error: %s requires an argument\n", os.Args[i])
+		os.Exit(1)
+	}
+	return os.Args[i+1]
+}
+
 func printUsage() {
 	fmt.Fprintf(os.Stderr, "chkiso - ISO/Drive Verification Tool v%s\n\n", VERSION)
-	fmt.Fprintf(os.Stderr, "Usage: chkiso [options] <path> [sha256-hash]\n\n")
+	fmt.Fprintf(os.Stderr, "Usage: chkiso [options] <path> [sha256-hash...]\n")
+	fmt.Fprintf(os.Stderr, "       chkiso <command> [arguments]\n\n")
 	fmt.Fprintf(os.Stderr, "Arguments:\n")
-	fmt.Fprintf(os.Stderr, "  path          Path to ISO file or drive letter (e.g., /path/to/image.iso or E:)\n")
-	fmt.Fprintf(os.Stderr, "  sha256-hash   Optional SHA256 hash for verification (positional)\n\n")
+	fmt.Fprintf(os.Stderr, "  path          Path to ISO file, drive, device or directory (e.g., image.iso, E:, /dev/sr0 or /mnt/usb),\n")
+	fmt.Fprintf(os.Stderr, "                or a checksum file listing images in the same folder\n")
+	fmt.Fprintf(os.Stderr, "  sha256-hash   Optional SHA256 hashes for verification (positional; any may match)\n\n")
+	fmt.Fprintf(os.Stderr, "Commands:\n")
+	fmt.Fprintf(os.Stderr, "  history [-db <file>] [-target <path>] [-failed] [-limit <n>]\n")
+	fmt.Fprintf(os.Stderr, "                      List recorded verifications\n")
+	fmt.Fprintf(os.Stderr, "  check-report <file> Check a timestamped report for modifications\n")
+	fmt.Fprintf(os.Stderr, "  catalog add|import|list|remove [arguments]\n")
+	fmt.Fprintf(os.Stderr, "                      Maintain the local catalog of known-good image hashes\n")
+	fmt.Fprintf(os.Stderr, "  identify <image> [-feed <file|url>]... [-no-feeds]\n")
+	fmt.Fprintf(os.Stderr, "                      Tell what an image is by looking its hash up in the catalog and feeds\n")
+	fmt.Fprintf(os.Stderr, "  schedule <dir> [-every hourly|daily|weekly] [-at HH:MM] [-webhook <url>] [-background] [-install]\n")
+	fmt.Fprintf(os.Stderr, "                      Periodically re-verify the images listed in a directory's checksum files\n")
+	fmt.Fprintf(os.Stderr, "  rip <drive|device> <output.iso> [-sha256 <hash>] [-force]\n")
+	fmt.Fprintf(os.Stderr, "                      Copy a disc to an ISO file, checking its hashes in the same read\n")
+	fmt.Fprintf(os.Stderr, "  write <image> <device> [-sha256 <hash>] [-yes]\n")
+	fmt.Fprintf(os.Stderr, "                      Write an image to a USB stick or disk and read it back to check it\n")
+	fmt.Fprintf(os.Stderr, "  bundle <staging-dir> [-key <file>] [-exe <file>]... [-label <text>]\n")
+	fmt.Fprintf(os.Stderr, "                      Add signed checksums, chkiso and an autorun.inf to media being prepared\n")
+	fmt.Fprintf(os.Stderr, "  create-manifest <dir|image> [-o <file>] [-hashes <list>]\n")
+	fmt.Fprintf(os.Stderr, "                      Write a chkiso.json manifest with sizes, times, hashes and a tree hash\n")
+	fmt.Fprintf(os.Stderr, "  extract-esp <image> -o <file>\n")
+	fmt.Fprintf(os.Stderr, "                      Copy the EFI System Partition of a hybrid ISO or disk image to a file\n")
+	fmt.Fprintf(os.Stderr, "  stamps <file|dir>...\n")
+	fmt.Fprintf(os.Stderr, "                      Show which files -stamp marked as verified, and which changed since\n")
+	fmt.Fprintf(os.Stderr, "  drives              List optical and removable drives that can be verified\n")
+	fmt.Fprintf(os.Stderr, "  bench [path] [-size <MiB>]\n")
+	fmt.Fprintf(os.Stderr, "                      Measure read throughput of a target and hash throughput of this CPU\n")
+	fmt.Fprintf(os.Stderr, "  entropy <image> [-regions <n>]\n")
+	fmt.Fprintf(os.Stderr, "                      Map the entropy of an image's regions, showing padding and zero-filled tails\n")
+	fmt.Fprintf(os.Stderr, "  dedupe <dir>        Find images with the same contents in a directory tree\n")
+	fmt.Fprintf(os.Stderr, "  compare-tree <dirA|image> <dirB|image>\n")
+	fmt.Fprintf(os.Stderr, "                      Compare the files of two directory trees or images, e.g. an ISO\n")
+	fmt.Fprintf(os.Stderr, "                      and the directory it was mastered from\n")
+	fmt.Fprintf(os.Stderr, "  compare-iso <imageA> <imageB>\n")
+	fmt.Fprintf(os.Stderr, "                      Tell whether two ISO images are functionally identical, ignoring\n")
+	fmt.Fprintf(os.Stderr, "                      timestamps and other metadata that change with every build\n")
+	fmt.Fprintf(os.Stderr, "  self-check          Check this executable against its release signature\n")
+	fmt.Fprintf(os.Stderr, "  associate [-remove] Open .sha/.sha256 files with chkiso (Windows)\n")
+	fmt.Fprintf(os.Stderr, "  powershell-module <dir>\n")
+	fmt.Fprintf(os.Stderr, "                      Write the ChkIso PowerShell module\n\n")
 	fmt.Fprintf(os.Stderr, "Options:\n")
-	fmt.Fprintf(os.Stderr, "  -sha256 <hash>      Expected SHA256 hash for verification\n")
+	fmt.Fprintf(os.Stderr, "  -sha256 <hash>      Expected SHA256 hash for verification; repeat it or separate\n")
+	fmt.Fprintf(os.Stderr, "                      hashes with commas to accept any of several\n")
 	fmt.Fprintf(os.Stderr, "  -sha256sum <hash>   Alias for -sha256\n")
 	fmt.Fprintf(os.Stderr, "  -sha <hash>         Alias for -sha256\n")
 	fmt.Fprintf(os.Stderr, "  -shafile <file>     Path to SHA256 hash file\n")
+	fmt.Fprintf(os.Stderr, "  -sha256-stdin       Read the expected SHA256 from standard input\n")
+	fmt.Fprintf(os.Stderr, "  -sha256-file <file> Read the expected SHA256 from a file holding just the hash\n")
+	fmt.Fprintf(os.Stderr, "  -fetch-checksum     Download the official checksums of a recognized Ubuntu, Debian,\n")
+	fmt.Fprintf(os.Stderr, "                      Fedora or Rocky Linux image and verify against them\n")
+	fmt.Fprintf(os.Stderr, "  -no-sidecar         Do not use hash files found next to the image or a hash in its name\n")
 	fmt.Fprintf(os.Stderr, "  -noverify           Skip verifying internal file hashes\n")
 	fmt.Fprintf(os.Stderr, "  -md5                Enable implanted MD5 check\n")
+	fmt.Fprintf(os.Stderr, "  -offset <bytes>     Hash only from this byte offset of the file or device\n")
+	fmt.Fprintf(os.Stderr, "  -length <bytes>     Hash only this many bytes (with -offset, or from the start)\n")
+	fmt.Fprintf(os.Stderr, "  -expect-label <label>\n")
+	fmt.Fprintf(os.Stderr, "                      Fail before hashing if the volume label differs (wrong disc)\n")
+	fmt.Fprintf(os.Stderr, "  -label-mismatch <warn|fail>\n")
+	fmt.Fprintf(os.Stderr, "                      Only warn about a different label, or fail (the default)\n")
+	fmt.Fprintf(os.Stderr, "  -expect-size <size> Fail before hashing if the image is not this many bytes (K, M or G suffix)\n")
+	fmt.Fprintf(os.Stderr, "  -scan-damage        While hashing, report long runs of zeros or repeated sectors\n")
+	fmt.Fprintf(os.Stderr, "  -source <image>     Verify the media against the SHA256 of the image it was burned from\n")
+	fmt.Fprintf(os.Stderr, "  -wait-for-disc      Wait for a disc (with the -source image's label) in the drive, then verify it\n")
+	fmt.Fprintf(os.Stderr, "  -jigdo <file>       Verify a reconstructed image against a .jigdo file and its template\n")
+	fmt.Fprintf(os.Stderr, "  -esp                List and hash the files of the EFI System Partition, checking its boot loaders\n")
+	fmt.Fprintf(os.Stderr, "  -boot-config        Check that the kernels, initrds and modules that isolinux, GRUB or ESXi\n")
+	fmt.Fprintf(os.Stderr, "                      configuration files name are on the media and match their checksums\n")
+	fmt.Fprintf(os.Stderr, "  -kernels            List the kernels and initrds on the media with their sizes and hashes\n")
+	fmt.Fprintf(os.Stderr, "  -kernel-sums <file> Compare the kernels and initrds with published checksums (implies -kernels)\n")
+	fmt.Fprintf(os.Stderr, "  -hashset <file>     Tell which files on the media a reference hash set, such as the NSRL RDS,\n")
+	fmt.Fprintf(os.Stderr, "                      lists as known software (also -nsrl)\n")
+	fmt.Fprintf(os.Stderr, "  -partition <n>      Verify only partition n of a raw disk image (.img)\n")
+	fmt.Fprintf(os.Stderr, "  -whole-device       Hash a whole drive, not just the ISO data area the disc declares\n")
+	fmt.Fprintf(os.Stderr, "  -manifest <path>    Verify this checksum file on the media instead of searching (repeatable)\n")
+	fmt.Fprintf(os.Stderr, "  -strict             Fail if no checksum files are found or nothing could be verified\n")
+	fmt.Fprintf(os.Stderr, "  -fips               Only use FIPS approved algorithms (SHA-256, SHA-512); disables MD5\n")
+	fmt.Fprintf(os.Stderr, "  -weak-evidence <warn|fail>\n")
+	fmt.Fprintf(os.Stderr, "                      Flag or fail runs whose only evidence is MD5 or CRC32\n")
+	fmt.Fprintf(os.Stderr, "  -incremental        Only re-hash files that changed since the last run\n")
+	fmt.Fprintf(os.Stderr, "  -policy <file>      Check the results against a verification policy file\n")
+	fmt.Fprintf(os.Stderr, "  -pubkey <key>       Check ed25519 signatures of checksum files (SHA256SUMS.sig) against this\n")
+	fmt.Fprintf(os.Stderr, "                      key, in hex or a PEM file; never use a key found on the media itself\n")
+	fmt.Fprintf(os.Stderr, "  -pubkey-created <date>\n")
+	fmt.Fprintf(os.Stderr, "                      When the -pubkey key was made (YYYY-MM-DD), for policies limiting its age\n")
+	fmt.Fprintf(os.Stderr, "  -rootonly           Only search the media root for checksum files\n")
+	fmt.Fprintf(os.Stderr, "  -maxdepth <n>       Search at most n directory levels below the root (0 = root only)\n")
 	fmt.Fprintf(os.Stderr, "  -dismount           Dismount/eject after verification\n")
 	fmt.Fprintf(os.Stderr, "  -eject              Alias for -dismount\n")
+	fmt.Fprintf(os.Stderr, "  -nohistory          Do not record this run in the verification history\n")
+	fmt.Fprintf(os.Stderr, "  -stamp              Record the verification in the verified files' extended attributes\n")
+	fmt.Fprintf(os.Stderr, "                      (alternate data streams on Windows); see chkiso stamps\n")
+	fmt.Fprintf(os.Stderr, "  -progress json      Write progress records as JSON lines to stderr\n")
+	fmt.Fprintf(os.Stderr, "  -progress-fd <n>    Write them to file descriptor n instead (not passed to an elevated rerun)\n")
+	fmt.Fprintf(os.Stderr, "  -control <socket>   Serve progress and accept \"cancel\" on a local socket during the run\n")
+	fmt.Fprintf(os.Stderr, "  -json               Print the results as JSON (see the PowerShell module)\n")
+	fmt.Fprintf(os.Stderr, "  -summary-only       Print only a line of path, SHA256 and PASSED or FAILED\n")
+	fmt.Fprintf(os.Stderr, "  -result-file <file> Write the final verdict as JSON to file\n")
+	fmt.Fprintf(os.Stderr, "  -result-fd <n>      Write it to file descriptor n instead (not passed to an elevated rerun)\n")
+	fmt.Fprintf(os.Stderr, "  -report <file>      Save a JSON report of the verification\n")
+	fmt.Fprintf(os.Stderr, "  -show-report        Open the verdict as a web page when the run is done\n")
+	fmt.Fprintf(os.Stderr, "  -notify             Show a desktop notification when a run of 30s or more is done\n")
+	fmt.Fprintf(os.Stderr, "  -notify-after <duration>\n")
+	fmt.Fprintf(os.Stderr, "                      Notify about runs that take at least this long instead, e.g. 5m\n")
+	fmt.Fprintf(os.Stderr, "  -lang <code>        Print verdicts in this language (de, en, es, fr) instead of the locale's\n")
+	fmt.Fprintf(os.Stderr, "  -dfxml <file>       Save the results as DFXML for digital forensics tools\n")
+	fmt.Fprintf(os.Stderr, "  -tsa <url>          Timestamp the saved report with an RFC 3161 authority\n")
+	fmt.Fprintf(os.Stderr, "  -audit-log <file>   Append a JSON record per verification event to file\n")
+	fmt.Fprintf(os.Stderr, "  -db <file>          Also record this run in a SQLite results database\n")
+	fmt.Fprintf(os.Stderr, "  -catalog <file>     Look the image up in this known-good catalog instead of the default one\n")
+	fmt.Fprintf(os.Stderr, "  -vt                 Look the image's SHA256 (never the image) up on VirusTotal; the API key\n")
+	fmt.Fprintf(os.Stderr, "                      is read from CHKISO_VT_API_KEY\n")
+	fmt.Fprintf(os.Stderr, "  -history            Display previously recorded verifications\n")
+	fmt.Fprintf(os.Stderr, "  -background         Run at low CPU and I/O priority\n")
+	fmt.Fprintf(os.Stderr, "  -max-rate <rate>    Read at most this many bytes per second (K, M or G suffix, e.g. 20M)\n")
+	fmt.Fprintf(os.Stderr, "  -jobs <n>           Hash up to n files on the media at once (results stay in listed order)\n")
+	fmt.Fprintf(os.Stderr, "  -unordered          With -jobs, print each file's result as soon as it is done\n")
+	fmt.Fprintf(os.Stderr, "  -timeout <duration> Fail the run if it takes longer, e.g. 2h\n")
+	fmt.Fprintf(os.Stderr, "  -file-timeout <duration>\n")
+	fmt.Fprintf(os.Stderr, "                      Fail a file on the media whose hash takes longer, e.g. 5m\n")
+	fmt.Fprintf(os.Stderr, "  -pause              Wait for Enter before exiting (used by the file association)\n")
 	fmt.Fprintf(os.Stderr, "  -version            Display version information\n")
 	fmt.Fprintf(os.Stderr, "  -help               Display this help information\n")
 	fmt.Fprintf(os.Stderr, "\nExamples:\n")
@@ -172,600 +1316,636 @@ func printUsage() {
 	fmt.Fprintf(os.Stderr, "  chkiso -noverify E:\n")
 }
 
-func validatePath(config *Config) error {
-	// Check if it's a drive letter (Windows style: E: or E:\)
-	if runtime.GOOS == "windows" {
-		drivePattern := regexp.MustCompile(`^([A-Za-z]):\\?$`)
-		if matches := drivePattern.FindStringSubmatch(config.Path); matches != nil {
-			config.isDrive = true
-			config.driveLetter = strings.ToUpper(matches[1])
-			// On Windows, we'll use device path for drive access
-			return nil
+// cliProgress renders verifier progress events as the familiar console output.
+func cliProgress(config *Config) verify.ProgressFunc {
+	return func(ev verify.Progress) {
+		switch ev.Phase {
+		case "begin":
+			printStepHeader(config, ev.Item)
+		case "end":
+			printStepResult(ev.Item, ev.Result)
+			if ev.Item == verify.StepSha256 && ev.Result.Err(ev.Item) == nil {
+				showKnownGood(config, ev.Result.Sha256)
+				if config.VirusTotal {
+					showVirusTotal(config, ev.Result.Sha256)
+				}
+			}
+			if ev.Item == verify.StepSha256 && config.ScanDamage {
+				printDamage(ev.Result.Damage)
+			}
+		case "info":
+			fmt.Println(ev.Item)
+		case "warning":
+			fmt.Fprintf(os.Stderr, "Warning: %s\n", ev.Item)
+		case "discovered":
+			contents := ev.Result.Contents
+			fmt.Printf("\nFound %d checksum file(s):\n", len(contents.ChecksumFiles))
+			for i, cf := range contents.ChecksumFiles {
+				fmt.Printf("  %d. %s\n", i+1, filepath.FromSlash(cf))
+			}
+		case "manifest":
+			fmt.Printf("\nProcessing checksum file: %s\n", filepath.Base(ev.Item))
+		case "contents":
+			printFileResult(ev)
 		}
 	}
-	
-	// Otherwise, treat as file path
-	info, err := os.Stat(config.Path)
-	if err != nil {
-		return fmt.Errorf("file not found: %s", config.Path)
-	}
-	if info.IsDir() {
-		return fmt.Errorf("path is a directory, not a file: %s", config.Path)
-	}
-	
-	// Resolve to absolute path
-	absPath, err := filepath.Abs(config.Path)
-	if err != nil {
-		return fmt.Errorf("failed to resolve path: %v", err)
-	}
-	config.Path = absPath
-	
-	return nil
 }
 
-func getSha256Hash(filePath string) (string, error) {
-	file, err := os.Open(filePath)
-	if err != nil {
-		return "", err
-	}
-	defer file.Close()
-	
-	hash := sha256.New()
-	if _, err := io.Copy(hash, file); err != nil {
-		return "", err
-	}
-	
-	return hex.EncodeToString(hash.Sum(nil)), nil
-}
-
-func getSha256FromPath(config *Config) (string, error) {
-	var reader io.Reader
-	var file *os.File
-	var err error
-	
-	if config.isDrive {
-		fmt.Printf("Calculating SHA256 hash for drive '%s:' (this can be slow)...\n", config.driveLetter)
-		// On Windows, use device path
-		if runtime.GOOS == "windows" {
-			devicePath := fmt.Sprintf("\\\\.\\%s:", config.driveLetter)
-			file, err = os.Open(devicePath)
+func printStepHeader(config *Config, step string) {
+	switch step {
+	case verify.StepLabel:
+		fmt.Printf("\n--- %s ---\n", i18n.T("Checking Volume Label"))
+	case verify.StepSize:
+		fmt.Printf("\n--- %s ---\n", i18n.T("Checking Size"))
+	case verify.StepSha256:
+		if len(config.AlternateSha256) > 0 {
+			fmt.Printf("\n--- %s ---\n", i18n.T("Verifying Path Against %d Accepted SHA256 Hashes", len(config.AlternateSha256)+1))
+		} else if config.Sha256Hash != "" {
+			fmt.Printf("\n--- %s ---\n", i18n.T("Verifying Path Against Provided SHA256 Hash"))
+		} else if config.expectedMD5 != "" {
+			fmt.Printf("\n--- %s ---\n", i18n.T("Verifying Path Against MD5 Hash File"))
 		} else {
-			return "", fmt.Errorf("drive letters are only supported on Windows")
+			fmt.Printf("\n--- %s ---\n", i18n.T("SHA256 Hash (Informational)"))
 		}
-	} else {
-		fmt.Printf("Calculating SHA256 hash for file '%s'...\n", filepath.Base(config.Path))
-		file, err = os.Open(config.Path)
+		if config.target.IsDrive {
+			fmt.Printf("Calculating SHA256 hash for drive '%s:' (this can be slow)...\n", config.target.DriveLetter)
+		} else if config.target.IsDevice {
+			fmt.Printf("Calculating SHA256 hash for device '%s' (this can be slow)...\n", config.target.Path)
+		} else if config.target.IsNRG() {
+			fmt.Printf("Calculating SHA256 hash for the data track of Nero image '%s'...\n", filepath.Base(config.target.ImagePath()))
+			if track, err := verify.NRGTrack(config.target); err == nil {
+				fmt.Printf("Track %d: %d-byte sectors at offset %d (only the 2048-byte user data is hashed)\n", track.Number, track.SectorSize, track.Offset)
+			}
+		} else if config.target.Partition > 0 {
+			fmt.Printf("Calculating SHA256 hash for partition %d of '%s'...\n", config.target.Partition, filepath.Base(config.target.ImagePath()))
+		} else if config.target.Compression != "" {
+			fmt.Printf("Calculating SHA256 hash for %s compressed image '%s' (decompressing as it is read)...\n",
+				config.target.Compression, filepath.Base(config.target.ImagePath()))
+		} else if parts := config.target.Parts; len(parts) > 0 {
+			fmt.Printf("Calculating SHA256 hash for split image '%s' (%d parts, %s to %s)...\n",
+				filepath.Base(config.target.Joined), len(parts), filepath.Base(parts[0]), filepath.Base(parts[len(parts)-1]))
+		} else {
+			fmt.Printf("Calculating SHA256 hash for file '%s'...\n", filepath.Base(config.target.Path))
+		}
+	case verify.StepMD5:
+		fmt.Printf("\n--- %s ---\n", i18n.T("Verifying Implanted ISO MD5 (checkisomd5 compatible)"))
+	case verify.StepDMG:
+		fmt.Printf("\n--- %s ---\n", i18n.T("Verifying Embedded DMG Checksums"))
+	case verify.StepWIM:
+		fmt.Printf("\n--- %s ---\n", i18n.T("Verifying WIM Integrity"))
+	case verify.StepJigdo:
+		fmt.Printf("\n--- %s ---\n", i18n.T("Verifying Against Jigdo Template"))
+		fmt.Printf("Jigdo file: %s\n", config.Jigdo)
+	case verify.StepESP:
+		fmt.Printf("\n--- %s ---\n", i18n.T("Verifying EFI System Partition"))
+	case verify.StepBoot:
+		fmt.Printf("\n--- %s ---\n", i18n.T("Checking Boot Loader Configuration"))
+	case verify.StepKernels:
+		fmt.Printf("\n--- %s ---\n", i18n.T("Checking Kernels and Initrds"))
+	case verify.StepHashSet:
+		fmt.Printf("\n--- %s ---\n", i18n.T("Checking Files Against the Reference Hash Set"))
+	case verify.StepContents:
+		fmt.Printf("\n--- %s ---\n", i18n.T("Verifying Contents"))
 	}
-	
-	if err != nil {
-		return "", err
-	}
-	defer file.Close()
-	
-	reader = file
-	hash := sha256.New()
-	if _, err := io.Copy(hash, reader); err != nil {
-		return "", err
-	}
-	
-	return hex.EncodeToString(hash.Sum(nil)), nil
-}
-
-func verifyPathAgainstHashString(config *Config) {
-	fmt.Println("\n--- Verifying Path Against Provided SHA256 Hash ---")
-	expectedHash := strings.ToLower(strings.TrimSpace(config.Sha256Hash))
-	
-	// Validate hash format (must be 64 hex characters)
-	if !regexp.MustCompile(`^[a-fA-F0-9]{64}$`).MatchString(expectedHash) {
-		fmt.Fprintf(os.Stderr, "Error: Invalid SHA256 hash format. Expected 64 hexadecimal characters.\n")
-		hasErrors = true
+}
+
+func printStepResult(step string, result *verify.Result) {
+	switch step {
+	case verify.StepLabel:
+		printLabelResult(result)
+		return
+	case verify.StepSize:
+		printSizeResult(result)
 		return
 	}
-	
-	calculatedHash, err := getSha256FromPath(config)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error calculating hash: %v\n", err)
-		hasErrors = true
+	if err := result.Err(step); err != nil {
+		switch step {
+		case verify.StepSha256:
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		case verify.StepMD5:
+			fmt.Fprintf(os.Stderr, "Error during MD5 check: %v\n", err)
+		case verify.StepDMG:
+			fmt.Fprintf(os.Stderr, "Error reading DMG: %v\n", err)
+		case verify.StepWIM:
+			fmt.Fprintf(os.Stderr, "Error reading WIM: %v\n", err)
+		case verify.StepJigdo:
+			fmt.Fprintf(os.Stderr, "Error during jigdo check: %v\n", err)
+		case verify.StepESP:
+			fmt.Fprintf(os.Stderr, "Error reading the EFI System Partition: %v\n", err)
+		case verify.StepBoot:
+			fmt.Fprintf(os.Stderr, "Error reading the boot loader configuration: %v\n", err)
+		case verify.StepKernels:
+			fmt.Fprintf(os.Stderr, "Error checking kernels and initrds: %v\n", err)
+		case verify.StepHashSet:
+			fmt.Fprintf(os.Stderr, "Error checking files against the hash set: %v\n", err)
+		default:
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		}
 		return
 	}
-	calculatedHash = strings.ToLower(calculatedHash)
-	
-	fmt.Printf("  - Expected:   %s\n", expectedHash)
-	fmt.Printf("  - Calculated: %s\n", calculatedHash)
-	
-	if calculatedHash == expectedHash {
-		fmt.Println("\033[32mResult: SUCCESS - Hashes match.\033[0m")
-	} else {
-		fmt.Println("\033[31mResult: FAILURE - Hashes DO NOT match.\033[0m")
-		hasErrors = true
+
+	switch step {
+	case verify.StepSha256:
+		if m := result.ImageMD5; m != nil {
+			fmt.Printf("SHA256: %s\n", result.Sha256)
+			fmt.Printf("  - Expected MD5:   %s\n", m.Expected)
+			fmt.Printf("  - Calculated MD5: %s\n", m.Calculated)
+			if m.Match {
+				fmt.Printf("\033[32m%s\033[0m\n", i18n.T("Result: SUCCESS - MD5 hashes match."))
+			} else {
+				fmt.Printf("\033[31m%s\033[0m\n", i18n.T("Result: FAILURE - MD5 hashes DO NOT match."))
+			}
+			return
+		}
+		if result.Hash == nil {
+			fmt.Printf("\033[33mSHA256: %s\033[0m\n", result.Sha256)
+			if result.CompressedSha256 != "" {
+				fmt.Printf("\033[33mSHA256 of the compressed file: %s\033[0m\n", result.CompressedSha256)
+			}
+			return
+		}
+		if candidates := result.Hash.Candidates; len(candidates) > 1 {
+			for i, c := range candidates {
+				fmt.Printf("  - Candidate %d: %s\n", i+1, c)
+			}
+		} else {
+			fmt.Printf("  - Expected:   %s\n", result.Hash.Expected)
+		}
+		fmt.Printf("  - Calculated: %s\n", result.Hash.Calculated)
+		if result.Hash.Compressed != "" {
+			fmt.Printf("  - Compressed: %s\n", result.Hash.Compressed)
+		}
+		if result.Hash.Match && len(result.Hash.Candidates) > 1 {
+			fmt.Printf("\033[32m%s\033[0m\n", i18n.T("Result: SUCCESS - Matches candidate %d of %d.", candidateIndex(result.Hash), len(result.Hash.Candidates)))
+		} else if result.Hash.Match {
+			fmt.Printf("\033[32m%s\033[0m\n", i18n.T("Result: SUCCESS - Hashes match."))
+		} else if len(result.Hash.Candidates) > 1 {
+			fmt.Printf("\033[31m%s\033[0m\n", i18n.T("Result: FAILURE - Hash matches none of the %d candidates.", len(result.Hash.Candidates)))
+		} else {
+			fmt.Printf("\033[31m%s\033[0m\n", i18n.T("Result: FAILURE - Hashes DO NOT match."))
+		}
+	case verify.StepMD5:
+		if result.MD5 == nil {
+			return
+		}
+		fmt.Printf("Verification Method: %s\n", result.MD5.VerificationMethod)
+		fmt.Printf("Stored MD5:          %s\n", result.MD5.StoredMD5)
+		fmt.Printf("Calculated MD5:      %s\n", result.MD5.CalculatedMD5)
+		if result.MD5.IsIntegrityOK {
+			fmt.Printf("\n\033[32m%s\033[0m\n", i18n.T("SUCCESS: Implanted MD5 is valid."))
+		} else {
+			fmt.Printf("\n\033[31m%s\033[0m\n", i18n.T("FAILURE: Implanted MD5 does not match calculated hash."))
+		}
+	case verify.StepDMG:
+		if result.DMG == nil {
+			return
+		}
+		for _, c := range result.DMG.Checks {
+			switch {
+			case c.Err != nil:
+				fmt.Printf("%-24s \033[31mERROR\033[0m (%v)\n", c.Name+":", c.Err)
+			case c.OK:
+				fmt.Printf("%-24s CRC32 %s \033[32mOK\033[0m\n", c.Name+":", c.Calculated)
+			default:
+				fmt.Printf("%-24s CRC32 %s, expected %s \033[31mFAILED\033[0m\n", c.Name+":", c.Calculated, c.Expected)
+			}
+		}
+		if result.DMG.Skipped > 0 {
+			fmt.Printf("Skipped %d checksum(s) that are empty or not CRC32.\n", result.DMG.Skipped)
+		}
+		switch {
+		case len(result.DMG.Checks) == 0:
+			fmt.Println("\033[33mThe DMG carries no CRC32 checksums to verify.\033[0m")
+		case result.DMG.OK():
+			fmt.Printf("\n\033[32m%s\033[0m\n", i18n.T("SUCCESS: All embedded DMG checksums are valid."))
+		default:
+			fmt.Printf("\n\033[31m%s\033[0m\n", i18n.T("FAILURE: Embedded DMG checksums do not match."))
+		}
+	case verify.StepWIM:
+		if result.WIM != nil {
+			printWIMResult(result.WIM)
+		}
+	case verify.StepJigdo:
+		if result.Jigdo != nil {
+			printJigdoResult(result.Jigdo)
+		}
+	case verify.StepESP:
+		if result.ESP != nil {
+			printESPResult(result.ESP)
+		}
+	case verify.StepBoot:
+		if result.Boot != nil {
+			printBootResult(result.Boot)
+		}
+	case verify.StepKernels:
+		if result.Kernels != nil {
+			printKernelResult(result.Kernels)
+		}
+	case verify.StepHashSet:
+		if result.HashSet != nil {
+			printHashSetResult(result.HashSet)
+		}
+	case verify.StepContents:
+		printContentSummary(result)
 	}
 }
 
-func verifyPathAgainstHashFile(config *Config) {
-	fmt.Println("\n--- Verifying Path Against SHA256 Hash File ---")
-	
-	content, err := os.ReadFile(config.ShaFile)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error reading hash file: %v\n", err)
-		hasErrors = true
+// printLabelResult shows the volume label checked with -expect-label. A
+// mismatch that -label-mismatch warn allows was already reported as a
+// warning.
+func printLabelResult(result *verify.Result) {
+	l := result.Label
+	if l == nil {
+		if err := result.Err(verify.StepLabel); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		}
 		return
 	}
-	
-	// Determine the filename pattern to search for
-	var isoFileNamePattern string
-	if config.isDrive {
-		isoFileNamePattern = ".*\\.iso"
-	} else {
-		isoFileNamePattern = regexp.QuoteMeta(filepath.Base(config.Path))
-	}
-	
-	// Try to find a hash entry matching the filename
-	pattern := fmt.Sprintf(`^([a-fA-F0-9]{64})\s+\*?\s*%s`, isoFileNamePattern)
-	re := regexp.MustCompile(pattern)
-	genericPattern := regexp.MustCompile(`^([a-fA-F0-9]{64})\s+\*?\s*.*`)
-	
-	lines := strings.Split(string(content), "\n")
-	var expectedHash string
-	
-	for _, line := range lines {
-		if matches := re.FindStringSubmatch(line); matches != nil {
-			expectedHash = strings.ToLower(matches[1])
-			break
-		}
-	}
-	
-	// If no specific match, try generic pattern (first hash in file)
-	if expectedHash == "" {
-		for _, line := range lines {
-			if matches := genericPattern.FindStringSubmatch(line); matches != nil {
-				expectedHash = strings.ToLower(matches[1])
-				break
-			}
-		}
+	fmt.Printf("  - Expected: %s\n", l.Expected)
+	fmt.Printf("  - Found:    %s\n", l.Found)
+	switch {
+	case l.Match:
+		fmt.Printf("\033[32m%s\033[0m\n", i18n.T("Result: SUCCESS - Volume label matches."))
+	case result.Err(verify.StepLabel) != nil:
+		fmt.Printf("\033[31m%s\033[0m\n", i18n.T("Result: FAILURE - Wrong media: the volume label does not match. Skipping the remaining checks."))
+	default:
+		fmt.Printf("\033[33m%s\033[0m\n", i18n.T("Result: MISMATCH - The volume label does not match; continuing."))
 	}
-	
-	if expectedHash == "" {
-		fmt.Fprintf(os.Stderr, "Error: Could not find a valid SHA256 hash entry in the hash file '%s'\n", config.ShaFile)
-		hasErrors = true
+}
+
+// printSizeResult shows the size checked with -expect-size.
+func printSizeResult(result *verify.Result) {
+	sz := result.Size
+	if sz == nil {
+		if err := result.Err(verify.StepSize); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		}
 		return
 	}
-	
-	config.Sha256Hash = expectedHash
-	verifyPathAgainstHashString(config)
+	fmt.Printf("  - Expected: %d bytes (%s)\n", sz.Expected, formatBytes(sz.Expected))
+	fmt.Printf("  - Found:    %d bytes (%s)\n", sz.Found, formatBytes(sz.Found))
+	switch {
+	case sz.Match():
+		fmt.Printf("\033[32m%s\033[0m\n", i18n.T("Result: SUCCESS - Size matches."))
+	case sz.Found < sz.Expected:
+		fmt.Printf("\033[31m%s\033[0m\n", i18n.T("Result: FAILURE - The image is %s short, probably a truncated download. Skipping the remaining checks.", formatBytes(sz.Expected-sz.Found)))
+	default:
+		fmt.Printf("\033[31m%s\033[0m\n", i18n.T("Result: FAILURE - The image is %s too large. Skipping the remaining checks.", formatBytes(sz.Found-sz.Expected)))
+	}
 }
 
-func displaySha256Hash(config *Config) {
-	fmt.Println("\n--- SHA256 Hash (Informational) ---")
-	calculatedHash, err := getSha256FromPath(config)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error calculating hash: %v\n", err)
-		hasErrors = true
+// printDamage lists the suspicious regions -scan-damage found.
+func printDamage(runs []verify.DamageRun) {
+	if len(runs) == 0 {
+		fmt.Println("No long runs of zero bytes or repeated sectors found.")
 		return
 	}
-	fmt.Printf("\033[33mSHA256: %s\033[0m\n", strings.ToLower(calculatedHash))
+	fmt.Printf("\n--- %s ---\n", i18n.T("Possibly Damaged Regions"))
+	for _, run := range runs {
+		what := "one sector repeated"
+		if run.Zeros {
+			what = "zero bytes"
+		}
+		fmt.Printf("  Offset %d (sector %d): %s of %s\n", run.Offset, run.Offset/2048, formatBytes(run.Length), what)
+	}
+	fmt.Println("\033[33mThese often mark where a bad burn or a failing drive lost data, but images may also hold them legitimately.\033[0m")
 }
 
-func verifyContents(config *Config) {
-	fmt.Println("\n--- Verifying Contents ---")
-	
-	var mountPath string
-	var needsCleanup bool
-	
-	if config.isDrive {
-		if runtime.GOOS == "windows" {
-			mountPath = fmt.Sprintf("%s:\\", config.driveLetter)
-			fmt.Printf("Verifying contents of physical drive at: %s\n", mountPath)
-		} else {
-			fmt.Fprintf(os.Stderr, "Error: Drive verification is only supported on Windows\n")
-			hasErrors = true
-			return
-		}
+func printWIMResult(w *wim.Result) {
+	h := w.Header
+	fmt.Printf("Version %#x, part %d of %d, %d image(s), compression: %s\n", h.Version, h.PartNumber, h.TotalParts, h.ImageCount, h.Compression)
+	if w.Integrity {
+		fmt.Printf("Integrity table: %d of %d chunks match\n", w.IntegrityChunks-w.IntegrityFailed, w.IntegrityChunks)
 	} else {
-		// For ISO files, try to mount them automatically on Windows
-		if runtime.GOOS == "windows" {
-			fmt.Printf("Mounting ISO: %s\n", config.Path)
-			driveLetter, err := mountISO(config.Path)
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "Failed to mount ISO automatically: %v\n", err)
-				fmt.Println("\nNote: For ISO files, please mount the ISO manually and verify using the mount point.")
-				fmt.Println("Example (Windows): Mount-DiskImage image.iso, then run: chkiso E:")
-				return
-			}
-			
-			config.mountedISO = true
-			config.mountedDriveLetter = driveLetter
-			needsCleanup = true
-			mountPath = fmt.Sprintf("%s:\\", driveLetter)
-			fmt.Printf("Mounted to drive: %s:\n", driveLetter)
-			
-			// Ensure cleanup happens even if verification fails
-			defer func() {
-				if needsCleanup && config.mountedISO {
-					fmt.Println("\nUnmounting ISO...")
-					if err := dismountISO(config.Path); err != nil {
-						fmt.Fprintf(os.Stderr, "Warning: Failed to unmount ISO: %v\n", err)
-						fmt.Printf("Please dismount manually using: Dismount-DiskImage -ImagePath '%s'\n", config.Path)
-					} else {
-						fmt.Println("ISO unmounted successfully.")
-						config.mountedISO = false
-					}
-				}
-			}()
+		fmt.Println("\033[33mNo integrity table (the WIM was captured without /CheckIntegrity).\033[0m")
+	}
+	fmt.Printf("Resources: %d listed, %d hashed, %d failed", w.Resources, w.ResourcesChecked, w.ResourcesFailed)
+	if skipped := w.Resources - w.ResourcesChecked - w.ResourcesFailed; skipped > 0 {
+		fmt.Printf(" (%d compressed resource(s) not decompressed)", skipped)
+	}
+	fmt.Println()
+	for _, problem := range w.Problems {
+		fmt.Printf("  \033[31m%s\033[0m\n", problem)
+	}
+	switch {
+	case !w.OK():
+		fmt.Printf("\n\033[31m%s\033[0m\n", i18n.T("FAILURE: The WIM is damaged."))
+	case !w.Integrity && w.ResourcesChecked == 0:
+		fmt.Println("\n\033[33mThe WIM structure is consistent, but it carries no hashes chkiso could check.\033[0m")
+	default:
+		fmt.Printf("\n\033[32m%s\033[0m\n", i18n.T("SUCCESS: WIM integrity verified."))
+	}
+}
+
+func printJigdoResult(j *jigdo.Result) {
+	algorithm := strings.ToUpper(j.Algorithm)
+	if j.TemplateChecked {
+		if j.TemplateHashFailed {
+			fmt.Println("Template:   \033[31mdoes not match the hash in the jigdo file\033[0m")
 		} else {
-			// Non-Windows platforms
-			fmt.Println("Note: For ISO files, please mount the ISO manually and verify using the mount point.")
-			fmt.Println("Example (Linux): sudo mount -o loop image.iso /mnt, then run: chkiso /mnt")
-			return
+			fmt.Println("Template:   matches the hash in the jigdo file")
 		}
 	}
-	
-	fmt.Printf("Searching for checksum files (*.sha, sha256sum.txt, SHA256SUMS) in %s...\n", mountPath)
-	
-	// Find checksum files
-	checksumFiles, err := findChecksumFiles(mountPath)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Warning: Error finding checksum files: %v\n", err)
-		return
+	fmt.Printf("Size:       %d bytes (expected %d)\n", j.Size, j.ExpectedSize)
+	fmt.Printf("Expected %s:   %s\n", algorithm, j.Expected)
+	fmt.Printf("Calculated %s: %s\n", algorithm, j.Calculated)
+	fmt.Printf("Package files: %d checked, %d failed\n", j.Components, len(j.Failures))
+	for _, f := range j.Failures {
+		name := f.Name
+		if name == "" {
+			name = f.Hash
+		}
+		fmt.Printf("  \033[31m%s\033[0m at offset %d (%d bytes)\n", name, f.Offset, f.Length)
 	}
-	
-	if len(checksumFiles) == 0 {
-		fmt.Println("Warning: Could not find any checksum files (*.sha, sha256sum.txt, SHA256SUMS) on the media.")
-		return
+	if j.OK() {
+		fmt.Printf("\n\033[32m%s\033[0m\n", i18n.T("SUCCESS: The image matches its jigdo template."))
+	} else {
+		fmt.Printf("\n\033[31m%s\033[0m\n", i18n.T("FAILURE: The image does not match its jigdo template."))
 	}
-	
-	// Report all found checksum files
-	fmt.Printf("\nFound %d checksum file(s):\n", len(checksumFiles))
-	for i, cf := range checksumFiles {
-		relPath, err := filepath.Rel(mountPath, cf)
-		if err != nil {
-			relPath = cf
-		}
-		fmt.Printf("  %d. %s\n", i+1, relPath)
+}
+
+func printESPResult(e *verify.ESPResult) {
+	where := e.Source
+	if e.ISOFile != "" {
+		where += ", " + e.ISOFile
+	}
+	fmt.Printf("Found:      %s at offset %d (%s)\n", where, e.Offset, formatBytes(e.Size))
+	fmt.Printf("Format:     %s", e.FileSystem)
+	if e.Label != "" {
+		fmt.Printf(", label '%s'", e.Label)
 	}
 	fmt.Println()
-	
-	totalFiles := 0
-	failedFiles := 0
-	
-	for _, checksumFile := range checksumFiles {
-		fmt.Printf("Processing checksum file: %s\n", filepath.Base(checksumFile))
-		baseDir := filepath.Dir(checksumFile)
-		
-		file, err := os.Open(checksumFile)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Warning: Could not open checksum file: %v\n", err)
-			continue
+	fmt.Printf("SHA256:     %s\n", e.Sha256)
+	fmt.Printf("Files:      %d\n", len(e.Files))
+	for _, f := range e.Files {
+		note := ""
+		switch {
+		case f.Differs():
+			note = "  \033[31mdiffers from the ISO 9660 tree\033[0m"
+		case f.ISOSha256 != "":
+			note = "  matches the ISO 9660 tree"
 		}
-		defer file.Close()  // Ensure file is closed even if we continue early
-		
-		scanner := bufio.NewScanner(file)
-		pattern := regexp.MustCompile(`^([a-fA-F0-9]{64})\s+[\*\.\/\\]*(.*)`)
-		
-		for scanner.Scan() {
-			line := scanner.Text()
-			matches := pattern.FindStringSubmatch(line)
-			if matches == nil {
-				continue
-			}
-			
-			totalFiles++
-			expectedHash := strings.ToLower(matches[1])
-			fileName := strings.TrimSpace(matches[2])
-			
-			// Validate that the file path doesn't escape the base directory
-			filePathOnMedia := filepath.Join(baseDir, fileName)
-			cleanPath := filepath.Clean(filePathOnMedia)
-			if !strings.HasPrefix(cleanPath, filepath.Clean(baseDir)) {
-				fmt.Printf("Warning: Skipping potentially unsafe path: %s (referenced in %s)\n", fileName, filepath.Base(checksumFile))
-				failedFiles++
-				continue
-			}
-			
-			if _, err := os.Stat(filePathOnMedia); os.IsNotExist(err) {
-				fmt.Printf("Warning: File not found on media: %s (referenced in %s)\n", fileName, filepath.Base(checksumFile))
-				failedFiles++
-				continue
-			}
-			
-			fmt.Printf("Verifying: %s", fileName)
-			calculatedHash, err := getSha256Hash(filePathOnMedia)
-			if err != nil {
-				fmt.Printf(" -> \033[31mERROR: %v\033[0m\n", err)
-				failedFiles++
-				continue
-			}
-			
-			calculatedHash = strings.ToLower(calculatedHash)
-			if calculatedHash == expectedHash {
-				fmt.Printf(" -> \033[32mOK\033[0m\n")
-			} else {
-				fmt.Printf(" -> \033[31mFAILED\033[0m\n")
-				failedFiles++
+		if f.BootLoader {
+			note += "  (boot loader)"
+		}
+		fmt.Printf("  %s  %s%s\n", f.Sha256, f.Path, note)
+	}
+	if e.OK() {
+		fmt.Printf("\n\033[32m%s\033[0m\n", i18n.T("SUCCESS: The EFI System Partition is consistent with the image."))
+	} else {
+		for _, p := range e.Problems {
+			fmt.Printf("\033[31m%s\033[0m\n", p)
+		}
+		fmt.Printf("\n\033[31m%s\033[0m\n", i18n.T("FAILURE: The EFI System Partition does not match the image."))
+	}
+}
+
+func printBootResult(b *verify.BootResult) {
+	fmt.Printf("Configuration files: %s\n", strings.Join(b.Configs, ", "))
+	for _, ref := range b.References {
+		switch ref.Status {
+		case verify.BootFileOK:
+			checked := ""
+			if ref.Expected != "" {
+				checked = fmt.Sprintf(", %s matches %s", strings.ToUpper(ref.Algorithm), ref.ChecksumFile)
 			}
+			fmt.Printf("  \033[32m%-8s\033[0m %s (%s%s)\n", ref.Status, ref.Path, ref.Keyword, checked)
+		case verify.BootFileSkipped:
+			fmt.Printf("  \033[33m%-8s\033[0m %s (%s, %s line %d)\n", ref.Status, ref.Path, ref.Keyword, ref.Config, ref.Line)
+		default:
+			fmt.Printf("  \033[31m%-8s\033[0m %s\n", ref.Status, ref)
 		}
-		fmt.Println()  // Add blank line between checksum files
 	}
-	
-	fmt.Println("--- Verification Summary ---")
-	fmt.Printf("Checksum files processed: %d\n", len(checksumFiles))
-	fmt.Printf("Total files verified: %d\n", totalFiles)
-	if failedFiles == 0 && totalFiles > 0 {
-		fmt.Printf("\033[32mSuccess: All %d files verified successfully.\033[0m\n", totalFiles)
-	} else if totalFiles == 0 {
-		fmt.Println("No files were verified.")
+	if b.OK() {
+		fmt.Printf("\n\033[32m%s\033[0m\n", i18n.T("SUCCESS: Every file the boot loader configuration names is present."))
 	} else {
-		fmt.Printf("\033[31mFailure: %d out of %d files failed verification.\033[0m\n", failedFiles, totalFiles)
-		hasErrors = true
+		fmt.Printf("\n\033[31m%s\033[0m\n", i18n.T("FAILURE: The boot loader configuration names missing or damaged files."))
 	}
 }
 
-// findChecksumFiles recursively searches for ALL checksum files in the given directory tree.
-// It finds files matching: *.sha, sha256sum.txt, or SHA256SUMS (case-insensitive).
-// This ensures all checksum files on the media are discovered and processed.
-func findChecksumFiles(rootPath string) ([]string, error) {
-	var checksumFiles []string
-	
-	err := filepath.Walk(rootPath, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			// Log permission errors but continue walking
-			fmt.Fprintf(os.Stderr, "Warning: Could not access %s: %v\n", path, err)
-			return nil
+func printKernelResult(k *verify.KernelResult) {
+	for _, b := range k.Images {
+		format := b.Format
+		if format == "" {
+			format = "unrecognized format"
 		}
-		if info.IsDir() {
-			return nil
+		if b.Version != "" {
+			format += ", " + b.Version
 		}
-		
-		name := strings.ToLower(info.Name())
-		if strings.HasSuffix(name, ".sha") || 
-		   name == "sha256sum.txt" || 
-		   name == "sha256sums" {
-			checksumFiles = append(checksumFiles, path)
+		fmt.Printf("%-6s  %s (%s, %s)\n", b.Kind, b.Path, formatBytes(b.Size), format)
+		fmt.Printf("        SHA256: %s\n", b.Sha256)
+		switch {
+		case b.Expected == "":
+		case b.Match():
+			fmt.Printf("        \033[32m%s matches %s\033[0m\n", strings.ToUpper(b.Algorithm), b.ChecksumFile)
+		default:
+			fmt.Printf("        \033[31m%s does not match %s (expected %s)\033[0m\n", strings.ToUpper(b.Algorithm), b.ChecksumFile, b.Expected)
 		}
-		
-		return nil
-	})
-	
-	return checksumFiles, err
+	}
+	switch {
+	case !k.OK():
+		fmt.Printf("\n\033[31m%s\033[0m\n", i18n.T("FAILURE: A kernel or initrd does not match its checksum."))
+	case k.Checked() == 0:
+		fmt.Println("\n\033[33mNo checksum file lists them; compare their hashes with the published ones, or give those with -kernel-sums.\033[0m")
+	default:
+		fmt.Printf("\n\033[32m%s\033[0m\n", i18n.T("SUCCESS: The kernels and initrds match their checksums."))
+	}
 }
 
-func verifyImplantedMD5(config *Config) {
-	fmt.Println("\n--- Verifying Implanted ISO MD5 (checkisomd5 compatible) ---")
-	
-	result, err := checkImplantedMD5(config)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error during MD5 check: %v\n", err)
-		hasErrors = true
+func printHashSetResult(h *verify.HashSetResult) {
+	fmt.Printf("Hash set: %s (%s, %s)\n", h.HashSet, h.Format, strings.ToUpper(h.Algorithm))
+	known, knownBytes := h.Known()
+	fmt.Printf("\033[32m%s\033[0m\n", i18n.T("Known software: %d of %d file(s), %s", known, len(h.Files), formatBytes(knownBytes)))
+	unknown := h.Unknown()
+	if len(unknown) == 0 {
 		return
 	}
-	
-	if result == nil {
-		fmt.Println("Warning: No 'ISO MD5SUM' signature found.")
-		return
+	var total int64
+	for _, f := range unknown {
+		total += f.Size
 	}
-	
-	fmt.Printf("Verification Method: %s\n", result.VerificationMethod)
-	fmt.Printf("Stored MD5:          %s\n", result.StoredMD5)
-	fmt.Printf("Calculated MD5:      %s\n", result.CalculatedMD5)
-	
-	if result.IsIntegrityOK {
-		fmt.Println("\n\033[32mSUCCESS: Implanted MD5 is valid.\033[0m")
-	} else {
-		fmt.Println("\n\033[31mFAILURE: Implanted MD5 does not match calculated hash.\033[0m")
-		hasErrors = true
+	fmt.Printf("\033[33m%s\033[0m\n", i18n.T("Not in the hash set: %d file(s), %s", len(unknown), formatBytes(total)))
+	for _, f := range unknown {
+		fmt.Printf("  %10s  %s\n", formatBytes(f.Size), f.Path)
 	}
 }
 
-type MD5Result struct {
-	VerificationMethod string
-	StoredMD5          string
-	CalculatedMD5      string
-	IsIntegrityOK      bool
+func printFileResult(ev verify.Progress) {
+	if ev.File == nil {
+		fmt.Print(i18n.T("Verifying: %s", ev.Item))
+		return
+	}
+	fr := ev.File
+	switch fr.Status {
+	case verify.FileOK:
+		if fr.Cached {
+			fmt.Printf(" -> \033[32mOK\033[0m %s\n", i18n.T("(unchanged)"))
+		} else if fr.Shared {
+			fmt.Printf(" -> \033[32mOK\033[0m %s\n", i18n.T("(already hashed)"))
+		} else {
+			fmt.Printf(" -> \033[32mOK\033[0m\n")
+		}
+	case verify.FileMismatch:
+		fmt.Printf(" -> \033[31m%s\033[0m\n", i18n.T("FAILED"))
+	case verify.FileSize:
+		fmt.Printf(" -> \033[31m%s\033[0m\n", i18n.T("SIZE MISMATCH (%d bytes, expected %d)", fr.Size, fr.ExpectedSize))
+	case verify.FileError:
+		fmt.Printf(" -> \033[31m%s\033[0m\n", i18n.T("ERROR: %v", fr.Err))
+	case verify.FileConflict:
+		fmt.Printf(" -> \033[31m%s\033[0m\n", i18n.T("MANIFEST CONFLICT: %v", fr.Err))
+	case verify.FileMissing:
+		fmt.Println(i18n.T("Warning: File not found on media: %s (referenced in %s)", fr.Name, filepath.Base(fr.ChecksumFile)))
+	case verify.FileUnsafe:
+		fmt.Println(i18n.T("Warning: Skipping potentially unsafe path: %s (referenced in %s)", fr.Name, filepath.Base(fr.ChecksumFile)))
+		if fr.Err != nil {
+			fmt.Printf("         %v\n", fr.Err)
+		}
+	}
 }
 
-func checkImplantedMD5(config *Config) (*MD5Result, error) {
-	var file *os.File
-	var err error
-	var fileLength int64
-	
-	if config.isDrive {
-		if runtime.GOOS == "windows" {
-			devicePath := fmt.Sprintf("\\\\.\\%s:", config.driveLetter)
-			file, err = os.Open(devicePath)
-			if err != nil {
-				return nil, err
-			}
-			
-			// For device paths, we can't use file.Stat() reliably on 32-bit Windows
-			// Instead, seek to end to get the size
-			fileLength, err = file.Seek(0, io.SeekEnd)
-			if err != nil {
-				file.Close()
-				// This typically happens with virtual/mounted drives (like mounted ISOs)
-				// which don't support device-level operations
-				return nil, fmt.Errorf("drive %s: does not support device-level access (likely a virtual/mounted drive).\n\n"+
-					"Implanted MD5 check requires direct access to the ISO file.\n"+
-					"To verify the implanted MD5, use the ISO file directly:\n"+
-					"  Example: chkiso path\\to\\image.iso -md5\n\n"+
-					"(Content verification will still work with the mounted drive)", config.driveLetter)
-			}
-			// Seek back to start
-			if _, err := file.Seek(0, io.SeekStart); err != nil {
-				file.Close()
-				return nil, err
+func printContentSummary(result *verify.Result) {
+	contents := result.Contents
+	if contents == nil {
+		if result.NeedsMount {
+			fmt.Println("Note: For ISO files, please mount the ISO manually and verify using the mount point.")
+			if runtime.GOOS == "windows" {
+				fmt.Println("Example (Windows): Mount-DiskImage image.iso, then run: chkiso E:")
+			} else {
+				fmt.Println("Example (Linux): sudo mount -o loop image.iso /mnt, then run: chkiso /mnt")
 			}
-		} else {
-			return nil, fmt.Errorf("drive letters are only supported on Windows")
 		}
+		return
+	}
+
+	fmt.Println()
+	fmt.Printf("--- %s ---\n", i18n.T("Verification Summary"))
+	fmt.Println(i18n.T("Checksum files processed: %d", len(contents.ChecksumFiles)))
+	fmt.Println(i18n.T("Total files verified: %d", contents.Total))
+	if contents.Cached > 0 {
+		fmt.Println(i18n.T("Unchanged since the last run (not re-read): %d", contents.Cached))
+	}
+	if contents.Shared > 0 {
+		fmt.Println(i18n.T("Listed in more than one entry (read once): %d", contents.Shared))
+	}
+	if contents.Skipped > 0 {
+		fmt.Printf("\033[33m%s\033[0m\n", i18n.T("Skipped (algorithm not FIPS approved): %d", contents.Skipped))
+	}
+	if contents.MediaFiles > 0 {
+		files, bytes := contents.Coverage()
+		fmt.Println(i18n.T("Covered by checksums: %.1f%% of files, %.1f%% of bytes", files, bytes))
+	}
+	if contents.Failed == 0 && contents.Total > 0 {
+		fmt.Printf("\033[32m%s\033[0m\n", i18n.T("Success: All %d files verified successfully.", contents.Total))
+	} else if contents.Total == 0 {
+		fmt.Println(i18n.T("No files were verified."))
 	} else {
-		file, err = os.Open(config.Path)
-		if err != nil {
-			return nil, err
+		fmt.Printf("\033[31m%s\033[0m\n", i18n.T("Failure: %d out of %d files failed verification.", contents.Failed, contents.Total))
+		if contents.Conflicts > 0 {
+			fmt.Printf("\033[31m%s\033[0m\n", i18n.T("%d file(s) are listed with different hashes by the checksum files, which usually means a bad mastering step.", contents.Conflicts))
 		}
-		
-		// For regular files, we can use Stat safely
-		fileInfo, err := file.Stat()
-		if err != nil {
-			file.Close()
-			return nil, err
+		if contents.SizeMismatch > 0 {
+			fmt.Printf("\033[31m%s\033[0m\n", i18n.T("%d file(s) did not match the size listed in the checksum file.", contents.SizeMismatch))
 		}
-		fileLength = fileInfo.Size()
 	}
-	
-	defer file.Close()
-	
-	// Read PVD block
-	pvdBlock := make([]byte, PVD_SIZE)
-	if _, err := file.Seek(PVD_OFFSET, 0); err != nil {
-		return nil, err
-	}
-	if n, err := file.Read(pvdBlock); err != nil || n != PVD_SIZE {
-		return nil, fmt.Errorf("could not read PVD")
-	}
-	
-	// Extract Application Use field
-	appUseData := pvdBlock[APP_USE_OFFSET : APP_USE_OFFSET+APP_USE_SIZE]
-	appUseString := string(appUseData)
-	
-	// Look for MD5 signature
-	md5Pattern := regexp.MustCompile(`ISO MD5SUM = ([0-9a-fA-F]{32})`)
-	matches := md5Pattern.FindStringSubmatch(appUseString)
-	if matches == nil {
-		return nil, nil
-	}
-	
-	storedHash := strings.ToLower(matches[1])
-	
-	// Look for SKIPSECTORS
-	skipSectors := 0
-	skipPattern := regexp.MustCompile(`SKIPSECTORS\s*=\s*(\d+)`)
-	if skipMatches := skipPattern.FindStringSubmatch(appUseString); skipMatches != nil {
-		fmt.Sscanf(skipMatches[1], "%d", &skipSectors)
-	}
-	
-	hashEndOffset := fileLength - int64(skipSectors*SECTOR_SIZE)
-	
-	// Create neutralized PVD (fill Application Use field with spaces)
-	neutralizedPvd := make([]byte, len(pvdBlock))
-	copy(neutralizedPvd, pvdBlock)
-	for i := 0; i < APP_USE_SIZE; i++ {
-		neutralizedPvd[APP_USE_OFFSET+i] = SPACE_CHAR
-	}
-	
-	// Calculate MD5 hash
-	hash := md5.New()
-	
-	// Part A: Read from start to PVD_OFFSET
-	if _, err := file.Seek(0, 0); err != nil {
-		return nil, err
+	printSignatures(contents.Signatures)
+	printUncovered(contents.Uncovered)
+}
+
+// printSignatures shows the outcome of checking the signatures of the
+// checksum files that have one.
+func printSignatures(signatures []verify.SignatureResult) {
+	for _, sig := range signatures {
+		color := "33"
+		switch sig.Status {
+		case verify.SignatureMissing:
+			continue
+		case verify.SignatureValid:
+			color = "32"
+		case verify.SignatureInvalid:
+			color = "31"
+		}
+		fmt.Printf("\033[%sm%s\033[0m\n", color, i18n.T("Signature %s: %s (%s)", filepath.FromSlash(sig.File), sig.Status, sig.Detail))
 	}
-	if _, err := io.CopyN(hash, file, PVD_OFFSET); err != nil {
-		return nil, err
+}
+
+// printUncovered lists the files on the media that no checksum file lists,
+// so it is clear how much of it the verification vouches for.
+func printUncovered(files []verify.UncoveredFile) {
+	if len(files) == 0 {
+		return
 	}
-	
-	// Part B: Add neutralized PVD
-	hash.Write(neutralizedPvd)
-	
-	// Part C: Read from after PVD to hashEndOffset
-	if _, err := file.Seek(PVD_OFFSET+PVD_SIZE, 0); err != nil {
-		return nil, err
+	var total int64
+	for _, f := range files {
+		total += f.Size
 	}
-	remaining := hashEndOffset - (PVD_OFFSET + PVD_SIZE)
-	if _, err := io.CopyN(hash, file, remaining); err != nil {
-		return nil, err
+	fmt.Printf("\n\033[33m%s\033[0m\n", i18n.T("Not listed in any checksum file: %d file(s), %s", len(files), formatBytes(total)))
+	for _, f := range files {
+		fmt.Printf("  %10s  %s\n", formatBytes(f.Size), f.Name)
 	}
-	
-	calculatedMD5 := hex.EncodeToString(hash.Sum(nil))
-	
-	return &MD5Result{
-		VerificationMethod: "ASCII String (checkisomd5 compatible)",
-		StoredMD5:          storedHash,
-		CalculatedMD5:      strings.ToLower(calculatedMD5),
-		IsIntegrityOK:      storedHash == strings.ToLower(calculatedMD5),
-	}, nil
-}
-
-// mountISO mounts an ISO file on Windows using PowerShell's Mount-DiskImage
-// Returns the drive letter (e.g., "H") and an error if mounting fails
-func mountISO(isoPath string) (string, error) {
-	if runtime.GOOS != "windows" {
-		return "", fmt.Errorf("automatic ISO mounting is only supported on Windows")
-	}
-	
-	// Get absolute path
-	absPath, err := filepath.Abs(isoPath)
-	if err != nil {
-		return "", fmt.Errorf("failed to get absolute path: %v", err)
-	}
-	
-	// Mount the ISO and get the drive letter
-	// Using PassThru to get the disk object, then Get-Volume to find the drive letter
-	psCommand := fmt.Sprintf(`
-		$disk = Mount-DiskImage -ImagePath '%s' -PassThru
-		if ($disk) {
-			$volume = Get-Volume -DiskImage $disk
-			if ($volume) {
-				$volume.DriveLetter
-			}
-		}
-	`, absPath)
-	
-	cmd := exec.Command("powershell", "-NoProfile", "-NonInteractive", "-Command", psCommand)
-	output, err := cmd.Output()
-	if err != nil {
-		if exitErr, ok := err.(*exec.ExitError); ok {
-			return "", fmt.Errorf("failed to mount ISO: %s", string(exitErr.Stderr))
+}
+
+func printPolicyReport(config *Config, report *policy.Report) {
+	fmt.Printf("\n--- %s ---\n", i18n.T("Policy Compliance"))
+	fmt.Printf("Policy: %s\n", config.PolicyFile)
+	for _, req := range report.Requirements {
+		if req.Met {
+			fmt.Printf("  [\033[32mPASS\033[0m] %s: %s\n", req.Name, req.Detail)
+		} else {
+			fmt.Printf("  [\033[31mFAIL\033[0m] %s: %s\n", req.Name, req.Detail)
 		}
-		return "", fmt.Errorf("failed to mount ISO: %v", err)
 	}
-	
-	driveLetter := strings.TrimSpace(string(output))
-	if driveLetter == "" {
-		return "", fmt.Errorf("failed to get drive letter after mounting")
+	if report.Compliant() {
+		fmt.Printf("\033[32m%s\033[0m\n", i18n.T("Result: COMPLIANT - All policy requirements are met."))
+	} else {
+		fmt.Printf("\033[31m%s\033[0m\n", i18n.T("Result: NOT COMPLIANT - One or more policy requirements are not met."))
 	}
-	
-	return driveLetter, nil
 }
 
-// dismountISO dismounts an ISO file on Windows using PowerShell's Dismount-DiskImage
-func dismountISO(isoPath string) error {
-	if runtime.GOOS != "windows" {
-		return fmt.Errorf("automatic ISO dismounting is only supported on Windows")
+// candidateIndex returns the 1-based position of the matched hash among
+// the candidates of h, or 0.
+func candidateIndex(h *verify.HashResult) int {
+	for i, c := range h.Candidates {
+		if c == h.Expected {
+			return i + 1
+		}
 	}
-	
-	// Get absolute path
-	absPath, err := filepath.Abs(isoPath)
+	return 0
+}
+
+// resolveHashFile reads the expected hash for the target from -shafile.
+func resolveHashFile(config *Config) (string, error) {
+	fmt.Printf("\n--- %s ---\n", i18n.T("Verifying Path Against SHA256 Hash File"))
+
+	content, err := os.ReadFile(config.ShaFile)
 	if err != nil {
-		return fmt.Errorf("failed to get absolute path: %v", err)
+		return "", fmt.Errorf("could not read hash file: %v", err)
 	}
-	
-	psCommand := fmt.Sprintf("Dismount-DiskImage -ImagePath '%s'", absPath)
-	cmd := exec.Command("powershell", "-NoProfile", "-NonInteractive", "-Command", psCommand)
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		return fmt.Errorf("failed to dismount ISO: %s", string(output))
+
+	expectedHash := verify.HashFromFile(config.target, string(content))
+	if expectedHash == "" {
+		return "", fmt.Errorf("could not find a valid SHA256 hash entry in the hash file '%s'", config.ShaFile)
 	}
-	
-	return nil
+	return expectedHash, nil
 }
 
 func handleDismount(config *Config) {
-	if config.isDrive {
+	if config.target.IsDrive {
 		fmt.Printf("\nNote: Ejecting drives is not yet implemented in this version.\n")
-		fmt.Printf("Please eject drive %s: manually.\n", config.driveLetter)
+		fmt.Printf("Please eject drive %s: manually.\n", config.target.DriveLetter)
 	} else if config.mountedISO {
 		// Only dismount if we mounted it
 		fmt.Printf("\nDismounting ISO...\n")
-		if err := dismountISO(config.Path); err != nil {
+		if err := verify.DismountISO(context.Background(), config.target.Path); err != nil {
 			fmt.Fprintf(os.Stderr, "Warning: Failed to dismount ISO: %v\n", err)
-			fmt.Printf("Please dismount %s manually.\n", config.Path)
+			fmt.Printf("Please dismount %s manually.\n", config.target.Path)
 		} else {
 			fmt.Println("ISO dismounted successfully.")
 		}
 	} else {
 		// ISO file but we didn't mount it
 		fmt.Printf("\nNote: ISO was not mounted automatically.\n")
-		if config.Path != "" {
-			fmt.Printf("If you mounted %s manually, please dismount it manually.\n", config.Path)
+		if config.target.Path != "" {
+			fmt.Printf("If you mounted %s manually, please dismount it manually.\n", config.target.Path)
 		}
 	}
 }
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// defaultNotifyAfter is how long a run must take before -notify announces
+// it; the verdict of a shorter one is still on the screen.
+const defaultNotifyAfter = 30 * time.Second
+
+// notifyDone announces the verdict of a long run with a desktop
+// notification, for -notify, so an operator who switched to other work
+// learns that the verification finished. Failures to notify are reported as
+// warnings; they never change the exit code.
+func notifyDone(config *Config, failures []error) {
+	after := config.NotifyAfter
+	if after == 0 {
+		after = defaultNotifyAfter
+	}
+	took := time.Since(config.started)
+	if took < after {
+		return
+	}
+	passed := len(failures) == 0
+	if err := sendNotification("chkiso", notificationText(config, passed, took), passed); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: Could not show a notification: %v\n", err)
+	}
+}
+
+// notificationText is the line of the notification, such as
+// "image.iso: verification PASSED (took 12m3s)".
+func notificationText(config *Config, passed bool, took time.Duration) string {
+	what := filepath.Base(config.Path)
+	if targets := *config.verdicts; len(targets) > 1 {
+		what = fmt.Sprintf("%s (%d images)", what, len(targets))
+	}
+	return fmt.Sprintf("%s: verification %s (took %s)", what, passFail(passed), took.Round(time.Second))
+}
@@ -0,0 +1,14 @@
+package main
+
+import "os/exec"
+
+// sendNotification posts a notification to Notification Center with
+// osascript, with a sound if the verification failed. The title and text
+// are passed as arguments of the script, so they need no quoting.
+func sendNotification(title, text string, passed bool) error {
+	script := "display notification (item 2 of argv) with title (item 1 of argv)"
+	if !passed {
+		script += ` sound name "Basso"`
+	}
+	return exec.Command("osascript", "-e", "on run argv", "-e", script, "-e", "end run", title, text).Run()
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// sendNotification shows a notification through the freedesktop
+// notification service of the desktop session: with notify-send if it is
+// installed, or else by calling the service over D-Bus with gdbus, which
+// comes with GLib.
+func sendNotification(title, text string, passed bool) error {
+	if os.Getenv("DISPLAY") == "" && os.Getenv("WAYLAND_DISPLAY") == "" {
+		return fmt.Errorf("there is no graphical session to show it in")
+	}
+	icon, urgency := "dialog-error", "critical"
+	if passed {
+		icon, urgency = "dialog-information", "normal"
+	}
+	if _, err := exec.LookPath("notify-send"); err == nil {
+		return exec.Command("notify-send", "--app-name=chkiso", "--urgency="+urgency, "--icon="+icon, title, text).Run()
+	}
+	if _, err := exec.LookPath("gdbus"); err != nil {
+		return fmt.Errorf("neither notify-send nor gdbus is installed")
+	}
+	// Arguments of the Notify method, after "--" so that the expiry is not
+	// taken for an option: app name, replaced notification id, icon,
+	// summary, body, actions, hints and expiry (-1 = the default)
+	out, err := exec.Command("gdbus", "call", "--session",
+		"--dest", "org.freedesktop.Notifications",
+		"--object-path", "/org/freedesktop/Notifications",
+		"--method", "org.freedesktop.Notifications.Notify", "--",
+		gvariantString("chkiso"), "0", gvariantString(icon), gvariantString(title), gvariantString(text),
+		"[]", "{}", "-1").CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("gdbus: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// gvariantString quotes s as a GVariant text format string, which is how
+// gdbus reads its arguments.
+func gvariantString(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
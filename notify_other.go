@@ -0,0 +1,13 @@
+//go:build !windows && !linux && !darwin
+
+package main
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// sendNotification is not supported here yet.
+func sendNotification(title, text string, passed bool) error {
+	return fmt.Errorf("desktop notifications are not supported on %s", runtime.GOOS)
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+)
+
+// toastAppID is the application a toast is shown for. chkiso is not
+// installed with a Start menu shortcut of its own, which Windows requires
+// of an application that shows toasts, so they are shown for PowerShell.
+const toastAppID = `{1AC14E77-02E7-4E5D-B744-2EB1AE5198B7}\WindowsPowerShell\v1.0\powershell.exe`
+
+// sendNotification shows a toast notification through the Windows Runtime
+// API PowerShell can reach. The title and text are passed in environment
+// variables, so they need no quoting, and escaped for the toast's XML.
+func sendNotification(title, text string, passed bool) error {
+	psCommand := "$null = [Windows.UI.Notifications.ToastNotificationManager, Windows.UI.Notifications, ContentType = WindowsRuntime]; " +
+		"$null = [Windows.Data.Xml.Dom.XmlDocument, Windows.Data.Xml.Dom.XmlDocument, ContentType = WindowsRuntime]; " +
+		"$xml = New-Object Windows.Data.Xml.Dom.XmlDocument; " +
+		"$xml.LoadXml(\"<toast><visual><binding template='ToastGeneric'><text>\" + [Security.SecurityElement]::Escape($env:CHKISO_TITLE) + " +
+		"\"</text><text>\" + [Security.SecurityElement]::Escape($env:CHKISO_TEXT) + \"</text></binding></visual></toast>\"); " +
+		"[Windows.UI.Notifications.ToastNotificationManager]::CreateToastNotifier('" + toastAppID + "').Show([Windows.UI.Notifications.ToastNotification]::new($xml))"
+	cmd := exec.Command("powershell", "-NoProfile", "-NonInteractive", "-Command", psCommand)
+	cmd.Env = append(os.Environ(), "CHKISO_TITLE="+title, "CHKISO_TEXT="+text)
+	return cmd.Run()
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/pappasjfed/chkiso/pkg/distro"
+	"github.com/pappasjfed/chkiso/pkg/manifest"
+	"github.com/pappasjfed/chkiso/pkg/verify"
+)
+
+// fetchTimeout bounds downloading a distribution's checksum file.
+const fetchTimeout = 60 * time.Second
+
+// useOfficialChecksum identifies the distribution release the target holds
+// and takes the expected hash from the checksum file its publisher hosts.
+// An image listed under another name, such as a renamed download, may match
+// any image of the release.
+func useOfficialChecksum(config *Config) error {
+	fmt.Println("\n--- Official Checksum ---")
+	release := verify.Release(config.target)
+	if release == nil {
+		return fmt.Errorf("-fetch-checksum: not a release chkiso can identify (Ubuntu, Debian, Fedora or Rocky Linux)")
+	}
+	config.release = release.String()
+	fmt.Printf("Identified: %s\n", release)
+	if len(release.ChecksumURLs()) == 0 {
+		return fmt.Errorf("cannot tell which checksum file lists this %s image; give it its original file name or use -shafile", release.Distro)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), fetchTimeout)
+	defer cancel()
+	sums, err := distro.Fetch(ctx, release)
+	if err != nil {
+		return fmt.Errorf("could not download the official checksum file: %v", err)
+	}
+	fmt.Printf("Downloaded: %s\n", sums.URL)
+	config.checksumURL = sums.URL
+
+	content := string(sums.Content)
+	if hash := verify.ListedHash(config.target, content, manifest.SHA256); hash != "" {
+		config.Sha256Hash = hash
+	} else {
+		entries, _ := manifest.ParseNamed(path.Base(sums.URL), sums.Content)
+		for _, e := range entries {
+			if e.Algorithm == manifest.SHA256 && strings.HasSuffix(strings.ToLower(e.Path), ".iso") {
+				config.addSha256(e.Hash)
+			}
+		}
+		if config.Sha256Hash == "" {
+			return fmt.Errorf("%s lists no SHA256 of an ISO image", sums.URL)
+		}
+		fmt.Printf("The image is not listed under its own name; accepting any of the %d images listed.\n", len(config.AlternateSha256)+1)
+	}
+
+	switch {
+	case sums.Signature != "":
+		fmt.Printf("Signature: %s\n", sums.Signature)
+	case sums.Signed():
+		fmt.Println("The checksum file carries an inline OpenPGP signature.")
+	default:
+		fmt.Println("No signature was found for the checksum file.")
+		return nil
+	}
+	fmt.Println("The file was downloaded over HTTPS from the distributor's server, but chkiso does")
+	fmt.Println("not check OpenPGP signatures; verify it with gpg --verify against the")
+	fmt.Println("distributor's signing key for full assurance.")
+	return nil
+}
+
+// showRelease names the distribution release an image holds when nothing
+// else gave an expected hash, pointing at -fetch-checksum.
+func showRelease(config *Config) {
+	if release := verify.Release(config.target); release != nil {
+		fmt.Printf("\nIdentified: %s (use -fetch-checksum to verify against its official checksums)\n", release)
+		config.release = release.String()
+	}
+}
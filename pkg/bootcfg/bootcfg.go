@@ -0,0 +1,260 @@
+// Package bootcfg reads the boot loader configuration files of installer
+// and live media: isolinux/syslinux .cfg files, GRUB's grub.cfg and the
+// BOOT.CFG of VMware ESXi. It returns the files each one has the boot
+// loader load, so they can be checked for on the media.
+package bootcfg
+
+import (
+	"bufio"
+	"bytes"
+	"path"
+	"strings"
+)
+
+// Kinds of configuration files.
+const (
+	Syslinux = "syslinux" // isolinux.cfg, syslinux.cfg and the files they include
+	GRUB     = "grub"     // grub.cfg and loopback.cfg
+	ESXi     = "esxi"     // BOOT.CFG of VMware ESXi
+)
+
+// Reference is a file a configuration file names.
+type Reference struct {
+	Line    int    // Line of the configuration file, starting at 1
+	Keyword string // "kernel", "initrd", "module", "include", ...
+	Path    string // Slash-separated, relative to the root of the media
+
+	// Variable is set when the path uses variables (GRUB's $prefix and the
+	// like) and cannot be resolved without running the boot loader. Path
+	// holds it as written then.
+	Variable bool
+}
+
+// Detect returns the kind of the configuration file at name, a
+// slash-separated path on the media, or "" if it is none. Names are
+// compared ignoring case, as ISO 9660 media without Rock Ridge or Joliet
+// names list them in capitals.
+func Detect(name string) string {
+	dir, base := path.Split(strings.ToLower(name))
+	parent := path.Base(dir)
+	switch {
+	case base == "isolinux.cfg" || base == "syslinux.cfg" || base == "extlinux.conf":
+		return Syslinux
+	case base == "grub.cfg" || base == "loopback.cfg":
+		return GRUB
+	case base == "boot.cfg":
+		return ESXi
+	case path.Ext(base) == ".cfg" && (parent == "isolinux" || parent == "syslinux"):
+		return Syslinux
+	case path.Ext(base) == ".cfg" && (parent == "grub" || parent == "grub2"):
+		return GRUB
+	}
+	return ""
+}
+
+// Parse returns the files that the configuration file of kind at name
+// names. Relative paths are resolved the way the boot loader does: against
+// the directory of the configuration file for syslinux, and against the
+// prefix, or else that directory, for ESXi. GRUB only takes absolute paths.
+func Parse(kind, name string, data []byte) []Reference {
+	dir := path.Dir(name)
+	switch kind {
+	case Syslinux:
+		return parseSyslinux(dir, data)
+	case GRUB:
+		return parseGRUB(data)
+	case ESXi:
+		return parseESXi(dir, data)
+	}
+	return nil
+}
+
+// lines calls fn with each line of data and its number, without comments
+// and surrounding space, skipping empty ones.
+func lines(data []byte, fn func(n int, line string)) {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, 1<<20)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fn(n, line)
+	}
+}
+
+// resolve makes p, as written in a configuration file in dir, a path
+// relative to the root of the media.
+func resolve(dir, p string) string {
+	if strings.HasPrefix(p, "/") {
+		return strings.TrimPrefix(path.Clean(p), "/")
+	}
+	return path.Join(dir, p)
+}
+
+// parseSyslinux reads an isolinux or syslinux configuration. Keywords are
+// not case-sensitive; initrds are given by INITRD or by initrd= in APPEND,
+// as comma-separated lists.
+func parseSyslinux(dir string, data []byte) []Reference {
+	var refs []Reference
+	add := func(n int, keyword, p string) {
+		if p != "" {
+			refs = append(refs, Reference{Line: n, Keyword: keyword, Path: resolve(dir, p)})
+		}
+	}
+	lines(data, func(n int, line string) {
+		fields := strings.Fields(line)
+		keyword := strings.ToLower(fields[0])
+		if keyword == "menu" && len(fields) > 1 {
+			// MENU INCLUDE reads a file; other MENU lines only set up the
+			// menu, and a missing background does not stop it booting
+			fields = fields[1:]
+			keyword = strings.ToLower(fields[0])
+			if keyword != "include" {
+				return
+			}
+		}
+		if len(fields) < 2 {
+			return
+		}
+		switch keyword {
+		case "kernel", "linux", "com32", "ui", "include", "config":
+			add(n, keyword, fields[1])
+		case "initrd":
+			for _, p := range strings.Split(fields[1], ",") {
+				add(n, "initrd", p)
+			}
+		case "append":
+			for _, arg := range fields[1:] {
+				if strings.HasPrefix(arg, "initrd=") {
+					for _, p := range strings.Split(strings.TrimPrefix(arg, "initrd="), ",") {
+						add(n, "initrd", p)
+					}
+				}
+			}
+		}
+	})
+	return refs
+}
+
+// parseGRUB reads the commands of a grub.cfg that load files: kernels,
+// initrds, multiboot modules, chainloaded images, device trees and the
+// configuration files it reads in turn.
+func parseGRUB(data []byte) []Reference {
+	var refs []Reference
+	lines(data, func(n int, line string) {
+		// Commands can share a line, separated by semicolons
+		for _, command := range strings.Split(line, ";") {
+			fields := grubFields(command)
+			if len(fields) < 2 {
+				continue
+			}
+			var keyword string
+			var paths []string
+			switch fields[0] {
+			case "linux", "linuxefi", "linux16", "kernel":
+				keyword, paths = "kernel", fields[1:2]
+			case "initrd", "initrdefi", "initrd16":
+				keyword, paths = "initrd", fields[1:]
+			case "multiboot", "multiboot2":
+				keyword, paths = "kernel", firstFile(fields[1:])
+			case "module", "module2":
+				keyword, paths = "module", firstFile(fields[1:])
+			case "chainloader":
+				keyword, paths = "chainloader", firstFile(fields[1:])
+			case "devicetree":
+				keyword, paths = "devicetree", fields[1:2]
+			case "source", "configfile":
+				keyword, paths = "include", fields[1:2]
+			default:
+				continue
+			}
+			for _, p := range paths {
+				// A device such as ($root) or (cd0) is the media itself
+				if strings.HasPrefix(p, "(") {
+					if i := strings.Index(p, ")"); i >= 0 {
+						p = p[i+1:]
+					}
+				}
+				switch {
+				case strings.Contains(p, "$"):
+					refs = append(refs, Reference{Line: n, Keyword: keyword, Path: p, Variable: true})
+				case strings.HasPrefix(p, "/"):
+					refs = append(refs, Reference{Line: n, Keyword: keyword, Path: resolve("", p)})
+				}
+			}
+		}
+	})
+	return refs
+}
+
+// grubFields splits a GRUB command into words, removing the quotes around
+// them.
+func grubFields(command string) []string {
+	fields := strings.Fields(command)
+	for i, f := range fields {
+		fields[i] = strings.Trim(f, `"'`)
+	}
+	return fields
+}
+
+// firstFile returns the first argument that is not an option, such as the
+// --nounzip of module or the --force of chainloader. Blocklists (+1) name
+// no file.
+func firstFile(args []string) []string {
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "-") {
+			continue
+		}
+		if strings.HasPrefix(arg, "+") {
+			return nil
+		}
+		return []string{arg}
+	}
+	return nil
+}
+
+// parseESXi reads the kernel= and modules= lines of an ESXi BOOT.CFG.
+// Modules are separated by "---"; relative names are looked for under
+// prefix=, or the directory of the file if it sets none.
+func parseESXi(dir string, data []byte) []Reference {
+	type line struct {
+		n      int
+		key    string
+		values []string
+	}
+	var found []line
+	lines(data, func(n int, text string) {
+		key, value, ok := strings.Cut(text, "=")
+		if !ok {
+			return
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		switch key {
+		case "prefix":
+			if value = strings.TrimSpace(value); value != "" {
+				dir = resolve(dir, value)
+			}
+		case "kernel":
+			found = append(found, line{n, "kernel", []string{strings.TrimSpace(value)}})
+		case "modules":
+			var modules []string
+			for _, m := range strings.Split(value, "---") {
+				// A module may be followed by its options
+				if fields := strings.Fields(m); len(fields) > 0 {
+					modules = append(modules, fields[0])
+				}
+			}
+			found = append(found, line{n, "module", modules})
+		}
+	})
+	var refs []Reference
+	for _, l := range found {
+		for _, p := range l.values {
+			if p != "" {
+				refs = append(refs, Reference{Line: l.n, Keyword: l.key, Path: resolve(dir, p)})
+			}
+		}
+	}
+	return refs
+}
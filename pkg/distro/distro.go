@@ -0,0 +1,199 @@
+// Package distro identifies well-known Linux distribution images from their
+// ISO 9660 volume labels and knows where each distribution publishes the
+// checksum files for its releases.
+package distro
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// maxChecksumFile bounds a downloaded checksum file; real ones are a few
+// kilobytes.
+const maxChecksumFile = 1 << 20
+
+// ErrNotFound is returned by Fetch when no checksum URL of a release exists.
+var ErrNotFound = errors.New("no official checksum file found")
+
+// Release is a distribution release identified from an image.
+type Release struct {
+	Distro  string // "Ubuntu", "Debian", "Fedora" or "Rocky Linux"
+	Version string
+	Edition string // e.g. "Server", "Workstation", "live"; may be empty
+	Arch    string // e.g. "amd64" or "x86_64"; may be empty
+	urls    []string
+}
+
+// String describes the release, e.g. "Ubuntu 22.04.3 Server (amd64)".
+func (r *Release) String() string {
+	s := r.Distro + " " + r.Version
+	if r.Edition != "" {
+		s += " " + r.Edition
+	}
+	if r.Arch != "" {
+		s += " (" + r.Arch + ")"
+	}
+	return s
+}
+
+// ChecksumURLs returns where the distribution publishes the checksum file
+// for the release, current locations first and archives after them.
+func (r *Release) ChecksumURLs() []string {
+	return r.urls
+}
+
+var (
+	ubuntuLabel = regexp.MustCompile(`^Ubuntu(-Server)? (\d+\.\d+(?:\.\d+)?)(?: LTS)? (\w+)$`)
+	debianLabel = regexp.MustCompile(`^Debian (\d+\.\d+\.\d+) (\w+) (\w+)$`)
+	debianLive  = regexp.MustCompile(`^d-live (\d+\.\d+\.\d+) (\w+) (\w+)$`)
+	fedoraWS    = regexp.MustCompile(`^Fedora-WS-Live-(\d+)-(\d+)-(\d+)$`)
+	fedoraDVD   = regexp.MustCompile(`^Fedora-(S|E)-dvd-(\w+)-(\d+)$`)
+	fedoraFile  = regexp.MustCompile(`-(x86_64|aarch64|ppc64le|s390x)-(\d+)-(\d+\.\d+)\.iso$`)
+	rockyLabel  = regexp.MustCompile(`^Rocky-(\d+)-(\d+)-(\w+)-(dvd|boot|minimal)`)
+)
+
+// Identify returns the release an image with the given volume label and
+// file name holds, or nil if it is not one chkiso knows. The file name is
+// only consulted for details some labels leave out, such as Fedora respins.
+func Identify(volumeID, fileName string) *Release {
+	volumeID = strings.TrimSpace(volumeID)
+	if m := ubuntuLabel.FindStringSubmatch(volumeID); m != nil {
+		r := &Release{Distro: "Ubuntu", Version: m[2], Arch: m[3]}
+		if m[1] != "" {
+			r.Edition = "Server"
+		}
+		r.urls = []string{
+			"https://releases.ubuntu.com/" + r.Version + "/SHA256SUMS",
+			"https://old-releases.ubuntu.com/releases/" + r.Version + "/SHA256SUMS",
+		}
+		return r
+	}
+	if m := debianLabel.FindStringSubmatch(volumeID); m != nil {
+		r := &Release{Distro: "Debian", Version: m[1], Arch: m[2]}
+		for _, base := range []string{"release", "archive"} {
+			for _, kind := range []string{"iso-cd", "iso-dvd"} {
+				r.urls = append(r.urls, fmt.Sprintf("https://cdimage.debian.org/cdimage/%s/%s/%s/%s/SHA256SUMS", base, r.Version, r.Arch, kind))
+			}
+		}
+		return r
+	}
+	if m := debianLive.FindStringSubmatch(volumeID); m != nil {
+		r := &Release{Distro: "Debian", Version: m[1], Edition: "live", Arch: m[3]}
+		for _, base := range []string{"release", "archive"} {
+			r.urls = append(r.urls, fmt.Sprintf("https://cdimage.debian.org/cdimage/%s/%s-live/%s/iso-hybrid/SHA256SUMS", base, r.Version, r.Arch))
+		}
+		return r
+	}
+	if m := fedoraWS.FindStringSubmatch(volumeID); m != nil {
+		arch := "x86_64"
+		if f := fedoraFile.FindStringSubmatch(fileName); f != nil {
+			arch = f[1]
+		}
+		return fedora(m[1], "Workstation", arch, m[2]+"."+m[3])
+	}
+	if m := fedoraDVD.FindStringSubmatch(volumeID); m != nil {
+		edition := "Server"
+		if m[1] == "E" {
+			edition = "Everything"
+		}
+		// The label leaves out the respin, which names the checksum file
+		f := fedoraFile.FindStringSubmatch(fileName)
+		if f == nil || f[2] != m[3] {
+			return &Release{Distro: "Fedora", Version: m[3], Edition: edition, Arch: m[2]}
+		}
+		return fedora(m[3], edition, m[2], f[3])
+	}
+	if m := rockyLabel.FindStringSubmatch(volumeID); m != nil {
+		r := &Release{Distro: "Rocky Linux", Version: m[1] + "." + m[2], Arch: m[3]}
+		r.urls = []string{
+			"https://download.rockylinux.org/pub/rocky/" + r.Version + "/isos/" + r.Arch + "/CHECKSUM",
+			"https://dl.rockylinux.org/vault/rocky/" + r.Version + "/isos/" + r.Arch + "/CHECKSUM",
+		}
+		return r
+	}
+	return nil
+}
+
+func fedora(version, edition, arch, respin string) *Release {
+	r := &Release{Distro: "Fedora", Version: version, Edition: edition, Arch: arch}
+	name := fmt.Sprintf("Fedora-%s-%s-%s-%s-CHECKSUM", edition, version, respin, arch)
+	for _, base := range []string{"https://download.fedoraproject.org/pub/fedora/linux/releases", "https://archives.fedoraproject.org/pub/archive/fedora/linux/releases"} {
+		r.urls = append(r.urls, fmt.Sprintf("%s/%s/%s/%s/iso/%s", base, version, edition, arch, name))
+	}
+	return r
+}
+
+// Checksums is a checksum file downloaded for a release.
+type Checksums struct {
+	URL     string
+	Content []byte
+	// Signature is the URL of a detached OpenPGP signature published with
+	// the file, if one was found.
+	Signature string
+}
+
+// Signed reports whether the file carries an inline OpenPGP signature.
+func (c *Checksums) Signed() bool {
+	return strings.HasPrefix(string(c.Content), "-----BEGIN PGP SIGNED MESSAGE-----")
+}
+
+// Fetch downloads the first checksum file of r that exists, and looks for a
+// detached signature next to it. It returns ErrNotFound if the release has
+// no checksum URLs or none of them exists.
+func Fetch(ctx context.Context, r *Release) (*Checksums, error) {
+	for _, url := range r.urls {
+		content, err := get(ctx, url)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		c := &Checksums{URL: url, Content: content}
+		for _, ext := range []string{".gpg", ".sign", ".sig", ".asc"} {
+			if exists(ctx, url+ext) {
+				c.Signature = url + ext
+				break
+			}
+		}
+		return c, nil
+	}
+	return nil, ErrNotFound
+}
+
+func get(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		return nil, ErrNotFound
+	case resp.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("%s returned %s", url, resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxChecksumFile))
+}
+
+func exists(ctx context.Context, url string) bool {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, url, nil)
+	if err != nil {
+		return false
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+	return resp.StatusCode == http.StatusOK
+}
@@ -0,0 +1,130 @@
+package dmg
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+
+	"github.com/pappasjfed/chkiso/internal/ctxio"
+)
+
+// Check is the outcome of comparing one embedded checksum.
+type Check struct {
+	Name       string // "data fork", "master", or the partition name
+	Expected   string
+	Calculated string
+	OK         bool
+	Err        error // Set when the checksum could not be calculated
+}
+
+// Result is the outcome of checking every checksum embedded in an image.
+// Checksums of a type other than CRC32, and empty ones, are skipped.
+type Result struct {
+	Checks  []Check
+	Skipped int
+}
+
+// OK reports whether every checksum that was checked matched.
+func (r *Result) OK() bool {
+	for _, c := range r.Checks {
+		if !c.OK {
+			return false
+		}
+	}
+	return true
+}
+
+// Verify checks the data fork checksum, each partition's checksum of its
+// decompressed data, and the master checksum over the partition checksums.
+// It stops early with ctx.Err() if ctx is cancelled.
+func (img *Image) Verify(ctx context.Context) (*Result, error) {
+	result := &Result{}
+	add := func(name string, want Checksum, got uint32, err error) {
+		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			return
+		}
+		expected, ok := want.CRC32()
+		if !ok {
+			result.Skipped++
+			return
+		}
+		c := Check{Name: name, Expected: fmt.Sprintf("%08x", expected), Err: err}
+		if err == nil {
+			c.Calculated = fmt.Sprintf("%08x", got)
+			c.OK = got == expected
+		}
+		result.Checks = append(result.Checks, c)
+	}
+
+	if _, ok := img.Trailer.DataChecksum.CRC32(); ok {
+		crc := crc32.NewIEEE()
+		fork := io.NewSectionReader(img.r, img.Trailer.DataForkOffset, img.Trailer.DataForkLength)
+		_, err := io.Copy(crc, ctxio.NewReader(ctx, fork))
+		add("data fork", img.Trailer.DataChecksum, crc.Sum32(), err)
+	} else {
+		result.Skipped++
+	}
+	if err := ctx.Err(); err != nil {
+		return result, err
+	}
+
+	// The master checksum covers the partitions' CRC32s as stored
+	var master []byte
+	for i, p := range img.Partitions {
+		name := p.Name
+		if name == "" {
+			name = fmt.Sprintf("partition %d", i)
+		}
+		stored, ok := p.Checksum.CRC32()
+		if !ok {
+			result.Skipped++
+			continue
+		}
+		master = binary.BigEndian.AppendUint32(master, stored)
+		crc := crc32.NewIEEE()
+		var err error
+		for _, c := range p.chunks {
+			if err = ctx.Err(); err != nil {
+				break
+			}
+			if c.zero() {
+				// Written a buffer at a time, as zero chunks can be large
+				if err = writeZeros(crc, c.SectorCount*SectorSize); err != nil {
+					break
+				}
+				continue
+			}
+			var data []byte
+			if data, err = img.decompressChunk(c); err != nil {
+				break
+			}
+			crc.Write(data)
+		}
+		add(name, p.Checksum, crc.Sum32(), err)
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+	}
+	if len(master) > 0 {
+		add("master", img.Trailer.MasterChecksum, crc32.ChecksumIEEE(master), nil)
+	} else {
+		result.Skipped++
+	}
+	return result, nil
+}
+
+// writeZeros writes n zero bytes to w.
+func writeZeros(w io.Writer, n int64) error {
+	zeros := make([]byte, 64<<10)
+	for n > 0 {
+		k, err := w.Write(zeros[:min64(n, int64(len(zeros)))])
+		if err != nil {
+			return err
+		}
+		n -= int64(k)
+	}
+	return nil
+}
@@ -0,0 +1,206 @@
+package dmg
+
+import (
+	"bytes"
+	"compress/bzip2"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/ulikunitz/xz"
+)
+
+// ErrUnsupportedCompression is returned when reading a chunk compressed
+// with a method chkiso cannot decompress (LZFSE).
+var ErrUnsupportedCompression = errors.New("unsupported compression method")
+
+// decompressChunk returns the sectors of c.
+func (img *Image) decompressChunk(c chunk) ([]byte, error) {
+	size := c.SectorCount * SectorSize
+	out := make([]byte, size)
+	var r io.Reader
+	switch c.Type {
+	case chunkZero, chunkIgnore:
+		return out, nil
+	case chunkRaw:
+		if _, err := img.r.ReadAt(out[:min64(size, c.Length)], c.Offset); err != nil {
+			return nil, err
+		}
+		return out, nil
+	}
+
+	raw := make([]byte, c.Length)
+	if _, err := img.r.ReadAt(raw, c.Offset); err != nil {
+		return nil, err
+	}
+	switch c.Type {
+	case chunkADC:
+		n, err := adcDecompress(out, raw)
+		if err != nil {
+			return nil, err
+		}
+		if int64(n) != size {
+			return nil, fmt.Errorf("ADC chunk at sector %d decompressed to %d bytes, expected %d", c.Sector, n, size)
+		}
+		return out, nil
+	case chunkZlib:
+		zr, err := zlib.NewReader(bytes.NewReader(raw))
+		if err != nil {
+			return nil, err
+		}
+		r = zr
+	case chunkBzip2:
+		r = bzip2.NewReader(bytes.NewReader(raw))
+	case chunkLZMA:
+		xr, err := xz.NewReader(bytes.NewReader(raw))
+		if err != nil {
+			return nil, err
+		}
+		r = xr
+	case chunkLZFSE:
+		return nil, fmt.Errorf("%w: LZFSE", ErrUnsupportedCompression)
+	default:
+		return nil, fmt.Errorf("%w: chunk type %#08x", ErrUnsupportedCompression, c.Type)
+	}
+	if _, err := io.ReadFull(r, out); err != nil {
+		return nil, fmt.Errorf("chunk at sector %d: %v", c.Sector, err)
+	}
+	return out, nil
+}
+
+// adcDecompress expands Apple Data Compression data from src into dst and
+// returns the number of bytes written.
+func adcDecompress(dst, src []byte) (int, error) {
+	n := 0
+	for i := 0; i < len(src); {
+		b := src[i]
+		var length, distance int
+		switch {
+		case b&0x80 != 0: // Literal run
+			length = int(b&0x7f) + 1
+			if i+1+length > len(src) || n+length > len(dst) {
+				return n, errors.New("corrupt ADC data")
+			}
+			n += copy(dst[n:], src[i+1:i+1+length])
+			i += 1 + length
+			continue
+		case b&0x40 != 0: // Three byte back reference
+			if i+2 >= len(src) {
+				return n, errors.New("corrupt ADC data")
+			}
+			length = int(b&0x3f) + 4
+			distance = int(src[i+1])<<8 | int(src[i+2])
+			i += 3
+		default: // Two byte back reference
+			if i+1 >= len(src) {
+				return n, errors.New("corrupt ADC data")
+			}
+			length = int(b&0x3c)>>2 + 3
+			distance = int(b&0x03)<<8 | int(src[i+1])
+			i += 2
+		}
+		from := n - distance - 1
+		if from < 0 || n+length > len(dst) {
+			return n, errors.New("corrupt ADC data")
+		}
+		// Byte by byte, since the source may overlap what is being written
+		for j := 0; j < length; j++ {
+			dst[n] = dst[from+j]
+			n++
+		}
+	}
+	return n, nil
+}
+
+func min64(a, b int64) int64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// Disk returns the decompressed disk the image holds. Sectors no block table
+// describes read as zeros.
+func (img *Image) Disk() *Disk {
+	d := &Disk{img: img, size: img.Size()}
+	for _, p := range img.Partitions {
+		d.chunks = append(d.chunks, p.chunks...)
+	}
+	sort.Slice(d.chunks, func(i, j int) bool { return d.chunks[i].Sector < d.chunks[j].Sector })
+	return d
+}
+
+// Disk reads the decompressed contents of an Image. Each chunk is
+// decompressed when first read; the most recent one is kept. ReadAt may be
+// called concurrently.
+type Disk struct {
+	mu     sync.Mutex // Guards the kept chunk
+	img    *Image
+	size   int64
+	chunks []chunk
+	last   int // Index of the chunk in data
+	data   []byte
+	offset int64 // Position for Read
+}
+
+// Size returns the size of the disk in bytes.
+func (d *Disk) Size() int64 { return d.size }
+
+func (d *Disk) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	n := 0
+	for n < len(p) {
+		pos := off + int64(n)
+		if pos >= d.size {
+			return n, io.EOF
+		}
+		sector := pos / SectorSize
+		i := sort.Search(len(d.chunks), func(i int) bool {
+			return d.chunks[i].Sector+d.chunks[i].SectorCount > sector
+		})
+		if i == len(d.chunks) || d.chunks[i].Sector > sector || d.chunks[i].zero() {
+			// A gap between chunks reads as zeros up to the next chunk, and
+			// a chunk of zeros up to its end
+			end := d.size
+			switch {
+			case i == len(d.chunks):
+			case d.chunks[i].Sector > sector:
+				end = d.chunks[i].Sector * SectorSize
+			default:
+				end = (d.chunks[i].Sector + d.chunks[i].SectorCount) * SectorSize
+			}
+			gap := min64(end-pos, int64(len(p)-n))
+			for j := int64(0); j < gap; j++ {
+				p[n] = 0
+				n++
+			}
+			continue
+		}
+		if d.data == nil || d.last != i {
+			data, err := d.img.decompressChunk(d.chunks[i])
+			if err != nil {
+				return n, err
+			}
+			d.data, d.last = data, i
+		}
+		within := pos - d.chunks[i].Sector*SectorSize
+		n += copy(p[n:], d.data[within:])
+	}
+	return n, nil
+}
+
+func (d *Disk) Read(p []byte) (int, error) {
+	n, err := d.ReadAt(p, d.offset)
+	d.offset += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return n, err
+}
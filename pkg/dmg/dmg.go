@@ -0,0 +1,362 @@
+// Package dmg reads Apple disk images in the UDIF format (.dmg): the
+// trailer, the block tables of its partitions, and the CRC32 checksums the
+// format embeds for the data fork and every partition.
+package dmg
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+)
+
+const (
+	trailerSize = 512
+	// SectorSize is the unit UDIF block tables count in.
+	SectorSize = 512
+	// maxSectors is the most sectors whose size in bytes fits an int64.
+	maxSectors = math.MaxInt64 / SectorSize
+	// maxChunkSize bounds the decompressed size of a chunk holding data,
+	// which is read into memory whole. Chunks are usually 1 MiB.
+	maxChunkSize = 64 << 20
+)
+
+// ErrNotDMG is returned by Open when the data has no UDIF trailer.
+var ErrNotDMG = errors.New("not a UDIF disk image (no 'koly' trailer)")
+
+// Checksum types used in UDIF headers.
+const (
+	ChecksumNone  = 0
+	ChecksumCRC32 = 2
+)
+
+// Checksum is a checksum as stored in UDIF headers: a type, a size in bits,
+// and up to 128 bytes of data.
+type Checksum struct {
+	Type uint32
+	Bits uint32
+	Data [32]uint32
+}
+
+// CRC32 returns the checksum's value if it is a CRC32.
+func (c Checksum) CRC32() (uint32, bool) {
+	if c.Type != ChecksumCRC32 || c.Bits != 32 {
+		return 0, false
+	}
+	return c.Data[0], true
+}
+
+// String describes the checksum for display, e.g. "CRC32 1a2b3c4d".
+func (c Checksum) String() string {
+	if crc, ok := c.CRC32(); ok {
+		return fmt.Sprintf("CRC32 %08x", crc)
+	}
+	if c.Type == ChecksumNone {
+		return "none"
+	}
+	return fmt.Sprintf("type %d", c.Type)
+}
+
+func parseChecksum(b []byte) Checksum {
+	var c Checksum
+	c.Type = binary.BigEndian.Uint32(b[0:4])
+	c.Bits = binary.BigEndian.Uint32(b[4:8])
+	for i := range c.Data {
+		c.Data[i] = binary.BigEndian.Uint32(b[8+4*i:])
+	}
+	return c
+}
+
+// Trailer is the 512 byte 'koly' block at the end of a UDIF image.
+type Trailer struct {
+	Version        uint32
+	DataForkOffset int64
+	DataForkLength int64
+	DataChecksum   Checksum // Checksum of the data fork as stored
+	XMLOffset      int64
+	XMLLength      int64
+	MasterChecksum Checksum // Checksum over the partitions' checksums
+	SectorCount    int64    // Size of the decompressed disk in sectors
+}
+
+// Chunk types in a block table.
+const (
+	chunkZero       = 0x00000000
+	chunkRaw        = 0x00000001
+	chunkIgnore     = 0x00000002
+	chunkADC        = 0x80000004
+	chunkZlib       = 0x80000005
+	chunkBzip2      = 0x80000006
+	chunkLZFSE      = 0x80000007
+	chunkLZMA       = 0x80000008
+	chunkComment    = 0x7ffffffe
+	chunkTerminator = 0xffffffff
+)
+
+// chunk is one run of sectors in a block table, stored at offset (absolute
+// within the image) in length bytes.
+type chunk struct {
+	Type        uint32
+	Sector      int64 // First sector on the decompressed disk
+	SectorCount int64
+	Offset      int64
+	Length      int64
+}
+
+// zero reports whether the chunk's sectors read as zeros, without data in
+// the image.
+func (c chunk) zero() bool {
+	return c.Type == chunkZero || c.Type == chunkIgnore
+}
+
+// Partition is one entry of the image's block table ('blkx' resource).
+type Partition struct {
+	Name        string
+	Sector      int64 // First sector on the decompressed disk
+	SectorCount int64
+	Checksum    Checksum // Checksum of the decompressed partition data
+	chunks      []chunk
+}
+
+// Image is an opened UDIF image.
+type Image struct {
+	r          io.ReaderAt
+	size       int64
+	Trailer    Trailer
+	Partitions []Partition
+}
+
+// Open reads the trailer and block tables of the UDIF image in r, which is
+// size bytes long.
+func Open(r io.ReaderAt, size int64) (*Image, error) {
+	if size < trailerSize {
+		return nil, ErrNotDMG
+	}
+	b := make([]byte, trailerSize)
+	if _, err := r.ReadAt(b, size-trailerSize); err != nil {
+		return nil, err
+	}
+	if string(b[0:4]) != "koly" {
+		return nil, ErrNotDMG
+	}
+	t := Trailer{
+		Version:        binary.BigEndian.Uint32(b[4:8]),
+		DataForkOffset: int64(binary.BigEndian.Uint64(b[24:32])),
+		DataForkLength: int64(binary.BigEndian.Uint64(b[32:40])),
+		DataChecksum:   parseChecksum(b[80:216]),
+		XMLOffset:      int64(binary.BigEndian.Uint64(b[216:224])),
+		XMLLength:      int64(binary.BigEndian.Uint64(b[224:232])),
+		MasterChecksum: parseChecksum(b[352:488]),
+		SectorCount:    int64(binary.BigEndian.Uint64(b[492:500])),
+	}
+	// Ranges are compared by subtraction, which cannot overflow
+	if t.DataForkOffset < 0 || t.DataForkLength < 0 || t.DataForkLength > size-t.DataForkOffset {
+		return nil, fmt.Errorf("data fork lies outside the image")
+	}
+	if t.SectorCount < 0 || t.SectorCount > maxSectors {
+		return nil, fmt.Errorf("invalid disk size of %d sectors", uint64(t.SectorCount))
+	}
+	if t.XMLLength <= 0 || t.XMLOffset < 0 || t.XMLLength > size-t.XMLOffset {
+		return nil, fmt.Errorf("image has no property list (old-style resource fork images are not supported)")
+	}
+
+	plist := make([]byte, t.XMLLength)
+	if _, err := r.ReadAt(plist, t.XMLOffset); err != nil {
+		return nil, err
+	}
+	resources, err := blkxResources(plist)
+	if err != nil {
+		return nil, fmt.Errorf("property list: %v", err)
+	}
+
+	img := &Image{r: r, size: size, Trailer: t}
+	for i, res := range resources {
+		p, err := parseMish(res.data, t.DataForkOffset)
+		if err != nil {
+			return nil, fmt.Errorf("block table %d: %v", i, err)
+		}
+		p.Name = res.name
+		for _, c := range p.chunks {
+			if c.Offset < 0 || c.Length < 0 || c.Length > size-c.Offset {
+				return nil, fmt.Errorf("block table %d: chunk lies outside the image", i)
+			}
+			if t.SectorCount > 0 && c.Sector+c.SectorCount > t.SectorCount {
+				return nil, fmt.Errorf("block table %d: chunk lies past the end of the disk", i)
+			}
+		}
+		img.Partitions = append(img.Partitions, *p)
+	}
+	return img, nil
+}
+
+// Size returns the size of the decompressed disk in bytes.
+func (img *Image) Size() int64 {
+	if img.Trailer.SectorCount > 0 {
+		return img.Trailer.SectorCount * SectorSize
+	}
+	var end int64
+	for _, p := range img.Partitions {
+		if e := p.Sector + p.SectorCount; e > end {
+			end = e
+		}
+	}
+	return end * SectorSize
+}
+
+// parseMish parses a 'mish' block table. Chunk offsets in it are relative
+// to the data fork, which starts at dataFork.
+func parseMish(b []byte, dataFork int64) (*Partition, error) {
+	const headerSize = 204
+	if len(b) < headerSize || string(b[0:4]) != "mish" {
+		return nil, fmt.Errorf("not a 'mish' block table")
+	}
+	p := &Partition{
+		Sector:      int64(binary.BigEndian.Uint64(b[8:16])),
+		SectorCount: int64(binary.BigEndian.Uint64(b[16:24])),
+		Checksum:    parseChecksum(b[64:200]),
+	}
+	base := dataFork + int64(binary.BigEndian.Uint64(b[24:32]))
+	count := int(binary.BigEndian.Uint32(b[200:204]))
+	if count < 0 || count > (len(b)-headerSize)/40 {
+		return nil, fmt.Errorf("truncated block table")
+	}
+	for i := 0; i < count; i++ {
+		e := b[headerSize+40*i:]
+		c := chunk{
+			Type:        binary.BigEndian.Uint32(e[0:4]),
+			Sector:      p.Sector + int64(binary.BigEndian.Uint64(e[8:16])),
+			SectorCount: int64(binary.BigEndian.Uint64(e[16:24])),
+			Offset:      base + int64(binary.BigEndian.Uint64(e[24:32])),
+			Length:      int64(binary.BigEndian.Uint64(e[32:40])),
+		}
+		switch c.Type {
+		case chunkComment:
+			continue
+		case chunkTerminator:
+			return p, nil
+		}
+		if c.Sector < 0 || c.SectorCount < 0 || c.SectorCount > maxSectors-c.Sector {
+			return nil, fmt.Errorf("chunk %d has an invalid sector range", i)
+		}
+		if !c.zero() && c.SectorCount > maxChunkSize/SectorSize {
+			return nil, fmt.Errorf("chunk %d is too large (%d sectors)", i, c.SectorCount)
+		}
+		p.chunks = append(p.chunks, c)
+	}
+	return p, nil
+}
+
+type blkxResource struct {
+	name string
+	data []byte
+}
+
+// blkxResources returns the 'blkx' entries of a UDIF property list, in order.
+func blkxResources(plist []byte) ([]blkxResource, error) {
+	d := xml.NewDecoder(bytes.NewReader(plist))
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return nil, err
+		}
+		if se, ok := tok.(xml.StartElement); ok && se.Name.Local == "dict" {
+			v, err := plistValue(d, se)
+			if err != nil {
+				return nil, err
+			}
+			root, _ := v.(map[string]interface{})
+			fork, _ := root["resource-fork"].(map[string]interface{})
+			entries, _ := fork["blkx"].([]interface{})
+			if len(entries) == 0 {
+				return nil, fmt.Errorf("no 'blkx' resources")
+			}
+			var out []blkxResource
+			for _, e := range entries {
+				entry, _ := e.(map[string]interface{})
+				data, _ := entry["Data"].([]byte)
+				name, _ := entry["Name"].(string)
+				if name == "" {
+					name, _ = entry["CFName"].(string)
+				}
+				out = append(out, blkxResource{name: name, data: data})
+			}
+			return out, nil
+		}
+	}
+}
+
+// plistValue decodes the property list element that starts with se into
+// map[string]interface{}, []interface{}, string, []byte or bool.
+func plistValue(d *xml.Decoder, se xml.StartElement) (interface{}, error) {
+	switch se.Name.Local {
+	case "dict":
+		m := make(map[string]interface{})
+		key := ""
+		for {
+			tok, err := d.Token()
+			if err != nil {
+				return nil, err
+			}
+			switch t := tok.(type) {
+			case xml.StartElement:
+				if t.Name.Local == "key" {
+					var k string
+					if err := d.DecodeElement(&k, &t); err != nil {
+						return nil, err
+					}
+					key = k
+					continue
+				}
+				v, err := plistValue(d, t)
+				if err != nil {
+					return nil, err
+				}
+				m[key] = v
+			case xml.EndElement:
+				return m, nil
+			}
+		}
+	case "array":
+		var a []interface{}
+		for {
+			tok, err := d.Token()
+			if err != nil {
+				return nil, err
+			}
+			switch t := tok.(type) {
+			case xml.StartElement:
+				v, err := plistValue(d, t)
+				if err != nil {
+					return nil, err
+				}
+				a = append(a, v)
+			case xml.EndElement:
+				return a, nil
+			}
+		}
+	case "true", "false":
+		if err := d.Skip(); err != nil {
+			return nil, err
+		}
+		return se.Name.Local == "true", nil
+	}
+	var text string
+	if err := d.DecodeElement(&text, &se); err != nil {
+		return nil, err
+	}
+	if se.Name.Local == "data" {
+		text = strings.Map(func(r rune) rune {
+			if r == ' ' || r == '\t' || r == '\n' || r == '\r' {
+				return -1
+			}
+			return r
+		}, text)
+		return base64.StdEncoding.DecodeString(text)
+	}
+	return text, nil
+}
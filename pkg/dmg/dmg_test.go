@@ -0,0 +1,369 @@
+package dmg
+
+import (
+	"bytes"
+	"compress/zlib"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"strings"
+	"testing"
+)
+
+// testChunk is a chunk of a block table under construction: its sectors
+// relative to the partition and its data in the data fork.
+type testChunk struct {
+	kind         uint32
+	sector, size int64 // In sectors
+	data         []byte
+}
+
+// udif assembles a UDIF image from partitions of chunks, starting at the
+// given sectors, with correct checksums. The edit functions (if non-nil)
+// change the block tables, trailer or property list before they are
+// written.
+type udif struct {
+	starts     []int64
+	partitions [][]testChunk
+	sectors    int64 // Disk size for the trailer
+	noCRC      bool  // Leave out partition checksums, for huge disks
+
+	editMish    func(i int, mish []byte)
+	editTrailer func(koly []byte)
+	plist       func(blkx string) string
+}
+
+func (u udif) build() []byte {
+	var fork bytes.Buffer
+	var blkx string
+	var master []byte
+	for i, chunks := range u.partitions {
+		crc := crc32.NewIEEE()
+		mish := make([]byte, 204+40*(len(chunks)+1))
+		copy(mish, "mish")
+		binary.BigEndian.PutUint32(mish[4:8], 1)
+		binary.BigEndian.PutUint64(mish[8:16], uint64(u.starts[i]))
+		for j, c := range chunks {
+			e := mish[204+40*j:]
+			binary.BigEndian.PutUint32(e[0:4], c.kind)
+			binary.BigEndian.PutUint64(e[8:16], uint64(c.sector))
+			binary.BigEndian.PutUint64(e[16:24], uint64(c.size))
+			binary.BigEndian.PutUint64(e[24:32], uint64(fork.Len()))
+			binary.BigEndian.PutUint64(e[32:40], uint64(len(c.data)))
+			fork.Write(c.data)
+			if !u.noCRC {
+				crc.Write(decompressed(c))
+			}
+			if end := u.starts[i] + c.sector + c.size; end > int64(binary.BigEndian.Uint64(mish[16:24]))+u.starts[i] {
+				binary.BigEndian.PutUint64(mish[16:24], uint64(end-u.starts[i]))
+			}
+		}
+		binary.BigEndian.PutUint32(mish[204+40*len(chunks):], chunkTerminator)
+		binary.BigEndian.PutUint32(mish[200:204], uint32(len(chunks)+1))
+		binary.BigEndian.PutUint32(mish[64:68], ChecksumCRC32)
+		binary.BigEndian.PutUint32(mish[68:72], 32)
+		binary.BigEndian.PutUint32(mish[72:76], crc.Sum32())
+		master = binary.BigEndian.AppendUint32(master, crc.Sum32())
+		if u.editMish != nil {
+			u.editMish(i, mish)
+		}
+		blkx += fmt.Sprintf("<dict><key>Name</key><string>part %d</string><key>Data</key><data>\n%s\n</data></dict>", i, base64.StdEncoding.EncodeToString(mish))
+	}
+
+	plist := `<?xml version="1.0" encoding="UTF-8"?><plist version="1.0"><dict><key>resource-fork</key><dict><key>blkx</key><array>` + blkx + `</array><key>plst</key><array/></dict></dict></plist>`
+	if u.plist != nil {
+		plist = u.plist(blkx)
+	}
+	img := append(fork.Bytes(), plist...)
+	koly := make([]byte, trailerSize)
+	copy(koly, "koly")
+	binary.BigEndian.PutUint32(koly[4:8], 4)
+	binary.BigEndian.PutUint64(koly[32:40], uint64(fork.Len()))
+	binary.BigEndian.PutUint32(koly[80:84], ChecksumCRC32)
+	binary.BigEndian.PutUint32(koly[84:88], 32)
+	binary.BigEndian.PutUint32(koly[88:92], crc32.ChecksumIEEE(fork.Bytes()))
+	binary.BigEndian.PutUint64(koly[216:224], uint64(fork.Len()))
+	binary.BigEndian.PutUint64(koly[224:232], uint64(len(plist)))
+	binary.BigEndian.PutUint32(koly[352:356], ChecksumCRC32)
+	binary.BigEndian.PutUint32(koly[356:360], 32)
+	binary.BigEndian.PutUint32(koly[360:364], crc32.ChecksumIEEE(master))
+	binary.BigEndian.PutUint64(koly[492:500], uint64(u.sectors))
+	if u.editTrailer != nil {
+		u.editTrailer(koly)
+	}
+	return append(img, koly...)
+}
+
+// decompressed returns the sectors a test chunk stands for.
+func decompressed(c testChunk) []byte {
+	out := make([]byte, c.size*SectorSize)
+	switch c.kind {
+	case chunkRaw:
+		copy(out, c.data)
+	case chunkADC, chunkZlib:
+		copy(out, sectorData(c.sector, c.size))
+	}
+	return out
+}
+
+// sectorData is the content the compressed test chunks hold.
+func sectorData(sector, n int64) []byte {
+	return bytes.Repeat([]byte(fmt.Sprintf("sector %04d ", sector)), int(n*SectorSize/12+1))[:n*SectorSize]
+}
+
+func zlibChunk(sector, n int64) testChunk {
+	var b bytes.Buffer
+	w := zlib.NewWriter(&b)
+	w.Write(sectorData(sector, n))
+	w.Close()
+	return testChunk{chunkZlib, sector, n, b.Bytes()}
+}
+
+// adcChunk encodes sectorData as ADC literal runs of up to 128 bytes.
+func adcChunk(sector, n int64) testChunk {
+	var b []byte
+	data := sectorData(sector, n)
+	for len(data) > 0 {
+		k := len(data)
+		if k > 128 {
+			k = 128
+		}
+		b = append(append(b, 0x80|byte(k-1)), data[:k]...)
+		data = data[k:]
+	}
+	return testChunk{chunkADC, sector, n, b}
+}
+
+// testDisk is a disk of two partitions: raw, ADC and zero chunks at
+// sectors 0-3, and a zlib chunk after a gap at sectors 8-9.
+func testDisk() udif {
+	return udif{
+		starts: []int64{0, 8},
+		partitions: [][]testChunk{
+			{
+				{chunkRaw, 0, 1, []byte("raw sector")},
+				adcChunk(1, 1),
+				{chunkZero, 2, 2, nil},
+			},
+			{zlibChunk(0, 2)},
+		},
+		sectors: 10,
+	}
+}
+
+func open(t *testing.T, data []byte) *Image {
+	t.Helper()
+	img, err := Open(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return img
+}
+
+func TestVerify(t *testing.T) {
+	img := open(t, testDisk().build())
+	if len(img.Partitions) != 2 || img.Partitions[1].Name != "part 1" {
+		t.Fatalf("Partitions = %+v", img.Partitions)
+	}
+	if got := img.Size(); got != 10*SectorSize {
+		t.Errorf("Size = %d, want %d", got, 10*SectorSize)
+	}
+	result, err := img.Verify(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.OK() || len(result.Checks) != 4 || result.Skipped != 0 {
+		t.Errorf("Verify = %+v, want 4 passing checks", result)
+	}
+}
+
+func TestVerifyDamage(t *testing.T) {
+	data := testDisk().build()
+	data[0] = 'R' // In the raw chunk
+	result, err := open(t, data).Verify(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	failed := map[string]bool{}
+	for _, c := range result.Checks {
+		if !c.OK {
+			failed[c.Name] = true
+		}
+	}
+	if len(failed) != 2 || !failed["data fork"] || !failed["part 0"] {
+		t.Errorf("failed checks %v, want data fork and part 0", failed)
+	}
+}
+
+func TestDisk(t *testing.T) {
+	disk := open(t, testDisk().build()).Disk()
+	want := make([]byte, 10*SectorSize)
+	copy(want, "raw sector")
+	copy(want[1*SectorSize:], sectorData(1, 1))
+	copy(want[8*SectorSize:], sectorData(0, 2))
+	got, err := io.ReadAll(disk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("disk differs from its chunks")
+	}
+	// Reads spanning chunks and gaps
+	for _, off := range []int64{0, 500, 1000, 2000, 4000, 4600} {
+		p := make([]byte, 700)
+		n, err := disk.ReadAt(p, off)
+		if err != nil && err != io.EOF {
+			t.Fatalf("ReadAt(%d): %v", off, err)
+		}
+		if !bytes.Equal(p[:n], want[off:off+int64(n)]) {
+			t.Errorf("ReadAt(%d) differs", off)
+		}
+	}
+}
+
+func TestHugeZeroChunk(t *testing.T) {
+	// A zero chunk of a petabyte reads without being held in memory
+	const sectors = 1 << 41
+	u := udif{
+		starts:     []int64{0},
+		partitions: [][]testChunk{{{chunkRaw, 0, 1, []byte("x")}, {chunkZero, 1, sectors, nil}}},
+		sectors:    sectors + 1,
+		noCRC:      true,
+	}
+	disk := open(t, u.build()).Disk()
+	p := bytes.Repeat([]byte{1}, 4096)
+	if _, err := disk.ReadAt(p, sectors/2*SectorSize-1000); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(p, make([]byte, len(p))) {
+		t.Error("zero chunk read as non-zero")
+	}
+}
+
+func TestOpenErrors(t *testing.T) {
+	put64 := func(off int, v uint64) func([]byte) {
+		return func(b []byte) { binary.BigEndian.PutUint64(b[off:], v) }
+	}
+	chunk64 := func(field int, v uint64) func(int, []byte) {
+		return func(i int, mish []byte) {
+			if i == 0 {
+				binary.BigEndian.PutUint64(mish[204+field:], v)
+			}
+		}
+	}
+	tests := []struct {
+		name string
+		u    func() udif
+		data func([]byte) []byte // Changes the built image
+		want string              // Expected in the error
+	}{
+		{name: "empty", data: func([]byte) []byte { return nil }, want: "not a UDIF"},
+		{name: "truncated trailer", data: func(b []byte) []byte { return b[:len(b)-1] }, want: "not a UDIF"},
+		{name: "data fork past the end", u: trailer(put64(32, 1<<40)), want: "data fork lies outside"},
+		{name: "data fork offset overflow", u: trailer(put64(24, math.MaxInt64-10), put64(32, 100)), want: "data fork lies outside"},
+		{name: "property list past the end", u: trailer(put64(224, 1<<40)), want: "no property list"},
+		{name: "property list length overflow", u: trailer(put64(216, 100), put64(224, math.MaxInt64-50)), want: "no property list"},
+		{name: "no property list", u: trailer(put64(224, 0)), want: "no property list"},
+		{name: "disk size overflow", u: trailer(put64(492, 1<<60)), want: "invalid disk size"},
+		{name: "truncated property list", u: plist(func(blkx string) string { return `<plist><dict><key>resource-fork</key><dict>` }), want: "property list"},
+		{name: "no blkx resources", u: plist(func(string) string { return `<plist><dict></dict></plist>` }), want: "no 'blkx' resources"},
+		{name: "bad base64", u: plist(func(string) string {
+			return `<plist><dict><key>resource-fork</key><dict><key>blkx</key><array><dict><key>Data</key><data>!!</data></dict></array></dict></dict></plist>`
+		}), want: "property list"},
+		{name: "not a block table", u: mish(func(i int, b []byte) { copy(b, "nope") }), want: "not a 'mish' block table"},
+		{name: "truncated block table", u: mish(func(i int, b []byte) { binary.BigEndian.PutUint32(b[200:], 1000) }), want: "truncated block table"},
+		{name: "chunk past the end", u: mish(chunk64(24, 1<<40)), want: "chunk lies outside the image"},
+		{name: "chunk length overflow", u: mish(chunk64(32, math.MaxInt64-5)), want: "chunk lies outside the image"},
+		{name: "chunk sector overflow", u: mish(chunk64(16, math.MaxInt64/2)), want: "invalid sector range"},
+		{name: "negative chunk sector", u: mish(chunk64(8, math.MaxUint64)), want: "invalid sector range"},
+		{name: "oversized data chunk", u: mish(chunk64(16, maxChunkSize/SectorSize+1)), want: "too large"},
+		{name: "chunk past the end of the disk", u: mish(chunk64(16, 100)), want: "past the end of the disk"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := testDisk()
+			if tt.u != nil {
+				u = tt.u()
+			}
+			data := u.build()
+			if tt.data != nil {
+				data = tt.data(data)
+			}
+			_, err := Open(bytes.NewReader(data), int64(len(data)))
+			if err == nil {
+				t.Fatal("Open succeeded")
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error %q, want %q", err, tt.want)
+			}
+		})
+	}
+	if _, err := Open(bytes.NewReader(nil), 0); !errors.Is(err, ErrNotDMG) {
+		t.Errorf("Open(empty) = %v, want ErrNotDMG", err)
+	}
+}
+
+// trailer, plist and mish return the test disk with its trailer, property
+// list or block tables changed.
+func trailer(edits ...func([]byte)) func() udif {
+	return func() udif {
+		u := testDisk()
+		u.editTrailer = func(b []byte) {
+			for _, edit := range edits {
+				edit(b)
+			}
+		}
+		return u
+	}
+}
+
+func plist(f func(blkx string) string) func() udif {
+	return func() udif {
+		u := testDisk()
+		u.plist = f
+		return u
+	}
+}
+
+func mish(f func(i int, mish []byte)) func() udif {
+	return func() udif {
+		u := testDisk()
+		u.editMish = f
+		return u
+	}
+}
+
+func TestCorruptChunks(t *testing.T) {
+	tests := []struct {
+		name  string
+		chunk testChunk
+	}{
+		{"ADC literal past the data", testChunk{chunkADC, 0, 1, []byte{0xFF, 1, 2}}},
+		{"ADC reference before the start", testChunk{chunkADC, 0, 1, []byte{0x80, 'a', 0x40, 0x10, 0x00}}},
+		{"ADC output short", testChunk{chunkADC, 0, 1, []byte{0x80, 'a'}}},
+		{"zlib garbage", testChunk{chunkZlib, 0, 1, []byte("not zlib")}},
+		{"bzip2 garbage", testChunk{chunkBzip2, 0, 1, []byte("not bzip2")}},
+		{"LZFSE", testChunk{chunkLZFSE, 0, 1, []byte("bvx2")}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := udif{starts: []int64{0}, partitions: [][]testChunk{{tt.chunk}}, sectors: 1}
+			img := open(t, u.build())
+			if _, err := io.ReadAll(img.Disk()); err == nil {
+				t.Error("reading the disk succeeded")
+			}
+			result, err := img.Verify(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.OK() {
+				t.Error("Verify passed")
+			}
+		})
+	}
+}
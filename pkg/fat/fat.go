@@ -0,0 +1,595 @@
+// Package fat reads FAT12, FAT16 and FAT32 file systems, such as the EFI
+// System Partition images embedded in bootable ISO images, as a read-only
+// io/fs.FS. Long file names are used when present; names are matched
+// case-insensitively, as FAT does.
+package fat
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf16"
+)
+
+// ErrNotFAT is returned by NewFS when r holds no FAT file system.
+var ErrNotFAT = errors.New("no FAT file system found")
+
+// maxFATSize bounds the allocation table read into memory. The FAT of a
+// 2 GiB FAT32 volume with 4 KiB clusters is 2 MiB; ESPs are far smaller.
+const maxFATSize = 64 << 20
+
+// dirEntrySize is the size of a directory entry, short or long name.
+const dirEntrySize = 32
+
+// maxDirSize is the size of the largest directory FAT allows, 65536
+// entries.
+const maxDirSize = 65536 * dirEntrySize
+
+// ErrDirectoryLoop is returned for a directory whose cluster is that of a
+// directory already read, which would otherwise be walked forever.
+var ErrDirectoryLoop = errors.New("directory loop")
+
+// Attribute bits of a directory entry.
+const (
+	attrVolumeID = 0x08
+	attrDir      = 0x10
+	attrLongName = 0x0F
+)
+
+// FS is a read-only io/fs.FS over the files of a FAT file system.
+type FS struct {
+	r    io.ReaderAt
+	kind int // 12, 16 or 32
+
+	clusterSize int64
+	clusters    uint32 // Number of data clusters
+	dataOffset  int64  // Where cluster 2 starts
+	size        int64  // Bytes of the volume, from its boot sector
+	label       string
+	fat         []byte
+
+	root    *entry
+	visited map[uint32]string // Names of the directories read, by cluster
+	mu      sync.Mutex        // Guards lazy loading of directory children
+}
+
+type extent struct {
+	offset int64
+	length int64
+}
+
+type entry struct {
+	name    string
+	dir     bool
+	size    int64
+	modTime time.Time
+	cluster uint32
+
+	// The root directory of FAT12 and FAT16 is a fixed area, not a chain
+	fixed *extent
+
+	loaded   bool
+	children []*entry
+}
+
+// NewFS reads the boot sector and allocation table of the FAT file system
+// in r.
+func NewFS(r io.ReaderAt) (*FS, error) {
+	boot := make([]byte, 512)
+	if _, err := r.ReadAt(boot, 0); err != nil {
+		return nil, err
+	}
+	if boot[510] != 0x55 || boot[511] != 0xAA || (boot[0] != 0xEB && boot[0] != 0xE9) {
+		return nil, ErrNotFAT
+	}
+	bytesPerSector := int64(binary.LittleEndian.Uint16(boot[11:13]))
+	sectorsPerCluster := int64(boot[13])
+	reserved := int64(binary.LittleEndian.Uint16(boot[14:16]))
+	fats := int64(boot[16])
+	rootEntries := int64(binary.LittleEndian.Uint16(boot[17:19]))
+	sectors := int64(binary.LittleEndian.Uint16(boot[19:21]))
+	fatSectors := int64(binary.LittleEndian.Uint16(boot[22:24]))
+	if sectors == 0 {
+		sectors = int64(binary.LittleEndian.Uint32(boot[32:36]))
+	}
+	fat32 := fatSectors == 0
+	if fat32 {
+		fatSectors = int64(binary.LittleEndian.Uint32(boot[36:40]))
+	}
+	switch bytesPerSector {
+	case 512, 1024, 2048, 4096:
+	default:
+		return nil, ErrNotFAT
+	}
+	if sectorsPerCluster == 0 || sectorsPerCluster&(sectorsPerCluster-1) != 0 || reserved == 0 || fats == 0 || fatSectors == 0 {
+		return nil, ErrNotFAT
+	}
+
+	rootSectors := (rootEntries*dirEntrySize + bytesPerSector - 1) / bytesPerSector
+	firstData := reserved + fats*fatSectors + rootSectors
+	if sectors <= firstData {
+		return nil, ErrNotFAT
+	}
+	f := &FS{
+		r:           r,
+		clusterSize: bytesPerSector * sectorsPerCluster,
+		clusters:    uint32((sectors - firstData) / sectorsPerCluster),
+		dataOffset:  firstData * bytesPerSector,
+		size:        sectors * bytesPerSector,
+		visited:     make(map[uint32]string),
+	}
+	// The cluster count alone decides the FAT type
+	switch {
+	case f.clusters < 4085:
+		f.kind = 12
+	case f.clusters < 65525:
+		f.kind = 16
+	default:
+		f.kind = 32
+	}
+	if fat32 != (f.kind == 32) {
+		return nil, fmt.Errorf("inconsistent FAT boot sector: %d clusters do not fit its layout", f.clusters)
+	}
+
+	fatSize := fatSectors * bytesPerSector
+	if fatSize > maxFATSize {
+		return nil, fmt.Errorf("FAT of %d bytes is too large", fatSize)
+	}
+	f.fat = make([]byte, fatSize)
+	if _, err := r.ReadAt(f.fat, reserved*bytesPerSector); err != nil {
+		return nil, err
+	}
+
+	f.root = &entry{name: ".", dir: true}
+	if f.kind == 32 {
+		f.root.cluster = binary.LittleEndian.Uint32(boot[44:48])
+		f.label = volumeLabel(boot[71:82])
+	} else {
+		f.root.fixed = &extent{offset: (reserved + fats*fatSectors) * bytesPerSector, length: rootEntries * dirEntrySize}
+		f.label = volumeLabel(boot[43:54])
+	}
+	return f, nil
+}
+
+// Type returns "FAT12", "FAT16" or "FAT32".
+func (f *FS) Type() string {
+	return fmt.Sprintf("FAT%d", f.kind)
+}
+
+// Size returns the size in bytes of the volume, as its boot sector declares.
+func (f *FS) Size() int64 {
+	return f.size
+}
+
+// Label returns the volume label, from the root directory if it has one or
+// else from the boot sector.
+func (f *FS) Label() string {
+	// Reading the root directory picks up its label entry
+	f.loadChildren(f.root)
+	return f.label
+}
+
+// volumeLabel trims a space-padded label, leaving out the "NO NAME" of
+// volumes without one.
+func volumeLabel(b []byte) string {
+	label := strings.TrimRight(string(b), " \x00")
+	if label == "NO NAME" {
+		return ""
+	}
+	return label
+}
+
+// next returns the cluster following c in its chain, and whether c is the
+// last one.
+func (f *FS) next(c uint32) (uint32, bool, error) {
+	var n, last uint32
+	switch f.kind {
+	case 12:
+		off := int(c) + int(c)/2
+		if off+2 > len(f.fat) {
+			return 0, false, fmt.Errorf("cluster %d is outside the FAT", c)
+		}
+		n = uint32(binary.LittleEndian.Uint16(f.fat[off:]))
+		if c&1 != 0 {
+			n >>= 4
+		} else {
+			n &= 0xFFF
+		}
+		last = 0xFF8
+	case 16:
+		off := 2 * int(c)
+		if off+2 > len(f.fat) {
+			return 0, false, fmt.Errorf("cluster %d is outside the FAT", c)
+		}
+		n = uint32(binary.LittleEndian.Uint16(f.fat[off:]))
+		last = 0xFFF8
+	default:
+		off := 4 * int(c)
+		if off+4 > len(f.fat) {
+			return 0, false, fmt.Errorf("cluster %d is outside the FAT", c)
+		}
+		n = binary.LittleEndian.Uint32(f.fat[off:]) & 0x0FFFFFFF
+		last = 0x0FFFFFF8
+	}
+	if n >= last {
+		return 0, true, nil
+	}
+	if n < 2 || n >= f.clusters+2 {
+		return 0, false, fmt.Errorf("broken cluster chain at cluster %d", c)
+	}
+	return n, false, nil
+}
+
+// extents returns the byte ranges of the cluster chain starting at start,
+// merging adjacent clusters. If size is positive, the chain is cut to it.
+func (f *FS) extents(start uint32, size int64) ([]extent, error) {
+	var out []extent
+	if start == 0 {
+		return nil, nil
+	}
+	if start < 2 || start >= f.clusters+2 {
+		return nil, fmt.Errorf("invalid start cluster %d", start)
+	}
+	remaining := size
+	for c, n := start, uint32(0); ; n++ {
+		// A chain longer than the volume loops
+		if n > f.clusters {
+			return nil, fmt.Errorf("cluster chain from %d loops", start)
+		}
+		offset := f.dataOffset + int64(c-2)*f.clusterSize
+		length := f.clusterSize
+		if size > 0 && remaining < length {
+			length = remaining
+		}
+		if k := len(out) - 1; k >= 0 && out[k].offset+out[k].length == offset {
+			out[k].length += length
+		} else {
+			out = append(out, extent{offset: offset, length: length})
+		}
+		remaining -= length
+		if size > 0 && remaining <= 0 {
+			return out, nil
+		}
+		next, last, err := f.next(c)
+		if err != nil {
+			return nil, err
+		}
+		if last {
+			break
+		}
+		c = next
+	}
+	if size > 0 && remaining > 0 {
+		return nil, fmt.Errorf("cluster chain from %d is shorter than the file", start)
+	}
+	return out, nil
+}
+
+// readExtents reads the bytes of a list of extents.
+func (f *FS) readExtents(extents []extent) ([]byte, error) {
+	var total int64
+	for _, x := range extents {
+		total += x.length
+	}
+	data := make([]byte, total)
+	pos := int64(0)
+	for _, x := range extents {
+		if _, err := f.r.ReadAt(data[pos:pos+x.length], x.offset); err != nil {
+			return nil, err
+		}
+		pos += x.length
+	}
+	return data, nil
+}
+
+// loadChildren reads the directory's entries, assembling long names.
+func (f *FS) loadChildren(dir *entry) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if dir.loaded {
+		return nil
+	}
+
+	var extents []extent
+	if dir.fixed != nil {
+		extents = []extent{*dir.fixed}
+	} else {
+		if name, ok := f.visited[dir.cluster]; ok && dir.cluster != 0 {
+			return fmt.Errorf("%w: directory %s is directory %s again", ErrDirectoryLoop, dir.name, name)
+		}
+		f.visited[dir.cluster] = dir.name
+		var err error
+		if extents, err = f.extents(dir.cluster, 0); err != nil {
+			return err
+		}
+	}
+	var total int64
+	for _, x := range extents {
+		total += x.length
+	}
+	if total > maxDirSize {
+		return fmt.Errorf("directory %s is larger than FAT allows", dir.name)
+	}
+	data, err := f.readExtents(extents)
+	if err != nil {
+		return err
+	}
+
+	var children []*entry
+	var long []uint16
+	var longSum byte
+	for pos := 0; pos+dirEntrySize <= len(data); pos += dirEntrySize {
+		rec := data[pos : pos+dirEntrySize]
+		if rec[0] == 0 {
+			break
+		}
+		if rec[0] == 0xE5 {
+			long = nil
+			continue
+		}
+		attr := rec[11]
+		if attr&0x3F == attrLongName {
+			seq := int(rec[0] & 0x1F)
+			if rec[0]&0x40 != 0 {
+				long = make([]uint16, 13*seq)
+				longSum = rec[13]
+			}
+			if seq == 0 || 13*seq > len(long) || rec[13] != longSum {
+				long = nil
+				continue
+			}
+			part := long[13*(seq-1) : 13*seq]
+			for i, off := range []int{1, 3, 5, 7, 9, 14, 16, 18, 20, 22, 24, 28, 30} {
+				part[i] = binary.LittleEndian.Uint16(rec[off:])
+			}
+			continue
+		}
+		name := shortName(rec)
+		if long != nil && checksum(rec[:11]) == longSum {
+			name = longName(long)
+		}
+		long = nil
+		if attr&attrVolumeID != 0 {
+			if dir == f.root && attr&attrDir == 0 {
+				f.label = volumeLabel(rec[:11])
+			}
+			continue
+		}
+		if !validName(name) {
+			// Besides "." and "..", a long name may be empty or hold a
+			// slash, which would make its path name some other entry
+			continue
+		}
+		cluster := uint32(binary.LittleEndian.Uint16(rec[26:28]))
+		if f.kind == 32 {
+			cluster |= uint32(binary.LittleEndian.Uint16(rec[20:22])) << 16
+		}
+		children = append(children, &entry{
+			name:    name,
+			dir:     attr&attrDir != 0,
+			size:    int64(binary.LittleEndian.Uint32(rec[28:32])),
+			modTime: dosTime(binary.LittleEndian.Uint16(rec[24:26]), binary.LittleEndian.Uint16(rec[22:24])),
+			cluster: cluster,
+		})
+	}
+
+	sort.Slice(children, func(i, j int) bool { return children[i].name < children[j].name })
+	dir.children = children
+	dir.loaded = true
+	return nil
+}
+
+// shortName returns the 8.3 name of an entry, lower-cased where Windows NT
+// marks the base name or extension as lower case.
+func shortName(rec []byte) string {
+	base := strings.TrimRight(string(rec[0:8]), " ")
+	ext := strings.TrimRight(string(rec[8:11]), " ")
+	if rec[0] == 0x05 {
+		base = "\xE5" + base[1:]
+	}
+	if rec[12]&0x08 != 0 {
+		base = strings.ToLower(base)
+	}
+	if rec[12]&0x10 != 0 {
+		ext = strings.ToLower(ext)
+	}
+	if ext == "" {
+		return base
+	}
+	return base + "." + ext
+}
+
+// longName decodes the UTF-16 long name, which ends at a NUL or runs to
+// the end of its last entry.
+func longName(units []uint16) string {
+	for i, u := range units {
+		if u == 0 {
+			units = units[:i]
+			break
+		}
+	}
+	return string(utf16.Decode(units))
+}
+
+// checksum is the checksum of a short name that its long name entries
+// carry, tying them to it.
+func checksum(name []byte) byte {
+	var sum byte
+	for _, b := range name {
+		sum = (sum&1)<<7 + sum>>1 + b
+	}
+	return sum
+}
+
+// dosTime decodes a FAT date and time, which are local time of the machine
+// that wrote them; they are read as UTC.
+func dosTime(date, t uint16) time.Time {
+	if date == 0 {
+		return time.Time{}
+	}
+	return time.Date(int(date>>9)+1980, time.Month(date>>5&0x0F), int(date&0x1F),
+		int(t>>11), int(t>>5&0x3F), int(t&0x1F)*2, 0, time.UTC)
+}
+
+// validName reports whether name is usable as a single path element.
+func validName(name string) bool {
+	return name != "." && !strings.Contains(name, "/") && fs.ValidPath(name)
+}
+
+// lookup resolves a slash-separated path to its entry.
+func (f *FS) lookup(name string) (*entry, error) {
+	if !fs.ValidPath(name) {
+		return nil, fs.ErrInvalid
+	}
+	e := f.root
+	if name == "." {
+		return e, nil
+	}
+	for _, part := range strings.Split(name, "/") {
+		if !e.dir {
+			return nil, fs.ErrNotExist
+		}
+		if err := f.loadChildren(e); err != nil {
+			return nil, err
+		}
+		var match *entry
+		for _, child := range e.children {
+			if strings.EqualFold(child.name, part) {
+				match = child
+				break
+			}
+		}
+		if match == nil {
+			return nil, fs.ErrNotExist
+		}
+		e = match
+	}
+	return e, nil
+}
+
+// Open implements fs.FS.
+func (f *FS) Open(name string) (fs.File, error) {
+	e, err := f.lookup(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	file := &file{fsys: f, e: e}
+	if !e.dir {
+		extents, err := f.extents(e.cluster, e.size)
+		if err != nil {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+		}
+		file.r = f.reader(extents)
+	}
+	return file, nil
+}
+
+// ReadDir implements fs.ReadDirFS.
+func (f *FS) ReadDir(name string) ([]fs.DirEntry, error) {
+	e, err := f.lookup(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: err}
+	}
+	if !e.dir {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+	if err := f.loadChildren(e); err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: err}
+	}
+	entries := make([]fs.DirEntry, len(e.children))
+	for i, child := range e.children {
+		entries[i] = fs.FileInfoToDirEntry(fileInfo{child})
+	}
+	return entries, nil
+}
+
+// Stat implements fs.StatFS.
+func (f *FS) Stat(name string) (fs.FileInfo, error) {
+	e, err := f.lookup(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: err}
+	}
+	return fileInfo{e}, nil
+}
+
+func (f *FS) reader(extents []extent) io.Reader {
+	readers := make([]io.Reader, len(extents))
+	for i, x := range extents {
+		readers[i] = io.NewSectionReader(f.r, x.offset, x.length)
+	}
+	return io.MultiReader(readers...)
+}
+
+type file struct {
+	fsys   *FS
+	e      *entry
+	r      io.Reader
+	read   int64
+	dirPos int
+}
+
+func (f *file) Stat() (fs.FileInfo, error) { return fileInfo{f.e}, nil }
+func (f *file) Close() error               { return nil }
+
+func (f *file) Read(b []byte) (int, error) {
+	if f.e.dir {
+		return 0, &fs.PathError{Op: "read", Path: f.e.name, Err: fs.ErrInvalid}
+	}
+	n, err := f.r.Read(b)
+	f.read += int64(n)
+	if err == io.EOF && f.read < f.e.size {
+		// The image ends inside the file
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+// ReadDir implements fs.ReadDirFile.
+func (f *file) ReadDir(n int) ([]fs.DirEntry, error) {
+	if !f.e.dir {
+		return nil, &fs.PathError{Op: "readdir", Path: f.e.name, Err: fs.ErrInvalid}
+	}
+	if err := f.fsys.loadChildren(f.e); err != nil {
+		return nil, err
+	}
+	remaining := f.e.children[f.dirPos:]
+	if n > 0 && len(remaining) > n {
+		remaining = remaining[:n]
+	}
+	if n > 0 && len(remaining) == 0 {
+		return nil, io.EOF
+	}
+	f.dirPos += len(remaining)
+	entries := make([]fs.DirEntry, len(remaining))
+	for i, child := range remaining {
+		entries[i] = fs.FileInfoToDirEntry(fileInfo{child})
+	}
+	return entries, nil
+}
+
+type fileInfo struct{ e *entry }
+
+func (i fileInfo) Name() string       { return path.Base(i.e.name) }
+func (i fileInfo) Size() int64        { return i.e.size }
+func (i fileInfo) ModTime() time.Time { return i.e.modTime }
+func (i fileInfo) IsDir() bool        { return i.e.dir }
+func (i fileInfo) Sys() interface{}   { return nil }
+
+func (i fileInfo) Mode() fs.FileMode {
+	if i.e.dir {
+		return fs.ModeDir | 0555
+	}
+	return 0444
+}
+
+var (
+	_ fs.ReadDirFS = (*FS)(nil)
+	_ fs.StatFS    = (*FS)(nil)
+)
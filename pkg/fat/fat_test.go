@@ -0,0 +1,333 @@
+package fat
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/fs"
+	"strings"
+	"testing"
+	"unicode/utf16"
+)
+
+// Layout of the images newImage builds: a boot sector, one FAT sector, one
+// root directory sector of 16 entries, then the data clusters.
+const (
+	fatOffset  = 512
+	rootOffset = 1024
+	dataOffset = 1536
+)
+
+// newImage returns a FAT12 volume of the given number of sectors, with
+// clusters of spc sectors.
+func newImage(sectors int, spc byte) []byte {
+	img := make([]byte, sectors*512)
+	img[0] = 0xEB
+	binary.LittleEndian.PutUint16(img[11:13], 512)
+	img[13] = spc
+	binary.LittleEndian.PutUint16(img[14:16], 1) // Reserved sectors
+	img[16] = 1                                  // FATs
+	binary.LittleEndian.PutUint16(img[17:19], 16)
+	binary.LittleEndian.PutUint16(img[19:21], uint16(sectors))
+	binary.LittleEndian.PutUint16(img[22:24], 1)
+	copy(img[43:54], "BOOTLABEL  ")
+	img[510], img[511] = 0x55, 0xAA
+	setFAT(img, 0, 0xFF8)
+	setFAT(img, 1, 0xFFF)
+	return img
+}
+
+// setFAT sets the FAT12 entry of cluster c.
+func setFAT(img []byte, c int, v uint16) {
+	b := img[fatOffset+c+c/2:]
+	if c&1 != 0 {
+		binary.LittleEndian.PutUint16(b, binary.LittleEndian.Uint16(b)&0x000F|v<<4)
+	} else {
+		binary.LittleEndian.PutUint16(b, binary.LittleEndian.Uint16(b)&0xF000|v&0x0FFF)
+	}
+}
+
+// chain links clusters into a chain ending at the last one.
+func chain(img []byte, clusters ...int) {
+	for i, c := range clusters {
+		if i+1 < len(clusters) {
+			setFAT(img, c, uint16(clusters[i+1]))
+		} else {
+			setFAT(img, c, 0xFFF)
+		}
+	}
+}
+
+// cluster returns the data of cluster c of an image with 512-byte clusters.
+func cluster(img []byte, c int) []byte {
+	return img[dataOffset+(c-2)*512:]
+}
+
+// dirent returns a short name entry; name is the padded 8.3 name.
+func dirent(name string, attr byte, cluster uint16, size uint32) []byte {
+	rec := make([]byte, dirEntrySize)
+	copy(rec, name)
+	rec[11] = attr
+	binary.LittleEndian.PutUint16(rec[22:24], 0x6000)                // 12:00:00
+	binary.LittleEndian.PutUint16(rec[24:26], uint16(44<<9|2<<5|29)) // 2024-02-29
+	binary.LittleEndian.PutUint16(rec[26:28], cluster)
+	binary.LittleEndian.PutUint32(rec[28:32], size)
+	return rec
+}
+
+// longEntries returns the long name entries for name that precede the short
+// name entry short, last part first as on disk.
+func longEntries(name string, short []byte) []byte {
+	units := utf16.Encode([]rune(name))
+	if len(units)%13 != 0 || len(units) == 0 {
+		units = append(units, 0)
+	}
+	for len(units)%13 != 0 {
+		units = append(units, 0xFFFF)
+	}
+	parts := len(units) / 13
+	sum := checksum(short[:11])
+	var out []byte
+	for seq := parts; seq >= 1; seq-- {
+		rec := make([]byte, dirEntrySize)
+		rec[0] = byte(seq)
+		if seq == parts {
+			rec[0] |= 0x40
+		}
+		rec[11] = attrLongName
+		rec[13] = sum
+		for i, off := range []int{1, 3, 5, 7, 9, 14, 16, 18, 20, 22, 24, 28, 30} {
+			binary.LittleEndian.PutUint16(rec[off:], units[13*(seq-1)+i])
+		}
+		out = append(out, rec...)
+	}
+	return out
+}
+
+// testImage is a volume with a label, README.TXT in the root and a long
+// named file of two clusters in SUBDIR, whose short name entry is the
+// fifth, after ".", ".." and two long name entries.
+func testImage() []byte {
+	img := newImage(64, 1)
+	short := dirent("LONGFI~1TXT", 0, 4, 600)
+	root := bytes.Join([][]byte{
+		dirent("ESP        ", attrVolumeID, 0, 0),
+		dirent("README  TXT", 0, 2, 5),
+		dirent("SUBDIR     ", attrDir, 3, 0),
+	}, nil)
+	copy(img[rootOffset:], root)
+	chain(img, 2)
+	copy(cluster(img, 2), "hello")
+	chain(img, 3)
+	copy(cluster(img, 3), bytes.Join([][]byte{
+		dirent(".          ", attrDir, 3, 0),
+		dirent("..         ", attrDir, 0, 0),
+		longEntries("Long File Name.txt", short),
+		short,
+	}, nil))
+	chain(img, 4, 6)
+	copy(cluster(img, 4), bytes.Repeat([]byte("a"), 512))
+	copy(cluster(img, 6), bytes.Repeat([]byte("b"), 88))
+	return img
+}
+
+func TestFS(t *testing.T) {
+	fsys, err := NewFS(bytes.NewReader(testImage()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fsys.Type(); got != "FAT12" {
+		t.Errorf("Type = %s, want FAT12", got)
+	}
+	if got := fsys.Label(); got != "ESP" {
+		t.Errorf("Label = %q, want ESP (from the root directory)", got)
+	}
+	long := strings.Repeat("a", 512) + strings.Repeat("b", 88)
+	for name, want := range map[string]string{
+		"README.TXT":                "hello",
+		"readme.txt":                "hello",
+		"SUBDIR/Long File Name.txt": long,
+		"subdir/LONG FILE NAME.TXT": long,
+	} {
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			t.Errorf("ReadFile(%s): %v", name, err)
+			continue
+		}
+		if string(data) != want {
+			t.Errorf("ReadFile(%s) = %d bytes, want %d", name, len(data), len(want))
+		}
+	}
+	info, err := fs.Stat(fsys, "README.TXT")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := info.ModTime().Format("2006-01-02 15:04:05"); got != "2024-02-29 12:00:00" {
+		t.Errorf("ModTime = %s", got)
+	}
+	var walked []string
+	fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+		walked = append(walked, name)
+		return nil
+	})
+	if got := strings.Join(walked, ","); got != ".,README.TXT,SUBDIR,SUBDIR/Long File Name.txt" {
+		t.Errorf("walked %s", got)
+	}
+}
+
+func TestNewFSErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		image func() []byte
+		want  string // Expected in the error
+	}{
+		{"zeroed", func() []byte { return make([]byte, 4096) }, "no FAT file system"},
+		{"shorter than the boot sector", func() []byte { return testImage()[:300] }, "EOF"},
+		{"truncated before the FAT", func() []byte { return testImage()[:fatOffset+100] }, "EOF"},
+		{"bad sector size", func() []byte {
+			img := testImage()
+			binary.LittleEndian.PutUint16(img[11:13], 500)
+			return img
+		}, "no FAT file system"},
+		{"cluster size not a power of two", func() []byte {
+			img := testImage()
+			img[13] = 3
+			return img
+		}, "no FAT file system"},
+		{"no data area", func() []byte {
+			img := testImage()
+			binary.LittleEndian.PutUint16(img[19:21], 3)
+			return img
+		}, "no FAT file system"},
+		{"FAT32 layout with FAT12 clusters", func() []byte {
+			img := testImage()
+			binary.LittleEndian.PutUint16(img[22:24], 0)
+			binary.LittleEndian.PutUint32(img[36:40], 1)
+			return img
+		}, "inconsistent"},
+		{"FAT larger than allowed", func() []byte {
+			img := testImage()
+			binary.LittleEndian.PutUint16(img[19:21], 0)
+			binary.LittleEndian.PutUint32(img[32:36], 1<<24)
+			binary.LittleEndian.PutUint16(img[22:24], 0)
+			binary.LittleEndian.PutUint32(img[36:40], 1<<18)
+			return img
+		}, "too large"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewFS(bytes.NewReader(tt.image()))
+			if err == nil {
+				t.Fatal("NewFS succeeded")
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error %q, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestDamagedVolumes(t *testing.T) {
+	tests := []struct {
+		name   string
+		damage func(img []byte) []byte
+		path   string // File to read, or directory if it ends in "/"
+		want   string // Expected in the error
+	}{
+		{"cluster chain loop", func(img []byte) []byte {
+			setFAT(img, 6, 4)
+			binary.LittleEndian.PutUint32(cluster(img, 3)[4*dirEntrySize+28:], 1<<20)
+			return img
+		}, "SUBDIR/Long File Name.txt", "loops"},
+		{"chain shorter than the file", func(img []byte) []byte {
+			setFAT(img, 4, 0xFFF)
+			return img
+		}, "SUBDIR/Long File Name.txt", "shorter than the file"},
+		{"chain to a free cluster", func(img []byte) []byte {
+			setFAT(img, 4, 0)
+			return img
+		}, "SUBDIR/Long File Name.txt", "broken cluster chain"},
+		{"chain past the last cluster", func(img []byte) []byte {
+			setFAT(img, 4, 0xF00)
+			return img
+		}, "SUBDIR/Long File Name.txt", "broken cluster chain"},
+		{"start cluster past the last cluster", func(img []byte) []byte {
+			binary.LittleEndian.PutUint16(img[rootOffset+dirEntrySize+26:], 0xF00)
+			return img
+		}, "README.TXT", "invalid start cluster"},
+		{"directory loop", func(img []byte) []byte {
+			// SUBDIR's long named file becomes a directory that is SUBDIR
+			rec := cluster(img, 3)[4*dirEntrySize:]
+			rec[11] = attrDir
+			binary.LittleEndian.PutUint16(rec[26:28], 3)
+			return img
+		}, "SUBDIR/Long File Name.txt/", "directory loop"},
+		{"directory larger than FAT allows", func(img []byte) []byte {
+			// 64 KiB clusters, and SUBDIR a chain of 40 of them
+			img = append(img[:dataOffset], make([]byte, 41*65536)...)
+			img[13] = 128
+			binary.LittleEndian.PutUint16(img[19:21], 3+41*128)
+			clusters := make([]int, 40)
+			for i := range clusters {
+				clusters[i] = 3 + i
+			}
+			chain(img, clusters...)
+			return img
+		}, "SUBDIR/", "larger than FAT allows"},
+		{"directory truncated", func(img []byte) []byte {
+			return img[:dataOffset+512+100]
+		}, "SUBDIR/", "EOF"},
+		{"file truncated", func(img []byte) []byte {
+			return img[:dataOffset+2*512+100]
+		}, "SUBDIR/Long File Name.txt", "unexpected EOF"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fsys, err := NewFS(bytes.NewReader(tt.damage(testImage())))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if dir, ok := strings.CutSuffix(tt.path, "/"); ok {
+				_, err = fs.ReadDir(fsys, dir)
+			} else {
+				_, err = fs.ReadFile(fsys, tt.path)
+			}
+			if err == nil {
+				t.Fatalf("reading %s succeeded", tt.path)
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error %q, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnusableNames(t *testing.T) {
+	img := testImage()
+	sub := cluster(img, 3)
+	// Replace the long name with one holding a slash, and add an entry
+	// whose long name is empty
+	short := sub[4*dirEntrySize : 5*dirEntrySize]
+	sub[2*dirEntrySize] = 0xE5
+	copy(sub[3*dirEntrySize:], longEntries("a/b", short))
+	empty := dirent("EMPTY   TXT", 0, 0, 0)
+	copy(sub[5*dirEntrySize:], append(longEntries("", empty), empty...))
+
+	fsys, err := NewFS(bytes.NewReader(img))
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := fs.ReadDir(fsys, "SUBDIR")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	if len(names) != 0 {
+		t.Errorf("SUBDIR lists %q, want nothing", names)
+	}
+}
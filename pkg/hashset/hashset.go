@@ -0,0 +1,219 @@
+// Package hashset reads reference hash sets of known software, such as the
+// Reference Data Set (RDS) of NIST's National Software Reference Library,
+// so that forensic examiners can set aside the files on media that are
+// known and focus on the rest.
+//
+// Three kinds of sets are read: RDS v3 SQLite databases, which are queried
+// rather than loaded; CSV files with a header row, which include the
+// NSRLFile.txt of RDS 2.x; and plain lists of one hash per line, optionally
+// followed by a file name, as md5sum and sha1sum write them.
+package hashset
+
+import (
+	"bufio"
+	"bytes"
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/pappasjfed/chkiso/pkg/manifest"
+
+	_ "modernc.org/sqlite" // RDS v3 is distributed as SQLite databases
+)
+
+// Formats of a Set.
+const (
+	RDSv3 = "RDS v3"    // SQLite database with a FILE table
+	RDS2  = "RDS 2.x"   // NSRLFile.txt
+	CSV   = "CSV"       // Other CSV with a header row naming a hash column
+	List  = "hash list" // One hash per line
+)
+
+// ErrEmpty is returned by Open for files that list no hashes.
+var ErrEmpty = errors.New("no hashes found")
+
+// Set is a reference hash set opened with Open.
+type Set struct {
+	Path      string
+	Format    string
+	Algorithm string // manifest.SHA256, manifest.SHA1 or manifest.MD5
+	Size      int    // Hashes loaded, or -1 for databases, which are queried instead
+
+	names map[string]string // Lowercase hash to the file name listed for it
+	db    *sql.DB
+}
+
+// Open reads the hash set at path, choosing the strongest algorithm it
+// lists when it lists several.
+func Open(path string) (*Set, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	r := bufio.NewReaderSize(file, 1<<20)
+	head, _ := r.Peek(16)
+	if bytes.HasPrefix(head, []byte("SQLite format 3\x00")) {
+		return openRDSv3(path)
+	}
+
+	set := &Set{Path: path, names: make(map[string]string)}
+	first, err := r.Peek(4096)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return nil, err
+	}
+	if bom := []byte("\xef\xbb\xbf"); bytes.HasPrefix(first, bom) {
+		// Notepad starts UTF-8 files with a byte order mark
+		r.Discard(len(bom))
+		first = first[len(bom):]
+	}
+	if line, _, _ := bytes.Cut(first, []byte("\n")); bytes.Contains(line, []byte(",")) {
+		err = set.readCSV(r)
+	} else {
+		err = set.readList(r)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	set.Size = len(set.names)
+	if set.Size == 0 {
+		return nil, fmt.Errorf("%s: %w", path, ErrEmpty)
+	}
+	return set, nil
+}
+
+// openRDSv3 opens an RDS v3 database, whose FILE table lists the SHA256,
+// SHA-1 and MD5 of each file.
+func openRDSv3(path string) (*Set, error) {
+	db, err := sql.Open("sqlite", "file:"+path+"?mode=ro")
+	if err != nil {
+		return nil, err
+	}
+	var n int
+	if err := db.QueryRow(`SELECT count(*) FROM pragma_table_info('FILE') WHERE name IN ('sha256', 'file_name')`).Scan(&n); err != nil || n != 2 {
+		db.Close()
+		return nil, fmt.Errorf("%s: not an RDS v3 database (no FILE table with sha256 and file_name columns)", path)
+	}
+	return &Set{Path: path, Format: RDSv3, Algorithm: manifest.SHA256, Size: -1, db: db}, nil
+}
+
+// csvHashColumns maps the names CSV headers give hash columns, in lower
+// case, to their algorithms.
+var csvHashColumns = map[string]string{
+	"sha-256": manifest.SHA256,
+	"sha256":  manifest.SHA256,
+	"sha-1":   manifest.SHA1,
+	"sha1":    manifest.SHA1,
+	"md5":     manifest.MD5,
+}
+
+// readCSV reads a CSV hash set with a header row, such as NSRLFile.txt:
+// "SHA-1","MD5","CRC32","FileName","FileSize","ProductCode",...
+func (s *Set) readCSV(r io.Reader) error {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.LazyQuotes = true
+	cr.ReuseRecord = true
+	header, err := cr.Read()
+	if err != nil {
+		return err
+	}
+	hashColumn, nameColumn := -1, -1
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if algorithm, ok := csvHashColumns[name]; ok && (hashColumn < 0 || manifest.Strength(algorithm) > manifest.Strength(s.Algorithm)) {
+			hashColumn, s.Algorithm = i, algorithm
+		}
+		if name == "filename" || name == "file_name" || name == "name" {
+			nameColumn = i
+		}
+	}
+	if hashColumn < 0 {
+		return fmt.Errorf("the header row names no SHA-256, SHA-1 or MD5 column")
+	}
+	s.Format = CSV
+	if strings.EqualFold(header[0], "SHA-1") && nameColumn >= 0 {
+		s.Format = RDS2
+	}
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if hashColumn >= len(record) {
+			continue
+		}
+		hash := strings.ToLower(strings.TrimSpace(record[hashColumn]))
+		if manifest.AlgorithmForLength(len(hash)) != s.Algorithm {
+			continue
+		}
+		name := ""
+		if nameColumn >= 0 && nameColumn < len(record) {
+			name = record[nameColumn]
+		}
+		if _, ok := s.names[hash]; !ok {
+			s.names[hash] = name
+		}
+	}
+}
+
+// readList reads a hash set of one hash per line, optionally followed by a
+// file name. The length of the first hash sets the algorithm; lines with
+// hashes of other lengths are skipped.
+func (s *Set) readList(r io.Reader) error {
+	s.Format = List
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		hash, name, _ := strings.Cut(line, " ")
+		hash = strings.ToLower(hash)
+		if s.Algorithm == "" {
+			switch algorithm := manifest.AlgorithmForLength(len(hash)); algorithm {
+			case manifest.SHA256, manifest.SHA1, manifest.MD5:
+				s.Algorithm = algorithm
+			default:
+				return fmt.Errorf("%q is not a SHA-256, SHA-1 or MD5 hash", hash)
+			}
+		}
+		if manifest.AlgorithmForLength(len(hash)) != s.Algorithm || strings.Trim(hash, "0123456789abcdef") != "" {
+			continue
+		}
+		if _, ok := s.names[hash]; !ok {
+			s.names[hash] = strings.TrimPrefix(strings.TrimSpace(name), "*")
+		}
+	}
+	return scanner.Err()
+}
+
+// Lookup reports whether the set lists hash, a hexadecimal digest in the
+// set's algorithm, and the file name it lists for it.
+func (s *Set) Lookup(hash string) (name string, ok bool, err error) {
+	if s.db != nil {
+		// RDS v3 keeps hashes in capitals
+		err := s.db.QueryRow(`SELECT file_name FROM FILE WHERE sha256 = ? LIMIT 1`, strings.ToUpper(hash)).Scan(&name)
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", false, nil
+		}
+		return name, err == nil, err
+	}
+	name, ok = s.names[strings.ToLower(hash)]
+	return name, ok, nil
+}
+
+// Close releases the database of an RDS v3 set.
+func (s *Set) Close() error {
+	if s.db != nil {
+		return s.db.Close()
+	}
+	return nil
+}
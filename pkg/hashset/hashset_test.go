@@ -0,0 +1,152 @@
+package hashset
+
+import (
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pappasjfed/chkiso/pkg/manifest"
+)
+
+const (
+	md5Hash    = "d41d8cd98f00b204e9800998ecf8427e"
+	sha1Hash   = "da39a3ee5e6b4b0d3255bfef95601890afd80709"
+	sha256Hash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+)
+
+func writeFile(t *testing.T, data string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "hashes.txt")
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestOpen(t *testing.T) {
+	const rds2 = `"SHA-1","MD5","CRC32","FileName","FileSize","ProductCode","OpSystemCode","SpecialCode"` + "\r\n" +
+		`"DA39A3EE5E6B4B0D3255BFEF95601890AFD80709","D41D8CD98F00B204E9800998ECF8427E","00000000","empty.txt",0,1,"WIN",""` + "\r\n"
+	tests := []struct {
+		name      string
+		data      string
+		format    string
+		algorithm string
+		hash      string // Listed, in the set's algorithm
+		file      string // Name listed for hash
+		size      int
+	}{
+		{"RDS 2.x", rds2, RDS2, manifest.SHA1, sha1Hash, "empty.txt", 1},
+		{"RDS 2.x with a BOM", "\ufeff" + rds2, RDS2, manifest.SHA1, sha1Hash, "empty.txt", 1},
+		{"CSV, strongest column", "name,md5,sha256\nempty.txt," + md5Hash + "," + sha256Hash + "\n", CSV, manifest.SHA256, sha256Hash, "empty.txt", 1},
+		{"CSV, short rows and bad hashes skipped", "MD5,FileName\n" + md5Hash + ",a\n\nnot a hash,b\n" + md5Hash[:30] + ",c\n", CSV, manifest.MD5, md5Hash, "a", 1},
+		{"md5sum output", md5Hash + "  empty.txt\n" + strings.Repeat("0", 32) + " *zeros.bin\n", List, manifest.MD5, md5Hash, "empty.txt", 2},
+		{"list with a BOM", "\ufeff" + sha1Hash + "\n", List, manifest.SHA1, sha1Hash, "", 1},
+		{"list, upper case, CRLF and comments", "# known files\r\n" + strings.ToUpper(sha256Hash) + "\r\n\r\n", List, manifest.SHA256, sha256Hash, "", 1},
+		{"list, other lengths skipped", md5Hash + "\n" + sha1Hash + "\n" + strings.Repeat("g", 32) + "\n", List, manifest.MD5, md5Hash, "", 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			set, err := Open(writeFile(t, tt.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer set.Close()
+			if set.Format != tt.format || set.Algorithm != tt.algorithm || set.Size != tt.size {
+				t.Errorf("got %s, %s, %d hashes; want %s, %s, %d", set.Format, set.Algorithm, set.Size, tt.format, tt.algorithm, tt.size)
+			}
+			for _, hash := range []string{tt.hash, strings.ToUpper(tt.hash)} {
+				name, ok, err := set.Lookup(hash)
+				if err != nil || !ok || name != tt.file {
+					t.Errorf("Lookup(%s) = %q, %v, %v; want %q", hash, name, ok, err, tt.file)
+				}
+			}
+			if _, ok, _ := set.Lookup(strings.Repeat("1", len(tt.hash))); ok {
+				t.Error("Lookup found an unlisted hash")
+			}
+		})
+	}
+}
+
+func TestOpenErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string // Expected in the error
+	}{
+		{"no hash column", "name,size\na,1\n", "names no SHA-256"},
+		{"not a hash", "hello world\n", "is not a SHA-256"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Open(writeFile(t, tt.data))
+			if err == nil {
+				t.Fatal("Open succeeded")
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error %q, want %q", err, tt.want)
+			}
+		})
+	}
+	for name, data := range map[string]string{
+		"empty":         "",
+		"BOM only":      "\ufeff",
+		"comments only": "# nothing\n\n",
+		"header only":   "SHA-1,FileName\n",
+	} {
+		if _, err := Open(writeFile(t, data)); !errors.Is(err, ErrEmpty) {
+			t.Errorf("%s: Open = %v, want ErrEmpty", name, err)
+		}
+	}
+	if _, err := Open(filepath.Join(t.TempDir(), "missing.txt")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Open(missing) = %v", err)
+	}
+}
+
+func TestRDSv3(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "RDS.db")
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, stmt := range []string{
+		`CREATE TABLE FILE (sha256 TEXT, sha1 TEXT, md5 TEXT, file_name TEXT)`,
+		`INSERT INTO FILE VALUES ('` + strings.ToUpper(sha256Hash) + `', '', '', 'empty.txt')`,
+		`CREATE TABLE OTHER (x TEXT)`,
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.Close()
+
+	set, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer set.Close()
+	if set.Format != RDSv3 || set.Algorithm != manifest.SHA256 || set.Size != -1 {
+		t.Errorf("got %s, %s, %d", set.Format, set.Algorithm, set.Size)
+	}
+	if name, ok, err := set.Lookup(sha256Hash); err != nil || !ok || name != "empty.txt" {
+		t.Errorf("Lookup = %q, %v, %v", name, ok, err)
+	}
+	if _, ok, err := set.Lookup(strings.Repeat("1", 64)); err != nil || ok {
+		t.Errorf("Lookup(unlisted) = %v, %v", ok, err)
+	}
+
+	other := filepath.Join(t.TempDir(), "other.db")
+	db, err = sql.Open("sqlite", other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`CREATE TABLE FILE (md5 TEXT)`); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+	if _, err := Open(other); err == nil || !strings.Contains(err.Error(), "not an RDS v3 database") {
+		t.Errorf("Open(other database) = %v", err)
+	}
+}
@@ -0,0 +1,94 @@
+package isofs
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+// El Torito platform IDs of boot catalog sections.
+const (
+	PlatformBIOS = 0x00
+	PlatformPPC  = 0x01
+	PlatformMac  = 0x02
+	PlatformEFI  = 0xEF
+)
+
+// BootEntry is a bootable entry of an El Torito boot catalog: the image a
+// firmware loads to boot the disc.
+type BootEntry struct {
+	Platform    byte   // PlatformBIOS, PlatformEFI, ...
+	Bootable    bool   // Marked bootable, rather than present but disabled
+	MediaType   byte   // 0 for no emulation, 1 to 3 for floppies, 4 for a hard disk
+	LoadSegment uint16 // Real-mode segment a BIOS loads the image at, 0 meaning 0x7C0
+	SystemType  byte   // Partition type of an emulated hard disk
+	SectorCount uint16 // 512-byte sectors loaded; 0 or 1 often means the whole image for EFI
+	LoadBlock   uint32 // Logical block of the image
+}
+
+// bootCatalogEntries bounds the entries read from a boot catalog, which
+// fits in one block in practice.
+const bootCatalogEntries = SectorSize / 32
+
+// BootCatalog returns the bootable entries of the El Torito boot catalog of
+// the ISO 9660 image in r, or nil if the image does not boot from one.
+func BootCatalog(r io.ReaderAt) ([]BootEntry, error) {
+	block := make([]byte, SectorSize)
+	catalog := uint32(0)
+	for sector := int64(16); sector < 16+64; sector++ {
+		if _, err := r.ReadAt(block, sector*SectorSize); err != nil {
+			return nil, err
+		}
+		if string(block[1:6]) != "CD001" || block[0] == vdTerminator {
+			break
+		}
+		if block[0] == vdBoot && dString(block[7:39]) == "EL TORITO SPECIFICATION" {
+			catalog = binary.LittleEndian.Uint32(block[71:75])
+			break
+		}
+	}
+	if catalog == 0 {
+		return nil, nil
+	}
+	if _, err := r.ReadAt(block, int64(catalog)*SectorSize); err != nil {
+		return nil, err
+	}
+	// The validation entry names the platform of the default entry
+	if block[0] != 1 || block[30] != 0x55 || block[31] != 0xAA {
+		return nil, nil
+	}
+	entries := []BootEntry{bootEntry(block[0x20:0x40], block[1])}
+	for i := 2; i < bootCatalogEntries; {
+		header := block[i*32 : i*32+32]
+		if header[0] != 0x90 && header[0] != 0x91 {
+			break
+		}
+		platform := header[1]
+		count := int(binary.LittleEndian.Uint16(header[2:4]))
+		i++
+		for n := 0; n < count && i < bootCatalogEntries; i++ {
+			e := block[i*32 : i*32+32]
+			if e[0] == 0x44 {
+				continue // Extension of the previous entry
+			}
+			entries = append(entries, bootEntry(e, platform))
+			n++
+		}
+		if header[0] == 0x91 {
+			break
+		}
+	}
+	return entries, nil
+}
+
+// bootEntry decodes a 32-byte default or section entry.
+func bootEntry(e []byte, platform byte) BootEntry {
+	return BootEntry{
+		Platform:    platform,
+		Bootable:    e[0] == 0x88,
+		MediaType:   e[1] & 0x0F,
+		LoadSegment: binary.LittleEndian.Uint16(e[2:4]),
+		SystemType:  e[4],
+		SectorCount: binary.LittleEndian.Uint16(e[6:8]),
+		LoadBlock:   binary.LittleEndian.Uint32(e[8:12]),
+	}
+}
@@ -0,0 +1,119 @@
+package isofs
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Volume descriptor types.
+const (
+	vdBoot          = 0
+	vdPrimary       = 1
+	vdSupplementary = 2
+	vdTerminator    = 255
+)
+
+// ErrNotISO9660 is returned when an image has no ISO 9660 volume descriptors.
+var ErrNotISO9660 = errors.New("not an ISO 9660 image")
+
+// PVD is the parsed Primary Volume Descriptor.
+type PVD struct {
+	SystemID        string
+	VolumeID        string
+	VolumeSetID     string
+	PublisherID     string
+	PreparerID      string
+	ApplicationID   string
+	VolumeSpaceSize uint32 // Size of the volume in logical blocks
+	LogicalBlock    uint16 // Logical block size in bytes, normally 2048
+	Created         time.Time
+	Modified        time.Time
+	ApplicationUse  []byte
+	root            []byte // Root directory record
+}
+
+// Size returns the size of the volume in bytes as declared by the PVD.
+func (p *PVD) Size() int64 {
+	return int64(p.VolumeSpaceSize) * int64(p.LogicalBlock)
+}
+
+// ParsePVD decodes a raw Primary Volume Descriptor block.
+func ParsePVD(block []byte) (*PVD, error) {
+	if len(block) < PVDSize || block[0] != vdPrimary || string(block[1:6]) != "CD001" {
+		return nil, ErrNotISO9660
+	}
+	return &PVD{
+		SystemID:        dString(block[8:40]),
+		VolumeID:        dString(block[40:72]),
+		VolumeSpaceSize: binary.LittleEndian.Uint32(block[80:84]),
+		LogicalBlock:    binary.LittleEndian.Uint16(block[128:130]),
+		VolumeSetID:     dString(block[190:318]),
+		PublisherID:     dString(block[318:446]),
+		PreparerID:      dString(block[446:574]),
+		ApplicationID:   dString(block[574:702]),
+		Created:         decDateTime(block[813:830]),
+		Modified:        decDateTime(block[830:847]),
+		ApplicationUse:  ApplicationUse(block),
+		root:            append([]byte(nil), block[156:190]...),
+	}, nil
+}
+
+// ReadVolume reads and parses the Primary Volume Descriptor of an image.
+func ReadVolume(r io.ReaderAt) (*PVD, error) {
+	block, err := ReadPVD(r)
+	if err != nil {
+		return nil, err
+	}
+	return ParsePVD(block)
+}
+
+// jolietRoot returns the root directory record of a Joliet supplementary
+// volume descriptor, or nil if the image has none.
+func jolietRoot(r io.ReaderAt) []byte {
+	block := make([]byte, SectorSize)
+	for sector := int64(16); sector < 16+64; sector++ {
+		if _, err := r.ReadAt(block, sector*SectorSize); err != nil {
+			return nil
+		}
+		if string(block[1:6]) != "CD001" || block[0] == vdTerminator {
+			return nil
+		}
+		if block[0] != vdSupplementary {
+			continue
+		}
+		escape := block[88:91]
+		if bytes.Equal(escape, []byte("%/@")) || bytes.Equal(escape, []byte("%/C")) || bytes.Equal(escape, []byte("%/E")) {
+			return append([]byte(nil), block[156:190]...)
+		}
+	}
+	return nil
+}
+
+// dString trims the space padding from a d-characters/a-characters field.
+func dString(b []byte) string {
+	return strings.TrimRight(string(b), " \x00")
+}
+
+// decDateTime decodes the 17-byte "YYYYMMDDHHMMSScc" + offset format.
+func decDateTime(b []byte) time.Time {
+	var year, month, day, hour, minute, second int
+	if _, err := fmt.Sscanf(string(b[:14]), "%4d%2d%2d%2d%2d%2d", &year, &month, &day, &hour, &minute, &second); err != nil || year == 0 {
+		return time.Time{}
+	}
+	offset := int(int8(b[16])) * 15 * 60
+	return time.Date(year, time.Month(month), day, hour, minute, second, 0, time.FixedZone("", offset))
+}
+
+// recordDateTime decodes the 7-byte directory record timestamp.
+func recordDateTime(b []byte) time.Time {
+	if b[0] == 0 && b[1] == 0 && b[2] == 0 {
+		return time.Time{}
+	}
+	offset := int(int8(b[6])) * 15 * 60
+	return time.Date(1900+int(b[0]), time.Month(b[1]), int(b[2]), int(b[3]), int(b[4]), int(b[5]), 0, time.FixedZone("", offset))
+}
@@ -0,0 +1,63 @@
+//go:build darwin
+
+package isofs
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// ioctls from <sys/disk.h> returning a disk's block size (uint32) and its
+// number of blocks (uint64).
+const (
+	dkiocGetBlockSize  = 0x40046418 // DKIOCGETBLOCKSIZE
+	dkiocGetBlockCount = 0x40086419 // DKIOCGETBLOCKCOUNT
+)
+
+// deviceSize returns the size of a disk such as /dev/disk2 or /dev/rdisk2.
+// macOS devices do not report their size when seeked to the end, so the
+// disk is asked for its geometry; seeking is only a last resort.
+func deviceSize(file *os.File) (int64, error) {
+	blockSize, blocks, err := geometry(file)
+	if err != nil {
+		return seekSize(file)
+	}
+	return int64(blockSize) * int64(blocks), nil
+}
+
+// rawDevice wraps the character devices /dev/rdiskN, which are much faster
+// to read than /dev/diskN but only in whole blocks, to accept any read.
+func rawDevice(file *os.File, size int64) Image {
+	info, err := file.Stat()
+	if err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		return file
+	}
+	blockSize, _, err := geometry(file)
+	if err != nil || blockSize == 0 {
+		return file
+	}
+	return newSectorReader(file, int64(blockSize), size)
+}
+
+// IsOptical reports whether devicePath is a CD, DVD or Blu-ray disc, which
+// macOS gives a block size of 2048 bytes; other disks use 512 or 4096.
+func IsOptical(devicePath string) bool {
+	file, err := os.Open(devicePath)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+	blockSize, _, err := geometry(file)
+	return err == nil && blockSize == SectorSize
+}
+
+func geometry(file *os.File) (blockSize uint32, blocks uint64, err error) {
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, file.Fd(), dkiocGetBlockSize, uintptr(unsafe.Pointer(&blockSize))); errno != 0 {
+		return 0, 0, errno
+	}
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, file.Fd(), dkiocGetBlockCount, uintptr(unsafe.Pointer(&blocks))); errno != 0 {
+		return 0, 0, errno
+	}
+	return blockSize, blocks, nil
+}
@@ -0,0 +1,44 @@
+//go:build !windows && !darwin
+
+package isofs
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// deviceSize returns the size of a raw device. Block devices on Unix-like
+// systems report their size when seeked to the end.
+func deviceSize(file *os.File) (int64, error) {
+	return seekSize(file)
+}
+
+// rawDevice returns file as is: block devices accept reads of any size.
+func rawDevice(file *os.File, size int64) Image {
+	return file
+}
+
+// opticalPrefixes are the names of optical drive devices in /dev.
+var opticalPrefixes = map[string][]string{
+	"linux":   {"sr", "scd"},
+	"freebsd": {"cd"},
+	"openbsd": {"cd", "rcd"},
+	"netbsd":  {"cd", "rcd"},
+}
+
+// IsOptical reports whether devicePath is a CD, DVD or Blu-ray drive, such
+// as /dev/sr0 or a link to it like /dev/cdrom.
+func IsOptical(devicePath string) bool {
+	if resolved, err := filepath.EvalSymlinks(devicePath); err == nil {
+		devicePath = resolved
+	}
+	name := filepath.Base(devicePath)
+	for _, prefix := range opticalPrefixes[runtime.GOOS] {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
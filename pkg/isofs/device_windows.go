@@ -0,0 +1,80 @@
+//go:build windows
+
+package isofs
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+// ioctlDiskGetLengthInfo is IOCTL_DISK_GET_LENGTH_INFO, which returns a
+// disk or volume's length in bytes as a GET_LENGTH_INFORMATION structure.
+const ioctlDiskGetLengthInfo = 0x0007405C
+
+// deviceSize returns the size of a volume such as \\.\E:. It asks the device
+// with IOCTL_DISK_GET_LENGTH_INFO, falls back to the volume size reported by
+// Get-Volume for device stacks that do not implement it, and only seeks to
+// the end as a last resort, since that is not reliable on every driver.
+func deviceSize(file *os.File) (int64, error) {
+	var length int64
+	var returned uint32
+	err := syscall.DeviceIoControl(syscall.Handle(file.Fd()), ioctlDiskGetLengthInfo,
+		nil, 0, (*byte)(unsafe.Pointer(&length)), uint32(unsafe.Sizeof(length)), &returned, nil)
+	if err == nil && returned == uint32(unsafe.Sizeof(length)) && length > 0 {
+		return length, nil
+	}
+	if size, err := volumeSize(file.Name()); err == nil {
+		return size, nil
+	}
+	return seekSize(file)
+}
+
+// rawDevice returns file as is. Volumes opened as \\.\X: are only read in
+// whole sectors from sector boundaries, as hashing and the PVD checks do.
+func rawDevice(file *os.File, size int64) Image {
+	return file
+}
+
+// driveCDROM is DRIVE_CDROM, GetDriveTypeW's result for optical drives.
+const driveCDROM = 5
+
+var procGetDriveType = syscall.NewLazyDLL("kernel32.dll").NewProc("GetDriveTypeW")
+
+// IsOptical reports whether devicePath, a \\.\X: drive letter device, is a
+// CD, DVD or Blu-ray drive.
+func IsOptical(devicePath string) bool {
+	letter := strings.TrimSuffix(strings.TrimPrefix(devicePath, `\\.\`), ":")
+	if len(letter) != 1 {
+		return false
+	}
+	root, err := syscall.UTF16PtrFromString(letter + `:\`)
+	if err != nil {
+		return false
+	}
+	kind, _, _ := procGetDriveType.Call(uintptr(unsafe.Pointer(root)))
+	return kind == driveCDROM
+}
+
+// volumeSize asks PowerShell's Get-Volume for the size of the volume behind
+// a \\.\X: device path.
+func volumeSize(devicePath string) (int64, error) {
+	letter := strings.TrimSuffix(strings.TrimPrefix(devicePath, `\\.\`), ":")
+	if len(letter) != 1 {
+		return 0, fmt.Errorf("%s is not a drive letter device", devicePath)
+	}
+	psCommand := fmt.Sprintf("(Get-Volume -DriveLetter %s -ErrorAction Stop).Size", letter)
+	out, err := exec.Command("powershell", "-NoProfile", "-NonInteractive", "-Command", psCommand).Output()
+	if err != nil {
+		return 0, fmt.Errorf("Get-Volume failed: %v", err)
+	}
+	size, err := strconv.ParseInt(strings.TrimSpace(string(out)), 10, 64)
+	if err != nil || size <= 0 {
+		return 0, fmt.Errorf("Get-Volume reported no size for %s:", letter)
+	}
+	return size, nil
+}
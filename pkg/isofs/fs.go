@@ -0,0 +1,533 @@
+package isofs
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf16"
+)
+
+// FS is a read-only io/fs.FS over the files of an ISO 9660 image. Joliet
+// names are used when present, then Rock Ridge names; otherwise plain ISO
+// 9660 names are matched case-insensitively with the ";1" version stripped.
+type FS struct {
+	r      io.ReaderAt
+	closer io.Closer
+	root   *entry
+	pvd    *PVD
+	size   int64 // Size of the image, or 0 if reading it would be needed to find it
+
+	joliet    bool
+	rockRidge bool
+	suspSkip  int // SUSP bytes to skip at the start of each system use area
+
+	mu      sync.Mutex       // Guards lazy loading of directory children
+	visited map[int64]string // Offsets of the directories loaded, to their names
+}
+
+type extent struct {
+	offset int64
+	length int64
+}
+
+type entry struct {
+	name    string
+	dir     bool
+	size    int64
+	modTime time.Time
+	extents []extent
+
+	loaded   bool
+	children []*entry
+}
+
+// NewFS reads the directory structure of the ISO 9660 image in r.
+func NewFS(r io.ReaderAt) (*FS, error) {
+	pvd, err := ReadVolume(r)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &FS{r: r, pvd: pvd, size: readerSize(r), visited: make(map[int64]string)}
+	rootRecord := pvd.root
+	if joliet := jolietRoot(r); joliet != nil {
+		f.joliet = true
+		rootRecord = joliet
+	}
+
+	root, ok := f.parseRecord(rootRecord)
+	if !ok || !root.dir {
+		return nil, ErrNotISO9660
+	}
+	root.name = "."
+	f.root = root
+
+	if !f.joliet {
+		f.detectRockRidge(rootRecord)
+	}
+	return f, nil
+}
+
+// readerSize returns the size of r if it can be had without reading it all,
+// as it can for files and the images Open returns, or else 0.
+func readerSize(r io.ReaderAt) int64 {
+	switch r := r.(type) {
+	case interface{ Size() int64 }:
+		return r.Size()
+	case *os.File:
+		if info, err := r.Stat(); err == nil && info.Mode().IsRegular() {
+			return info.Size()
+		}
+	}
+	return 0
+}
+
+// OpenFS opens the image file at path as an FS. Close releases the file.
+func OpenFS(path string) (*FS, error) {
+	file, _, err := Open(path)
+	if err != nil {
+		return nil, err
+	}
+	f, err := NewFS(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	f.closer = file
+	return f, nil
+}
+
+// Close releases the underlying image file if the FS opened it.
+func (f *FS) Close() error {
+	if f.closer != nil {
+		return f.closer.Close()
+	}
+	return nil
+}
+
+// Volume returns the image's Primary Volume Descriptor.
+func (f *FS) Volume() *PVD {
+	return f.pvd
+}
+
+// detectRockRidge looks for the SUSP "SP" entry in the root's "." record,
+// which announces Rock Ridge extensions.
+func (f *FS) detectRockRidge(rootRecord []byte) {
+	first, ok := f.firstRecord(rootRecord)
+	if !ok {
+		return
+	}
+	su := systemUse(first)
+	if len(su) >= 7 && string(su[0:2]) == "SP" && su[4] == 0xBE && su[5] == 0xEF {
+		f.rockRidge = true
+		f.suspSkip = int(su[6])
+	}
+}
+
+// firstRecord returns the first record ("." entry) of the directory described by rec.
+func (f *FS) firstRecord(rec []byte) ([]byte, bool) {
+	lba := binary.LittleEndian.Uint32(rec[2:6])
+	block := make([]byte, SectorSize)
+	if _, err := f.r.ReadAt(block, int64(lba)*SectorSize); err != nil {
+		return nil, false
+	}
+	length := int(block[0])
+	if length < 34 || length > len(block) {
+		return nil, false
+	}
+	return block[:length], true
+}
+
+// systemUse returns the system use area following a record's name.
+func systemUse(rec []byte) []byte {
+	nameLen := int(rec[32])
+	start := 33 + nameLen
+	if nameLen%2 == 0 {
+		start++
+	}
+	if start >= len(rec) {
+		return nil
+	}
+	return rec[start:]
+}
+
+// parseRecord decodes one directory record into an entry.
+func (f *FS) parseRecord(rec []byte) (*entry, bool) {
+	if len(rec) < 34 || int(rec[0]) > len(rec) {
+		return nil, false
+	}
+	nameLen := int(rec[32])
+	if 33+nameLen > len(rec) {
+		return nil, false
+	}
+	lba := int64(binary.LittleEndian.Uint32(rec[2:6]))
+	size := int64(binary.LittleEndian.Uint32(rec[10:14]))
+	e := &entry{
+		dir:     rec[25]&0x02 != 0,
+		size:    size,
+		modTime: recordDateTime(rec[18:25]),
+		extents: []extent{{offset: lba * SectorSize, length: size}},
+	}
+	rawName := rec[33 : 33+nameLen]
+	switch {
+	case nameLen == 1 && (rawName[0] == 0 || rawName[0] == 1):
+		e.name = string(rawName) // "." and ".." placeholders
+	case f.joliet:
+		e.name = decodeUCS2(rawName)
+	default:
+		e.name = string(rawName)
+	}
+	if f.rockRidge {
+		if name, ok := f.rockRidgeName(systemUse(rec)); ok {
+			e.name = name
+			return e, true
+		}
+	}
+	e.name = cleanName(e.name)
+	return e, true
+}
+
+// rockRidgeName assembles the Rock Ridge "NM" alternate name, following
+// "CE" continuation areas.
+func (f *FS) rockRidgeName(su []byte) (string, bool) {
+	if len(su) < f.suspSkip {
+		return "", false
+	}
+	su = su[f.suspSkip:]
+	var name strings.Builder
+	found := false
+	for hops := 0; hops < 8; hops++ {
+		var next []byte
+		for len(su) >= 4 {
+			length := int(su[2])
+			if length < 4 || length > len(su) {
+				break
+			}
+			sig := string(su[0:2])
+			switch sig {
+			case "NM":
+				if length > 5 && su[4]&0x06 == 0 {
+					name.Write(su[5:length])
+					found = true
+				}
+			case "CE":
+				// A continuation area lies within one logical block
+				if length >= 28 {
+					block := int64(binary.LittleEndian.Uint32(su[4:8]))
+					offset := int64(binary.LittleEndian.Uint32(su[12:16]))
+					size := int64(binary.LittleEndian.Uint32(su[20:24]))
+					if offset+size <= SectorSize && size > 0 {
+						next = make([]byte, size)
+						if _, err := f.r.ReadAt(next, block*SectorSize+offset); err != nil {
+							next = nil
+						}
+					}
+				}
+			case "ST":
+				su = nil
+				continue
+			}
+			su = su[length:]
+		}
+		if next == nil {
+			break
+		}
+		su = next
+	}
+	return name.String(), found && name.Len() > 0
+}
+
+// cleanName strips the ";1" version suffix and a trailing "." from a name.
+func cleanName(name string) string {
+	if i := strings.IndexByte(name, ';'); i >= 0 {
+		name = name[:i]
+	}
+	if strings.HasSuffix(name, ".") && name != "." {
+		name = strings.TrimSuffix(name, ".")
+	}
+	return name
+}
+
+func decodeUCS2(b []byte) string {
+	units := make([]uint16, len(b)/2)
+	for i := range units {
+		units[i] = binary.BigEndian.Uint16(b[2*i:])
+	}
+	return string(utf16.Decode(units))
+}
+
+// ErrDirectoryLoop is returned for a directory whose records lead back to a
+// directory already read, which would otherwise be walked forever.
+var ErrDirectoryLoop = errors.New("directory loop")
+
+// inImage reports whether the extent lies within the image, when its size is
+// known.
+func (f *FS) inImage(x extent) bool {
+	return f.size == 0 || x.offset+x.length <= f.size
+}
+
+// loadChildren reads the directory's records. Multi-extent files (flag 0x80)
+// are merged into a single entry. The records are read a sector at a time,
+// as they never span sectors, so a damaged directory size costs no more
+// memory than a sector.
+func (f *FS) loadChildren(dir *entry) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if dir.loaded {
+		return nil
+	}
+	start := dir.extents[0]
+	if !f.inImage(start) {
+		return fmt.Errorf("directory %s extends past the end of the image", dir.name)
+	}
+	if name, ok := f.visited[start.offset]; ok {
+		return fmt.Errorf("%w: directory %s is directory %s again", ErrDirectoryLoop, dir.name, name)
+	}
+	f.visited[start.offset] = dir.name
+
+	var children []*entry
+	var pending *entry
+	sector := make([]byte, SectorSize)
+	for off := int64(0); off < start.length; off += SectorSize {
+		data := sector
+		if rest := start.length - off; rest < SectorSize {
+			data = sector[:rest]
+		}
+		n, err := f.r.ReadAt(data, start.offset+off)
+		if err != nil && err != io.EOF {
+			return err
+		}
+		data = data[:n]
+
+		for pos := 0; pos < len(data); {
+			length := int(data[pos])
+			if length == 0 {
+				// Records never span sectors; the rest is padding
+				break
+			}
+			if pos+length > len(data) {
+				break
+			}
+			rec := data[pos : pos+length]
+			pos += length
+
+			e, ok := f.parseRecord(rec)
+			if !ok || e.name == "\x00" || e.name == "\x01" {
+				continue
+			}
+			if !validName(e.name) {
+				// An empty name, "..", or a slash would make the entry's
+				// path name some other entry, or its own directory
+				continue
+			}
+			for _, x := range e.extents {
+				if !f.inImage(x) {
+					return fmt.Errorf("%s in directory %s extends past the end of the image", e.name, dir.name)
+				}
+			}
+			multiExtent := rec[25]&0x80 != 0
+			if pending != nil {
+				pending.extents = append(pending.extents, e.extents...)
+				pending.size += e.size
+				if !multiExtent {
+					children = append(children, pending)
+					pending = nil
+				}
+				continue
+			}
+			if multiExtent {
+				pending = e
+				continue
+			}
+			children = append(children, e)
+		}
+		if n < len(data) || err == io.EOF {
+			break
+		}
+	}
+	if pending != nil {
+		children = append(children, pending)
+	}
+
+	sort.Slice(children, func(i, j int) bool { return children[i].name < children[j].name })
+	dir.children = children
+	dir.loaded = true
+	return nil
+}
+
+// validName reports whether name is usable as a single path element.
+func validName(name string) bool {
+	return name != "." && !strings.Contains(name, "/") && fs.ValidPath(name)
+}
+
+// lookup resolves a slash-separated path to its entry.
+func (f *FS) lookup(name string) (*entry, error) {
+	if !fs.ValidPath(name) {
+		return nil, fs.ErrInvalid
+	}
+	e := f.root
+	if name == "." {
+		return e, nil
+	}
+	for _, part := range strings.Split(name, "/") {
+		if !e.dir {
+			return nil, fs.ErrNotExist
+		}
+		if err := f.loadChildren(e); err != nil {
+			return nil, err
+		}
+		var match *entry
+		for _, child := range e.children {
+			if child.name == part {
+				match = child
+				break
+			}
+			// Plain ISO 9660 names are upper case; match them case-insensitively
+			if match == nil && !f.joliet && !f.rockRidge && strings.EqualFold(child.name, part) {
+				match = child
+			}
+		}
+		if match == nil {
+			return nil, fs.ErrNotExist
+		}
+		e = match
+	}
+	return e, nil
+}
+
+// Open implements fs.FS.
+func (f *FS) Open(name string) (fs.File, error) {
+	e, err := f.lookup(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	return &file{fsys: f, e: e, r: f.reader(e)}, nil
+}
+
+// ReadDir implements fs.ReadDirFS.
+func (f *FS) ReadDir(name string) ([]fs.DirEntry, error) {
+	e, err := f.lookup(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: err}
+	}
+	if !e.dir {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+	if err := f.loadChildren(e); err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: err}
+	}
+	entries := make([]fs.DirEntry, len(e.children))
+	for i, child := range e.children {
+		entries[i] = fs.FileInfoToDirEntry(fileInfo{child})
+	}
+	return entries, nil
+}
+
+// Stat implements fs.StatFS.
+func (f *FS) Stat(name string) (fs.FileInfo, error) {
+	e, err := f.lookup(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: err}
+	}
+	return fileInfo{e}, nil
+}
+
+// Extents returns the byte ranges of the named file within the image.
+func (f *FS) Extents(name string) ([][2]int64, error) {
+	e, err := f.lookup(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "extents", Path: name, Err: err}
+	}
+	out := make([][2]int64, len(e.extents))
+	for i, x := range e.extents {
+		out[i] = [2]int64{x.offset, x.length}
+	}
+	return out, nil
+}
+
+func (f *FS) reader(e *entry) io.Reader {
+	if len(e.extents) == 1 {
+		return io.NewSectionReader(f.r, e.extents[0].offset, e.extents[0].length)
+	}
+	readers := make([]io.Reader, len(e.extents))
+	for i, x := range e.extents {
+		readers[i] = io.NewSectionReader(f.r, x.offset, x.length)
+	}
+	return io.MultiReader(readers...)
+}
+
+type file struct {
+	fsys   *FS
+	e      *entry
+	r      io.Reader
+	dirPos int
+}
+
+func (f *file) Stat() (fs.FileInfo, error) { return fileInfo{f.e}, nil }
+func (f *file) Close() error               { return nil }
+
+func (f *file) Read(b []byte) (int, error) {
+	if f.e.dir {
+		return 0, &fs.PathError{Op: "read", Path: f.e.name, Err: fs.ErrInvalid}
+	}
+	return f.r.Read(b)
+}
+
+// ReadAt allows random access for single-extent files.
+func (f *file) ReadAt(b []byte, off int64) (int, error) {
+	if ra, ok := f.r.(io.ReaderAt); ok {
+		return ra.ReadAt(b, off)
+	}
+	return 0, &fs.PathError{Op: "readat", Path: f.e.name, Err: fs.ErrInvalid}
+}
+
+// ReadDir implements fs.ReadDirFile.
+func (f *file) ReadDir(n int) ([]fs.DirEntry, error) {
+	if !f.e.dir {
+		return nil, &fs.PathError{Op: "readdir", Path: f.e.name, Err: fs.ErrInvalid}
+	}
+	if err := f.fsys.loadChildren(f.e); err != nil {
+		return nil, err
+	}
+	remaining := f.e.children[f.dirPos:]
+	if n > 0 && len(remaining) > n {
+		remaining = remaining[:n]
+	}
+	if n > 0 && len(remaining) == 0 {
+		return nil, io.EOF
+	}
+	f.dirPos += len(remaining)
+	entries := make([]fs.DirEntry, len(remaining))
+	for i, child := range remaining {
+		entries[i] = fs.FileInfoToDirEntry(fileInfo{child})
+	}
+	return entries, nil
+}
+
+type fileInfo struct{ e *entry }
+
+func (i fileInfo) Name() string       { return path.Base(i.e.name) }
+func (i fileInfo) Size() int64        { return i.e.size }
+func (i fileInfo) ModTime() time.Time { return i.e.modTime }
+func (i fileInfo) IsDir() bool        { return i.e.dir }
+func (i fileInfo) Sys() interface{}   { return nil }
+
+func (i fileInfo) Mode() fs.FileMode {
+	if i.e.dir {
+		return fs.ModeDir | 0555
+	}
+	return 0444
+}
+
+var (
+	_ fs.ReadDirFS = (*FS)(nil)
+	_ fs.StatFS    = (*FS)(nil)
+)
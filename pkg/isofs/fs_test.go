@@ -0,0 +1,314 @@
+package isofs
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io/fs"
+	"strings"
+	"testing"
+)
+
+// newImage returns a zeroed image of n sectors with a Primary Volume
+// Descriptor whose root directory is the sector at rootLBA, rootSize bytes
+// long, and a terminator after it.
+func newImage(n int, rootLBA, rootSize uint32) []byte {
+	img := make([]byte, n*SectorSize)
+	pvd := img[16*SectorSize:]
+	pvd[0] = vdPrimary
+	copy(pvd[1:6], "CD001")
+	pvd[6] = 1
+	copy(pvd[40:72], strings.Repeat(" ", 32))
+	copy(pvd[40:], "TEST")
+	binary.LittleEndian.PutUint32(pvd[80:84], uint32(n))
+	binary.BigEndian.PutUint32(pvd[84:88], uint32(n))
+	binary.LittleEndian.PutUint16(pvd[128:130], SectorSize)
+	binary.BigEndian.PutUint16(pvd[130:132], SectorSize)
+	copy(pvd[156:190], record("\x00", rootLBA, rootSize, true, nil))
+	copy(pvd[813:], "2024010203040500")
+	term := img[17*SectorSize:]
+	term[0] = vdTerminator
+	copy(term[1:6], "CD001")
+	term[6] = 1
+	return img
+}
+
+// record returns a directory record for name, followed by the system use
+// area su.
+func record(name string, lba, size uint32, dir bool, su []byte) []byte {
+	n := len(name)
+	pad := 0
+	if n%2 == 0 {
+		pad = 1
+	}
+	rec := make([]byte, 33+n+pad+len(su))
+	rec[0] = byte(len(rec))
+	binary.LittleEndian.PutUint32(rec[2:6], lba)
+	binary.BigEndian.PutUint32(rec[6:10], lba)
+	binary.LittleEndian.PutUint32(rec[10:14], size)
+	binary.BigEndian.PutUint32(rec[14:18], size)
+	copy(rec[18:25], []byte{124, 1, 2, 3, 4, 5, 0})
+	if dir {
+		rec[25] = 0x02
+	}
+	rec[28] = 1
+	rec[32] = byte(n)
+	copy(rec[33:], name)
+	copy(rec[33+n+pad:], su)
+	return rec
+}
+
+// putDir writes the records of a directory, after its "." and ".." entries,
+// into the sector at lba.
+func putDir(img []byte, lba, parent uint32, dot []byte, records ...[]byte) {
+	data := append(record("\x00", lba, SectorSize, true, dot), record("\x01", parent, SectorSize, true, nil)...)
+	for _, rec := range records {
+		data = append(data, rec...)
+	}
+	sector := img[int(lba)*SectorSize : int(lba+1)*SectorSize]
+	copy(sector, make([]byte, SectorSize))
+	copy(sector, data)
+}
+
+// susp returns a SUSP entry with signature sig and data.
+func susp(sig string, data ...byte) []byte {
+	return append([]byte{sig[0], sig[1], byte(4 + len(data)), 1}, data...)
+}
+
+// both32 encodes v in both byte orders, as ISO 9660 does.
+func both32(v uint32) []byte {
+	b := make([]byte, 8)
+	binary.LittleEndian.PutUint32(b, v)
+	binary.BigEndian.PutUint32(b[4:], v)
+	return b
+}
+
+// ceEntry returns a Rock Ridge "CE" entry pointing at a continuation area.
+func ceEntry(block, offset, size uint32) []byte {
+	data := append(both32(block), both32(offset)...)
+	return susp("CE", append(data, both32(size)...)...)
+}
+
+// plainImage is an image with README.TXT;1 in the root and DATA/FILE.BIN;1
+// below it.
+func plainImage() []byte {
+	img := newImage(24, 18, SectorSize)
+	putDir(img, 18, 18, nil,
+		record("DATA", 19, SectorSize, true, nil),
+		record("README.TXT;1", 20, 5, false, nil),
+	)
+	putDir(img, 19, 18, nil, record("FILE.BIN;1", 21, 3, false, nil))
+	copy(img[20*SectorSize:], "hello")
+	copy(img[21*SectorSize:], "abc")
+	return img
+}
+
+func TestFS(t *testing.T) {
+	fsys, err := NewFS(bytes.NewReader(plainImage()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fsys.Volume().VolumeID; got != "TEST" {
+		t.Errorf("VolumeID = %q, want TEST", got)
+	}
+	for name, want := range map[string]string{
+		"README.TXT":    "hello",
+		"readme.txt":    "hello", // Plain ISO 9660 names match case-insensitively
+		"DATA/FILE.BIN": "abc",
+	} {
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			t.Errorf("ReadFile(%s): %v", name, err)
+			continue
+		}
+		if string(data) != want {
+			t.Errorf("ReadFile(%s) = %q, want %q", name, data, want)
+		}
+	}
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	if got := strings.Join(names, ","); got != "DATA,README.TXT" {
+		t.Errorf("root lists %s, want DATA,README.TXT", got)
+	}
+	if _, err := fs.Stat(fsys, "MISSING"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Stat(MISSING) = %v, want ErrNotExist", err)
+	}
+}
+
+func TestRockRidgeNames(t *testing.T) {
+	sp := susp("SP", 0xBE, 0xEF, 0)
+	continued := susp("NM", append([]byte{0}, "continued.txt"...)...)
+	tests := []struct {
+		name string
+		su   []byte
+		area []byte // Continuation area in sector 22
+		want string // Empty if the entry is skipped
+	}{
+		{"NM entry", susp("NM", append([]byte{0}, "long-name.txt"...)...), nil, "long-name.txt"},
+		{"NM in continuation area", ceEntry(22, 100, uint32(len(continued))), continued, "continued.txt"},
+		{"continuation area past its block", ceEntry(22, 2040, uint32(len(continued))), continued, "NAME.TXT"},
+		{"oversized continuation area", ceEntry(22, 0, 1<<30), nil, "NAME.TXT"},
+		{"no NM entry", nil, nil, "NAME.TXT"},
+		{"slash in NM entry", susp("NM", append([]byte{0}, "a/b"...)...), nil, ""},
+		{"NM entry of ..", susp("NM", append([]byte{0}, ".."...)...), nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img := newImage(24, 18, SectorSize)
+			putDir(img, 18, 18, sp, record("NAME.TXT;1", 20, 2, false, tt.su))
+			copy(img[20*SectorSize:], "hi")
+			if tt.area != nil {
+				offset := int(binary.LittleEndian.Uint32(tt.su[12:16]))
+				if offset+len(tt.area) <= SectorSize {
+					copy(img[22*SectorSize+offset:], tt.area)
+				}
+			}
+			fsys, err := NewFS(bytes.NewReader(img))
+			if err != nil {
+				t.Fatal(err)
+			}
+			entries, err := fs.ReadDir(fsys, ".")
+			if err != nil {
+				t.Fatal(err)
+			}
+			var names []string
+			for _, e := range entries {
+				names = append(names, e.Name())
+			}
+			if got := strings.Join(names, ","); got != tt.want {
+				t.Errorf("root lists %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDamagedImages(t *testing.T) {
+	tests := []struct {
+		name  string
+		image func() []byte
+		path  string // Directory to read
+		err   error  // Expected error, or nil for any
+	}{
+		{
+			name:  "not ISO 9660",
+			image: func() []byte { return make([]byte, 24*SectorSize) },
+			err:   ErrNotISO9660,
+		},
+		{
+			name:  "truncated before the PVD",
+			image: func() []byte { return plainImage()[:10*SectorSize] },
+		},
+		{
+			name:  "truncated before the root directory",
+			image: func() []byte { return plainImage()[:18*SectorSize] },
+			path:  ".",
+		},
+		{
+			name: "directory larger than the image",
+			image: func() []byte {
+				img := newImage(24, 18, 0xFFFFFFFF)
+				putDir(img, 18, 18, nil)
+				return img
+			},
+			path: ".",
+		},
+		{
+			name: "directory past the end of the image",
+			image: func() []byte {
+				img := plainImage()
+				putDir(img, 18, 18, nil, record("DATA", 0x00FFFFFF, SectorSize, true, nil))
+				return img
+			},
+			path: ".",
+		},
+		{
+			name: "file past the end of the image",
+			image: func() []byte {
+				img := plainImage()
+				putDir(img, 18, 18, nil, record("BIG.BIN;1", 20, 0xFFFFFFFF, false, nil))
+				return img
+			},
+			path: ".",
+		},
+		{
+			name: "directory loop",
+			image: func() []byte {
+				img := plainImage()
+				putDir(img, 19, 18, nil, record("AGAIN", 18, SectorSize, true, nil))
+				return img
+			},
+			path: "DATA/AGAIN",
+			err:  ErrDirectoryLoop,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fsys, err := NewFS(bytes.NewReader(tt.image()))
+			if err == nil {
+				if tt.path == "" {
+					t.Fatal("NewFS succeeded")
+				}
+				_, err = fs.ReadDir(fsys, tt.path)
+			}
+			if err == nil {
+				t.Fatalf("reading %s succeeded", tt.path)
+			}
+			if tt.err != nil && !errors.Is(err, tt.err) {
+				t.Errorf("error %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestEmptyName(t *testing.T) {
+	// A directory named ";1" has an empty name and would be walked as its
+	// own parent
+	img := plainImage()
+	putDir(img, 18, 18, nil, record(";1", 18, SectorSize, true, nil))
+	fsys, err := NewFS(bytes.NewReader(img))
+	if err != nil {
+		t.Fatal(err)
+	}
+	walked := 0
+	err = fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if walked++; walked > 10 {
+			return errors.New("walked the root again")
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if walked != 1 {
+		t.Errorf("walked %d entries, want only the root", walked)
+	}
+}
+
+// FuzzNewFS reads every file of arbitrary images, which must not panic,
+// loop or allocate more than the image holds. The seed images are large
+// enough that minimizing an input takes minutes; fuzz with
+// -fuzzminimizetime 0.
+func FuzzNewFS(f *testing.F) {
+	f.Add(plainImage())
+	img := newImage(24, 18, SectorSize)
+	putDir(img, 18, 18, susp("SP", 0xBE, 0xEF, 0), record("NAME.TXT;1", 20, 2, false, ceEntry(22, 0, 16)))
+	f.Add(img)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		fsys, err := NewFS(bytes.NewReader(data))
+		if err != nil {
+			return
+		}
+		fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+			if err == nil && !d.IsDir() {
+				fs.ReadFile(fsys, name)
+			}
+			return nil
+		})
+	})
+}
@@ -0,0 +1,85 @@
+// Package isofs reads ISO 9660 structures from image files and devices.
+package isofs
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/pappasjfed/chkiso/internal/winpath"
+)
+
+const (
+	SectorSize   = 2048
+	PVDOffset    = 16 * SectorSize // The Primary Volume Descriptor lives in sector 16
+	PVDSize      = SectorSize
+	AppUseOffset = 883 // Offset of the Application Use field within the PVD
+	AppUseSize   = 512
+)
+
+// Open opens an image file or raw device for reading and returns it with its size.
+// Regular files are sized with Stat; devices are asked for their length (see
+// deviceSize), since Stat does not report a usable size for them. Devices
+// that only accept whole-sector reads are wrapped to accept any (see
+// rawDevice).
+func Open(path string) (Image, int64, error) {
+	file, err := os.Open(winpath.Long(path))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	info, err := file.Stat()
+	if err == nil && info.Mode().IsRegular() {
+		return file, info.Size(), nil
+	}
+
+	size, err := deviceSize(file)
+	if err != nil {
+		file.Close()
+		return nil, 0, err
+	}
+	return rawDevice(file, size), size, nil
+}
+
+// seekSize sizes a device by seeking to its end and back.
+func seekSize(file *os.File) (int64, error) {
+	size, err := file.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+	return size, nil
+}
+
+// ReadPVD reads the raw Primary Volume Descriptor block.
+func ReadPVD(r io.ReaderAt) ([]byte, error) {
+	pvd := make([]byte, PVDSize)
+	if n, err := r.ReadAt(pvd, PVDOffset); n != PVDSize {
+		if err == nil {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, fmt.Errorf("could not read PVD: %v", err)
+	}
+	return pvd, nil
+}
+
+// VolumeSize returns the size of the ISO 9660 volume described by a PVD
+// block (volume space size times logical block size), or 0 if the block is
+// not a Primary Volume Descriptor. On burned discs the device is usually
+// larger than the volume, because of padding and run-out sectors.
+func VolumeSize(pvd []byte) int64 {
+	if len(pvd) < PVDSize || pvd[0] != 1 || string(pvd[1:6]) != "CD001" {
+		return 0
+	}
+	blocks := int64(binary.LittleEndian.Uint32(pvd[80:84]))
+	blockSize := int64(binary.LittleEndian.Uint16(pvd[128:130]))
+	return blocks * blockSize
+}
+
+// ApplicationUse returns the Application Use field of a PVD block.
+func ApplicationUse(pvd []byte) []byte {
+	return pvd[AppUseOffset : AppUseOffset+AppUseSize]
+}
@@ -0,0 +1,76 @@
+package isofs
+
+import (
+	"errors"
+	"io"
+	"os"
+)
+
+// sectorReader reads a raw device that only accepts reads of whole sectors
+// at sector boundaries, such as /dev/rdiskN on macOS, for callers that read
+// any range: unaligned reads go through a buffer covering whole sectors.
+type sectorReader struct {
+	file   *os.File
+	sector int64
+	size   int64
+	offset int64 // Position for Read
+}
+
+func newSectorReader(file *os.File, sector, size int64) *sectorReader {
+	return &sectorReader{file: file, sector: sector, size: size}
+}
+
+func (r *sectorReader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+	if off >= r.size {
+		return 0, io.EOF
+	}
+	end := off + int64(len(p))
+	if end > r.size {
+		end = r.size
+	}
+	if off%r.sector == 0 && (end-off)%r.sector == 0 && end-off == int64(len(p)) {
+		return r.file.ReadAt(p, off)
+	}
+
+	start := off - off%r.sector
+	if rem := end % r.sector; rem != 0 {
+		end += r.sector - rem
+	}
+	buf := make([]byte, end-start)
+	n, err := r.file.ReadAt(buf, start)
+	if int64(n) <= off-start {
+		if err == nil {
+			err = io.EOF
+		}
+		return 0, err
+	}
+	copied := copy(p, buf[off-start:n])
+	if copied < len(p) {
+		if err == nil {
+			err = io.EOF
+		}
+		return copied, err
+	}
+	return copied, nil
+}
+
+// Size returns the size of the device.
+func (r *sectorReader) Size() int64 {
+	return r.size
+}
+
+func (r *sectorReader) Read(p []byte) (int, error) {
+	n, err := r.ReadAt(p, r.offset)
+	r.offset += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return n, err
+}
+
+func (r *sectorReader) Close() error {
+	return r.file.Close()
+}
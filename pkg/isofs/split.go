@@ -0,0 +1,145 @@
+package isofs
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+
+	"github.com/pappasjfed/chkiso/internal/winpath"
+)
+
+// Image is an opened image: a file, a device, or the parts of a split image
+// read as one.
+type Image interface {
+	io.Reader
+	io.ReaderAt
+	io.Closer
+}
+
+// splitPattern matches the names of split image parts: image.iso.001 (as
+// written by 7-Zip, HJSplit and split -d -a 3) and image.iso.part01.
+var splitPattern = regexp.MustCompile(`(?i)^(.+)\.(part)?(\d+)$`)
+
+// SplitParts returns every part of the split image that path belongs to, in
+// order, and the name of the joined image (path without its part suffix).
+// It returns nil if path is not a part of a split image, or the set has only
+// one part. Numbering must start at 0 or 1 and be continuous.
+func SplitParts(path string) (parts []string, joined string) {
+	m := splitPattern.FindStringSubmatch(filepath.Base(path))
+	if m == nil || (m[2] == "" && len(m[3]) != 3) {
+		return nil, ""
+	}
+	dir := filepath.Dir(path)
+	width := len(m[3])
+	prefix := m[1] + "." + m[2]
+	name := func(n int) string {
+		return filepath.Join(dir, fmt.Sprintf("%s%0*d", prefix, width, n))
+	}
+
+	first := 1
+	if _, err := os.Stat(name(0)); err == nil {
+		first = 0
+	}
+	for n := first; ; n++ {
+		if _, err := os.Stat(name(n)); err != nil {
+			break
+		}
+		parts = append(parts, name(n))
+	}
+	if len(parts) < 2 {
+		return nil, ""
+	}
+	return parts, filepath.Join(dir, m[1])
+}
+
+// OpenParts opens the parts of a split image as one Image and returns it
+// with its total size.
+func OpenParts(parts []string) (Image, int64, error) {
+	img := &multiImage{}
+	for _, part := range parts {
+		file, err := os.Open(winpath.Long(part))
+		if err != nil {
+			img.Close()
+			return nil, 0, err
+		}
+		info, err := file.Stat()
+		if err != nil {
+			file.Close()
+			img.Close()
+			return nil, 0, err
+		}
+		img.files = append(img.files, file)
+		img.starts = append(img.starts, img.size)
+		img.size += info.Size()
+	}
+	return img, img.size, nil
+}
+
+// multiImage reads a sequence of files as if they were concatenated.
+type multiImage struct {
+	files  []*os.File
+	starts []int64 // Offset of each file within the image
+	size   int64
+	offset int64 // Position for Read
+}
+
+func (m *multiImage) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+	if off >= m.size {
+		return 0, io.EOF
+	}
+	// The last part starting at or before off holds it
+	i := sort.Search(len(m.starts), func(i int) bool { return m.starts[i] > off }) - 1
+	n := 0
+	for n < len(p) && i < len(m.files) {
+		partOff := off + int64(n) - m.starts[i]
+		partSize := m.size - m.starts[i]
+		if i+1 < len(m.starts) {
+			partSize = m.starts[i+1] - m.starts[i]
+		}
+		want := p[n:]
+		if int64(len(want)) > partSize-partOff {
+			want = want[:partSize-partOff]
+		}
+		read, err := m.files[i].ReadAt(want, partOff)
+		n += read
+		if err != nil && !(err == io.EOF && read == len(want)) {
+			return n, err
+		}
+		i++
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// Size returns the size of the joined image.
+func (m *multiImage) Size() int64 {
+	return m.size
+}
+
+func (m *multiImage) Read(p []byte) (int, error) {
+	n, err := m.ReadAt(p, m.offset)
+	m.offset += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return n, err
+}
+
+func (m *multiImage) Close() error {
+	var first error
+	for _, f := range m.files {
+		if err := f.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
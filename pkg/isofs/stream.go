@@ -0,0 +1,168 @@
+package isofs
+
+import (
+	"errors"
+	"io"
+	"sync"
+)
+
+const (
+	streamBlockSize = 256 << 10
+	// streamHeadBlocks are kept for the whole life of a StreamImage: the
+	// volume descriptors and, usually, the directory tree live there.
+	streamHeadBlocks = 16
+	// streamCachedBlocks bounds the other blocks kept in memory.
+	streamCachedBlocks = 64
+)
+
+// StreamImage is an Image over a stream that can only be read forwards,
+// such as a decompressor. Reading at an earlier offset than the stream has
+// reached reopens it from the start, so it is fast for the mostly ascending
+// reads of hashing and ISO 9660 parsing, and correct, if slow, otherwise.
+// The first few MiB and recently read blocks are kept in memory. ReadAt
+// may be called concurrently.
+type StreamImage struct {
+	mu     sync.Mutex // Guards the stream and the cache
+	open   func() (io.ReadCloser, error)
+	r      io.ReadCloser
+	pos    int64 // Offset r has reached
+	size   int64 // Total size once the end has been seen, else -1
+	blocks map[int64][]byte
+	recent []int64 // Cached blocks past the head, oldest first
+	offset int64   // Position for Read
+}
+
+// NewStreamImage returns an Image over the streams open returns, each of
+// which must produce the same bytes from the start.
+func NewStreamImage(open func() (io.ReadCloser, error)) *StreamImage {
+	return &StreamImage{open: open, size: -1, blocks: make(map[int64][]byte)}
+}
+
+// Size returns the length of the stream, reading to its end if it has not
+// been reached yet.
+func (s *StreamImage) Size() (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.size >= 0 {
+		return s.size, nil
+	}
+	if s.r == nil {
+		if err := s.reopen(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := io.Copy(io.Discard, s.r)
+	if err != nil {
+		return 0, err
+	}
+	s.size = s.pos + n
+	s.pos = s.size
+	return s.size, nil
+}
+
+func (s *StreamImage) reopen() error {
+	if s.r != nil {
+		s.r.Close()
+	}
+	r, err := s.open()
+	if err != nil {
+		return err
+	}
+	s.r = r
+	s.pos = 0
+	return nil
+}
+
+// block returns block n, which is shorter than streamBlockSize only at the
+// end of the stream.
+func (s *StreamImage) block(n int64) ([]byte, error) {
+	if b, ok := s.blocks[n]; ok {
+		return b, nil
+	}
+	start := n * streamBlockSize
+	if s.size >= 0 && start >= s.size {
+		return nil, io.EOF
+	}
+	if s.r == nil || s.pos > start {
+		if err := s.reopen(); err != nil {
+			return nil, err
+		}
+	}
+	if skip := start - s.pos; skip > 0 {
+		copied, err := io.CopyN(io.Discard, s.r, skip)
+		s.pos += copied
+		if err == io.EOF {
+			s.size = s.pos
+			return nil, io.EOF
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	b := make([]byte, streamBlockSize)
+	read, err := io.ReadFull(s.r, b)
+	s.pos += int64(read)
+	switch {
+	case errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF):
+		s.size = s.pos
+		if read == 0 {
+			return nil, io.EOF
+		}
+		b = b[:read]
+	case err != nil:
+		return nil, err
+	}
+
+	s.blocks[n] = b
+	if n >= streamHeadBlocks {
+		s.recent = append(s.recent, n)
+		if len(s.recent) > streamCachedBlocks {
+			delete(s.blocks, s.recent[0])
+			s.recent = s.recent[1:]
+		}
+	}
+	return b, nil
+}
+
+func (s *StreamImage) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for n < len(p) {
+		pos := off + int64(n)
+		b, err := s.block(pos / streamBlockSize)
+		if err != nil {
+			return n, err
+		}
+		within := int(pos % streamBlockSize)
+		if within >= len(b) {
+			return n, io.EOF
+		}
+		n += copy(p[n:], b[within:])
+	}
+	return n, nil
+}
+
+func (s *StreamImage) Read(p []byte) (int, error) {
+	n, err := s.ReadAt(p, s.offset)
+	s.offset += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return n, err
+}
+
+// Close closes the underlying stream.
+func (s *StreamImage) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.r == nil {
+		return nil
+	}
+	err := s.r.Close()
+	s.r = nil
+	return err
+}
@@ -0,0 +1,141 @@
+// Package isomd5 checks MD5 sums implanted into ISO images by implantisomd5,
+// compatible with checkisomd5.
+package isomd5
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pappasjfed/chkiso/internal/ctxio"
+	"github.com/pappasjfed/chkiso/internal/pipeline"
+	"github.com/pappasjfed/chkiso/pkg/isofs"
+)
+
+const spaceChar = 0x20 // Space character used for neutralizing the PVD
+
+var (
+	// ErrNoSignature is returned when the image carries no 'ISO MD5SUM' signature.
+	ErrNoSignature = errors.New("no 'ISO MD5SUM' signature found")
+
+	md5Pattern  = regexp.MustCompile(`ISO MD5SUM = ([0-9a-fA-F]{32})`)
+	skipPattern = regexp.MustCompile(`SKIPSECTORS\s*=\s*(\d+)`)
+)
+
+// Result is the outcome of an implanted MD5 check.
+type Result struct {
+	VerificationMethod string
+	StoredMD5          string
+	CalculatedMD5      string
+	SkipSectors        int
+	IsIntegrityOK      bool
+}
+
+// Check verifies the implanted MD5 of the image in r, which is size bytes long.
+// Hashing stops early with ctx.Err() if ctx is cancelled.
+func Check(ctx context.Context, r io.ReaderAt, size int64) (*Result, error) {
+	return CheckAhead(ctx, r, size, 1)
+}
+
+// CheckAhead is Check reading up to ahead megabytes ahead of hashing, which
+// keeps an optical drive reading at full speed (see pipeline.CopyAhead).
+func CheckAhead(ctx context.Context, r io.ReaderAt, size int64, ahead int) (*Result, error) {
+	pvdBlock, err := isofs.ReadPVD(r)
+	if err != nil {
+		return nil, err
+	}
+	w, err := NewWriter(pvdBlock, size)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := pipeline.CopyAhead(ctx, w, ctxio.NewReader(ctx, io.NewSectionReader(r, 0, w.end)), ahead); err != nil {
+		return nil, err
+	}
+	return w.Result()
+}
+
+// Writer calculates the implanted MD5 of an image written to it from the
+// start, in order, so that it can be checked while the image is read for
+// something else, such as copying it. Bytes past the hashed area are
+// ignored.
+type Writer struct {
+	hash        hash.Hash
+	stored      string
+	skipSectors int
+	end         int64 // End of the hashed area
+	pos         int64 // Offset of the next byte written
+}
+
+// NewWriter returns a Writer for the image of size bytes with the Primary
+// Volume Descriptor pvdBlock, or ErrNoSignature if no MD5 is implanted in it.
+func NewWriter(pvdBlock []byte, size int64) (*Writer, error) {
+	appUseString := string(isofs.ApplicationUse(pvdBlock))
+	matches := md5Pattern.FindStringSubmatch(appUseString)
+	if matches == nil {
+		return nil, ErrNoSignature
+	}
+	w := &Writer{hash: md5.New(), stored: strings.ToLower(matches[1])}
+	if skipMatches := skipPattern.FindStringSubmatch(appUseString); skipMatches != nil {
+		w.skipSectors, _ = strconv.Atoi(skipMatches[1])
+	}
+	w.end = size - int64(w.skipSectors)*isofs.SectorSize
+	return w, nil
+}
+
+// Write hashes p, with the Application Use field of the Primary Volume
+// Descriptor, which holds the implanted MD5, read as spaces.
+func (w *Writer) Write(p []byte) (int, error) {
+	n := len(p)
+	if left := w.end - w.pos; int64(len(p)) > left {
+		if left < 0 {
+			left = 0
+		}
+		p = p[:left]
+	}
+	appUse := int64(isofs.PVDOffset + isofs.AppUseOffset)
+	for len(p) > 0 {
+		switch {
+		case w.pos >= appUse && w.pos < appUse+isofs.AppUseSize:
+			k := appUse + isofs.AppUseSize - w.pos
+			if int64(len(p)) < k {
+				k = int64(len(p))
+			}
+			w.hash.Write(bytes.Repeat([]byte{spaceChar}, int(k)))
+			w.pos += k
+			p = p[k:]
+		case w.pos < appUse && w.pos+int64(len(p)) > appUse:
+			k := appUse - w.pos
+			w.hash.Write(p[:k])
+			w.pos += k
+			p = p[k:]
+		default:
+			w.hash.Write(p)
+			w.pos += int64(len(p))
+			p = nil
+		}
+	}
+	return n, nil
+}
+
+// Result returns the outcome of the check once the whole hashed area was
+// written, or io.ErrUnexpectedEOF if the image ended too soon.
+func (w *Writer) Result() (*Result, error) {
+	if w.pos < w.end {
+		return nil, io.ErrUnexpectedEOF
+	}
+	calculatedMD5 := hex.EncodeToString(w.hash.Sum(nil))
+	return &Result{
+		VerificationMethod: "ASCII String (checkisomd5 compatible)",
+		StoredMD5:          w.stored,
+		CalculatedMD5:      calculatedMD5,
+		SkipSectors:        w.skipSectors,
+		IsIntegrityOK:      w.stored == calculatedMD5,
+	}, nil
+}
@@ -0,0 +1,333 @@
+// Package jigdo reads Jigsaw Download (.jigdo and .template) files, which
+// Debian uses to distribute images as the list of packages they are built
+// from, and checks a reconstructed image against them: its size and hash,
+// and the hash of every package file within it.
+package jigdo
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"math"
+	"strings"
+
+	"github.com/pappasjfed/chkiso/internal/ctxio"
+)
+
+// ErrNotTemplate is returned by ReadTemplate when the data has no DESC
+// section.
+var ErrNotTemplate = errors.New("not a jigdo template (no DESC section)")
+
+// encoding is jigdo's Base64 variant: URL-safe and unpadded.
+var encoding = base64.RawURLEncoding
+
+// Jigdo is the part of a .jigdo file needed for verification.
+type Jigdo struct {
+	Version        string
+	ImageName      string // [Image] Filename
+	TemplateName   string // [Image] Template
+	TemplateMD5    string // Hex MD5 of the template, if listed
+	TemplateSHA256 string // Hex SHA256 of the template, if listed
+	// Parts maps the hex MD5 or SHA256 of each package file to its
+	// location, e.g. "Debian:pool/main/b/bash/bash_5.2.15-2_amd64.deb".
+	Parts map[string]string
+}
+
+// ParseJigdo reads a .jigdo file, which is usually gzip compressed.
+func ParseJigdo(r io.Reader) (*Jigdo, error) {
+	br := bufio.NewReader(r)
+	if magic, err := br.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		br = bufio.NewReader(zr)
+	}
+
+	j := &Jigdo{Parts: make(map[string]string)}
+	section := ""
+	scanner := bufio.NewScanner(br)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = line[1 : len(line)-1]
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		key, value = strings.TrimSpace(key), unquote(strings.TrimSpace(value))
+		switch section {
+		case "Jigdo":
+			if key == "Version" {
+				j.Version = value
+			}
+		case "Image":
+			switch key {
+			case "Filename":
+				j.ImageName = value
+			case "Template":
+				j.TemplateName = value
+			case "Template-MD5Sum":
+				j.TemplateMD5 = decodeHash(value)
+			case "Template-SHA256Sum":
+				j.TemplateSHA256 = decodeHash(value)
+			}
+		case "Parts":
+			if h := decodeHash(key); h != "" {
+				j.Parts[h] = value
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if j.TemplateName == "" {
+		return nil, fmt.Errorf("not a jigdo file (no [Image] Template entry)")
+	}
+	return j, nil
+}
+
+func unquote(s string) string {
+	if len(s) >= 2 && (s[0] == '\'' || s[0] == '"') && s[len(s)-1] == s[0] {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+// decodeHash converts a jigdo Base64 digest to hex, or returns "".
+func decodeHash(s string) string {
+	b, err := encoding.DecodeString(s)
+	if err != nil || (len(b) != md5.Size && len(b) != sha256.Size) {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
+
+// DESC entry types. The MD5 ones are from jigdo 1.x templates, the SHA256
+// ones from jigdo 2.x.
+const (
+	entryUnmatched   = 2
+	entryImageMD5    = 5
+	entryMatchedMD5  = 6
+	entryWrittenMD5  = 7
+	entryImageSHA256 = 8
+	entryMatchedSHA  = 9
+	entryWrittenSHA  = 10
+)
+
+// A DESC section starts with "DESC" and its length, and ends with the
+// length again.
+const (
+	descHeaderSize    = 4 + 6
+	descTrailerLength = 6
+)
+
+// Component is one region of the image a template describes.
+type Component struct {
+	Offset int64
+	Length int64
+	// Hash is the hex digest of a package file placed here, or "" for data
+	// stored in the template itself.
+	Hash string
+}
+
+// Template is the DESC section of a .template file: the layout of the
+// image and its expected size and hash.
+type Template struct {
+	ImageSize  int64
+	Algorithm  string // "md5" or "sha256"
+	ImageHash  string // Hex digest of the whole image
+	Components []Component
+}
+
+// ReadTemplate reads the DESC section at the end of the template in r, which
+// is size bytes long.
+func ReadTemplate(r io.ReaderAt, size int64) (*Template, error) {
+	if size < descHeaderSize+descTrailerLength {
+		return nil, ErrNotTemplate
+	}
+	b := make([]byte, descTrailerLength)
+	if _, err := r.ReadAt(b, size-descTrailerLength); err != nil {
+		return nil, err
+	}
+	length := int64(uint48(b))
+	if length < descHeaderSize+descTrailerLength || length > size || length > 256<<20 {
+		return nil, ErrNotTemplate
+	}
+	desc := make([]byte, length)
+	if _, err := r.ReadAt(desc, size-length); err != nil {
+		return nil, err
+	}
+	if string(desc[0:4]) != "DESC" || int64(uint48(desc[4:10])) != length {
+		return nil, ErrNotTemplate
+	}
+
+	t := &Template{}
+	entries := desc[descHeaderSize : length-descTrailerLength]
+	var offset int64
+	for len(entries) > 0 {
+		var n int
+		switch entries[0] {
+		case entryUnmatched:
+			n = 1 + 6
+		case entryImageMD5:
+			n = 1 + 6 + 16 + 4
+		case entryMatchedMD5, entryWrittenMD5:
+			n = 1 + 6 + 8 + 16
+		case entryImageSHA256:
+			n = 1 + 6 + 32 + 4
+		case entryMatchedSHA, entryWrittenSHA:
+			n = 1 + 6 + 8 + 32
+		default:
+			return nil, fmt.Errorf("unknown DESC entry type %d", entries[0])
+		}
+		if len(entries) < n {
+			return nil, fmt.Errorf("truncated DESC section")
+		}
+		e := entries[:n]
+		entries = entries[n:]
+		length := int64(uint48(e[1:7]))
+		switch e[0] {
+		case entryImageMD5, entryImageSHA256:
+			t.ImageSize = length
+			t.Algorithm = "md5"
+			if e[0] == entryImageSHA256 {
+				t.Algorithm = "sha256"
+			}
+			t.ImageHash = hex.EncodeToString(e[7 : n-4])
+			continue
+		case entryUnmatched:
+			t.Components = append(t.Components, Component{Offset: offset, Length: length})
+		default:
+			t.Components = append(t.Components, Component{Offset: offset, Length: length, Hash: hex.EncodeToString(e[15:])})
+		}
+		if offset > math.MaxInt64-length {
+			return nil, fmt.Errorf("the template's parts add up to more than %d bytes", int64(math.MaxInt64))
+		}
+		offset += length
+	}
+	if t.ImageHash == "" {
+		return nil, fmt.Errorf("the template has no image information")
+	}
+	if offset != t.ImageSize {
+		return nil, fmt.Errorf("the template's parts add up to %d bytes, but the image is %d", offset, t.ImageSize)
+	}
+	return t, nil
+}
+
+func uint48(b []byte) uint64 {
+	var v uint64
+	for i := 5; i >= 0; i-- {
+		v = v<<8 | uint64(b[i])
+	}
+	return v
+}
+
+// Failure is a package file whose region of the image does not match.
+type Failure struct {
+	Component
+	Name       string // Location from the .jigdo file, if listed
+	Calculated string
+}
+
+// Result is the outcome of checking an image against a template.
+type Result struct {
+	Algorithm          string
+	Expected           string // Digest of the whole image per the template
+	Calculated         string
+	ExpectedSize       int64
+	Size               int64
+	Components         int // Package files checked
+	Failures           []Failure
+	TemplateChecked    bool // The template's own hash, listed in the .jigdo file, was checked
+	TemplateHashFailed bool
+}
+
+// OK reports whether the image matched the template.
+func (r *Result) OK() bool {
+	return r.Size == r.ExpectedSize && r.Calculated == r.Expected && len(r.Failures) == 0 && !r.TemplateHashFailed
+}
+
+// Verify reads the image from r in one pass and compares its size and hash,
+// and the hash of each package file in it, with the template. j may be nil;
+// if given, it names failing package files.
+func Verify(ctx context.Context, r io.Reader, t *Template, j *Jigdo) (*Result, error) {
+	result := &Result{Algorithm: t.Algorithm, Expected: t.ImageHash, ExpectedSize: t.ImageSize}
+	newHash := md5.New
+	if t.Algorithm == "sha256" {
+		newHash = sha256.New
+	}
+	whole := newHash()
+	r = ctxio.NewReader(ctx, r)
+	buf := make([]byte, 1<<20)
+	for _, c := range t.Components {
+		var part hash.Hash
+		var w io.Writer = whole
+		if c.Hash != "" {
+			part = newHash()
+			w = io.MultiWriter(whole, part)
+		}
+		n, err := io.CopyBuffer(w, io.LimitReader(r, c.Length), buf)
+		result.Size += n
+		if err != nil {
+			return nil, err
+		}
+		if n < c.Length {
+			// The image is too short; the size check reports it
+			break
+		}
+		if part == nil {
+			continue
+		}
+		result.Components++
+		if sum := hex.EncodeToString(part.Sum(nil)); sum != c.Hash {
+			f := Failure{Component: c, Calculated: sum}
+			if j != nil {
+				f.Name = j.Parts[c.Hash]
+			}
+			result.Failures = append(result.Failures, f)
+		}
+	}
+	// Trailing data makes the image too long
+	n, err := io.CopyBuffer(whole, r, buf)
+	result.Size += n
+	if err != nil {
+		return nil, err
+	}
+	result.Calculated = hex.EncodeToString(whole.Sum(nil))
+	return result, nil
+}
+
+// CheckTemplate compares the hash of the template in r with the one the
+// .jigdo file lists, recording the outcome in result. It does nothing if
+// the .jigdo file lists none.
+func CheckTemplate(ctx context.Context, r io.Reader, j *Jigdo, result *Result) error {
+	expected, h := j.TemplateSHA256, sha256.New()
+	if expected == "" {
+		expected, h = j.TemplateMD5, md5.New()
+	}
+	if expected == "" {
+		return nil
+	}
+	if _, err := io.Copy(h, ctxio.NewReader(ctx, r)); err != nil {
+		return err
+	}
+	result.TemplateChecked = true
+	result.TemplateHashFailed = hex.EncodeToString(h.Sum(nil)) != expected
+	return nil
+}
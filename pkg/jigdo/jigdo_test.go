@@ -0,0 +1,246 @@
+package jigdo
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func put48(b []byte, v uint64) []byte {
+	for i := 0; i < 6; i++ {
+		b = append(b, byte(v>>(8*i)))
+	}
+	return b
+}
+
+// desc returns a template: some compressed data, then a DESC section of
+// the entries.
+func desc(entries ...[]byte) []byte {
+	body := bytes.Join(entries, nil)
+	length := uint64(descHeaderSize + len(body) + descTrailerLength)
+	b := append([]byte("template data"), "DESC"...)
+	b = put48(b, length)
+	b = append(b, body...)
+	return put48(b, length)
+}
+
+func unmatched(length uint64) []byte {
+	return put48([]byte{entryUnmatched}, length)
+}
+
+// matched returns an entry for a package file holding data, hashed with
+// MD5 or, if sha is set, SHA256.
+func matched(data []byte, sha bool) []byte {
+	if sha {
+		sum := sha256.Sum256(data)
+		return append(put48([]byte{entryMatchedSHA}, uint64(len(data))), append(make([]byte, 8), sum[:]...)...)
+	}
+	sum := md5.Sum(data)
+	return append(put48([]byte{entryMatchedMD5}, uint64(len(data))), append(make([]byte, 8), sum[:]...)...)
+}
+
+// imageInfo returns the entry giving the size and hash of image.
+func imageInfo(image []byte, sha bool) []byte {
+	if sha {
+		sum := sha256.Sum256(image)
+		return append(put48([]byte{entryImageSHA256}, uint64(len(image))), append(sum[:], 0, 0, 0, 0)...)
+	}
+	sum := md5.Sum(image)
+	return append(put48([]byte{entryImageMD5}, uint64(len(image))), append(sum[:], 0, 0, 0, 0)...)
+}
+
+var (
+	header  = []byte("image header ")
+	pkg     = []byte("package file contents")
+	trailer = []byte(" image trailer")
+	image   = bytes.Join([][]byte{header, pkg, trailer}, nil)
+)
+
+// testTemplate is a template of image, with pkg as its package file.
+func testTemplate(sha bool) []byte {
+	return desc(
+		unmatched(uint64(len(header))),
+		matched(pkg, sha),
+		unmatched(uint64(len(trailer))),
+		imageInfo(image, sha),
+	)
+}
+
+func readTemplate(t *testing.T, b []byte) *Template {
+	t.Helper()
+	tmpl, err := ReadTemplate(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tmpl
+}
+
+func TestReadTemplate(t *testing.T) {
+	for _, sha := range []bool{false, true} {
+		tmpl := readTemplate(t, testTemplate(sha))
+		want := "md5"
+		if sha {
+			want = "sha256"
+		}
+		if tmpl.Algorithm != want || tmpl.ImageSize != int64(len(image)) || len(tmpl.Components) != 3 {
+			t.Errorf("sha %v: got %s, %d bytes, %d components", sha, tmpl.Algorithm, tmpl.ImageSize, len(tmpl.Components))
+			continue
+		}
+		if c := tmpl.Components[1]; c.Offset != int64(len(header)) || c.Length != int64(len(pkg)) || c.Hash == "" {
+			t.Errorf("sha %v: package component %+v", sha, c)
+		}
+	}
+}
+
+func TestReadTemplateErrors(t *testing.T) {
+	valid := testTemplate(false)
+	// Enough parts of 2^48-1 bytes to add up to more than 2^63
+	huge := make([][]byte, 1<<15+1)
+	for i := range huge {
+		huge[i] = unmatched(1<<48 - 1)
+	}
+	tests := []struct {
+		name     string
+		template []byte
+		want     error  // Expected error, or nil to check wantText
+		wantText string // Expected in the error
+	}{
+		{"empty", nil, ErrNotTemplate, ""},
+		{"no DESC section", bytes.Repeat([]byte("x"), 100), ErrNotTemplate, ""},
+		{"length past the start", put48(bytes.Repeat([]byte("x"), 20), 1000), ErrNotTemplate, ""},
+		{"length too small", put48(bytes.Repeat([]byte("x"), 20), 3), ErrNotTemplate, ""},
+		{"lengths disagree", func() []byte {
+			b := append([]byte(nil), valid...)
+			b[len("template data")+4]++
+			return b
+		}(), ErrNotTemplate, ""},
+		{"truncated", valid[:len(valid)-1], ErrNotTemplate, ""},
+		{"unknown entry", desc([]byte{42, 0, 0, 0, 0, 0, 0}), nil, "unknown DESC entry type 42"},
+		{"entry truncated", desc(imageInfo(image, true)[:20]), nil, "truncated DESC section"},
+		{"no image information", desc(unmatched(10)), nil, "no image information"},
+		{"parts shorter than the image", desc(unmatched(10), imageInfo(image, false)), nil, "add up to 10 bytes"},
+		{"parts overflow", desc(append(huge, imageInfo(image, false))...), nil, "add up to more than"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ReadTemplate(bytes.NewReader(tt.template), int64(len(tt.template)))
+			if err == nil {
+				t.Fatal("ReadTemplate succeeded")
+			}
+			if tt.want != nil && !errors.Is(err, tt.want) {
+				t.Errorf("error %q, want %q", err, tt.want)
+			}
+			if tt.want == nil && !strings.Contains(err.Error(), tt.wantText) {
+				t.Errorf("error %q, want %q", err, tt.wantText)
+			}
+		})
+	}
+}
+
+func TestVerify(t *testing.T) {
+	j := &Jigdo{Parts: map[string]string{}}
+	sum := md5.Sum(pkg)
+	j.Parts[hex.EncodeToString(sum[:])] = "Debian:pool/main/p/pkg/pkg.deb"
+	damaged := append([]byte(nil), image...)
+	damaged[len(header)] ^= 1
+	tests := []struct {
+		name     string
+		image    []byte
+		ok       bool
+		failures int
+	}{
+		{"matching", image, true, 0},
+		{"damaged package file", damaged, false, 1},
+		{"too short", image[:len(image)-5], false, 0},
+		{"truncated in the package file", image[:len(header)+3], false, 0},
+		{"trailing data", append(append([]byte(nil), image...), 0), false, 0},
+	}
+	for _, sha := range []bool{false, true} {
+		tmpl := readTemplate(t, testTemplate(sha))
+		for _, tt := range tests {
+			result, err := Verify(context.Background(), bytes.NewReader(tt.image), tmpl, j)
+			if err != nil {
+				t.Fatalf("%s: %v", tt.name, err)
+			}
+			if result.OK() != tt.ok || len(result.Failures) != tt.failures {
+				t.Errorf("%s, sha %v: OK %v with %d failures, want %v with %d", tt.name, sha, result.OK(), len(result.Failures), tt.ok, tt.failures)
+			}
+			if result.Size != int64(len(tt.image)) {
+				t.Errorf("%s, sha %v: Size = %d, want %d", tt.name, sha, result.Size, len(tt.image))
+			}
+			if len(result.Failures) > 0 && !sha && result.Failures[0].Name != "Debian:pool/main/p/pkg/pkg.deb" {
+				t.Errorf("%s: failure named %q", tt.name, result.Failures[0].Name)
+			}
+		}
+	}
+}
+
+const jigdoFile = `# JigsawDownload
+[Jigdo]
+Version=1.1
+
+[Image]
+Filename=debian.iso
+Template='debian.template'
+Template-MD5Sum=%s
+
+[Parts]
+%s=Debian:pool/main/p/pkg/pkg.deb
+not-a-hash=Debian:ignored
+`
+
+func TestParseJigdo(t *testing.T) {
+	tmplSum := md5.Sum(testTemplate(false))
+	pkgSum := md5.Sum(pkg)
+	text := strings.NewReplacer("%s=", encoding.EncodeToString(pkgSum[:])+"=", "%s", encoding.EncodeToString(tmplSum[:])).Replace(jigdoFile)
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write([]byte(text))
+	zw.Close()
+
+	for name, data := range map[string][]byte{"plain": []byte(text), "gzip": gz.Bytes(), "CRLF": []byte(strings.ReplaceAll(text, "\n", "\r\n"))} {
+		j, err := ParseJigdo(bytes.NewReader(data))
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if j.Version != "1.1" || j.ImageName != "debian.iso" || j.TemplateName != "debian.template" {
+			t.Errorf("%s: got %+v", name, j)
+		}
+		if j.TemplateMD5 != hex.EncodeToString(tmplSum[:]) {
+			t.Errorf("%s: TemplateMD5 = %s", name, j.TemplateMD5)
+		}
+		if len(j.Parts) != 1 || j.Parts[hex.EncodeToString(pkgSum[:])] != "Debian:pool/main/p/pkg/pkg.deb" {
+			t.Errorf("%s: Parts = %v", name, j.Parts)
+		}
+
+		for _, tt := range []struct {
+			template []byte
+			failed   bool
+		}{{testTemplate(false), false}, {testTemplate(true), true}} {
+			var result Result
+			if err := CheckTemplate(context.Background(), bytes.NewReader(tt.template), j, &result); err != nil {
+				t.Fatal(err)
+			}
+			if !result.TemplateChecked || result.TemplateHashFailed != tt.failed {
+				t.Errorf("%s: checked %v, failed %v, want failed %v", name, result.TemplateChecked, result.TemplateHashFailed, tt.failed)
+			}
+		}
+	}
+
+	for name, data := range map[string]string{
+		"empty":       "",
+		"no template": "[Image]\nFilename=debian.iso\n",
+		"bad gzip":    "\x1f\x8b\x08garbage",
+	} {
+		if _, err := ParseJigdo(strings.NewReader(data)); err == nil {
+			t.Errorf("%s: ParseJigdo succeeded", name)
+		}
+	}
+}
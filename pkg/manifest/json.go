@@ -0,0 +1,121 @@
+package manifest
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// JSONVersion is the version of the native chkiso JSON manifest format.
+// Version 2 added modification times, the tree hash and tool metadata;
+// version 1 manifests are still read.
+const JSONVersion = 2
+
+// JSONManifest is the native chkiso manifest format.
+type JSONManifest struct {
+	Version  int        `json:"version"`
+	Tool     *JSONTool  `json:"tool,omitempty"`
+	TreeHash string     `json:"tree_hash,omitempty"` // See CalculateTreeHash
+	Files    []JSONFile `json:"files"`
+}
+
+// JSONTool describes the program that wrote a JSONManifest.
+type JSONTool struct {
+	Name    string    `json:"name"`
+	Version string    `json:"version"`
+	Created time.Time `json:"created"`
+	Host    string    `json:"host,omitempty"`
+}
+
+// JSONFile is one file in a JSONManifest. Hashes maps an algorithm name
+// (md5, sha1, sha256, sha512) to its hex digest.
+type JSONFile struct {
+	Path   string            `json:"path"`
+	Size   *int64            `json:"size,omitempty"`
+	MTime  *time.Time        `json:"mtime,omitempty"`
+	Hashes map[string]string `json:"hashes"`
+}
+
+// CalculateTreeHash returns the hash of the whole tree m lists: the SHA256
+// of its files' "<sha256>  <path>" lines, sorted by path, which is what
+// sha256sum would print for them. It identifies the tree in one hash, and
+// tells an edited file list from the one that was hashed. It returns "" if
+// a file has no SHA256.
+func (m *JSONManifest) CalculateTreeHash() string {
+	files := make([]JSONFile, len(m.Files))
+	copy(files, m.Files)
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	h := sha256.New()
+	for _, f := range files {
+		sum := strings.ToLower(f.Hashes[SHA256])
+		if AlgorithmForLength(len(sum)) != SHA256 {
+			return ""
+		}
+		fmt.Fprintf(h, "%s  %s\n", sum, f.Path)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// WriteJSON writes m, indented for people to read.
+func WriteJSON(w io.Writer, m *JSONManifest) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// strongest lists algorithms in the order they are preferred for verification.
+var strongest = []string{SHA512, SHA256, SHA1, MD5}
+
+type jsonParser struct{}
+
+func (jsonParser) Name() string { return "json" }
+
+func (jsonParser) Detect(name string, data []byte) bool {
+	return bytes.HasPrefix(bytes.TrimSpace(data), []byte("{"))
+}
+
+// Parse returns one entry per file, using the strongest hash it lists. A
+// manifest whose tree hash does not match its files is refused.
+func (jsonParser) Parse(data []byte) ([]Entry, error) {
+	var m JSONManifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, errorf("invalid JSON manifest: %v", err)
+	}
+	if m.Version > JSONVersion {
+		return nil, errorf("unsupported JSON manifest version %d (newest supported is %d)", m.Version, JSONVersion)
+	}
+	if m.TreeHash != "" && !strings.EqualFold(m.TreeHash, m.CalculateTreeHash()) {
+		return nil, errorf("JSON manifest's tree hash does not match the files it lists; the manifest was changed after it was written")
+	}
+
+	var entries []Entry
+	for _, f := range m.Files {
+		size := int64(-1)
+		if f.Size != nil {
+			size = *f.Size
+		}
+		for _, algorithm := range strongest {
+			hash, ok := f.Hashes[algorithm]
+			if !ok || AlgorithmForLength(len(hash)) != algorithm {
+				continue
+			}
+			entries = append(entries, Entry{
+				Algorithm: algorithm,
+				Hash:      strings.ToLower(hash),
+				Path:      cleanPath(f.Path),
+				Size:      size,
+			})
+			break
+		}
+	}
+	return entries, nil
+}
@@ -0,0 +1,242 @@
+// Package manifest finds and parses checksum files (SHA256SUMS and friends).
+package manifest
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Hash algorithms an Entry can name.
+const (
+	MD5    = "md5"
+	SHA1   = "sha1"
+	SHA256 = "sha256"
+	SHA512 = "sha512"
+	CRC32  = "crc32"
+)
+
+// Entry is one file listed in a checksum file.
+type Entry struct {
+	Algorithm string // One of MD5, SHA1, SHA256, SHA512 or CRC32
+	Hash      string // Lowercase hexadecimal digest
+	Path      string // Path relative to the checksum file's directory
+	Size      int64  // Expected size in bytes, or -1 if the format does not record it
+}
+
+// SignatureExts are the extensions of detached signatures published next to
+// images and checksum files, such as SHA256SUMS.sig or SHA256SUMS.gpg.
+var SignatureExts = []string{".sig", ".asc", ".gpg", ".sign"}
+
+// Patterns describes the checksum file names Find looks for, for messages.
+const Patterns = "*.sha, *.sha256, *.md5, *.sfv, sha256sum.txt, SHA256SUMS, MD5SUMS, chkiso.json"
+
+// AlgorithmForLength returns the algorithm whose hex digest has n characters.
+func AlgorithmForLength(n int) string {
+	switch n {
+	case 8:
+		return CRC32
+	case 32:
+		return MD5
+	case 40:
+		return SHA1
+	case 64:
+		return SHA256
+	case 128:
+		return SHA512
+	}
+	return ""
+}
+
+// Strength ranks algorithm by collision resistance, weakest first, so two
+// algorithms can be compared. Unknown algorithms rank 0.
+func Strength(algorithm string) int {
+	switch algorithm {
+	case CRC32:
+		return 1
+	case MD5:
+		return 2
+	case SHA1:
+		return 3
+	case SHA256:
+		return 4
+	case SHA512:
+		return 5
+	}
+	return 0
+}
+
+// FIPSApproved reports whether algorithm is a FIPS 180-4 hash that remains
+// approved for integrity checking. SHA-1 is excluded since NIST is
+// withdrawing it.
+func FIPSApproved(algorithm string) bool {
+	return algorithm == SHA256 || algorithm == SHA512
+}
+
+// Parse reads all entries from a checksum file, detecting its format.
+// Lines that are not checksum entries are ignored.
+func Parse(r io.Reader) ([]Entry, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return ParseNamed("", data)
+}
+
+// ParseNamed parses data using the parser detected for a file called name.
+func ParseNamed(name string, data []byte) ([]Entry, error) {
+	data = decodeText(data)
+	return Detect(name, data).Parse(data)
+}
+
+// ParseFile reads all entries from the checksum file at path.
+func ParseFile(path string) ([]Entry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseNamed(filepath.Base(path), data)
+}
+
+// ParseFS reads all entries from the checksum file name within fsys.
+func ParseFS(fsys fs.FS, name string) ([]Entry, error) {
+	data, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	return ParseNamed(path.Base(name), data)
+}
+
+// FindHash returns the SHA256 listed for fileName in a hash
+// file's content. An entry naming the file is preferred; otherwise the first
+// SHA256 in the file is used. An empty fileName prefers any *.iso entry. It
+// returns "" if the content holds no SHA256 at all.
+func FindHash(content, fileName string) string {
+	entries, err := ParseNamed("", []byte(content))
+	if err != nil {
+		return ""
+	}
+
+	namePattern := regexp.MustCompile(`(?i)\.iso$`)
+	matches := func(path string) bool {
+		if fileName == "" {
+			return namePattern.MatchString(path)
+		}
+		return SameName(path, fileName)
+	}
+
+	first := ""
+	for _, entry := range entries {
+		if entry.Algorithm != SHA256 {
+			continue
+		}
+		if matches(entry.Path) {
+			return entry.Hash
+		}
+		if first == "" {
+			first = entry.Hash
+		}
+	}
+
+	// If no specific match, use the first hash in the file
+	return first
+}
+
+// IsChecksumFile reports whether name looks like a checksum file
+// (see Patterns; matching is case-insensitive).
+func IsChecksumFile(name string) bool {
+	name = strings.ToLower(name)
+	for _, suffix := range []string{".sha", ".sha256", ".sha512", ".md5", ".sfv"} {
+		if strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+	switch name {
+	case "sha256sum.txt", "sha256sums", "sha512sums", "sha1sums", "md5sums", "md5sum.txt", "chkiso.json":
+		return true
+	}
+	return false
+}
+
+// FindOptions scopes checksum file discovery.
+type FindOptions struct {
+	// RootOnly searches the root directory only.
+	RootOnly bool
+	// MaxDepth limits how many directory levels below the root are searched;
+	// 0 means no limit.
+	MaxDepth int
+	// Warn (if non-nil) receives entries that could not be accessed.
+	Warn func(path string, err error)
+}
+
+// depth returns how many directories deep a slash-separated path is.
+func depth(name string) int {
+	if name == "." {
+		return 0
+	}
+	return strings.Count(name, "/") + 1
+}
+
+// FindFS recursively searches for ALL checksum files in fsys and returns
+// their slash-separated paths. Entries that cannot be accessed are passed to
+// opts.Warn and skipped, so one unreadable directory does not hide the rest
+// of the media. The walk stops with ctx.Err() if ctx is cancelled.
+func FindFS(ctx context.Context, fsys fs.FS, opts FindOptions) ([]string, error) {
+	var checksumFiles []string
+
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		if err != nil {
+			if opts.Warn != nil {
+				opts.Warn(name, err)
+			}
+			if d != nil && d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() && depth(name) > 0 && (opts.RootOnly || opts.MaxDepth > 0 && depth(name) > opts.MaxDepth) {
+			return fs.SkipDir
+		}
+		if !d.IsDir() && IsChecksumFile(d.Name()) {
+			checksumFiles = append(checksumFiles, name)
+		}
+		return nil
+	})
+
+	return checksumFiles, err
+}
+
+// Find is FindFS for a directory on the local file system; it returns
+// native paths rooted at rootPath.
+func Find(ctx context.Context, rootPath string, opts FindOptions) ([]string, error) {
+	warn := opts.Warn
+	opts.Warn = func(name string, err error) {
+		if warn != nil {
+			warn(filepath.Join(rootPath, filepath.FromSlash(name)), err)
+		}
+	}
+	names, err := FindFS(ctx, os.DirFS(rootPath), opts)
+	paths := make([]string, len(names))
+	for i, name := range names {
+		paths[i] = filepath.Join(rootPath, filepath.FromSlash(name))
+	}
+	return paths, err
+}
+
+// cleanPath strips a leading "./" or "/" from a manifest path.
+func cleanPath(path string) string {
+	return strings.TrimLeft(strings.TrimPrefix(path, "./"), "/\\")
+}
+
+func errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("manifest: "+format, args...)
+}
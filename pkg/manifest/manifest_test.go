@@ -0,0 +1,139 @@
+package manifest
+
+import (
+	"encoding/binary"
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf16"
+)
+
+const (
+	md5Hex    = "d41d8cd98f00b204e9800998ecf8427e"
+	sha1Hex   = "da39a3ee5e6b4b0d3255bfef95601890afd80709"
+	sha256Hex = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+)
+
+// encodeUTF16 returns s in UTF-16 with the given byte order, after a byte
+// order mark if bom is set.
+func encodeUTF16(s string, order binary.ByteOrder, bom bool) []byte {
+	units := utf16.Encode([]rune(s))
+	if bom {
+		units = append([]uint16{0xfeff}, units...)
+	}
+	b := make([]byte, 2*len(units))
+	for i, u := range units {
+		order.PutUint16(b[2*i:], u)
+	}
+	return b
+}
+
+func entry(algorithm, hash, path string) Entry {
+	return Entry{Algorithm: algorithm, Hash: hash, Path: path, Size: -1}
+}
+
+func TestParseNamed(t *testing.T) {
+	gnu := sha256Hex + "  image.iso\n" + md5Hex + " *boot/core.img\n"
+	gnuEntries := []Entry{entry(SHA256, sha256Hex, "image.iso"), entry(MD5, md5Hex, "boot/core.img")}
+	size := int64(42)
+
+	tests := []struct {
+		name    string
+		file    string // Checksum file name
+		data    []byte
+		want    []Entry
+		wantErr bool
+	}{
+		{"GNU", "SHA256SUMS", []byte(gnu), gnuEntries, false},
+		{"GNU upper case", "", []byte(strings.ToUpper(sha256Hex) + "  image.iso\n"), []Entry{entry(SHA256, sha256Hex, "image.iso")}, false},
+		{"GNU CRLF and comments", "", []byte("# Release 1.0\r\n" + strings.ReplaceAll(gnu, "\n", "\r\n")), gnuEntries, false},
+		{"GNU leading ./", "", []byte(sha1Hex + "  ./dir/file\n"), []Entry{entry(SHA1, sha1Hex, "dir/file")}, false},
+		{"GNU escaped name", "", []byte(`\` + sha256Hex + `  a\\b\nc` + "\n"), []Entry{entry(SHA256, sha256Hex, "a\\b\nc")}, false},
+		{"UTF-8 BOM", "", append([]byte("\xef\xbb\xbf"), gnu...), gnuEntries, false},
+		{"UTF-16 LE with BOM", "", encodeUTF16(gnu, binary.LittleEndian, true), gnuEntries, false},
+		{"UTF-16 BE with BOM", "", encodeUTF16(gnu, binary.BigEndian, true), gnuEntries, false},
+		{"UTF-16 LE without BOM", "", encodeUTF16(gnu, binary.LittleEndian, false), gnuEntries, false},
+		{"UTF-16 BE without BOM", "", encodeUTF16(gnu, binary.BigEndian, false), gnuEntries, false},
+		{"UTF-16 non-ASCII name", "", encodeUTF16(sha256Hex+"  café.iso\r\n", binary.LittleEndian, true), []Entry{entry(SHA256, sha256Hex, "café.iso")}, false},
+		{"truncated line", "", []byte(gnu + sha256Hex[:20]), gnuEntries, false},
+		{"no final newline", "", []byte(strings.TrimSuffix(gnu, "\n")), gnuEntries, false},
+		{"odd-length hash", "", []byte(sha256Hex[:63] + "  image.iso\n"), nil, false},
+		{"empty", "", nil, nil, false},
+		{"BSD", "", []byte("SHA256 (image.iso) = " + sha256Hex + "\nMD5 (boot/core.img) = " + md5Hex + "\n"), []Entry{entry(SHA256, sha256Hex, "image.iso"), entry(MD5, md5Hex, "boot/core.img")}, false},
+		{"BSD wrong length for algorithm", "", []byte("SHA256 (image.iso) = " + md5Hex + "\n"), nil, false},
+		{"BSD escaped name", "", []byte(`\SHA1 (a\nb) = ` + sha1Hex + "\n"), []Entry{entry(SHA1, sha1Hex, "a\nb")}, false},
+		{"certutil", "", []byte("SHA256 hash of C:\\Downloads\\image.iso:\r\n" + sha256Hex + "\r\nCertUtil: -hashfile command completed successfully.\r\n"), []Entry{entry(SHA256, sha256Hex, "image.iso")}, false},
+		{"certutil spaced bytes", "", []byte("MD5 hash of file image.iso:\n" + spaced(md5Hex) + "\n"), []Entry{entry(MD5, md5Hex, "image.iso")}, false},
+		{"certutil truncated", "", []byte("SHA256 hash of image.iso:\n"), nil, false},
+		{"SFV", "disc.sfv", []byte("; written by a tool\nimage.iso 0A1B2C3D\n"), []Entry{entry(CRC32, "0a1b2c3d", "image.iso")}, false},
+		{"JSON", "chkiso.json", []byte(`{"version":2,"files":[{"path":"./image.iso","size":42,"hashes":{"md5":"` + md5Hex + `","sha256":"` + sha256Hex + `"}}]}`), []Entry{{Algorithm: SHA256, Hash: sha256Hex, Path: "image.iso", Size: size}}, false},
+		{"JSON truncated", "chkiso.json", []byte(`{"version":2,"files":[{"path":"image.iso"`), nil, true},
+		{"JSON newer version", "chkiso.json", []byte(`{"version":99,"files":[]}`), nil, true},
+		{"JSON edited after hashing", "chkiso.json", []byte(`{"version":2,"tree_hash":"` + sha256Hex + `","files":[{"path":"image.iso","hashes":{"sha256":"` + sha256Hex + `"}}]}`), nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseNamed(tt.file, tt.data)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseNamed error = %v, want error %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseNamed = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// spaced separates the bytes of a hex digest with spaces, as older certutil
+// versions do.
+func spaced(hex string) string {
+	var parts []string
+	for i := 0; i+2 <= len(hex); i += 2 {
+		parts = append(parts, hex[i:i+2])
+	}
+	return strings.Join(parts, " ")
+}
+
+func TestNameForms(t *testing.T) {
+	const nfc, nfd = "caf\u00e9.iso", "cafe\u0301.iso"
+	tests := []struct {
+		name string
+		want []string
+	}{
+		{"image.iso", []string{"image.iso"}},
+		{nfc, []string{nfc, nfd}},
+		{nfd, []string{nfd, nfc}},
+	}
+	for _, tt := range tests {
+		if got := NameForms(tt.name); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("NameForms(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+	if !SameName(nfc, nfd) {
+		t.Errorf("SameName(%q, %q) = false", nfc, nfd)
+	}
+	if SameName(nfc, "cafe.iso") {
+		t.Errorf("SameName(%q, cafe.iso) = true", nfc)
+	}
+}
+
+func TestFindHash(t *testing.T) {
+	const other = "0000000000000000000000000000000000000000000000000000000000000000"
+	content := md5Hex + "  image.iso\n" + other + "  other.img\n" + sha256Hex + "  cafe\u0301.iso\n"
+	tests := []struct {
+		fileName string
+		want     string
+	}{
+		{"caf\u00e9.iso", sha256Hex}, // NFC name matches the NFD entry
+		{"", sha256Hex},              // Any *.iso entry
+		{"missing.iso", other},       // First SHA256
+	}
+	for _, tt := range tests {
+		if got := FindHash(content, tt.fileName); got != tt.want {
+			t.Errorf("FindHash(%q) = %s, want %s", tt.fileName, got, tt.want)
+		}
+	}
+	if got := FindHash(md5Hex+"  image.iso\n", ""); got != "" {
+		t.Errorf("FindHash without a SHA256 = %s, want none", got)
+	}
+}
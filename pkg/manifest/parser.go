@@ -0,0 +1,208 @@
+package manifest
+
+import (
+	"bufio"
+	"bytes"
+	"regexp"
+	"strings"
+)
+
+// Parser reads one checksum file format. Supporting a new vendor format means
+// implementing Parser and passing it to Register.
+type Parser interface {
+	// Name identifies the format, e.g. "gnu" or "bsd".
+	Name() string
+	// Detect reports whether data (from a file called name, which may be
+	// empty) looks like this format.
+	Detect(name string, data []byte) bool
+	// Parse returns the entries in data.
+	Parse(data []byte) ([]Entry, error)
+}
+
+// parsers are tried in order; the GNU parser accepts anything and comes last.
+var parsers = []Parser{jsonParser{}, bsdParser{}, certutilParser{}, sfvParser{}, gnuParser{}}
+
+// Register adds a parser. It is tried before the built-in formats.
+func Register(p Parser) {
+	parsers = append([]Parser{p}, parsers...)
+}
+
+// Detect returns the parser for data, falling back to the GNU format.
+func Detect(name string, data []byte) Parser {
+	for _, p := range parsers {
+		if p.Detect(name, data) {
+			return p
+		}
+	}
+	return gnuParser{}
+}
+
+// ParserByName returns the registered parser called name, or nil.
+func ParserByName(name string) Parser {
+	for _, p := range parsers {
+		if p.Name() == name {
+			return p
+		}
+	}
+	return nil
+}
+
+// lines splits data into lines without their line endings (LF or CRLF),
+// decoding UTF-16 and dropping a byte order mark and "#" comment lines.
+func lines(data []byte) []string {
+	var out []string
+	data = decodeText(data)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue
+		}
+		out = append(out, line)
+	}
+	return out
+}
+
+// unescapeName undoes the escaping coreutils applies to file names
+// containing a backslash or newline. Such lines start with a backslash, and
+// in the name "\\" stands for a backslash, "\n" for a newline and "\r" for a
+// carriage return.
+func unescapeName(name string) string {
+	if !strings.Contains(name, "\\") {
+		return name
+	}
+	var b strings.Builder
+	for i := 0; i < len(name); i++ {
+		if name[i] == '\\' && i+1 < len(name) {
+			switch name[i+1] {
+			case '\\':
+				b.WriteByte('\\')
+				i++
+				continue
+			case 'n':
+				b.WriteByte('\n')
+				i++
+				continue
+			case 'r':
+				b.WriteByte('\r')
+				i++
+				continue
+			}
+		}
+		b.WriteByte(name[i])
+	}
+	return b.String()
+}
+
+// gnuParser reads coreutils output: "<hex>  <file>" or "<hex> *<file>", with
+// a leading backslash on lines whose file name is escaped.
+type gnuParser struct{}
+
+var gnuPattern = regexp.MustCompile(`^(\\?)([a-fA-F0-9]{128}|[a-fA-F0-9]{64}|[a-fA-F0-9]{40}|[a-fA-F0-9]{32})[ \t]+\*?(.*)`)
+
+func (gnuParser) Name() string { return "gnu" }
+
+func (gnuParser) Detect(name string, data []byte) bool {
+	for _, line := range lines(data) {
+		if gnuPattern.MatchString(line) {
+			return true
+		}
+	}
+	return false
+}
+
+func (gnuParser) Parse(data []byte) ([]Entry, error) {
+	var entries []Entry
+	for _, line := range lines(data) {
+		matches := gnuPattern.FindStringSubmatch(line)
+		if matches == nil {
+			continue
+		}
+		name := strings.TrimSpace(matches[3])
+		if matches[1] != "" {
+			name = unescapeName(name)
+		}
+		entries = append(entries, Entry{
+			Algorithm: AlgorithmForLength(len(matches[2])),
+			Hash:      strings.ToLower(matches[2]),
+			Path:      cleanPath(name),
+			Size:      -1,
+		})
+	}
+	return entries, nil
+}
+
+// bsdParser reads BSD-style tagged lines: "SHA256 (<file>) = <hex>", as
+// also written by coreutils --tag, with the same escaping as the GNU format.
+type bsdParser struct{}
+
+var bsdPattern = regexp.MustCompile(`^(\\?)(MD5|SHA1|SHA256|SHA512)\s*\((.*)\)\s*=\s*([a-fA-F0-9]+)\s*$`)
+
+func (bsdParser) Name() string { return "bsd" }
+
+func (bsdParser) Detect(name string, data []byte) bool {
+	for _, line := range lines(data) {
+		if bsdPattern.MatchString(line) {
+			return true
+		}
+	}
+	return false
+}
+
+func (bsdParser) Parse(data []byte) ([]Entry, error) {
+	var entries []Entry
+	for _, line := range lines(data) {
+		matches := bsdPattern.FindStringSubmatch(line)
+		if matches == nil {
+			continue
+		}
+		algorithm := strings.ToLower(matches[2])
+		if AlgorithmForLength(len(matches[4])) != algorithm {
+			continue
+		}
+		name := strings.TrimPrefix(matches[3], "*")
+		if matches[1] != "" {
+			name = unescapeName(name)
+		}
+		entries = append(entries, Entry{
+			Algorithm: algorithm,
+			Hash:      strings.ToLower(matches[4]),
+			Path:      cleanPath(name),
+			Size:      -1,
+		})
+	}
+	return entries, nil
+}
+
+// sfvParser reads Simple File Verification files: "<file> <crc32>", with
+// ";" comment lines.
+type sfvParser struct{}
+
+var sfvPattern = regexp.MustCompile(`^(.+?)\s+([a-fA-F0-9]{8})\s*$`)
+
+func (sfvParser) Name() string { return "sfv" }
+
+func (sfvParser) Detect(name string, data []byte) bool {
+	return strings.HasSuffix(strings.ToLower(name), ".sfv")
+}
+
+func (sfvParser) Parse(data []byte) ([]Entry, error) {
+	var entries []Entry
+	for _, line := range lines(data) {
+		if strings.HasPrefix(strings.TrimSpace(line), ";") {
+			continue
+		}
+		matches := sfvPattern.FindStringSubmatch(line)
+		if matches == nil {
+			continue
+		}
+		entries = append(entries, Entry{
+			Algorithm: CRC32,
+			Hash:      strings.ToLower(matches[2]),
+			Path:      cleanPath(matches[1]),
+			Size:      -1,
+		})
+	}
+	return entries, nil
+}
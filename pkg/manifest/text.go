@@ -0,0 +1,110 @@
+package manifest
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/unicode/norm"
+)
+
+// utf8BOM is the byte order mark some Windows editors write at the start of
+// UTF-8 files.
+var utf8BOM = []byte("\xef\xbb\xbf")
+
+// decodeText returns checksum file data as UTF-8 without a byte order mark.
+// Windows tools often write UTF-16 (PowerShell's ">" redirection, for
+// example), with or without a BOM.
+func decodeText(data []byte) []byte {
+	var endianness unicode.Endianness
+	switch {
+	case bytes.HasPrefix(data, utf8BOM):
+		return data[len(utf8BOM):]
+	case bytes.HasPrefix(data, []byte{0xff, 0xfe}):
+		endianness = unicode.LittleEndian
+	case bytes.HasPrefix(data, []byte{0xfe, 0xff}):
+		endianness = unicode.BigEndian
+	// Without a BOM, ASCII text in UTF-16 has a NUL in every other byte
+	case len(data) >= 4 && len(data)%2 == 0 && data[0] != 0 && data[1] == 0 && data[2] != 0 && data[3] == 0:
+		endianness = unicode.LittleEndian
+	case len(data) >= 4 && len(data)%2 == 0 && data[0] == 0 && data[1] != 0 && data[2] == 0 && data[3] != 0:
+		endianness = unicode.BigEndian
+	default:
+		return data
+	}
+	decoded, err := unicode.UTF16(endianness, unicode.UseBOM).NewDecoder().Bytes(data)
+	if err != nil {
+		return data
+	}
+	return decoded
+}
+
+// SameName reports whether two file names are equal once Unicode is
+// normalized, so that a name written in NFC (as on Windows and most Linux
+// systems) matches the same name in NFD (as stored by macOS).
+func SameName(a, b string) bool {
+	return a == b || norm.NFC.String(a) == norm.NFC.String(b)
+}
+
+// NameForms returns name followed by its NFC and NFD forms where they differ
+// from it, the spellings to try when looking a manifest entry up on media.
+func NameForms(name string) []string {
+	forms := []string{name}
+	for _, form := range []norm.Form{norm.NFC, norm.NFD} {
+		alt := form.String(name)
+		if alt != forms[0] && (len(forms) == 1 || alt != forms[1]) {
+			forms = append(forms, alt)
+		}
+	}
+	return forms
+}
+
+// certutilParser reads the output of Windows "certutil -hashfile":
+//
+//	SHA256 hash of image.iso:
+//	5891b5b5...
+//	CertUtil: -hashfile command completed successfully.
+//
+// Older versions separate the digest's bytes with spaces.
+type certutilParser struct{}
+
+var certutilHeader = regexp.MustCompile(`^(MD5|SHA1|SHA256|SHA512) hash of (?:file )?(.+):\s*$`)
+
+func (certutilParser) Name() string { return "certutil" }
+
+func (certutilParser) Detect(name string, data []byte) bool {
+	for _, line := range lines(data) {
+		if certutilHeader.MatchString(line) {
+			return true
+		}
+	}
+	return false
+}
+
+func (certutilParser) Parse(data []byte) ([]Entry, error) {
+	var entries []Entry
+	all := lines(data)
+	for i := 0; i+1 < len(all); i++ {
+		header := certutilHeader.FindStringSubmatch(all[i])
+		if header == nil {
+			continue
+		}
+		algorithm := strings.ToLower(header[1])
+		hash := strings.ToLower(strings.Join(strings.Fields(all[i+1]), ""))
+		if AlgorithmForLength(len(hash)) != algorithm || !hexPattern.MatchString(hash) {
+			continue
+		}
+		// certutil prints the path it was given; entries are relative to
+		// the checksum file, so keep only the base name
+		path := header[2]
+		if j := strings.LastIndexAny(path, `\/`); j >= 0 {
+			path = path[j+1:]
+		}
+		entries = append(entries, Entry{Algorithm: algorithm, Hash: hash, Path: path, Size: -1})
+		i++
+	}
+	return entries, nil
+}
+
+var hexPattern = regexp.MustCompile(`^[a-f0-9]+$`)
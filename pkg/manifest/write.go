@@ -0,0 +1,26 @@
+package manifest
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// nameEscaper escapes file names the way coreutils does, for unescapeName.
+var nameEscaper = strings.NewReplacer("\\", "\\\\", "\n", "\\n", "\r", "\\r")
+
+// WriteGNU writes entries in the coreutils format of sha256sum and its
+// siblings, "<hex>  <file>", which any of them can check with -c. Names
+// holding a backslash or newline are escaped as coreutils escapes them.
+func WriteGNU(w io.Writer, entries []Entry) error {
+	out := bufio.NewWriter(w)
+	for _, e := range entries {
+		prefix, name := "", e.Path
+		if strings.ContainsAny(name, "\\\n\r") {
+			prefix, name = "\\", nameEscaper.Replace(name)
+		}
+		fmt.Fprintf(out, "%s%s  %s\n", prefix, e.Hash, name)
+	}
+	return out.Flush()
+}
@@ -0,0 +1,265 @@
+// Package nrg reads Nero Burning ROM images (.nrg): the chunk chain at the
+// end of the file and the tracks it describes, so that the ISO 9660 data
+// track inside can be read like a plain .iso.
+package nrg
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrNotNRG is returned when the data has no Nero footer.
+var ErrNotNRG = errors.New("not a Nero image (no 'NER5' or 'NERO' footer)")
+
+// Track is one track of the image.
+type Track struct {
+	Number     int
+	SectorSize int   // Bytes per sector as stored: 2048, 2336 or 2352
+	Mode       int   // Nero mode code
+	Offset     int64 // Start of the track's first sector (index 1) in the file
+	End        int64 // End of the track in the file
+}
+
+// Data reports whether the track holds data rather than audio.
+func (t Track) Data() bool {
+	return t.dataOffset() >= 0
+}
+
+// dataOffset returns where the 2048 bytes of user data start within each
+// stored sector, or -1 for audio tracks.
+func (t Track) dataOffset() int {
+	switch t.SectorSize {
+	case 2048:
+		return 0
+	case 2336: // Mode 2 form 1 without sync and header
+		return 8
+	case 2352:
+		switch t.Mode {
+		case 0x07: // Audio
+			return -1
+		case 0x03, 0x05, 0x06: // Mode 2 form 1 and XA
+			return 24
+		}
+		return 16 // Mode 1 with sync and header
+	}
+	return -1
+}
+
+// Image is an opened Nero image.
+type Image struct {
+	r       io.ReaderAt
+	Version int // 1 for the 'NERO' footer, 2 for 'NER5'
+	Tracks  []Track
+}
+
+// Open reads the chunk chain of the Nero image in r, which is size bytes long.
+func Open(r io.ReaderAt, size int64) (*Image, error) {
+	img := &Image{r: r}
+	var chain int64
+	footer := make([]byte, 12)
+	if size >= 12 {
+		if _, err := r.ReadAt(footer, size-12); err != nil {
+			return nil, err
+		}
+	}
+	switch {
+	case size >= 12 && string(footer[0:4]) == "NER5":
+		img.Version = 2
+		chain = int64(binary.BigEndian.Uint64(footer[4:12]))
+	case size >= 8 && string(footer[4:8]) == "NERO":
+		img.Version = 1
+		chain = int64(binary.BigEndian.Uint32(footer[8:12]))
+	default:
+		return nil, ErrNotNRG
+	}
+
+	hdr := make([]byte, 8)
+	for pos := chain; ; {
+		// By subtraction, which cannot overflow
+		if pos < 0 || pos > size-8 {
+			return nil, fmt.Errorf("chunk chain runs past the end of the image")
+		}
+		if _, err := r.ReadAt(hdr, pos); err != nil {
+			return nil, err
+		}
+		id := string(hdr[0:4])
+		length := int64(binary.BigEndian.Uint32(hdr[4:8]))
+		if id == "END!" {
+			break
+		}
+		if length > size-pos-8 {
+			return nil, fmt.Errorf("chunk %q runs past the end of the image", id)
+		}
+		data := make([]byte, length)
+		if _, err := r.ReadAt(data, pos+8); err != nil {
+			return nil, err
+		}
+		switch id {
+		case "DAOX", "DAOI":
+			img.Tracks = append(img.Tracks, parseDAO(data, id == "DAOX")...)
+		case "ETN2", "ETNF":
+			img.Tracks = append(img.Tracks, parseETN(data, id == "ETN2", len(img.Tracks))...)
+		}
+		pos += 8 + length
+	}
+	if len(img.Tracks) == 0 {
+		return nil, fmt.Errorf("the image lists no tracks")
+	}
+	for _, t := range img.Tracks {
+		if t.Offset < 0 || t.End < t.Offset || t.End > size {
+			return nil, fmt.Errorf("track %d lies outside the image", t.Number)
+		}
+	}
+	return img, nil
+}
+
+// parseDAO reads a disc-at-once chunk: a 22 byte header followed by one
+// block per track, with 64-bit offsets in DAOX and 32-bit ones in DAOI.
+func parseDAO(b []byte, wide bool) []Track {
+	const header = 22
+	blockSize := 30
+	if wide {
+		blockSize = 42
+	}
+	if len(b) < header {
+		return nil
+	}
+	first := int(b[20])
+	var tracks []Track
+	for i := 0; header+(i+1)*blockSize <= len(b); i++ {
+		e := b[header+i*blockSize:]
+		t := Track{
+			Number:     first + i,
+			SectorSize: int(binary.BigEndian.Uint16(e[12:14])),
+			Mode:       int(e[14]),
+		}
+		if wide {
+			t.Offset = int64(binary.BigEndian.Uint64(e[26:34]))
+			t.End = int64(binary.BigEndian.Uint64(e[34:42]))
+		} else {
+			t.Offset = int64(binary.BigEndian.Uint32(e[22:26]))
+			t.End = int64(binary.BigEndian.Uint32(e[26:30]))
+		}
+		tracks = append(tracks, t)
+	}
+	return tracks
+}
+
+// parseETN reads a track-at-once chunk: one entry per track with its offset,
+// length and mode, 32 bytes each in ETN2 and 20 in ETNF.
+func parseETN(b []byte, wide bool, previous int) []Track {
+	entrySize := 20
+	if wide {
+		entrySize = 32
+	}
+	var tracks []Track
+	for i := 0; (i+1)*entrySize <= len(b); i++ {
+		e := b[i*entrySize:]
+		var t Track
+		if wide {
+			t.Offset = int64(binary.BigEndian.Uint64(e[0:8]))
+			t.End = t.Offset + int64(binary.BigEndian.Uint64(e[8:16]))
+			t.Mode = int(binary.BigEndian.Uint32(e[16:20]))
+		} else {
+			t.Offset = int64(binary.BigEndian.Uint32(e[0:4]))
+			t.End = t.Offset + int64(binary.BigEndian.Uint32(e[4:8]))
+			t.Mode = int(binary.BigEndian.Uint32(e[8:12]))
+		}
+		t.Number = previous + i + 1
+		t.SectorSize = etnSectorSize(t.Mode)
+		tracks = append(tracks, t)
+	}
+	return tracks
+}
+
+// etnSectorSize maps track-at-once mode codes to stored sector sizes.
+func etnSectorSize(mode int) int {
+	switch mode {
+	case 0x00, 0x02, 0x03:
+		return 2048
+	case 0x06:
+		return 2336
+	}
+	return 2352
+}
+
+// DataTrack returns the first data track, which holds the ISO 9660 file
+// system of a data or mixed-mode disc.
+func (img *Image) DataTrack() (Track, error) {
+	for _, t := range img.Tracks {
+		if t.Data() {
+			return t, nil
+		}
+	}
+	return Track{}, fmt.Errorf("the image has no data track")
+}
+
+// UserData returns the 2048 byte user data of every sector of t, read as
+// one contiguous ISO image, and its size. Audio tracks read as empty.
+func (img *Image) UserData(t Track) (*TrackReader, int64) {
+	var sectors int64
+	if t.Data() {
+		sectors = (t.End - t.Offset) / int64(t.SectorSize)
+	}
+	tr := &TrackReader{r: img.r, track: t, size: sectors * 2048}
+	return tr, tr.size
+}
+
+// TrackReader reads the user data of a track, skipping the sync, header and
+// error correction bytes of raw sectors.
+type TrackReader struct {
+	r      io.ReaderAt
+	track  Track
+	size   int64
+	offset int64 // Position for Read
+}
+
+func (tr *TrackReader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+	if tr.track.SectorSize == 2048 {
+		// Cooked sectors are contiguous
+		if off >= tr.size {
+			return 0, io.EOF
+		}
+		if remaining := tr.size - off; int64(len(p)) > remaining {
+			n, err := tr.r.ReadAt(p[:remaining], tr.track.Offset+off)
+			if err == nil {
+				err = io.EOF
+			}
+			return n, err
+		}
+		return tr.r.ReadAt(p, tr.track.Offset+off)
+	}
+	n := 0
+	for n < len(p) {
+		pos := off + int64(n)
+		if pos >= tr.size {
+			return n, io.EOF
+		}
+		sector, within := pos/2048, pos%2048
+		chunk := p[n:]
+		if int64(len(chunk)) > 2048-within {
+			chunk = chunk[:2048-within]
+		}
+		at := tr.track.Offset + sector*int64(tr.track.SectorSize) + int64(tr.track.dataOffset()) + within
+		read, err := tr.r.ReadAt(chunk, at)
+		n += read
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+func (tr *TrackReader) Read(p []byte) (int, error) {
+	n, err := tr.ReadAt(p, tr.offset)
+	tr.offset += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return n, err
+}
@@ -0,0 +1,234 @@
+package nrg
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"strings"
+	"testing"
+)
+
+// userData returns sectors sectors of 2048 bytes, each filled with its
+// number so that misplaced sectors show.
+func userData(sectors int) []byte {
+	b := make([]byte, sectors*2048)
+	for i := range b {
+		b[i] = byte(i/2048 + 1)
+	}
+	return b
+}
+
+// store wraps each 2048 byte sector of data in a stored sector of size
+// bytes, with the user data at offset and 0xEE in the remaining bytes.
+func store(data []byte, size, offset int) []byte {
+	var out []byte
+	for i := 0; i < len(data); i += 2048 {
+		sector := bytes.Repeat([]byte{0xEE}, size)
+		copy(sector[offset:], data[i:i+2048])
+		out = append(out, sector...)
+	}
+	return out
+}
+
+// chunk returns a chunk with the given id and data.
+func chunk(id string, data []byte) []byte {
+	b := make([]byte, 8, 8+len(data))
+	copy(b, id)
+	binary.BigEndian.PutUint32(b[4:8], uint32(len(data)))
+	return append(b, data...)
+}
+
+// daoBlock describes one track of a DAOX chunk, or of a DAOI chunk if
+// !wide.
+func daoBlock(wide bool, sectorSize, mode int, offset, end int64) []byte {
+	if !wide {
+		e := make([]byte, 30)
+		binary.BigEndian.PutUint16(e[12:14], uint16(sectorSize))
+		e[14] = byte(mode)
+		binary.BigEndian.PutUint32(e[22:26], uint32(offset))
+		binary.BigEndian.PutUint32(e[26:30], uint32(end))
+		return e
+	}
+	e := make([]byte, 42)
+	binary.BigEndian.PutUint16(e[12:14], uint16(sectorSize))
+	e[14] = byte(mode)
+	binary.BigEndian.PutUint64(e[26:34], uint64(offset))
+	binary.BigEndian.PutUint64(e[34:42], uint64(end))
+	return e
+}
+
+// dao returns a DAOX or DAOI chunk for the blocks, numbering tracks from 1.
+func dao(wide bool, blocks ...[]byte) []byte {
+	header := make([]byte, 22)
+	header[20] = 1
+	id := "DAOI"
+	if wide {
+		id = "DAOX"
+	}
+	return chunk(id, append(header, bytes.Join(blocks, nil)...))
+}
+
+// etnEntry describes one track of an ETN2 chunk, or of an ETNF chunk if
+// !wide.
+func etnEntry(wide bool, offset, length int64, mode int) []byte {
+	if !wide {
+		e := make([]byte, 20)
+		binary.BigEndian.PutUint32(e[0:4], uint32(offset))
+		binary.BigEndian.PutUint32(e[4:8], uint32(length))
+		binary.BigEndian.PutUint32(e[8:12], uint32(mode))
+		return e
+	}
+	e := make([]byte, 32)
+	binary.BigEndian.PutUint64(e[0:8], uint64(offset))
+	binary.BigEndian.PutUint64(e[8:16], uint64(length))
+	binary.BigEndian.PutUint32(e[16:20], uint32(mode))
+	return e
+}
+
+// image returns a Nero image of the track data followed by the chunks, an
+// END! chunk and a footer of the given version pointing at the first chunk.
+func image(version int, tracks []byte, chunks ...[]byte) []byte {
+	b := append([]byte(nil), tracks...)
+	chain := len(b)
+	for _, c := range chunks {
+		b = append(b, c...)
+	}
+	b = append(b, chunk("END!", nil)...)
+	if version == 2 {
+		b = append(b, "NER5"...)
+		return binary.BigEndian.AppendUint64(b, uint64(chain))
+	}
+	b = append(b, "NERO"...)
+	return binary.BigEndian.AppendUint32(b, uint32(chain))
+}
+
+func TestUserData(t *testing.T) {
+	data := userData(3)
+	tests := []struct {
+		name  string
+		image []byte
+	}{
+		{"DAOX, cooked sectors", image(2, data, dao(true, daoBlock(true, 2048, 0, 0, 3*2048)))},
+		{"DAOI, mode 1 raw sectors", image(1, store(data, 2352, 16), dao(false, daoBlock(false, 2352, 0x01, 0, 3*2352)))},
+		{"DAOX, mode 2 form 1 raw sectors", image(2, store(data, 2352, 24), dao(true, daoBlock(true, 2352, 0x03, 0, 3*2352)))},
+		{"DAOX, mode 2 form 1 without headers", image(2, store(data, 2336, 8), dao(true, daoBlock(true, 2336, 0, 0, 3*2336)))},
+		{"ETN2, cooked sectors", image(2, data, chunk("ETN2", etnEntry(true, 0, 3*2048, 0x00)))},
+		{"ETNF, mode 2 form 1", image(1, store(data, 2336, 8), chunk("ETNF", etnEntry(false, 0, 3*2336, 0x06)))},
+		{"audio track first", image(2, append(make([]byte, 2*2352), data...), dao(true,
+			daoBlock(true, 2352, 0x07, 0, 2*2352),
+			daoBlock(true, 2048, 0, 2*2352, 2*2352+3*2048),
+		))},
+		{"unknown chunks skipped", image(2, data, chunk("CUEX", make([]byte, 16)), dao(true, daoBlock(true, 2048, 0, 0, 3*2048)))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img, err := Open(bytes.NewReader(tt.image), int64(len(tt.image)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			track, err := img.DataTrack()
+			if err != nil {
+				t.Fatal(err)
+			}
+			r, size := img.UserData(track)
+			if size != int64(len(data)) {
+				t.Errorf("size = %d, want %d", size, len(data))
+			}
+			got, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, data) {
+				t.Error("user data differs")
+			}
+			// A read across a sector boundary and past the end
+			p := make([]byte, 100)
+			n, err := r.ReadAt(p, 3*2048-50)
+			if n != 50 || err != io.EOF || !bytes.Equal(p[:n], data[3*2048-50:]) {
+				t.Errorf("ReadAt at the end = %d, %v", n, err)
+			}
+			if n, err := r.ReadAt(p, 2048-50); n != 100 || err != nil || !bytes.Equal(p, data[2048-50:2048+50]) {
+				t.Errorf("ReadAt across sectors = %d, %v", n, err)
+			}
+		})
+	}
+}
+
+func TestOpenErrors(t *testing.T) {
+	data := userData(1)
+	track := dao(true, daoBlock(true, 2048, 0, 0, 2048))
+	tests := []struct {
+		name  string
+		image []byte
+		want  string // Expected in the error
+	}{
+		{"empty", nil, "not a Nero image"},
+		{"zeros", make([]byte, 4096), "not a Nero image"},
+		{"chain past the end", func() []byte {
+			b := image(2, data, track)
+			binary.BigEndian.PutUint64(b[len(b)-8:], 1<<40)
+			return b
+		}(), "chunk chain runs past"},
+		{"chain offset overflow", func() []byte {
+			b := image(2, data, track)
+			binary.BigEndian.PutUint64(b[len(b)-8:], math.MaxInt64-4)
+			return b
+		}(), "chunk chain runs past"},
+		{"chain offset negative", func() []byte {
+			b := image(2, data, track)
+			binary.BigEndian.PutUint64(b[len(b)-8:], 1<<63)
+			return b
+		}(), "chunk chain runs past"},
+		{"chunk past the end", func() []byte {
+			b := image(2, data, track)
+			binary.BigEndian.PutUint32(b[len(data)+4:], math.MaxUint32)
+			return b
+		}(), "runs past the end"},
+		{"chain without END!", func() []byte {
+			b := image(2, data, track)
+			copy(b[len(data)+len(track):], "NOPE")
+			return b
+		}(), "chunk"},
+		{"no tracks", image(2, data, chunk("CUEX", nil)), "lists no tracks"},
+		{"DAO chunk shorter than its header", image(2, data, chunk("DAOX", make([]byte, 10))), "lists no tracks"},
+		{"track past the end", image(2, data, dao(true, daoBlock(true, 2048, 0, 0, 1<<40))), "lies outside"},
+		{"track ends before it starts", image(2, data, dao(true, daoBlock(true, 2048, 0, 2048, 0))), "lies outside"},
+		{"track offset negative", image(2, data, dao(true, daoBlock(true, 2048, 0, -2048, 0))), "lies outside"},
+		{"ETN2 length overflow", image(2, data, chunk("ETN2", etnEntry(true, 1024, math.MaxInt64, 0))), "lies outside"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Open(bytes.NewReader(tt.image), int64(len(tt.image)))
+			if err == nil {
+				t.Fatal("Open succeeded")
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error %q, want %q", err, tt.want)
+			}
+		})
+	}
+	if _, err := Open(bytes.NewReader(nil), 0); !errors.Is(err, ErrNotNRG) {
+		t.Errorf("Open(empty) = %v, want ErrNotNRG", err)
+	}
+}
+
+func TestNoDataTrack(t *testing.T) {
+	b := image(2, make([]byte, 2*2352), dao(true,
+		daoBlock(true, 2352, 0x07, 0, 2352),
+		daoBlock(true, 0, 0, 2352, 2*2352),
+	))
+	img, err := Open(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := img.DataTrack(); err == nil {
+		t.Error("DataTrack found a data track")
+	}
+	for _, track := range img.Tracks {
+		if _, size := img.UserData(track); size != 0 {
+			t.Errorf("track %d: UserData size = %d, want 0", track.Number, size)
+		}
+	}
+}
@@ -0,0 +1,297 @@
+// Package partition reads the MBR and GPT partition tables of raw disk
+// images, such as the .img files Raspberry Pi and appliance images ship as.
+package partition
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"strings"
+	"unicode/utf16"
+)
+
+// SectorSize is the logical sector size partition tables are read with.
+const SectorSize = 512
+
+// ErrNoTable is returned by Read when the image has no partition table.
+var ErrNoTable = errors.New("no MBR or GPT partition table found")
+
+// Partition schemes.
+const (
+	MBR = "mbr"
+	GPT = "gpt"
+)
+
+// Partition is one entry of a partition table.
+type Partition struct {
+	Index    int    // Number as listed by fdisk and parted, starting at 1
+	Type     string // Human readable type, e.g. "Linux filesystem"
+	Name     string // GPT partition name, if any
+	Offset   int64  // Start in bytes
+	Size     int64  // Length in bytes
+	Bootable bool   // MBR active flag
+}
+
+// Table is the partition table of a disk image.
+type Table struct {
+	Scheme     string
+	Partitions []Partition
+	// Problems lists inconsistencies found while reading the table, such as
+	// GPT checksum mismatches or partitions extending past the image.
+	Problems []string
+}
+
+// Find returns the partition numbered index, or nil.
+func (t *Table) Find(index int) *Partition {
+	for i := range t.Partitions {
+		if t.Partitions[i].Index == index {
+			return &t.Partitions[i]
+		}
+	}
+	return nil
+}
+
+// Read returns the partition table of the disk image in r. A GPT is
+// preferred when the MBR is a protective one. If size is positive,
+// partitions are also checked against it.
+func Read(r io.ReaderAt, size int64) (*Table, error) {
+	mbr := make([]byte, SectorSize)
+	if _, err := r.ReadAt(mbr, 0); err != nil {
+		if err == io.EOF {
+			return nil, ErrNoTable
+		}
+		return nil, err
+	}
+	if mbr[510] != 0x55 || mbr[511] != 0xaa {
+		return nil, ErrNoTable
+	}
+
+	var table *Table
+	if mbr[446+4] == 0xee {
+		t, err := readGPT(r)
+		if err != nil {
+			return nil, err
+		}
+		table = t
+	} else {
+		t, err := readMBR(r, mbr)
+		if err != nil {
+			return nil, err
+		}
+		table = t
+	}
+	if size > 0 {
+		for _, p := range table.Partitions {
+			if p.Offset+p.Size > size {
+				table.Problems = append(table.Problems, fmt.Sprintf("partition %d extends %d bytes past the end of the image", p.Index, p.Offset+p.Size-size))
+			}
+		}
+	}
+	return table, nil
+}
+
+// readMBR reads the four primary entries of mbr and the logical partitions
+// of an extended partition, numbered from 5 as Linux does.
+func readMBR(r io.ReaderAt, mbr []byte) (*Table, error) {
+	t := &Table{Scheme: MBR}
+	var extended int64
+	for i := 0; i < 4; i++ {
+		e := mbr[446+16*i:]
+		kind := e[4]
+		start := int64(binary.LittleEndian.Uint32(e[8:12]))
+		count := int64(binary.LittleEndian.Uint32(e[12:16]))
+		if kind == 0 || count == 0 {
+			continue
+		}
+		if isExtended(kind) {
+			extended = start
+			continue
+		}
+		t.Partitions = append(t.Partitions, Partition{
+			Index:    i + 1,
+			Type:     mbrType(kind),
+			Offset:   start * SectorSize,
+			Size:     count * SectorSize,
+			Bootable: e[0] == 0x80,
+		})
+	}
+	if extended == 0 {
+		if len(t.Partitions) == 0 {
+			return nil, ErrNoTable
+		}
+		return t, nil
+	}
+
+	// Each extended boot record holds a logical partition, relative to
+	// itself, and a link to the next record, relative to the extended one
+	ebr := make([]byte, SectorSize)
+	next := extended
+	for index := 5; index < 5+128; index++ {
+		if _, err := r.ReadAt(ebr, next*SectorSize); err != nil {
+			t.Problems = append(t.Problems, fmt.Sprintf("could not read extended boot record at sector %d: %v", next, err))
+			break
+		}
+		if ebr[510] != 0x55 || ebr[511] != 0xaa {
+			t.Problems = append(t.Problems, fmt.Sprintf("invalid extended boot record at sector %d", next))
+			break
+		}
+		e := ebr[446:]
+		if count := int64(binary.LittleEndian.Uint32(e[12:16])); e[4] != 0 && count > 0 {
+			t.Partitions = append(t.Partitions, Partition{
+				Index:  index,
+				Type:   mbrType(e[4]),
+				Offset: (next + int64(binary.LittleEndian.Uint32(e[8:12]))) * SectorSize,
+				Size:   count * SectorSize,
+			})
+		}
+		link := ebr[446+16:]
+		if link[4] == 0 || binary.LittleEndian.Uint32(link[8:12]) == 0 {
+			break
+		}
+		next = extended + int64(binary.LittleEndian.Uint32(link[8:12]))
+	}
+	return t, nil
+}
+
+func isExtended(kind byte) bool {
+	return kind == 0x05 || kind == 0x0f || kind == 0x85
+}
+
+// readGPT reads the GUID partition table that starts in sector 1.
+func readGPT(r io.ReaderAt) (*Table, error) {
+	t := &Table{Scheme: GPT}
+	header := make([]byte, SectorSize)
+	if _, err := r.ReadAt(header, SectorSize); err != nil {
+		return nil, fmt.Errorf("could not read GPT header: %v", err)
+	}
+	if string(header[0:8]) != "EFI PART" {
+		return nil, fmt.Errorf("protective MBR without a GPT header")
+	}
+	headerSize := binary.LittleEndian.Uint32(header[12:16])
+	if headerSize >= 92 && headerSize <= SectorSize {
+		check := append([]byte(nil), header[:headerSize]...)
+		for i := 16; i < 20; i++ {
+			check[i] = 0
+		}
+		if crc32.ChecksumIEEE(check) != binary.LittleEndian.Uint32(header[16:20]) {
+			t.Problems = append(t.Problems, "GPT header checksum does not match")
+		}
+	}
+
+	entriesLBA := int64(binary.LittleEndian.Uint64(header[72:80]))
+	count := binary.LittleEndian.Uint32(header[80:84])
+	entrySize := binary.LittleEndian.Uint32(header[84:88])
+	if entrySize < 128 || entrySize > 4096 || count > 1024 {
+		return nil, fmt.Errorf("invalid GPT header (%d entries of %d bytes)", count, entrySize)
+	}
+	if entriesLBA < 0 || entriesLBA >= math.MaxInt64/SectorSize {
+		return nil, fmt.Errorf("invalid GPT header (entries at sector %d)", uint64(entriesLBA))
+	}
+	entries := make([]byte, int(count)*int(entrySize))
+	if _, err := r.ReadAt(entries, entriesLBA*SectorSize); err != nil {
+		return nil, fmt.Errorf("could not read GPT entries: %v", err)
+	}
+	if crc32.ChecksumIEEE(entries) != binary.LittleEndian.Uint32(header[88:92]) {
+		t.Problems = append(t.Problems, "GPT partition entries checksum does not match")
+	}
+
+	for i := 0; i < int(count); i++ {
+		e := entries[i*int(entrySize):]
+		typeGUID := guid(e[0:16])
+		if typeGUID == "00000000-0000-0000-0000-000000000000" {
+			continue
+		}
+		first := int64(binary.LittleEndian.Uint64(e[32:40]))
+		last := int64(binary.LittleEndian.Uint64(e[40:48]))
+		if last < first {
+			t.Problems = append(t.Problems, fmt.Sprintf("partition %d ends before it starts", i+1))
+			continue
+		}
+		if first < 0 || last >= math.MaxInt64/SectorSize {
+			// Such sectors have no byte offset; they would wrap around
+			t.Problems = append(t.Problems, fmt.Sprintf("partition %d lies past the last addressable sector", i+1))
+			continue
+		}
+		t.Partitions = append(t.Partitions, Partition{
+			Index:  i + 1,
+			Type:   gptType(typeGUID),
+			Name:   utf16Name(e[56:128]),
+			Offset: first * SectorSize,
+			Size:   (last - first + 1) * SectorSize,
+		})
+	}
+	return t, nil
+}
+
+// guid formats a GPT GUID, whose first three fields are little-endian.
+func guid(b []byte) string {
+	return fmt.Sprintf("%08X-%04X-%04X-%X-%X",
+		binary.LittleEndian.Uint32(b[0:4]), binary.LittleEndian.Uint16(b[4:6]), binary.LittleEndian.Uint16(b[6:8]), b[8:10], b[10:16])
+}
+
+func utf16Name(b []byte) string {
+	units := make([]uint16, 0, len(b)/2)
+	for i := 0; i+1 < len(b); i += 2 {
+		u := binary.LittleEndian.Uint16(b[i:])
+		if u == 0 {
+			break
+		}
+		units = append(units, u)
+	}
+	return string(utf16.Decode(units))
+}
+
+var mbrTypes = map[byte]string{
+	0x01: "FAT12",
+	0x04: "FAT16 <32M",
+	0x06: "FAT16",
+	0x07: "NTFS/exFAT",
+	0x0b: "FAT32",
+	0x0c: "FAT32 (LBA)",
+	0x0e: "FAT16 (LBA)",
+	0x17: "Hidden NTFS/exFAT",
+	0x27: "Windows recovery",
+	0x82: "Linux swap",
+	0x83: "Linux",
+	0x8e: "Linux LVM",
+	0xa5: "FreeBSD",
+	0xa8: "Darwin UFS",
+	0xaf: "HFS/HFS+",
+	0xef: "EFI (FAT)",
+	0xfd: "Linux RAID",
+}
+
+func mbrType(kind byte) string {
+	if name, ok := mbrTypes[kind]; ok {
+		return fmt.Sprintf("%s (0x%02x)", name, kind)
+	}
+	return fmt.Sprintf("0x%02x", kind)
+}
+
+var gptTypes = map[string]string{
+	"C12A7328-F81F-11D2-BA4B-00A0C93EC93B": "EFI System",
+	"21686148-6449-6E6F-744E-656564454649": "BIOS boot",
+	"EBD0A0A2-B9E5-4433-87C0-68B6B72699C7": "Microsoft basic data",
+	"E3C9E316-0B5C-4DB8-817D-F92DF00215AE": "Microsoft reserved",
+	"DE94BBA4-06D1-4D40-A16A-BFD50179D6AC": "Windows recovery",
+	"0FC63DAF-8483-4772-8E79-3D69D8477DE4": "Linux filesystem",
+	"0657FD6D-A4AB-43C4-84E5-0933C84B4F4F": "Linux swap",
+	"E6D6D379-F507-44C2-A23C-238F2A3DF928": "Linux LVM",
+	"A19D880F-05FC-4D3B-A006-743F0F84911E": "Linux RAID",
+	"4F68BCE3-E8CD-4DB1-96E7-FBCAF984B709": "Linux root (x86-64)",
+	"B921B045-1DF0-41C3-AF44-4C6F280D3FAE": "Linux root (ARM64)",
+	"BC13C2FF-59E6-4262-A352-B275FD6F7172": "Linux extended boot",
+	"48465300-0000-11AA-AA11-00306543ECAC": "Apple HFS+",
+	"7C3457EF-0000-11AA-AA11-00306543ECAC": "Apple APFS",
+	"516E7CB4-6ECF-11D6-8FF8-00022D09712B": "FreeBSD data",
+}
+
+func gptType(g string) string {
+	if name, ok := gptTypes[g]; ok {
+		return name
+	}
+	return strings.ToLower(g)
+}
@@ -0,0 +1,282 @@
+package partition
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf16"
+)
+
+// mbrEntry is a primary or logical MBR entry.
+type mbrEntry struct {
+	kind         byte
+	start, count uint32
+	boot         bool
+}
+
+// putMBR writes a boot record with entries and the 55 AA signature into the
+// sector at lba of img.
+func putMBR(img []byte, lba int, entries ...mbrEntry) {
+	sector := img[lba*SectorSize:]
+	for i, e := range entries {
+		b := sector[446+16*i:]
+		if e.boot {
+			b[0] = 0x80
+		}
+		b[4] = e.kind
+		binary.LittleEndian.PutUint32(b[8:12], e.start)
+		binary.LittleEndian.PutUint32(b[12:16], e.count)
+	}
+	sector[510], sector[511] = 0x55, 0xaa
+}
+
+// gptEntry is a GPT partition entry; its type is a GUID in on-disk order.
+type gptEntry struct {
+	typeGUID    [16]byte
+	first, last uint64
+	name        string
+}
+
+// linuxGUID is the "Linux filesystem" type in on-disk order.
+var linuxGUID = [16]byte{0xaf, 0x3d, 0xc6, 0x0f, 0x83, 0x84, 0x72, 0x47, 0x8e, 0x79, 0x3d, 0x69, 0xd8, 0x47, 0x7d, 0xe4}
+
+// gptImage returns an image of n sectors with a protective MBR and a GPT
+// of four 128-byte entries in sector 2, with correct checksums.
+func gptImage(n int, parts ...gptEntry) []byte {
+	img := make([]byte, n*SectorSize)
+	putMBR(img, 0, mbrEntry{kind: 0xee, start: 1, count: uint32(n - 1)})
+	entries := img[2*SectorSize : 3*SectorSize]
+	for i, p := range parts {
+		e := entries[128*i:]
+		copy(e[0:16], p.typeGUID[:])
+		binary.LittleEndian.PutUint64(e[32:40], p.first)
+		binary.LittleEndian.PutUint64(e[40:48], p.last)
+		for j, u := range utf16.Encode([]rune(p.name)) {
+			binary.LittleEndian.PutUint16(e[56+2*j:], u)
+		}
+	}
+	header := img[SectorSize:]
+	copy(header, "EFI PART")
+	binary.LittleEndian.PutUint32(header[12:16], 92)
+	binary.LittleEndian.PutUint64(header[72:80], 2)
+	binary.LittleEndian.PutUint32(header[80:84], 4)
+	binary.LittleEndian.PutUint32(header[84:88], 128)
+	binary.LittleEndian.PutUint32(header[88:92], crc32.ChecksumIEEE(entries))
+	binary.LittleEndian.PutUint32(header[16:20], crc32.ChecksumIEEE(header[:92]))
+	return img
+}
+
+func TestRead(t *testing.T) {
+	tests := []struct {
+		name    string
+		image   func() []byte
+		scheme  string
+		want    []Partition
+		problem string // Expected in Problems, or "" for none
+		err     error  // Expected error, or errAny
+	}{
+		{
+			name: "MBR",
+			image: func() []byte {
+				img := make([]byte, 64*SectorSize)
+				putMBR(img, 0, mbrEntry{kind: 0x0c, start: 8, count: 16, boot: true}, mbrEntry{}, mbrEntry{kind: 0x83, start: 24, count: 40})
+				return img
+			},
+			scheme: MBR,
+			want: []Partition{
+				{Index: 1, Type: "FAT32 (LBA) (0x0c)", Offset: 8 * SectorSize, Size: 16 * SectorSize, Bootable: true},
+				{Index: 3, Type: "Linux (0x83)", Offset: 24 * SectorSize, Size: 40 * SectorSize},
+			},
+		},
+		{
+			name: "MBR with logical partitions",
+			image: func() []byte {
+				img := make([]byte, 64*SectorSize)
+				putMBR(img, 0, mbrEntry{kind: 0x0f, start: 16, count: 48})
+				putMBR(img, 16, mbrEntry{kind: 0x83, start: 2, count: 10}, mbrEntry{kind: 0x05, start: 16, count: 16})
+				putMBR(img, 32, mbrEntry{kind: 0x82, start: 2, count: 14})
+				return img
+			},
+			scheme: MBR,
+			want: []Partition{
+				{Index: 5, Type: "Linux (0x83)", Offset: 18 * SectorSize, Size: 10 * SectorSize},
+				{Index: 6, Type: "Linux swap (0x82)", Offset: 34 * SectorSize, Size: 14 * SectorSize},
+			},
+		},
+		{
+			name: "MBR partition past the end",
+			image: func() []byte {
+				img := make([]byte, 64*SectorSize)
+				putMBR(img, 0, mbrEntry{kind: 0x83, start: 8, count: 0xFFFFFFFF})
+				return img
+			},
+			scheme:  MBR,
+			want:    []Partition{{Index: 1, Type: "Linux (0x83)", Offset: 8 * SectorSize, Size: 0xFFFFFFFF * SectorSize}},
+			problem: "past the end of the image",
+		},
+		{
+			name: "extended boot record past the end",
+			image: func() []byte {
+				img := make([]byte, 64*SectorSize)
+				putMBR(img, 0, mbrEntry{kind: 0x83, start: 8, count: 8}, mbrEntry{kind: 0x05, start: 0xFFFFFF00, count: 8})
+				return img
+			},
+			scheme:  MBR,
+			want:    []Partition{{Index: 1, Type: "Linux (0x83)", Offset: 8 * SectorSize, Size: 8 * SectorSize}},
+			problem: "could not read extended boot record",
+		},
+		{
+			name: "extended boot records in a loop",
+			image: func() []byte {
+				img := make([]byte, 64*SectorSize)
+				putMBR(img, 0, mbrEntry{kind: 0x05, start: 16, count: 48})
+				putMBR(img, 16, mbrEntry{kind: 0x83, start: 2, count: 4}, mbrEntry{kind: 0x05, start: 16, count: 16})
+				putMBR(img, 32, mbrEntry{}, mbrEntry{kind: 0x05, start: 16, count: 16})
+				return img
+			},
+			scheme: MBR,
+			// The second record links to itself; the chain is only followed
+			// so far
+			want: []Partition{{Index: 5, Type: "Linux (0x83)", Offset: 18 * SectorSize, Size: 4 * SectorSize}},
+		},
+		{
+			name:  "no signature",
+			image: func() []byte { return make([]byte, 64*SectorSize) },
+			err:   ErrNoTable,
+		},
+		{
+			name: "empty MBR",
+			image: func() []byte {
+				img := make([]byte, 64*SectorSize)
+				putMBR(img, 0)
+				return img
+			},
+			err: ErrNoTable,
+		},
+		{
+			name: "shorter than a sector",
+			image: func() []byte {
+				img := make([]byte, 64*SectorSize)
+				putMBR(img, 0, mbrEntry{kind: 0x83, start: 8, count: 8})
+				return img[:300]
+			},
+			err: ErrNoTable,
+		},
+		{
+			name:   "GPT",
+			image:  func() []byte { return gptImage(64, gptEntry{linuxGUID, 34, 63, "rootfs"}) },
+			scheme: GPT,
+			want:   []Partition{{Index: 1, Type: "Linux filesystem", Name: "rootfs", Offset: 34 * SectorSize, Size: 30 * SectorSize}},
+		},
+		{
+			name: "GPT header checksum",
+			image: func() []byte {
+				img := gptImage(64, gptEntry{linuxGUID, 34, 63, "rootfs"})
+				img[SectorSize+16] ^= 0xff
+				return img
+			},
+			scheme:  GPT,
+			want:    []Partition{{Index: 1, Type: "Linux filesystem", Name: "rootfs", Offset: 34 * SectorSize, Size: 30 * SectorSize}},
+			problem: "GPT header checksum does not match",
+		},
+		{
+			name: "GPT entries checksum",
+			image: func() []byte {
+				img := gptImage(64, gptEntry{linuxGUID, 34, 63, "rootfs"})
+				img[2*SectorSize+56] = 'R'
+				return img
+			},
+			scheme:  GPT,
+			want:    []Partition{{Index: 1, Type: "Linux filesystem", Name: "Rootfs", Offset: 34 * SectorSize, Size: 30 * SectorSize}},
+			problem: "GPT partition entries checksum does not match",
+		},
+		{
+			name:    "GPT partition past the end",
+			image:   func() []byte { return gptImage(64, gptEntry{linuxGUID, 34, 99, ""}) },
+			scheme:  GPT,
+			want:    []Partition{{Index: 1, Type: "Linux filesystem", Offset: 34 * SectorSize, Size: 66 * SectorSize}},
+			problem: "partition 1 extends 18432 bytes past the end of the image",
+		},
+		{
+			name:    "GPT partition ending before it starts",
+			image:   func() []byte { return gptImage(64, gptEntry{linuxGUID, 40, 39, ""}) },
+			scheme:  GPT,
+			problem: "partition 1 ends before it starts",
+		},
+		{
+			name:    "GPT partition past any sector",
+			image:   func() []byte { return gptImage(64, gptEntry{linuxGUID, 1 << 62, 1<<62 + 1, ""}) },
+			scheme:  GPT,
+			problem: "partition 1 lies past the last addressable sector",
+		},
+		{
+			name:  "GPT truncated before the header",
+			image: func() []byte { return gptImage(64)[:SectorSize] },
+			err:   errAny,
+		},
+		{
+			name:  "GPT truncated before the entries",
+			image: func() []byte { return gptImage(64)[:2*SectorSize+100] },
+			err:   errAny,
+		},
+		{
+			name: "GPT entries past the end",
+			image: func() []byte {
+				img := gptImage(64)
+				binary.LittleEndian.PutUint64(img[SectorSize+72:], 1<<60)
+				return img
+			},
+			err: errAny,
+		},
+		{
+			name: "GPT oversized entries",
+			image: func() []byte {
+				img := gptImage(64)
+				binary.LittleEndian.PutUint32(img[SectorSize+84:], 1<<20)
+				return img
+			},
+			err: errAny,
+		},
+		{
+			name: "protective MBR without a GPT",
+			image: func() []byte {
+				img := gptImage(64)
+				copy(img[SectorSize:], "NOT GPT!")
+				return img
+			},
+			err: errAny,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img := tt.image()
+			table, err := Read(bytes.NewReader(img), int64(len(img)))
+			if tt.err != nil {
+				if err == nil || tt.err != errAny && !errors.Is(err, tt.err) {
+					t.Fatalf("Read error = %v, want %v", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if table.Scheme != tt.scheme {
+				t.Errorf("Scheme = %s, want %s", table.Scheme, tt.scheme)
+			}
+			if !reflect.DeepEqual(table.Partitions, tt.want) {
+				t.Errorf("Partitions = %+v, want %+v", table.Partitions, tt.want)
+			}
+			problems := strings.Join(table.Problems, "; ")
+			if tt.problem == "" && problems != "" || !strings.Contains(problems, tt.problem) {
+				t.Errorf("Problems = %q, want %q", problems, tt.problem)
+			}
+		})
+	}
+}
+
+// errAny stands for any error in test tables.
+var errAny = errors.New("any error")
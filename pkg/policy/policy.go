@@ -0,0 +1,225 @@
+// Package policy loads verification policy files and checks verification
+// results against them, for environments that must document that media met
+// a fixed set of requirements.
+package policy
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/pappasjfed/chkiso/pkg/manifest"
+	"github.com/pappasjfed/chkiso/pkg/verify"
+)
+
+// Version is the newest policy file version this package understands.
+const Version = 1
+
+// ErrNotCompliant is wrapped by the failures Report.Failures returns.
+var ErrNotCompliant = errors.New("policy requirement not met")
+
+// Policy is the requirements a verification run must meet. Zero values
+// impose no requirement.
+type Policy struct {
+	Version int `json:"version"`
+
+	// RequireSignedManifest requires every checksum file used to carry a
+	// valid signature by the trusted key, given with -pubkey, and
+	// MaxSigningKeyAgeDays limits how old that key may be.
+	RequireSignedManifest bool `json:"require_signed_manifest,omitempty"`
+	MaxSigningKeyAgeDays  int  `json:"max_signing_key_age_days,omitempty"`
+
+	// MinAlgorithm is the weakest hash algorithm (md5, sha1, sha256, sha512)
+	// accepted for files on the media. At least one file must be verified.
+	MinAlgorithm string `json:"min_algorithm,omitempty"`
+
+	// RequireImplantedMD5 requires a valid implanted ISO MD5.
+	RequireImplantedMD5 bool `json:"require_implanted_md5,omitempty"`
+
+	// MinFileCoverage and MinByteCoverage are the lowest percentages of
+	// the files on the media, and of their bytes, that checksum files must
+	// list.
+	MinFileCoverage float64 `json:"min_file_coverage,omitempty"`
+	MinByteCoverage float64 `json:"min_byte_coverage,omitempty"`
+}
+
+// Load reads a policy file. Unknown fields are rejected so that a misspelled
+// requirement is not silently ignored.
+func Load(path string) (*Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read policy file: %v", err)
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	var p Policy
+	if err := dec.Decode(&p); err != nil {
+		return nil, fmt.Errorf("invalid policy file %s: %v", path, err)
+	}
+	if p.Version > Version {
+		return nil, fmt.Errorf("unsupported policy version %d (newest supported is %d)", p.Version, Version)
+	}
+	if p.MinAlgorithm != "" && manifest.Strength(p.MinAlgorithm) == 0 {
+		return nil, fmt.Errorf("invalid policy file %s: unknown min_algorithm %q", path, p.MinAlgorithm)
+	}
+	if p.MaxSigningKeyAgeDays < 0 {
+		return nil, fmt.Errorf("invalid policy file %s: max_signing_key_age_days must not be negative", path)
+	}
+	if p.MinFileCoverage < 0 || p.MinFileCoverage > 100 || p.MinByteCoverage < 0 || p.MinByteCoverage > 100 {
+		return nil, fmt.Errorf("invalid policy file %s: coverage must be a percentage from 0 to 100", path)
+	}
+	return &p, nil
+}
+
+// Apply enables the checks in opts that the policy needs results from.
+func (p *Policy) Apply(opts *verify.Options) {
+	if p.RequireImplantedMD5 {
+		opts.ImplantedMD5 = true
+	}
+	if p.MinAlgorithm != "" || p.RequireSignedManifest || p.MaxSigningKeyAgeDays > 0 || p.MinFileCoverage > 0 || p.MinByteCoverage > 0 {
+		opts.Contents = true
+	}
+}
+
+// Requirement is the outcome of one policy requirement.
+type Requirement struct {
+	Name   string
+	Met    bool
+	Detail string
+}
+
+// Report lists the outcome of every requirement the policy sets.
+type Report struct {
+	Requirements []Requirement
+}
+
+// Compliant reports whether every requirement was met.
+func (r *Report) Compliant() bool {
+	return len(r.Failures()) == 0
+}
+
+// Failures returns one error wrapping ErrNotCompliant per unmet requirement.
+func (r *Report) Failures() []error {
+	var failures []error
+	for _, req := range r.Requirements {
+		if !req.Met {
+			failures = append(failures, fmt.Errorf("%w: %s: %s", ErrNotCompliant, req.Name, req.Detail))
+		}
+	}
+	return failures
+}
+
+// Evaluate checks result against the policy.
+func (p *Policy) Evaluate(result *verify.Result) *Report {
+	report := &Report{}
+	add := func(name string, met bool, detail string) {
+		report.Requirements = append(report.Requirements, Requirement{Name: name, Met: met, Detail: detail})
+	}
+
+	if p.RequireSignedManifest {
+		met, detail := checkSigned(result.Contents)
+		add("Signed manifest", met, detail)
+	}
+	if p.MaxSigningKeyAgeDays > 0 {
+		met, detail := p.checkKeyAge(result.Contents, time.Now())
+		add(fmt.Sprintf("Signing key at most %d days old", p.MaxSigningKeyAgeDays), met, detail)
+	}
+
+	if p.MinAlgorithm != "" {
+		name := fmt.Sprintf("Files hashed with %s or stronger", p.MinAlgorithm)
+		met, detail := p.checkAlgorithm(result.Contents)
+		add(name, met, detail)
+	}
+
+	if p.MinFileCoverage > 0 || p.MinByteCoverage > 0 {
+		p.checkCoverage(result.Contents, add)
+	}
+
+	if p.RequireImplantedMD5 {
+		switch {
+		case result.MD5 == nil:
+			add("Implanted MD5", false, "no implanted MD5 was found")
+		case !result.MD5.IsIntegrityOK:
+			add("Implanted MD5", false, "implanted MD5 does not match")
+		default:
+			add("Implanted MD5", true, "implanted MD5 is valid")
+		}
+	}
+	return report
+}
+
+func (p *Policy) checkAlgorithm(contents *verify.ContentResult) (bool, string) {
+	if contents == nil || contents.Total == 0 {
+		return false, "no files were verified"
+	}
+	minimum := manifest.Strength(p.MinAlgorithm)
+	weak := 0
+	for _, f := range contents.Files {
+		if manifest.Strength(f.Algorithm) < minimum {
+			weak++
+		}
+	}
+	if weak > 0 {
+		return false, fmt.Sprintf("%d out of %d files use a weaker algorithm", weak, len(contents.Files))
+	}
+	return true, fmt.Sprintf("all %d files", len(contents.Files))
+}
+
+// checkSigned reports whether every checksum file used is signed by the
+// trusted key.
+func checkSigned(contents *verify.ContentResult) (bool, string) {
+	if contents == nil || len(contents.Signatures) == 0 {
+		return false, "no checksum files were verified"
+	}
+	for _, sig := range contents.Signatures {
+		if sig.Status != verify.SignatureValid {
+			return false, fmt.Sprintf("%s: %s", sig.ChecksumFile, sig.Detail)
+		}
+	}
+	return true, fmt.Sprintf("all %d checksum file(s) signed by the trusted key", len(contents.Signatures))
+}
+
+// checkKeyAge reports whether the trusted key that signed the checksum
+// files was at most MaxSigningKeyAgeDays old at now.
+func (p *Policy) checkKeyAge(contents *verify.ContentResult, now time.Time) (bool, string) {
+	if contents == nil || len(contents.Signatures) == 0 {
+		return false, "no checksum files were verified"
+	}
+	signed := false
+	for _, sig := range contents.Signatures {
+		signed = signed || sig.Status == verify.SignatureValid
+	}
+	if !signed {
+		return false, "no checksum file is signed by the trusted key"
+	}
+	// Every signature was checked against the same key
+	created := contents.Signatures[0].KeyCreated
+	if created.IsZero() {
+		return false, "the trusted key's creation date is not known; give it with -pubkey-created"
+	}
+	age := int(now.Sub(created).Hours() / 24)
+	return age <= p.MaxSigningKeyAgeDays, fmt.Sprintf("the key was created on %s, %d days ago", created.Format("2006-01-02"), age)
+}
+
+func (p *Policy) checkCoverage(contents *verify.ContentResult, add func(string, bool, string)) {
+	var files, bytes float64
+	if contents != nil {
+		files, bytes = contents.Coverage()
+	}
+	check := func(what string, minimum, covered float64) {
+		if minimum == 0 {
+			return
+		}
+		name := fmt.Sprintf("At least %g%% of %s covered by checksums", minimum, what)
+		if contents == nil {
+			add(name, false, "the contents were not verified")
+			return
+		}
+		add(name, covered >= minimum, fmt.Sprintf("%.1f%% of %s covered", covered, what))
+	}
+	check("files", p.MinFileCoverage, files)
+	check("bytes", p.MinByteCoverage, bytes)
+}
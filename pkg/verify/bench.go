@@ -0,0 +1,92 @@
+package verify
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/pappasjfed/chkiso/internal/ctxio"
+	"github.com/pappasjfed/chkiso/pkg/manifest"
+)
+
+// BenchAlgorithms are the hash algorithms `chkiso bench` measures, in the
+// order it reports them.
+var BenchAlgorithms = []string{manifest.MD5, manifest.SHA1, manifest.SHA256, manifest.SHA512, manifest.CRC32}
+
+// Throughput is an amount of data processed in some time.
+type Throughput struct {
+	Bytes    int64
+	Duration time.Duration
+}
+
+// PerSecond returns the throughput in bytes per second.
+func (t Throughput) PerSecond() float64 {
+	if t.Duration <= 0 {
+		return 0
+	}
+	return float64(t.Bytes) / t.Duration.Seconds()
+}
+
+// RawSize returns the size of the target's bytes as stored: the file, the
+// joined parts of a split image, or the device.
+func (t *Target) RawSize() (int64, error) {
+	if t.IsDir {
+		return 0, fmt.Errorf("%s is a directory, which has no image to read", t.Path)
+	}
+	file, size, err := t.openRaw()
+	if err != nil {
+		return 0, err
+	}
+	file.Close()
+	return size, nil
+}
+
+// BenchRead reads up to length bytes of the target as stored, starting at
+// offset, in reads of bufferSize bytes, and measures how fast it went.
+func BenchRead(ctx context.Context, t *Target, offset, length int64, bufferSize int) (Throughput, error) {
+	file, _, err := t.openRaw()
+	if err != nil {
+		return Throughput{}, err
+	}
+	defer file.Close()
+
+	r := ctxio.NewReader(ctx, io.NewSectionReader(file, offset, length))
+	buf := make([]byte, bufferSize)
+	var result Throughput
+	start := time.Now()
+	for {
+		n, err := r.Read(buf)
+		result.Bytes += int64(n)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return Throughput{}, err
+		}
+	}
+	result.Duration = time.Since(start)
+	return result, nil
+}
+
+// BenchHash hashes data with algorithm over and over for at least duration,
+// and measures how fast it went. Only the CPU is measured: data is in
+// memory.
+func BenchHash(ctx context.Context, algorithm string, data []byte, duration time.Duration) (Throughput, error) {
+	h, err := NewHash(algorithm)
+	if err != nil {
+		return Throughput{}, err
+	}
+	var result Throughput
+	start := time.Now()
+	for result.Duration < duration {
+		if err := ctx.Err(); err != nil {
+			return Throughput{}, err
+		}
+		h.Write(data)
+		result.Bytes += int64(len(data))
+		result.Duration = time.Since(start)
+	}
+	h.Sum(nil)
+	return result, nil
+}
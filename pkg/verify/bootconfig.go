@@ -0,0 +1,214 @@
+package verify
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+
+	"github.com/pappasjfed/chkiso/pkg/bootcfg"
+	"github.com/pappasjfed/chkiso/pkg/manifest"
+)
+
+// Statuses of a BootReference.
+const (
+	BootFileOK       = "OK"
+	BootFileMissing  = "MISSING"
+	BootFileMismatch = "FAILED"   // Listed in a checksum file with another hash
+	BootFileSkipped  = "VARIABLE" // Uses boot loader variables, so was not looked for
+)
+
+// BootReference is a file a boot loader configuration file names.
+type BootReference struct {
+	Config  string // Configuration file naming it
+	Line    int
+	Keyword string // "kernel", "initrd", "module", "include", ...
+	Path    string // Path on the media, as found there if it was
+	Status  string
+
+	// When a checksum file on the media lists the file
+	ChecksumFile string
+	Algorithm    string
+	Expected     string
+	Calculated   string
+}
+
+// String describes the reference and its status, as in "casper/vmlinuz
+// (kernel, isolinux/txt.cfg line 5) is missing".
+func (r BootReference) String() string {
+	where := fmt.Sprintf("%s (%s, %s line %d)", r.Path, r.Keyword, r.Config, r.Line)
+	switch r.Status {
+	case BootFileMissing:
+		return where + " is missing"
+	case BootFileMismatch:
+		return fmt.Sprintf("%s does not match the %s in %s", where, strings.ToUpper(r.Algorithm), r.ChecksumFile)
+	case BootFileSkipped:
+		return where + " uses boot loader variables and was not looked for"
+	}
+	return where + " is present"
+}
+
+// BootResult is what the boot loader configuration files on the
+// media reference, and whether those files are there.
+type BootResult struct {
+	Configs    []string // Configuration files found, slash-separated
+	References []BootReference
+}
+
+// Problems returns the references to missing files and to files that do
+// not match their checksums.
+func (r *BootResult) Problems() []BootReference {
+	var problems []BootReference
+	for _, ref := range r.References {
+		if ref.Status == BootFileMissing || ref.Status == BootFileMismatch {
+			problems = append(problems, ref)
+		}
+	}
+	return problems
+}
+
+// OK reports whether every file the configuration files name is there and
+// matches the checksums listed for it.
+func (r *BootResult) OK() bool {
+	return len(r.Problems()) == 0
+}
+
+// BootConfig finds the isolinux, syslinux, GRUB and ESXi boot loader
+// configuration files in fsys and checks that every kernel, initrd and
+// module they name exists, and matches its hash if a checksum file lists
+// it. It returns nil if there are no configuration files. With fips, only
+// FIPS approved hashes are checked.
+func BootConfig(ctx context.Context, fsys fs.FS, fips bool) (*BootResult, error) {
+	var configs []string
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		if err != nil {
+			if d != nil && d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if d.Type().IsRegular() && bootcfg.Detect(name) != "" {
+			configs = append(configs, name)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(configs) == 0 {
+		return nil, nil
+	}
+
+	listed, err := listedHashes(ctx, fsys, fips)
+	if err != nil {
+		return nil, err
+	}
+	result := &BootResult{Configs: configs}
+	hashes := make(map[string]string)
+	for _, config := range configs {
+		data, err := fs.ReadFile(fsys, config)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", config, err)
+		}
+		for _, ref := range bootcfg.Parse(bootcfg.Detect(config), config, data) {
+			br := BootReference{Config: config, Line: ref.Line, Keyword: ref.Keyword, Path: ref.Path}
+			if ref.Variable {
+				br.Status = BootFileSkipped
+				result.References = append(result.References, br)
+				continue
+			}
+			name, err := lookupFold(fsys, ref.Path)
+			if err != nil {
+				br.Status = BootFileMissing
+				result.References = append(result.References, br)
+				continue
+			}
+			br.Path = name
+			br.Status = BootFileOK
+			if entry, ok := listed[strings.ToLower(name)]; ok {
+				br.ChecksumFile, br.Algorithm, br.Expected = entry.checksumFile, entry.Algorithm, entry.Hash
+				key := entry.Algorithm + ":" + name
+				if br.Calculated, ok = hashes[key]; !ok {
+					if br.Calculated, err = FSFileHash(ctx, fsys, name, entry.Algorithm); err != nil {
+						return nil, fmt.Errorf("%s: %v", name, err)
+					}
+					hashes[key] = br.Calculated
+				}
+				if br.Calculated != br.Expected {
+					br.Status = BootFileMismatch
+				}
+			}
+			result.References = append(result.References, br)
+		}
+	}
+	return result, nil
+}
+
+// listedEntry is a checksum file entry, with the file listing it.
+type listedEntry struct {
+	manifest.Entry
+	checksumFile string
+}
+
+// listedHashes returns the strongest hash the checksum files on the media
+// list for each file, by its path in lower case.
+func listedHashes(ctx context.Context, fsys fs.FS, fips bool) (map[string]listedEntry, error) {
+	checksumFiles, err := manifest.FindFS(ctx, fsys, manifest.FindOptions{})
+	if err != nil {
+		return nil, err
+	}
+	listed := make(map[string]listedEntry)
+	for _, checksumFile := range checksumFiles {
+		entries, err := manifest.ParseFS(fsys, checksumFile)
+		if err != nil {
+			// Content verification reports checksum files it cannot read
+			continue
+		}
+		for _, entry := range entries {
+			if fips && !manifest.FIPSApproved(entry.Algorithm) {
+				continue
+			}
+			name := strings.ToLower(path.Join(path.Dir(checksumFile), strings.ReplaceAll(entry.Path, "\\", "/")))
+			if prev, ok := listed[name]; ok && manifest.Strength(prev.Algorithm) >= manifest.Strength(entry.Algorithm) {
+				continue
+			}
+			listed[name] = listedEntry{Entry: entry, checksumFile: checksumFile}
+		}
+	}
+	return listed, nil
+}
+
+// lookupFold finds name, a slash-separated path, in fsys ignoring case, as
+// FAT does and as boot loaders reading ISO 9660 names in capitals do. It
+// returns the path as fsys spells it.
+func lookupFold(fsys fs.FS, name string) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", fs.ErrInvalid
+	}
+	if _, err := fs.Stat(fsys, name); err == nil {
+		return name, nil
+	}
+	dir := "."
+	for _, part := range strings.Split(name, "/") {
+		entries, err := fs.ReadDir(fsys, dir)
+		if err != nil {
+			return "", err
+		}
+		found := ""
+		for _, e := range entries {
+			if strings.EqualFold(e.Name(), part) {
+				found = e.Name()
+				break
+			}
+		}
+		if found == "" {
+			return "", fs.ErrNotExist
+		}
+		dir = path.Join(dir, found)
+	}
+	return dir, nil
+}
@@ -0,0 +1,206 @@
+package verify
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pappasjfed/chkiso/pkg/isofs"
+)
+
+// cacheVersion is the version of the on-disk cache format.
+const cacheVersion = 1
+
+// Cache remembers the hashes calculated for files on the media so that a
+// later run can skip files whose path, size and modification time have not
+// changed.
+type Cache struct {
+	path string
+
+	mu      sync.Mutex
+	targets map[string]*cacheTarget // Keyed by Target.String()
+}
+
+// cacheTarget holds the entries for one target. For image files the stamp
+// records the image's size and modification time, so a rebuilt image never
+// reuses results from its predecessor. For drives and devices it records the
+// identity of the volume in them, so another disc with the same paths, sizes
+// and times never reuses the results of the one recorded.
+type cacheTarget struct {
+	Stamp string                `json:"stamp,omitempty"`
+	Files map[string]cacheEntry `json:"files"` // Keyed by path|algorithm
+}
+
+type cacheEntry struct {
+	Size    int64  `json:"size"`
+	ModTime int64  `json:"mtime"` // Unix nanoseconds
+	Hash    string `json:"hash"`
+}
+
+type cacheFile struct {
+	Version int                     `json:"version"`
+	Targets map[string]*cacheTarget `json:"targets"`
+}
+
+// LoadCache reads the cache stored at path. A missing file yields an empty
+// cache that Save will create.
+func LoadCache(path string) (*Cache, error) {
+	c := &Cache{
+		path:    path,
+		targets: make(map[string]*cacheTarget),
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read cache: %v", err)
+	}
+	var f cacheFile
+	if err := json.Unmarshal(data, &f); err != nil || f.Version != cacheVersion {
+		// A stale or damaged cache only costs a full re-verification
+		return c, nil
+	}
+	if f.Targets != nil {
+		c.targets = f.Targets
+	}
+	return c, nil
+}
+
+// Save writes the cache back to its file.
+func (c *Cache) Save() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	data, err := json.Marshal(cacheFile{Version: cacheVersion, Targets: c.targets})
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0o755); err != nil {
+		return fmt.Errorf("could not create cache directory: %v", err)
+	}
+	tmp := c.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("could not write cache: %v", err)
+	}
+	return os.Rename(tmp, c.path)
+}
+
+// scope returns the view of the cache for one target, discarding its entries
+// if the target is an image that changed since they were recorded, or a
+// drive or device that now holds another volume. A drive or device whose
+// volume cannot be identified is not cached, and the error says why.
+func (c *Cache) scope(target *Target) (*cacheScope, error) {
+	if c == nil {
+		return nil, nil
+	}
+	var stamp string
+	switch {
+	case target.isMedia():
+		var err error
+		if stamp, err = volumeStamp(target); err != nil {
+			return nil, err
+		}
+	case !target.IsDir:
+		files := target.Parts
+		if len(files) == 0 {
+			files = []string{target.Path}
+		}
+		for _, file := range files {
+			info, err := os.Stat(file)
+			if err != nil {
+				return nil, nil
+			}
+			if stamp != "" {
+				stamp += ","
+			}
+			stamp += strconv.FormatInt(info.Size(), 10) + "|" + strconv.FormatInt(info.ModTime().UnixNano(), 10)
+		}
+	}
+	key := target.String()
+	if target.Partition > 0 {
+		// Each partition has files of its own
+		key += "#" + strconv.Itoa(target.Partition)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := c.targets[key]
+	if t == nil || t.Stamp != stamp || t.Files == nil {
+		t = &cacheTarget{Stamp: stamp, Files: make(map[string]cacheEntry)}
+		c.targets[key] = t
+	}
+	return &cacheScope{cache: c, target: t}, nil
+}
+
+// volumeStampSize is how much of the start of a volume that is not ISO 9660
+// identifies it: the boot sector of FAT, exFAT and NTFS, with the volume
+// serial number, and the superblock of ext2/3/4, with the UUID.
+const volumeStampSize = 4096
+
+// volumeStamp identifies the volume in a drive or device. An ISO 9660 disc
+// is identified by its volume and volume set identifiers, its creation and
+// modification times, and a hash of its whole Primary Volume Descriptor;
+// other volumes by a hash of their first sectors.
+func volumeStamp(target *Target) (string, error) {
+	image, _, err := target.openRaw()
+	if err != nil {
+		return "", fmt.Errorf("could not identify the volume in %s: %v", target, err)
+	}
+	defer image.Close()
+	if block, err := isofs.ReadPVD(image); err == nil {
+		if pvd, err := isofs.ParsePVD(block); err == nil {
+			sum := sha256.Sum256(block)
+			return fmt.Sprintf("pvd|%s|%s|%s|%s|%x", pvd.VolumeID, pvd.VolumeSetID,
+				pvd.Created.UTC().Format(time.RFC3339), pvd.Modified.UTC().Format(time.RFC3339), sum), nil
+		}
+	}
+	head := make([]byte, volumeStampSize)
+	if n, err := image.ReadAt(head, 0); n != len(head) {
+		if err == nil {
+			err = io.ErrUnexpectedEOF
+		}
+		return "", fmt.Errorf("could not identify the volume in %s: %v", target, err)
+	}
+	return fmt.Sprintf("head|%x", sha256.Sum256(head)), nil
+}
+
+// cacheScope looks up and records hashes for the files of one target.
+type cacheScope struct {
+	cache  *Cache
+	target *cacheTarget
+}
+
+// lookup returns the hash recorded for the file if it is unchanged.
+func (s *cacheScope) lookup(name, algorithm string, info fs.FileInfo) (string, bool) {
+	if s == nil || info == nil || info.ModTime().IsZero() {
+		return "", false
+	}
+	s.cache.mu.Lock()
+	defer s.cache.mu.Unlock()
+	e, ok := s.target.Files[name+"|"+algorithm]
+	if !ok || e.Size != info.Size() || e.ModTime != info.ModTime().UnixNano() {
+		return "", false
+	}
+	return e.Hash, true
+}
+
+// store records the hash calculated for the file.
+func (s *cacheScope) store(name, algorithm string, info fs.FileInfo, hash string) {
+	if s == nil || info == nil || info.ModTime().IsZero() {
+		return
+	}
+	s.cache.mu.Lock()
+	defer s.cache.mu.Unlock()
+	s.target.Files[name+"|"+algorithm] = cacheEntry{
+		Size:    info.Size(),
+		ModTime: info.ModTime().UnixNano(),
+		Hash:    hash,
+	}
+}
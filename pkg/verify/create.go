@@ -0,0 +1,91 @@
+package verify
+
+import (
+	"context"
+	"encoding/hex"
+	"hash"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+
+	"github.com/pappasjfed/chkiso/internal/ctxio"
+	"github.com/pappasjfed/chkiso/pkg/manifest"
+)
+
+// CreateManifest hashes every regular file in fsys with each of algorithms,
+// reading each file once, and returns a native manifest listing them with
+// their sizes and modification times, and the tree hash when SHA256 is one
+// of the algorithms. Checksum files and their signatures are left out, as
+// verification leaves them out of its coverage. The caller fills in Tool.
+func CreateManifest(ctx context.Context, fsys fs.FS, algorithms []string) (*manifest.JSONManifest, error) {
+	for _, algorithm := range algorithms {
+		if _, err := NewHash(algorithm); err != nil {
+			return nil, err
+		}
+	}
+	m := &manifest.JSONManifest{Version: manifest.JSONVersion}
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() || IsChecksumOrSignature(path.Base(name)) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		hashes, err := fsFileHashes(ctx, fsys, name, algorithms)
+		if err != nil {
+			return err
+		}
+		size, mtime := info.Size(), info.ModTime().UTC()
+		m.Files = append(m.Files, manifest.JSONFile{Path: name, Size: &size, MTime: &mtime, Hashes: hashes})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	m.TreeHash = m.CalculateTreeHash()
+	return m, nil
+}
+
+// IsChecksumOrSignature reports whether name is a checksum file or a
+// detached signature of one.
+func IsChecksumOrSignature(name string) bool {
+	for _, ext := range manifest.SignatureExts {
+		if strings.HasSuffix(strings.ToLower(name), ext) {
+			name = name[:len(name)-len(ext)]
+			break
+		}
+	}
+	return manifest.IsChecksumFile(name)
+}
+
+// fsFileHashes returns the hex digests of the file name within fsys for each
+// of algorithms, from one read.
+func fsFileHashes(ctx context.Context, fsys fs.FS, name string, algorithms []string) (map[string]string, error) {
+	file, err := fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	hashes := make([]hash.Hash, len(algorithms))
+	writers := make([]io.Writer, len(algorithms))
+	for i, algorithm := range algorithms {
+		if hashes[i], err = NewHash(algorithm); err != nil {
+			return nil, err
+		}
+		writers[i] = hashes[i]
+	}
+	if _, err := io.Copy(io.MultiWriter(writers...), ctxio.NewReader(ctx, file)); err != nil {
+		return nil, err
+	}
+	sums := make(map[string]string, len(algorithms))
+	for i, algorithm := range algorithms {
+		sums[algorithm] = hex.EncodeToString(hashes[i].Sum(nil))
+	}
+	return sums, nil
+}
@@ -0,0 +1,88 @@
+package verify
+
+import (
+	"bytes"
+
+	"github.com/pappasjfed/chkiso/pkg/isofs"
+)
+
+const (
+	// damageZeroRun is the shortest run of zero bytes reported as damage.
+	// Images hold shorter ones in the system area, between files and in
+	// the free space of embedded boot file systems.
+	damageZeroRun = 1 << 20
+	// damageRepeatRun is the shortest run of one sector repeated that is
+	// reported; a failing drive may return the same buffer again and again.
+	damageRepeatRun = 256 << 10
+)
+
+// DamageRun is a stretch of an image that looks damaged: a long run of zero
+// bytes, or of one sector repeated, with data on both sides of it.
+type DamageRun struct {
+	Offset int64
+	Length int64
+	Zeros  bool // Zero bytes; otherwise the same sector repeated
+}
+
+// damageScanner finds DamageRuns in the sectors written to it, in order.
+// Runs reaching the end of the image are padding, so they are left out.
+type damageScanner struct {
+	partial [isofs.SectorSize]byte // A sector split across writes
+	fill    int                    // Bytes of partial filled
+	prev    [isofs.SectorSize]byte
+	offset  int64 // Of the next whole sector
+	run     *DamageRun
+	runs    []DamageRun
+}
+
+var zeroSector [isofs.SectorSize]byte
+
+func (s *damageScanner) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		if s.fill > 0 || len(p) < isofs.SectorSize {
+			k := copy(s.partial[s.fill:], p)
+			s.fill += k
+			p = p[k:]
+			if s.fill == isofs.SectorSize {
+				s.sector(s.partial[:])
+				s.fill = 0
+			}
+			continue
+		}
+		s.sector(p[:isofs.SectorSize])
+		p = p[isofs.SectorSize:]
+	}
+	return n, nil
+}
+
+// sector scans the next whole sector.
+func (s *damageScanner) sector(b []byte) {
+	zero := bytes.Equal(b, zeroSector[:])
+	repeat := !zero && s.offset > 0 && bytes.Equal(b, s.prev[:])
+	switch {
+	case s.run != nil && s.run.Zeros && zero, s.run != nil && !s.run.Zeros && repeat:
+		s.run.Length += isofs.SectorSize
+	default:
+		s.endRun()
+		if zero {
+			s.run = &DamageRun{Offset: s.offset, Length: isofs.SectorSize, Zeros: true}
+		} else if repeat {
+			// The run starts with the first copy
+			s.run = &DamageRun{Offset: s.offset - isofs.SectorSize, Length: 2 * isofs.SectorSize}
+		}
+	}
+	copy(s.prev[:], b)
+	s.offset += isofs.SectorSize
+}
+
+// endRun records the current run if it is long enough to be reported.
+func (s *damageScanner) endRun() {
+	if s.run == nil {
+		return
+	}
+	if s.run.Zeros && s.run.Length >= damageZeroRun || !s.run.Zeros && s.run.Length >= damageRepeatRun {
+		s.runs = append(s.runs, *s.run)
+	}
+	s.run = nil
+}
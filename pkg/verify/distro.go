@@ -0,0 +1,28 @@
+package verify
+
+import (
+	"path/filepath"
+
+	"github.com/pappasjfed/chkiso/pkg/distro"
+	"github.com/pappasjfed/chkiso/pkg/isofs"
+)
+
+// Release identifies the distribution release the target holds from its
+// ISO 9660 volume label, or returns nil if it is not a known one or has no
+// readable label.
+func Release(t *Target) *distro.Release {
+	file, _, err := t.open()
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+	pvd, err := isofs.ReadVolume(file)
+	if err != nil {
+		return nil
+	}
+	name := ""
+	if !t.IsDrive {
+		name = filepath.Base(t.ImagePath())
+	}
+	return distro.Identify(pvd.VolumeID, name)
+}
@@ -0,0 +1,77 @@
+package verify
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"strings"
+
+	"github.com/pappasjfed/chkiso/pkg/dmg"
+	"github.com/pappasjfed/chkiso/pkg/isofs"
+)
+
+// IsDMG reports whether the target is an Apple disk image (.dmg).
+func (t *Target) IsDMG() bool {
+	return !t.IsDrive && !t.IsDir && strings.EqualFold(filepath.Ext(t.ImagePath()), ".dmg")
+}
+
+// DMGChecksums checks the CRC32 checksums embedded in a DMG target: that of
+// the data fork, those of its partitions, and the master checksum.
+func DMGChecksums(ctx context.Context, t *Target) (*dmg.Result, error) {
+	file, size, err := t.open()
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	img, err := dmg.Open(file, size)
+	if err != nil {
+		return nil, err
+	}
+	return img.Verify(ctx)
+}
+
+// dmgFS returns the files of the DMG in r. Only ISO 9660 file systems can
+// be read, either as the whole disk or in one of its partitions; HFS+ and
+// APFS are recognized so the error can say why the contents are unreadable.
+func dmgFS(r io.ReaderAt, size int64) (fs.FS, error) {
+	img, err := dmg.Open(r, size)
+	if err != nil {
+		return nil, err
+	}
+	disk := img.Disk()
+	if fsys, err := isofs.NewFS(disk); err == nil {
+		return fsys, nil
+	}
+	var found []string
+	for _, p := range img.Partitions {
+		part := io.NewSectionReader(disk, p.Sector*dmg.SectorSize, p.SectorCount*dmg.SectorSize)
+		if fsys, err := isofs.NewFS(part); err == nil {
+			return fsys, nil
+		}
+		if name := fileSystemName(part); name != "" {
+			found = append(found, name)
+		}
+	}
+	if len(found) > 0 {
+		return nil, fmt.Errorf("the disk image holds %s, which chkiso cannot read; only ISO 9660 contents can be verified", strings.Join(uniqueStrings(found), " and "))
+	}
+	return nil, fmt.Errorf("no readable file system found in the disk image")
+}
+
+// fileSystemName names the HFS+ or APFS file system starting in r, if any.
+func fileSystemName(r io.ReaderAt) string {
+	b := make([]byte, 1026)
+	if _, err := r.ReadAt(b, 0); err != nil {
+		return ""
+	}
+	switch {
+	case string(b[32:36]) == "NXSB":
+		return "APFS"
+	case string(b[1024:1026]) == "H+" || string(b[1024:1026]) == "HX":
+		return "HFS+"
+	}
+	return ""
+}
@@ -0,0 +1,244 @@
+package verify
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Drive is optical or removable media attached to the computer.
+type Drive struct {
+	Path string // Target to verify it: E:, /dev/sr0 or /dev/disk2
+	Kind string // "optical" or "removable"
+	Size int64  // Bytes; 0 when no medium is inserted
+	Name string // Volume label or device model, if known
+}
+
+// ListDrives returns the optical and removable media chkiso can verify:
+// CD-ROM and removable volumes from Get-Volume on Windows, external and
+// optical whole disks from diskutil on macOS, and optical, removable and USB
+// block devices from /sys/block on Linux.
+func ListDrives(ctx context.Context) ([]Drive, error) {
+	switch runtime.GOOS {
+	case "windows":
+		return windowsDrives(ctx)
+	case "darwin":
+		return darwinDrives(ctx)
+	case "linux":
+		return linuxDrives("/sys/block")
+	}
+	return nil, fmt.Errorf("listing drives is not supported on %s", runtime.GOOS)
+}
+
+func windowsDrives(ctx context.Context) ([]Drive, error) {
+	psCommand := `Get-Volume | Where-Object { $_.DriveLetter -and ($_.DriveType -eq 'CD-ROM' -or $_.DriveType -eq 'Removable') } | ` +
+		`Sort-Object DriveLetter | ForEach-Object { '{0}|{1}|{2}|{3}' -f $_.DriveLetter, $_.DriveType, $_.Size, $_.FileSystemLabel }`
+	out, err := exec.CommandContext(ctx, "powershell", "-NoProfile", "-NonInteractive", "-Command", psCommand).Output()
+	if err != nil {
+		return nil, fmt.Errorf("Get-Volume failed: %v", err)
+	}
+	var drives []Drive
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.SplitN(strings.TrimSpace(line), "|", 4)
+		if len(fields) != 4 {
+			continue
+		}
+		d := Drive{Path: fields[0] + ":", Kind: "removable", Name: fields[3]}
+		if fields[1] == "CD-ROM" {
+			d.Kind = "optical"
+		}
+		d.Size, _ = strconv.ParseInt(fields[2], 10, 64)
+		drives = append(drives, d)
+	}
+	return drives, nil
+}
+
+// linuxDrives lists the optical (sr*), removable and USB disks in sysfs,
+// whole disks only, since a written image starts at the disk's first sector.
+func linuxDrives(sysBlock string) ([]Drive, error) {
+	entries, err := os.ReadDir(sysBlock)
+	if err != nil {
+		return nil, err
+	}
+	read := func(name, file string) string {
+		b, _ := os.ReadFile(filepath.Join(sysBlock, name, file))
+		return strings.TrimSpace(string(b))
+	}
+	var drives []Drive
+	for _, e := range entries {
+		name := e.Name()
+		d := Drive{Path: "/dev/" + name}
+		switch {
+		case strings.HasPrefix(name, "sr"):
+			d.Kind = "optical"
+		case read(name, "removable") == "1":
+			d.Kind = "removable"
+		default:
+			// USB sticks often claim to be fixed disks
+			if link, err := filepath.EvalSymlinks(filepath.Join(sysBlock, name)); err == nil && strings.Contains(link, "/usb") {
+				d.Kind = "removable"
+			}
+		}
+		if d.Kind == "" {
+			continue
+		}
+		if sectors, err := strconv.ParseInt(read(name, "size"), 10, 64); err == nil {
+			d.Size = sectors * 512 // sysfs counts 512-byte sectors whatever the device's own
+		}
+		d.Name = strings.TrimSpace(read(name, "device/vendor") + " " + read(name, "device/model"))
+		drives = append(drives, d)
+	}
+	return drives, nil
+}
+
+// darwinDrives lists the physical whole disks diskutil reports as optical,
+// removable or external.
+func darwinDrives(ctx context.Context) ([]Drive, error) {
+	out, err := exec.CommandContext(ctx, "diskutil", "list", "-plist").Output()
+	if err != nil {
+		return nil, fmt.Errorf("diskutil list failed: %v", err)
+	}
+	list, err := parsePlist(out)
+	if err != nil {
+		return nil, fmt.Errorf("could not read diskutil output: %v", err)
+	}
+	disks, _ := plistDict(list)["WholeDisks"].([]interface{})
+	var drives []Drive
+	for _, disk := range disks {
+		name, _ := disk.(string)
+		if name == "" {
+			continue
+		}
+		out, err := exec.CommandContext(ctx, "diskutil", "info", "-plist", name).Output()
+		if err != nil {
+			continue
+		}
+		v, err := parsePlist(out)
+		if err != nil {
+			continue
+		}
+		if d, ok := darwinDrive(plistDict(v)); ok {
+			drives = append(drives, d)
+		}
+	}
+	sort.Slice(drives, func(i, j int) bool { return drives[i].Path < drives[j].Path })
+	return drives, nil
+}
+
+// darwinDrive describes the disk in info, the output of diskutil info, and
+// reports whether it is one to list.
+func darwinDrive(info map[string]interface{}) (Drive, bool) {
+	str := func(key string) string { s, _ := info[key].(string); return s }
+	flag := func(key string) bool { b, _ := info[key].(bool); return b }
+	if str("VirtualOrPhysical") == "Virtual" {
+		// Disk images and APFS containers
+		return Drive{}, false
+	}
+	d := Drive{Path: str("DeviceNode"), Name: str("MediaName")}
+	switch {
+	case str("OpticalMediaType") != "" || str("OpticalDeviceType") != "":
+		d.Kind = "optical"
+	case flag("RemovableMedia") || flag("Removable") || flag("Ejectable") || !flag("Internal"):
+		d.Kind = "removable"
+	default:
+		return Drive{}, false
+	}
+	for _, key := range []string{"TotalSize", "Size"} {
+		if size, ok := info[key].(int64); ok && size > 0 {
+			d.Size = size
+			break
+		}
+	}
+	return d, d.Path != ""
+}
+
+func plistDict(v interface{}) map[string]interface{} {
+	m, _ := v.(map[string]interface{})
+	return m
+}
+
+// parsePlist decodes an XML property list such as diskutil -plist writes.
+// Dictionaries become maps, arrays slices, integers int64 and booleans bool;
+// strings, dates and data are kept as text.
+func parsePlist(data []byte) (interface{}, error) {
+	d := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			return nil, fmt.Errorf("empty property list")
+		}
+		if err != nil {
+			return nil, err
+		}
+		if start, ok := tok.(xml.StartElement); ok && start.Name.Local != "plist" {
+			return plistValue(d, start)
+		}
+	}
+}
+
+func plistValue(d *xml.Decoder, start xml.StartElement) (interface{}, error) {
+	switch start.Name.Local {
+	case "dict":
+		m := make(map[string]interface{})
+		key := ""
+		for {
+			tok, err := d.Token()
+			if err != nil {
+				return nil, err
+			}
+			switch t := tok.(type) {
+			case xml.StartElement:
+				if t.Name.Local == "key" {
+					if err := d.DecodeElement(&key, &t); err != nil {
+						return nil, err
+					}
+					continue
+				}
+				v, err := plistValue(d, t)
+				if err != nil {
+					return nil, err
+				}
+				m[key] = v
+			case xml.EndElement:
+				return m, nil
+			}
+		}
+	case "array":
+		var a []interface{}
+		for {
+			tok, err := d.Token()
+			if err != nil {
+				return nil, err
+			}
+			switch t := tok.(type) {
+			case xml.StartElement:
+				v, err := plistValue(d, t)
+				if err != nil {
+					return nil, err
+				}
+				a = append(a, v)
+			case xml.EndElement:
+				return a, nil
+			}
+		}
+	case "true", "false":
+		return start.Name.Local == "true", d.Skip()
+	}
+	var text string
+	if err := d.DecodeElement(&text, &start); err != nil {
+		return nil, err
+	}
+	if start.Name.Local == "integer" {
+		return strconv.ParseInt(strings.TrimSpace(text), 10, 64)
+	}
+	return text, nil
+}
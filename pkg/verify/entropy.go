@@ -0,0 +1,82 @@
+package verify
+
+import (
+	"context"
+	"io"
+	"math"
+
+	"github.com/pappasjfed/chkiso/internal/ctxio"
+	"github.com/pappasjfed/chkiso/pkg/isofs"
+)
+
+// EntropyRegion is a region of an image with the Shannon entropy of its
+// bytes.
+type EntropyRegion struct {
+	Offset  int64
+	Length  int64
+	Entropy float64 // Bits per byte, from 0 (one value repeated) to 8 (random)
+	Zeros   bool    // Every byte is zero
+}
+
+// EntropyMap divides the image of t into about regions equal regions of
+// whole sectors and measures the entropy of each, which shows zero-filled
+// tails of truncated copies, blank padding, and where compressed or
+// encrypted data lies. The image is read once, or twice for a compressed
+// image whose size is not known yet. Bytes read are reported through
+// progress with the phase "entropy".
+func EntropyMap(ctx context.Context, t *Target, regions int, progress ProgressFunc) ([]EntropyRegion, error) {
+	file, size, err := t.open()
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	if regions < 1 {
+		regions = 1
+	}
+	regionSize := (size + int64(regions) - 1) / int64(regions)
+	regionSize = (regionSize + isofs.SectorSize - 1) / isofs.SectorSize * isofs.SectorSize
+	if regionSize == 0 {
+		return nil, nil
+	}
+
+	r := &progressReader{r: ctxio.NewReader(ctx, io.NewSectionReader(file, 0, size)), phase: "entropy", item: t.String(), total: size, progress: progress}
+	var result []EntropyRegion
+	buf := make([]byte, 1<<20)
+	for offset := int64(0); offset < size; offset += regionSize {
+		length := regionSize
+		if size-offset < length {
+			length = size - offset
+		}
+		var counts [256]int64
+		for left := length; left > 0; {
+			chunk := buf
+			if left < int64(len(chunk)) {
+				chunk = chunk[:left]
+			}
+			n, err := io.ReadFull(r, chunk)
+			if err != nil {
+				return nil, err
+			}
+			for _, b := range chunk[:n] {
+				counts[b]++
+			}
+			left -= int64(n)
+		}
+		result = append(result, EntropyRegion{Offset: offset, Length: length, Entropy: entropy(&counts, length), Zeros: counts[0] == length})
+	}
+	return result, nil
+}
+
+// entropy returns the Shannon entropy in bits per byte of total bytes with
+// the given counts of each value.
+func entropy(counts *[256]int64, total int64) float64 {
+	e := 0.0
+	for _, c := range counts {
+		if c == 0 {
+			continue
+		}
+		p := float64(c) / float64(total)
+		e -= p * math.Log2(p)
+	}
+	return e
+}
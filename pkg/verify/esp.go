@@ -0,0 +1,255 @@
+package verify
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/pappasjfed/chkiso/internal/ctxio"
+	"github.com/pappasjfed/chkiso/pkg/fat"
+	"github.com/pappasjfed/chkiso/pkg/isofs"
+	"github.com/pappasjfed/chkiso/pkg/partition"
+)
+
+// ErrNoESP is returned by ESP and ExtractESP for images that boot without
+// an EFI System Partition.
+var ErrNoESP = errors.New("no EFI System Partition found")
+
+// ESPResult describes the EFI System Partition of an image: the FAT file
+// system UEFI firmware boots a hybrid ISO or a disk image from.
+type ESPResult struct {
+	Source     string // Where it was found: "El Torito" or "partition N"
+	ISOFile    string // The file of the ISO 9660 tree holding it, if any
+	Offset     int64  // Start in the image, in bytes
+	Size       int64
+	Sha256     string
+	FileSystem string // FAT12, FAT16 or FAT32
+	Label      string
+	Files      []ESPFile
+
+	// Problems lists EFI executables that differ from the file of the same
+	// path in the ISO 9660 tree. Firmware boots the one in the ESP, so a
+	// difference means it does not boot what the rest of the image ships.
+	Problems []string
+}
+
+// ESPFile is a file in an EFI System Partition.
+type ESPFile struct {
+	Path       string
+	Size       int64
+	Sha256     string
+	BootLoader bool   // EFI/BOOT/BOOT*.EFI, the loader for removable media
+	ISOSha256  string // SHA256 of the same path in the ISO 9660 tree, if there is one
+}
+
+// Differs reports whether the file is also in the ISO 9660 tree with other
+// contents.
+func (f ESPFile) Differs() bool {
+	return f.ISOSha256 != "" && f.ISOSha256 != f.Sha256
+}
+
+// OK reports whether the ESP was read without problems.
+func (r *ESPResult) OK() bool {
+	return len(r.Problems) == 0
+}
+
+// BootLoaders returns the removable media boot loaders in the ESP.
+func (r *ESPResult) BootLoaders() []ESPFile {
+	var loaders []ESPFile
+	for _, f := range r.Files {
+		if f.BootLoader {
+			loaders = append(loaders, f)
+		}
+	}
+	return loaders
+}
+
+// HasESP reports whether the target is an image that may hold an EFI
+// System Partition: not a directory, a drive, or a WIM, DMG or zip archive.
+func (t *Target) HasESP() bool {
+	return !t.IsDir && !t.IsDrive && !t.IsWIM() && !t.IsDMG() && !strings.EqualFold(filepath.Ext(t.ImagePath()), ".zip")
+}
+
+// findESP locates the EFI System Partition of image: the image the UEFI
+// entry of its El Torito boot catalog loads, or else a partition of type
+// EFI System. It returns nil if there is neither.
+func findESP(image io.ReaderAt, size int64) (*ESPResult, error) {
+	entries, err := isofs.BootCatalog(image)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		if e.Platform != isofs.PlatformEFI || e.MediaType != 0 {
+			continue
+		}
+		esp := &ESPResult{Source: "El Torito", Offset: int64(e.LoadBlock) * isofs.SectorSize}
+		esp.ISOFile, esp.Size = isoFileAt(image, esp.Offset)
+		// A count of 0 or 1 sectors leaves the size to the FAT boot sector,
+		// as mkisofs cannot record more than 32 MiB
+		if esp.Size == 0 && e.SectorCount > 1 {
+			esp.Size = int64(e.SectorCount) * 512
+		}
+		if esp.Size == 0 {
+			fsys, err := fat.NewFS(io.NewSectionReader(image, esp.Offset, size-esp.Offset))
+			if err != nil {
+				return nil, fmt.Errorf("the UEFI boot image at block %d: %v", e.LoadBlock, err)
+			}
+			esp.Size = fsys.Size()
+		}
+		if esp.Offset+esp.Size > size {
+			return nil, fmt.Errorf("the UEFI boot image at block %d extends past the end of the image", e.LoadBlock)
+		}
+		return esp, nil
+	}
+
+	table, err := partition.Read(image, size)
+	if errors.Is(err, partition.ErrNoTable) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range table.Partitions {
+		if p.Type != "EFI System" && !strings.HasPrefix(p.Type, "EFI (FAT)") {
+			continue
+		}
+		if p.Offset+p.Size > size {
+			return nil, fmt.Errorf("EFI System Partition %d extends past the end of the image", p.Index)
+		}
+		esp := &ESPResult{Source: fmt.Sprintf("partition %d", p.Index), Offset: p.Offset, Size: p.Size}
+		esp.ISOFile, _ = isoFileAt(image, esp.Offset)
+		return esp, nil
+	}
+	return nil, nil
+}
+
+// isoFileAt returns the file of the ISO 9660 tree in image that starts at
+// offset, such as images/efiboot.img, with its size.
+func isoFileAt(image io.ReaderAt, offset int64) (string, int64) {
+	fsys, err := isofs.NewFS(image)
+	if err != nil {
+		return "", 0
+	}
+	var found string
+	var size int64
+	fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		if extents, err := fsys.Extents(name); err == nil && len(extents) > 0 && extents[0][0] == offset {
+			if info, err := d.Info(); err == nil {
+				found, size = name, info.Size()
+			}
+			return fs.SkipAll
+		}
+		return nil
+	})
+	return found, size
+}
+
+// ESP finds the EFI System Partition of the target's image, hashes it and
+// each file on it, and compares the files with those of the same paths in
+// the ISO 9660 tree. It returns ErrNoESP if the image has none.
+func ESP(ctx context.Context, t *Target) (*ESPResult, error) {
+	image, size, err := t.open()
+	if err != nil {
+		return nil, err
+	}
+	defer image.Close()
+	esp, err := findESP(image, size)
+	if err != nil {
+		return nil, err
+	}
+	if esp == nil {
+		return nil, ErrNoESP
+	}
+
+	section := io.NewSectionReader(image, esp.Offset, esp.Size)
+	h := sha256.New()
+	if _, err := io.Copy(h, ctxio.NewReader(ctx, section)); err != nil {
+		return nil, err
+	}
+	esp.Sha256 = hex.EncodeToString(h.Sum(nil))
+
+	fsys, err := fat.NewFS(section)
+	if err != nil {
+		return nil, fmt.Errorf("could not read the EFI System Partition: %v", err)
+	}
+	esp.FileSystem = fsys.Type()
+	esp.Label = fsys.Label()
+
+	// The ISO 9660 tree, if there is one, carries its own copies of the
+	// boot loaders on most distributions
+	iso, _ := isofs.NewFS(image)
+	err = fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		sum, err := FSFileHash(ctx, fsys, name, "sha256")
+		if err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+		f := ESPFile{Path: name, Size: info.Size(), Sha256: sum, BootLoader: isBootLoader(name)}
+		if iso != nil {
+			if isoName, err := lookupFold(iso, name); err == nil {
+				if f.ISOSha256, err = FSFileHash(ctx, iso, isoName, "sha256"); err != nil {
+					return fmt.Errorf("%s in the ISO 9660 tree: %v", isoName, err)
+				}
+				if f.Differs() && strings.EqualFold(path.Ext(name), ".efi") {
+					esp.Problems = append(esp.Problems, fmt.Sprintf("%s differs from %s in the ISO 9660 tree", name, isoName))
+				}
+			}
+		}
+		esp.Files = append(esp.Files, f)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return esp, nil
+}
+
+// isBootLoader reports whether name is where firmware looks for the boot
+// loader of removable media, EFI/BOOT/BOOT<arch>.EFI.
+func isBootLoader(name string) bool {
+	dir, file := path.Split(strings.ToUpper(name))
+	return dir == "EFI/BOOT/" && strings.HasPrefix(file, "BOOT") && strings.HasSuffix(file, ".EFI")
+}
+
+// ExtractESP copies the EFI System Partition of the target's image to w and
+// returns where it was found, with its SHA256. It returns ErrNoESP if the
+// image has none.
+func ExtractESP(ctx context.Context, t *Target, w io.Writer) (*ESPResult, error) {
+	image, size, err := t.open()
+	if err != nil {
+		return nil, err
+	}
+	defer image.Close()
+	esp, err := findESP(image, size)
+	if err != nil {
+		return nil, err
+	}
+	if esp == nil {
+		return nil, ErrNoESP
+	}
+	h := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(w, h), ctxio.NewReader(ctx, io.NewSectionReader(image, esp.Offset, esp.Size))); err != nil {
+		return nil, err
+	}
+	esp.Sha256 = hex.EncodeToString(h.Sum(nil))
+	return esp, nil
+}
@@ -0,0 +1,54 @@
+package verify
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pappasjfed/chkiso/pkg/isofs"
+)
+
+// LabelResult is the volume label of a target compared with the expected
+// one.
+type LabelResult struct {
+	Expected string
+	Found    string
+	Match    bool // The same apart from case and padding
+}
+
+// VolumeLabel returns the volume identifier of the target's ISO 9660
+// volume. A compressed image is only decompressed as far as its volume
+// descriptors.
+func VolumeLabel(t *Target) (string, error) {
+	var image isofs.Image
+	if t.Compression != "" && !t.narrowed() {
+		image = isofs.NewStreamImage(t.decompress)
+	} else {
+		var err error
+		if image, _, err = t.open(); err != nil {
+			return "", err
+		}
+	}
+	defer image.Close()
+	pvd, err := isofs.ReadVolume(image)
+	if err != nil {
+		return "", fmt.Errorf("could not read the volume label: %v", err)
+	}
+	return pvd.VolumeID, nil
+}
+
+// sameLabel reports whether two volume labels are the same apart from case
+// and padding.
+func sameLabel(a, b string) bool {
+	return strings.EqualFold(strings.TrimSpace(a), strings.TrimSpace(b))
+}
+
+// SizeResult is the size of a target compared with the expected one.
+type SizeResult struct {
+	Expected int64
+	Found    int64 // Bytes as stored: all parts of a split image, a compressed file before decompression
+}
+
+// Match reports whether the target has the expected size.
+func (s *SizeResult) Match() bool {
+	return s.Found == s.Expected
+}
@@ -0,0 +1,111 @@
+package verify
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"io/fs"
+	"os"
+	"time"
+
+	"github.com/pappasjfed/chkiso/internal/ctxio"
+	"github.com/pappasjfed/chkiso/internal/winpath"
+	"github.com/pappasjfed/chkiso/pkg/manifest"
+)
+
+// NewHash returns a hash for one of the manifest algorithm names.
+func NewHash(algorithm string) (hash.Hash, error) {
+	switch algorithm {
+	case manifest.MD5:
+		return md5.New(), nil
+	case manifest.SHA1:
+		return sha1.New(), nil
+	case manifest.SHA256:
+		return sha256.New(), nil
+	case manifest.SHA512:
+		return sha512.New(), nil
+	case manifest.CRC32:
+		return crc32.NewIEEE(), nil
+	}
+	return nil, fmt.Errorf("unsupported hash algorithm %q", algorithm)
+}
+
+// FileHash returns the hex digest of a regular file using algorithm.
+func FileHash(ctx context.Context, filePath, algorithm string) (string, error) {
+	h, err := NewHash(algorithm)
+	if err != nil {
+		return "", err
+	}
+	file, err := os.Open(winpath.Long(filePath))
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	if _, err := io.Copy(h, ctxio.NewReader(ctx, file)); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// FSFileHash returns the hex digest of the file name within fsys using algorithm.
+func FSFileHash(ctx context.Context, fsys fs.FS, name, algorithm string) (string, error) {
+	h, err := NewHash(algorithm)
+	if err != nil {
+		return "", err
+	}
+	file, err := fsys.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	if _, err := io.Copy(h, ctxio.NewReader(ctx, file)); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// fsFileHashTimeout is FSFileHash giving up after timeout, if non-zero.
+// Opening and reading happen in a goroutine, so it returns on time even
+// when the file system does not: the goroutine is left behind.
+func fsFileHashTimeout(ctx context.Context, fsys fs.FS, name, algorithm string, timeout time.Duration) (string, error) {
+	if timeout <= 0 {
+		return FSFileHash(ctx, fsys, name, algorithm)
+	}
+	fileCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	type hashed struct {
+		sum string
+		err error
+	}
+	done := make(chan hashed, 1)
+	go func() {
+		sum, err := FSFileHash(fileCtx, fsys, name, algorithm)
+		done <- hashed{sum, err}
+	}()
+	select {
+	case h := <-done:
+		if h.err != nil && ctx.Err() == nil && fileCtx.Err() != nil {
+			return "", fmt.Errorf("hashing timed out after %s", timeout)
+		}
+		return h.sum, h.err
+	case <-fileCtx.Done():
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+		return "", fmt.Errorf("hashing timed out after %s", timeout)
+	}
+}
+
+// FileSha256 returns the SHA256 of a regular file.
+func FileSha256(ctx context.Context, filePath string) (string, error) {
+	return FileHash(ctx, filePath, manifest.SHA256)
+}
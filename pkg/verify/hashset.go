@@ -0,0 +1,84 @@
+package verify
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+
+	"github.com/pappasjfed/chkiso/pkg/hashset"
+)
+
+// HashSetFile is a file on the media looked up in a reference hash set.
+type HashSetFile struct {
+	Path  string
+	Size  int64
+	Hash  string // In the algorithm of the hash set
+	Known bool
+	Name  string // File name the hash set lists for the hash, if any
+}
+
+// HashSetResult tells which files on the media a reference hash set, such
+// as the NSRL's RDS, lists as known software.
+type HashSetResult struct {
+	HashSet   string // Path of the hash set
+	Format    string
+	Algorithm string
+	Files     []HashSetFile
+}
+
+// Known returns how many of the files, and how many of their bytes, the
+// hash set lists.
+func (r *HashSetResult) Known() (files int, bytes int64) {
+	for _, f := range r.Files {
+		if f.Known {
+			files++
+			bytes += f.Size
+		}
+	}
+	return files, bytes
+}
+
+// Unknown returns the files the hash set does not list.
+func (r *HashSetResult) Unknown() []HashSetFile {
+	var unknown []HashSetFile
+	for _, f := range r.Files {
+		if !f.Known {
+			unknown = append(unknown, f)
+		}
+	}
+	return unknown
+}
+
+// HashSet hashes every file on fsys in the algorithm of set and looks it up
+// there.
+func HashSet(ctx context.Context, fsys fs.FS, set *hashset.Set) (*HashSetResult, error) {
+	result := &HashSetResult{HashSet: set.Path, Format: set.Format, Algorithm: set.Algorithm}
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		f := HashSetFile{Path: name, Size: info.Size()}
+		if f.Hash, err = FSFileHash(ctx, fsys, name, set.Algorithm); err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+		if f.Name, f.Known, err = set.Lookup(f.Hash); err != nil {
+			return fmt.Errorf("looking up %s in %s: %v", name, set.Path, err)
+		}
+		result.Files = append(result.Files, f)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
@@ -0,0 +1,81 @@
+package verify
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/pappasjfed/chkiso/pkg/jigdo"
+)
+
+// JigdoTemplate returns the path of the .template file belonging to the
+// .jigdo file at jigdoPath: the one it names, looked for in the same
+// directory, or else the .jigdo file's name with a .template extension.
+func JigdoTemplate(jigdoPath string, j *jigdo.Jigdo) string {
+	dir := filepath.Dir(jigdoPath)
+	// The template may be named by URL
+	named := filepath.Join(dir, path.Base(strings.ReplaceAll(j.TemplateName, "\\", "/")))
+	if _, err := os.Stat(named); err == nil {
+		return named
+	}
+	return strings.TrimSuffix(jigdoPath, filepath.Ext(jigdoPath)) + ".template"
+}
+
+// JigdoCheck verifies an image target against the .jigdo file at
+// jigdoPath and its template: the template's own hash, then the size and
+// hash of the image and of every package file in it, read in one pass.
+// With fips, templates using MD5 are refused with ErrNotApproved.
+func JigdoCheck(ctx context.Context, t *Target, jigdoPath string, fips bool, progress ProgressFunc) (*jigdo.Result, error) {
+	if t.IsDrive || t.IsDir {
+		return nil, fmt.Errorf("jigdo verification needs an image file, not a drive or directory")
+	}
+	jf, err := os.Open(jigdoPath)
+	if err != nil {
+		return nil, err
+	}
+	j, err := jigdo.ParseJigdo(jf)
+	jf.Close()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", filepath.Base(jigdoPath), err)
+	}
+
+	templatePath := JigdoTemplate(jigdoPath, j)
+	tf, err := os.Open(templatePath)
+	if err != nil {
+		return nil, fmt.Errorf("could not open the template: %v", err)
+	}
+	defer tf.Close()
+	info, err := tf.Stat()
+	if err != nil {
+		return nil, err
+	}
+	tmpl, err := jigdo.ReadTemplate(tf, info.Size())
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", filepath.Base(templatePath), err)
+	}
+	if fips && tmpl.Algorithm != "sha256" {
+		return nil, fmt.Errorf("jigdo %s template %w", tmpl.Algorithm, ErrNotApproved)
+	}
+
+	file, _, err := t.open()
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	reader := &progressReader{r: io.NewSectionReader(file, 0, 1<<62), phase: "jigdo", item: t.String(), total: tmpl.ImageSize, progress: progress}
+	result, err := jigdo.Verify(ctx, reader, tmpl, j)
+	if err != nil {
+		return nil, err
+	}
+	if fips && j.TemplateSHA256 == "" {
+		return result, nil
+	}
+	if err := jigdo.CheckTemplate(ctx, io.NewSectionReader(tf, 0, info.Size()), j, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
@@ -0,0 +1,273 @@
+package verify
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pappasjfed/chkiso/pkg/bootcfg"
+	"github.com/pappasjfed/chkiso/pkg/manifest"
+)
+
+// Kinds of BootImage.
+const (
+	KindKernel = "kernel"
+	KindInitrd = "initrd"
+)
+
+// BootImage is a kernel or initrd on the media.
+type BootImage struct {
+	Path    string
+	Kind    string // KindKernel or KindInitrd
+	Size    int64
+	Sha256  string
+	Format  string // "bzImage", "ARM64 Image", "gzip", "zstd", "cpio", ... or "" if not recognized
+	Version string // Version string of an x86 bzImage
+
+	// Set when a checksum file lists the image: one on the media, or the
+	// published checksums given with Options.KernelSums
+	ChecksumFile string
+	Algorithm    string
+	Expected     string
+	Calculated   string
+}
+
+// Match reports whether the image matches the hash listed for it. Images
+// no checksum file lists match.
+func (b BootImage) Match() bool {
+	return b.Expected == "" || b.Calculated == b.Expected
+}
+
+// KernelResult lists the kernels and initrds on the media.
+type KernelResult struct {
+	Images []BootImage
+}
+
+// Checked returns how many images were compared with a listed hash.
+func (r *KernelResult) Checked() int {
+	n := 0
+	for _, b := range r.Images {
+		if b.Expected != "" {
+			n++
+		}
+	}
+	return n
+}
+
+// OK reports whether every image a checksum file lists matches it.
+func (r *KernelResult) OK() bool {
+	for _, b := range r.Images {
+		if !b.Match() {
+			return false
+		}
+	}
+	return true
+}
+
+// Kernels finds the kernels and initrds on fsys, by their names and by the
+// boot loader configuration files naming them, and hashes each one. Those
+// listed by a checksum file on the media, or by the checksum file sums off
+// it if given, are compared with it; sums is preferred, as what a
+// distribution publishes. With fips, only FIPS approved hashes are
+// compared.
+func Kernels(ctx context.Context, fsys fs.FS, sums string, fips bool) (*KernelResult, error) {
+	kinds := make(map[string]string)
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		if err != nil {
+			if d != nil && d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		if kind := bootcfg.Detect(name); kind != "" {
+			data, err := fs.ReadFile(fsys, name)
+			if err != nil {
+				return nil
+			}
+			for _, ref := range bootcfg.Parse(kind, name, data) {
+				if ref.Variable || (ref.Keyword != KindKernel && ref.Keyword != KindInitrd) || isSyslinuxModule(ref.Path) {
+					continue
+				}
+				if found, err := lookupFold(fsys, ref.Path); err == nil && kinds[found] == "" {
+					kinds[found] = ref.Keyword
+				}
+			}
+		}
+		if kind := bootImageKind(path.Base(name)); kind != "" && kinds[name] == "" {
+			kinds[name] = kind
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(kinds) == 0 {
+		return nil, nil
+	}
+
+	listed, err := listedHashes(ctx, fsys, fips)
+	if err != nil {
+		return nil, err
+	}
+	var published []manifest.Entry
+	if sums != "" {
+		data, err := os.ReadFile(sums)
+		if err != nil {
+			return nil, err
+		}
+		if published, err = manifest.ParseNamed(filepath.Base(sums), data); err != nil {
+			return nil, fmt.Errorf("%s: %v", sums, err)
+		}
+	}
+
+	names := make([]string, 0, len(kinds))
+	for name := range kinds {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	result := &KernelResult{}
+	for _, name := range names {
+		info, err := fs.Stat(fsys, name)
+		if err != nil {
+			return nil, err
+		}
+		b := BootImage{Path: name, Kind: kinds[name], Size: info.Size()}
+		if b.Format, b.Version, err = bootImageFormat(fsys, name); err != nil {
+			return nil, fmt.Errorf("%s: %v", name, err)
+		}
+		if b.Sha256, err = FSFileHash(ctx, fsys, name, manifest.SHA256); err != nil {
+			return nil, fmt.Errorf("%s: %v", name, err)
+		}
+		if entry, ok := publishedEntry(published, name, fips); ok {
+			b.ChecksumFile, b.Algorithm, b.Expected = filepath.Base(sums), entry.Algorithm, entry.Hash
+		} else if entry, ok := listed[strings.ToLower(name)]; ok {
+			b.ChecksumFile, b.Algorithm, b.Expected = entry.checksumFile, entry.Algorithm, entry.Hash
+		}
+		if b.Algorithm == manifest.SHA256 {
+			b.Calculated = b.Sha256
+		} else if b.Algorithm != "" {
+			if b.Calculated, err = FSFileHash(ctx, fsys, name, b.Algorithm); err != nil {
+				return nil, fmt.Errorf("%s: %v", name, err)
+			}
+		}
+		result.Images = append(result.Images, b)
+	}
+	return result, nil
+}
+
+// bootImageKind tells kernels and initrds apart by the names distributions
+// give them: vmlinuz, vmlinuz-linux, bzImage, initrd.img, initrd.gz,
+// initramfs-linux.img and the like. Signatures and checksums of them are
+// not images.
+func bootImageKind(name string) string {
+	name = strings.ToLower(name)
+	if IsChecksumOrSignature(name) || strings.HasSuffix(name, ".cfg") || strings.HasSuffix(name, ".txt") {
+		return ""
+	}
+	switch {
+	case strings.HasPrefix(name, "vmlinuz") || strings.HasPrefix(name, "vmlinux") || strings.HasPrefix(name, "bzimage"):
+		return KindKernel
+	case strings.HasPrefix(name, "initrd") || strings.HasPrefix(name, "initramfs"):
+		return KindInitrd
+	}
+	return ""
+}
+
+// isSyslinuxModule reports whether a file syslinux loads with KERNEL is a
+// COM32 module, a boot sector or a PXE image rather than a kernel.
+func isSyslinuxModule(name string) bool {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".c32", ".bin", ".bs", ".bss", ".com", ".cbt", ".0":
+		return true
+	}
+	return false
+}
+
+// bootImageFormat recognizes a kernel or initrd by its first bytes, and
+// reads the version string of an x86 bzImage.
+func bootImageFormat(fsys fs.FS, name string) (format, version string, err error) {
+	file, err := fsys.Open(name)
+	if err != nil {
+		return "", "", err
+	}
+	defer file.Close()
+	// The setup header and the version string it points to are in the
+	// first 16 KiB of a bzImage
+	head := make([]byte, 16<<10)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", "", err
+	}
+	head = head[:n]
+
+	switch {
+	case len(head) >= 0x210 && string(head[0x202:0x206]) == "HdrS":
+		// kernel_version points 0x200 bytes before the string it names
+		if offset := int(binary.LittleEndian.Uint16(head[0x20E:0x210])) + 0x200; offset > 0x200 && offset < len(head) {
+			version = string(head[offset:])
+			if i := strings.IndexByte(version, 0); i >= 0 {
+				version = version[:i]
+			}
+		}
+		return "bzImage", strings.TrimSpace(version), nil
+	case len(head) >= 0x40 && string(head[0x38:0x3C]) == "ARMd":
+		return "ARM64 Image", "", nil
+	case len(head) >= 8 && string(head[0:2]) == "MZ" && string(head[4:8]) == "zimg":
+		return "EFI zboot", "", nil
+	case len(head) >= 2 && string(head[0:2]) == "MZ":
+		return "EFI executable", "", nil
+	case bytes.HasPrefix(head, []byte("070701")) || bytes.HasPrefix(head, []byte("070702")):
+		return "cpio", "", nil
+	case bytes.HasPrefix(head, []byte{0x1F, 0x8B}):
+		return "gzip", "", nil
+	case bytes.HasPrefix(head, []byte{0xFD, '7', 'z', 'X', 'Z', 0x00}):
+		return "xz", "", nil
+	case bytes.HasPrefix(head, []byte{0x28, 0xB5, 0x2F, 0xFD}):
+		return "zstd", "", nil
+	case bytes.HasPrefix(head, []byte{0x02, 0x21, 0x4C, 0x18}):
+		return "lz4", "", nil
+	case bytes.HasPrefix(head, []byte{0x5D, 0x00, 0x00}):
+		return "lzma", "", nil
+	case bytes.HasPrefix(head, []byte("BZh")):
+		return "bzip2", "", nil
+	}
+	return "", "", nil
+}
+
+// publishedEntry finds the entry of published checksums for name: one
+// listing the same path, or else the only one with the same base name, as
+// distributions publish kernels next to their images rather than in the
+// layout of the media.
+func publishedEntry(entries []manifest.Entry, name string, fips bool) (manifest.Entry, bool) {
+	var byBase []manifest.Entry
+	for _, entry := range entries {
+		if fips && !manifest.FIPSApproved(entry.Algorithm) {
+			continue
+		}
+		p := strings.TrimPrefix(path.Clean(strings.ReplaceAll(entry.Path, "\\", "/")), "/")
+		if strings.EqualFold(p, name) {
+			return entry, true
+		}
+		if strings.EqualFold(path.Base(p), path.Base(name)) {
+			byBase = append(byBase, entry)
+		}
+	}
+	if len(byBase) == 1 {
+		return byBase[0], true
+	}
+	return manifest.Entry{}, false
+}
@@ -0,0 +1,74 @@
+package verify
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// MountISO mounts an ISO file on Windows using PowerShell's Mount-DiskImage.
+// Returns the drive letter (e.g., "H") and an error if mounting fails.
+func MountISO(ctx context.Context, isoPath string) (string, error) {
+	if runtime.GOOS != "windows" {
+		return "", fmt.Errorf("automatic ISO mounting is only supported on Windows")
+	}
+
+	// Get absolute path
+	absPath, err := filepath.Abs(isoPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to get absolute path: %v", err)
+	}
+
+	// Mount the ISO and get the drive letter
+	// Using PassThru to get the disk object, then Get-Volume to find the drive letter
+	psCommand := fmt.Sprintf(`
+		$disk = Mount-DiskImage -ImagePath '%s' -PassThru
+		if ($disk) {
+			$volume = Get-Volume -DiskImage $disk
+			if ($volume) {
+				$volume.DriveLetter
+			}
+		}
+	`, absPath)
+
+	cmd := exec.CommandContext(ctx, "powershell", "-NoProfile", "-NonInteractive", "-Command", psCommand)
+	output, err := cmd.Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			return "", fmt.Errorf("failed to mount ISO: %s", string(exitErr.Stderr))
+		}
+		return "", fmt.Errorf("failed to mount ISO: %v", err)
+	}
+
+	driveLetter := strings.TrimSpace(string(output))
+	if driveLetter == "" {
+		return "", fmt.Errorf("failed to get drive letter after mounting")
+	}
+
+	return driveLetter, nil
+}
+
+// DismountISO dismounts an ISO file on Windows using PowerShell's Dismount-DiskImage.
+func DismountISO(ctx context.Context, isoPath string) error {
+	if runtime.GOOS != "windows" {
+		return fmt.Errorf("automatic ISO dismounting is only supported on Windows")
+	}
+
+	// Get absolute path
+	absPath, err := filepath.Abs(isoPath)
+	if err != nil {
+		return fmt.Errorf("failed to get absolute path: %v", err)
+	}
+
+	psCommand := fmt.Sprintf("Dismount-DiskImage -ImagePath '%s'", absPath)
+	cmd := exec.CommandContext(ctx, "powershell", "-NoProfile", "-NonInteractive", "-Command", psCommand)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to dismount ISO: %s", string(output))
+	}
+
+	return nil
+}
@@ -0,0 +1,59 @@
+package verify
+
+import (
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/pappasjfed/chkiso/internal/decompress"
+	"github.com/pappasjfed/chkiso/pkg/isofs"
+	"github.com/pappasjfed/chkiso/pkg/nrg"
+)
+
+// IsNRG reports whether the target is a Nero image (.nrg), whose data track
+// is verified instead of the whole file.
+func (t *Target) IsNRG() bool {
+	if t.IsDrive || t.IsDir {
+		return false
+	}
+	return strings.EqualFold(filepath.Ext(decompress.TrimExt(t.ImagePath())), ".nrg")
+}
+
+// NRGTrack returns the data track of a Nero target, which is what gets
+// hashed and verified.
+func NRGTrack(t *Target) (nrg.Track, error) {
+	image, size, err := t.openImage()
+	if err != nil {
+		return nrg.Track{}, err
+	}
+	defer image.Close()
+	img, err := nrg.Open(image, size)
+	if err != nil {
+		return nrg.Track{}, err
+	}
+	return img.DataTrack()
+}
+
+// openNRG narrows a Nero image, which is size bytes long, to the user data
+// of its data track: the ISO image that was burned. Closing the result
+// closes image.
+func openNRG(image isofs.Image, size int64) (isofs.Image, int64, error) {
+	img, err := nrg.Open(image, size)
+	if err != nil {
+		image.Close()
+		return nil, 0, err
+	}
+	track, err := img.DataTrack()
+	if err != nil {
+		image.Close()
+		return nil, 0, err
+	}
+	data, length := img.UserData(track)
+	return trackImage{TrackReader: data, Closer: image}, length, nil
+}
+
+// trackImage is the data track of a Nero image.
+type trackImage struct {
+	*nrg.TrackReader
+	io.Closer
+}
@@ -0,0 +1,60 @@
+package verify
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/pappasjfed/chkiso/internal/decompress"
+	"github.com/pappasjfed/chkiso/pkg/isofs"
+	"github.com/pappasjfed/chkiso/pkg/partition"
+)
+
+// IsDiskImage reports whether the target is named like a raw disk image
+// (.img or .raw, possibly compressed), whose partition table is worth showing.
+func (t *Target) IsDiskImage() bool {
+	if t.IsDrive || t.IsDir {
+		return false
+	}
+	ext := strings.ToLower(filepath.Ext(decompress.TrimExt(t.ImagePath())))
+	return ext == ".img" || ext == ".raw"
+}
+
+// PartitionTable reads the MBR or GPT partition table of the target's image.
+// It returns partition.ErrNoTable if there is none.
+func PartitionTable(t *Target) (*partition.Table, error) {
+	image, size, err := t.openImage()
+	if err != nil {
+		return nil, err
+	}
+	defer image.Close()
+	return partition.Read(image, size)
+}
+
+// openPartition narrows image, which is size bytes long, to the target's
+// selected partition. Closing the result closes image.
+func (t *Target) openPartition(image isofs.Image, size int64) (isofs.Image, int64, error) {
+	table, err := partition.Read(image, size)
+	if err != nil {
+		image.Close()
+		return nil, 0, err
+	}
+	p := table.Find(t.Partition)
+	if p == nil {
+		image.Close()
+		return nil, 0, fmt.Errorf("the image has no partition %d", t.Partition)
+	}
+	length := p.Size
+	if p.Offset+length > size {
+		image.Close()
+		return nil, 0, fmt.Errorf("partition %d extends past the end of the image", t.Partition)
+	}
+	return sectionImage{SectionReader: io.NewSectionReader(image, p.Offset, length), Closer: image}, length, nil
+}
+
+// sectionImage is a byte range of an Image.
+type sectionImage struct {
+	*io.SectionReader
+	io.Closer
+}
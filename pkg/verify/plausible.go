@@ -0,0 +1,62 @@
+package verify
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/pappasjfed/chkiso/internal/decompress"
+	"github.com/pappasjfed/chkiso/pkg/isofs"
+)
+
+const (
+	// plausibleISOSize is the size below which an ".iso" file is suspect:
+	// even a minimal bootable image is larger.
+	plausibleISOSize = 1 << 20
+	// plausibleExtra is how much larger than its volume an image may be,
+	// for the partitions hybrid images append after it, before it is
+	// suspect.
+	plausibleExtra = 64 << 20
+)
+
+// Plausibility returns warnings about an ".iso" image that is probably not
+// the file that was meant, such as an HTML error page saved under the
+// image's name or an interrupted download: it has no ISO 9660 Primary
+// Volume Descriptor, is smaller than any real image, or its size is far
+// from the size of the volume it declares. Other targets get no warnings,
+// and neither does an image that cannot be opened, which the checks report.
+// The size of a compressed image is not checked, since finding it means
+// decompressing all of it.
+func Plausibility(t *Target) []string {
+	if t.IsDir || t.isMedia() || t.narrowed() || !strings.EqualFold(filepath.Ext(decompress.TrimExt(t.ImagePath())), ".iso") {
+		return nil
+	}
+	name := filepath.Base(t.ImagePath())
+	var image isofs.Image
+	size := int64(-1)
+	if t.Compression != "" {
+		image = isofs.NewStreamImage(t.decompress)
+	} else {
+		var err error
+		if image, size, err = t.open(); err != nil {
+			return nil
+		}
+	}
+	defer image.Close()
+
+	var warnings []string
+	if size >= 0 && size < plausibleISOSize {
+		warnings = append(warnings, fmt.Sprintf("%s is only %d bytes, too small for a real ISO image; it may be an error page or an interrupted download.", name, size))
+	}
+	volume := isoVolumeSize(image)
+	switch {
+	case volume == 0:
+		warnings = append(warnings, fmt.Sprintf("%s has no ISO 9660 volume descriptor, so it is probably not an ISO image (or a UDF-only one).", name))
+	case size < 0:
+	case size < volume:
+		warnings = append(warnings, fmt.Sprintf("%s is %d bytes, but its volume is %d bytes; the image is probably truncated.", name, size, volume))
+	case size-volume > plausibleExtra && size-volume > volume:
+		warnings = append(warnings, fmt.Sprintf("%s is %d bytes, much larger than its %d-byte volume; it may not be the image it appears to be.", name, size, volume))
+	}
+	return warnings
+}
@@ -0,0 +1,209 @@
+package verify
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/pappasjfed/chkiso/internal/ctxio"
+	"github.com/pappasjfed/chkiso/pkg/isofs"
+)
+
+// ImageComparison is the outcome of CompareImages.
+type ImageComparison struct {
+	Identical        bool // The images are the same bit for bit
+	SHA256A, SHA256B string
+
+	Volume  []FieldDiff // Volume descriptor fields that differ
+	Ignored []FieldDiff // Differences in volatile metadata, which do not count
+	Boot    []string    // Differences of the boot catalogs and boot images
+	Files   *TreeDiff   // Nil if the images are identical
+}
+
+// FieldDiff is a field of two images that differs.
+type FieldDiff struct {
+	Field string
+	A, B  string
+}
+
+// Equivalent reports whether the images hold the same things: they are
+// identical, or differ only in volatile metadata.
+func (c *ImageComparison) Equivalent() bool {
+	return c.Identical || len(c.Volume)+len(c.Boot) == 0 && c.Files.OK()
+}
+
+// CompareImages tells whether two ISO images are functionally the same, as
+// when checking that an image rebuilt from the same sources reproduces the
+// original. Unless they are identical bit for bit, it compares the volume
+// descriptor fields that name and describe the volume, the El Torito boot
+// entries with the bytes firmware loads from each, and the contents of
+// every file, as CompareTrees does. It ignores what changes with every
+// build: the volume timestamps (from which the volume serial number and
+// UUID that operating systems show are derived), the application use area
+// holding the implanted MD5, the volume size and where files and boot
+// images are placed, and file modification times.
+func CompareImages(ctx context.Context, a, b *Target, progress ProgressFunc) (*ImageComparison, error) {
+	c := &ImageComparison{}
+	var err error
+	if c.SHA256A, err = Sha256(ctx, a, progress); err != nil {
+		return nil, err
+	}
+	if c.SHA256B, err = Sha256(ctx, b, progress); err != nil {
+		return nil, err
+	}
+	if c.SHA256A == c.SHA256B {
+		c.Identical = true
+		return c, nil
+	}
+
+	imageA, _, err := a.open()
+	if err != nil {
+		return nil, err
+	}
+	defer imageA.Close()
+	imageB, _, err := b.open()
+	if err != nil {
+		return nil, err
+	}
+	defer imageB.Close()
+
+	if err := c.compareVolumes(imageA, imageB); err != nil {
+		return nil, err
+	}
+	if err := c.compareBoot(ctx, imageA, imageB); err != nil {
+		return nil, err
+	}
+
+	fsA, err := isofs.NewFS(imageA)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", a, err)
+	}
+	fsB, err := isofs.NewFS(imageB)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", b, err)
+	}
+	if c.Files, err = CompareTrees(ctx, fsA, fsB, progress); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// compareVolumes compares the Primary Volume Descriptors of the images.
+func (c *ImageComparison) compareVolumes(a, b io.ReaderAt) error {
+	blockA, err := isofs.ReadPVD(a)
+	if err != nil {
+		return err
+	}
+	blockB, err := isofs.ReadPVD(b)
+	if err != nil {
+		return err
+	}
+	pvdA, err := isofs.ParsePVD(blockA)
+	if err != nil {
+		return err
+	}
+	pvdB, err := isofs.ParsePVD(blockB)
+	if err != nil {
+		return err
+	}
+
+	compare := func(list *[]FieldDiff, field, a, b string) {
+		if a != b {
+			*list = append(*list, FieldDiff{field, a, b})
+		}
+	}
+	compare(&c.Volume, "System identifier", pvdA.SystemID, pvdB.SystemID)
+	compare(&c.Volume, "Volume label", pvdA.VolumeID, pvdB.VolumeID)
+	compare(&c.Volume, "Volume set identifier", pvdA.VolumeSetID, pvdB.VolumeSetID)
+	compare(&c.Volume, "Publisher", pvdA.PublisherID, pvdB.PublisherID)
+	compare(&c.Volume, "Data preparer", pvdA.PreparerID, pvdB.PreparerID)
+	compare(&c.Volume, "Application", pvdA.ApplicationID, pvdB.ApplicationID)
+	compare(&c.Volume, "Logical block size", strconv.Itoa(int(pvdA.LogicalBlock)), strconv.Itoa(int(pvdB.LogicalBlock)))
+
+	// Shown as recorded: "YYYYMMDDHHMMSScc" and the offset from UTC in
+	// quarter hours
+	stamp := func(block []byte, offset int) string {
+		return fmt.Sprintf("%s%+d", strings.TrimRight(string(block[offset:offset+16]), "\x00"), int8(block[offset+16]))
+	}
+	compare(&c.Ignored, "Volume created", stamp(blockA, 813), stamp(blockB, 813))
+	compare(&c.Ignored, "Volume modified", stamp(blockA, 830), stamp(blockB, 830))
+	compare(&c.Ignored, "Volume expires", stamp(blockA, 847), stamp(blockB, 847))
+	compare(&c.Ignored, "Volume effective", stamp(blockA, 864), stamp(blockB, 864))
+	compare(&c.Ignored, "Volume size (blocks)", strconv.Itoa(int(pvdA.VolumeSpaceSize)), strconv.Itoa(int(pvdB.VolumeSpaceSize)))
+	if string(pvdA.ApplicationUse) != string(pvdB.ApplicationUse) {
+		c.Ignored = append(c.Ignored, FieldDiff{"Application use (implanted MD5)", "", ""})
+	}
+	return nil
+}
+
+// compareBoot compares the El Torito boot entries of the images, apart from
+// where their boot images are, and the bytes each entry loads.
+func (c *ImageComparison) compareBoot(ctx context.Context, a, b io.ReaderAt) error {
+	entriesA, err := isofs.BootCatalog(a)
+	if err != nil {
+		return err
+	}
+	entriesB, err := isofs.BootCatalog(b)
+	if err != nil {
+		return err
+	}
+	if len(entriesA) != len(entriesB) {
+		c.Boot = append(c.Boot, fmt.Sprintf("%d boot entries, %d in the second image", len(entriesA), len(entriesB)))
+		return nil
+	}
+	for i := range entriesA {
+		ea, eb := entriesA[i], entriesB[i]
+		if ea.LoadBlock != eb.LoadBlock {
+			c.Ignored = append(c.Ignored, FieldDiff{fmt.Sprintf("Boot entry %d (%s) location", i+1, platformName(ea.Platform)), strconv.Itoa(int(ea.LoadBlock)), strconv.Itoa(int(eb.LoadBlock))})
+		}
+		ea.LoadBlock, eb.LoadBlock = 0, 0
+		if ea != eb {
+			c.Boot = append(c.Boot, fmt.Sprintf("boot entry %d (%s) differs: %+v, %+v in the second image", i+1, platformName(ea.Platform), entriesA[i], entriesB[i]))
+			continue
+		}
+		sumA, err := bootImageHash(ctx, a, entriesA[i])
+		if err != nil {
+			return err
+		}
+		sumB, err := bootImageHash(ctx, b, entriesB[i])
+		if err != nil {
+			return err
+		}
+		if sumA != sumB {
+			c.Boot = append(c.Boot, fmt.Sprintf("boot entry %d (%s) loads different data", i+1, platformName(ea.Platform)))
+		}
+	}
+	return nil
+}
+
+// platformName names an El Torito platform ID.
+func platformName(platform byte) string {
+	switch platform {
+	case isofs.PlatformBIOS:
+		return "BIOS"
+	case isofs.PlatformPPC:
+		return "PowerPC"
+	case isofs.PlatformMac:
+		return "Mac"
+	case isofs.PlatformEFI:
+		return "UEFI"
+	}
+	return fmt.Sprintf("platform 0x%02X", platform)
+}
+
+// bootImageHash returns the SHA256 of the bytes firmware loads for e.
+func bootImageHash(ctx context.Context, r io.ReaderAt, e isofs.BootEntry) (string, error) {
+	length := int64(e.SectorCount) * 512
+	if length < 512 {
+		length = 512
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, ctxio.NewReader(ctx, io.NewSectionReader(r, int64(e.LoadBlock)*isofs.SectorSize, length))); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,70 @@
+package verify
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+
+	"github.com/pappasjfed/chkiso/internal/ctxio"
+	"github.com/pappasjfed/chkiso/internal/pipeline"
+	"github.com/pappasjfed/chkiso/pkg/isofs"
+	"github.com/pappasjfed/chkiso/pkg/isomd5"
+)
+
+// RipResult is the outcome of Rip.
+type RipResult struct {
+	Size      int64 // Bytes copied
+	MediaSize int64 // Bytes on the medium, which may hold more than the ISO volume
+	Sha256    string
+	MD5       string         // Of the bytes copied, for hash files that list MD5s
+	Implanted *isomd5.Result // Nil if the image carries no implanted MD5
+}
+
+// Rip copies the image of t to w, such as a disc to an ISO file, reading it
+// once: the SHA256 and MD5 of the copy and the implanted MD5 are calculated
+// from the same reads. From a drive or device it copies the ISO data area
+// its Primary Volume Descriptor declares, so that the copy is the image
+// that was burned. Bytes read are reported through progress with the
+// phase "sha256".
+func Rip(ctx context.Context, t *Target, w io.Writer, progress ProgressFunc) (*RipResult, error) {
+	file, size, err := t.open()
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	result := &RipResult{Size: size, MediaSize: size}
+	if t.isMedia() {
+		if volume := isoVolumeSize(file); volume > 0 && volume < size {
+			result.Size = volume
+		}
+	}
+	sha, sum := sha256.New(), md5.New()
+	hashes := []io.Writer{w, sha, sum}
+	var implanted *isomd5.Writer
+	if pvd, err := isofs.ReadPVD(file); err == nil {
+		// Without a signature there is no implanted MD5 to check
+		if implanted, err = isomd5.NewWriter(pvd, result.Size); err == nil {
+			hashes = append(hashes, implanted)
+		}
+	}
+
+	reader := &progressReader{r: ctxio.NewReader(ctx, io.NewSectionReader(file, 0, result.Size)), phase: "sha256", item: t.String(), total: result.Size, progress: progress}
+	n, err := pipeline.CopyAhead(ctx, io.MultiWriter(hashes...), reader, t.readAhead())
+	if err != nil {
+		return nil, err
+	}
+	if n < result.Size {
+		return nil, io.ErrUnexpectedEOF
+	}
+	result.Sha256 = hex.EncodeToString(sha.Sum(nil))
+	result.MD5 = hex.EncodeToString(sum.Sum(nil))
+	if implanted != nil {
+		if result.Implanted, err = implanted.Result(); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
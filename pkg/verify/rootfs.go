@@ -0,0 +1,93 @@
+package verify
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pappasjfed/chkiso/internal/winpath"
+)
+
+// ErrOutsideRoot is returned when a path on the media resolves, through
+// symlinks or junctions, to a location outside the media root.
+var ErrOutsideRoot = errors.New("path resolves outside the media root")
+
+// rootFS serves the files below a directory like os.DirFS, but refuses to
+// open anything resolving outside its root. os.DirFS rejects ".." in names
+// but follows symlinks wherever they point, so a link on the media could
+// otherwise make chkiso hash, and vouch for, a file that is not on the media
+// at all. Paths are opened in extended-length form on Windows, so deep
+// trees are not cut off at MAX_PATH.
+type rootFS struct {
+	root     string // Root as given
+	realRoot string // Root with symlinks resolved
+}
+
+// RootFS returns the files below the directory root, like os.DirFS, but
+// refuses to open or stat a path whose target lies outside root once
+// symlinks are resolved.
+func RootFS(root string) fs.FS {
+	realRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		realRoot = filepath.Clean(root)
+	}
+	return &rootFS{root: root, realRoot: realRoot}
+}
+
+func (r *rootFS) Open(name string) (fs.File, error) {
+	full, err := r.contain("open", name)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(winpath.Long(full))
+	if err != nil {
+		return nil, relativeError(err, name)
+	}
+	return f, nil
+}
+
+func (r *rootFS) Stat(name string) (fs.FileInfo, error) {
+	full, err := r.contain("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(winpath.Long(full))
+	if err != nil {
+		return nil, relativeError(err, name)
+	}
+	return info, nil
+}
+
+// relativeError reports err against the name within the FS, as os.DirFS
+// does, rather than the full (possibly prefixed) path.
+func relativeError(err error, name string) error {
+	var pe *fs.PathError
+	if errors.As(err, &pe) {
+		return &fs.PathError{Op: pe.Op, Path: name, Err: pe.Err}
+	}
+	return err
+}
+
+// contain checks that name, after resolving symlinks, is within the root and
+// returns its full path. A name that does not exist is left for the open to
+// report.
+func (r *rootFS) contain(op, name string) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	full := filepath.Join(r.root, filepath.FromSlash(name))
+	resolved, err := filepath.EvalSymlinks(full)
+	if errors.Is(err, fs.ErrNotExist) {
+		return full, nil
+	}
+	if err != nil {
+		return "", &fs.PathError{Op: op, Path: name, Err: err}
+	}
+	rel, err := filepath.Rel(r.realRoot, resolved)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) || filepath.IsAbs(rel) {
+		return "", &fs.PathError{Op: op, Path: name, Err: ErrOutsideRoot}
+	}
+	return full, nil
+}
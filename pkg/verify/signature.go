@@ -0,0 +1,85 @@
+package verify
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"io/fs"
+	"time"
+
+	"github.com/pappasjfed/chkiso/pkg/manifest"
+)
+
+// ErrBadSignature is reported by Result.Failures for a checksum file whose
+// ed25519 signature the trusted signing key did not make.
+var ErrBadSignature = errors.New("checksum file signature is not valid")
+
+// SignatureStatus is the verdict for the detached signature of a checksum
+// file.
+type SignatureStatus string
+
+const (
+	SignatureValid     SignatureStatus = "VALID"     // Made by the trusted key over the checksum file as it is
+	SignatureInvalid   SignatureStatus = "INVALID"   // An ed25519 signature the trusted key did not make
+	SignatureUnchecked SignatureStatus = "UNCHECKED" // No trusted key, or a signature format chkiso cannot check
+	SignatureMissing   SignatureStatus = "MISSING"   // No signature next to the checksum file
+)
+
+// SignatureResult is the outcome of checking the signature of one checksum
+// file. Only raw ed25519 signatures, as `chkiso bundle` writes, are
+// checked; OpenPGP ones are reported as unchecked.
+type SignatureResult struct {
+	ChecksumFile string
+	File         string // Signature file, or "" if there is none
+	Status       SignatureStatus
+	Detail       string
+	// KeyCreated is when the trusted key was created, if known, so that
+	// a policy can limit its age.
+	KeyCreated time.Time
+}
+
+// checkSignatures checks the detached signature of each checksum file in
+// fsys against key, which must come from outside the media: a key found
+// next to the data it signs proves nothing about who wrote either.
+func checkSignatures(fsys fs.FS, checksumFiles []string, key ed25519.PublicKey, created time.Time) []SignatureResult {
+	var results []SignatureResult
+	for _, name := range checksumFiles {
+		sr := SignatureResult{ChecksumFile: name, Status: SignatureMissing, KeyCreated: created}
+		for _, ext := range manifest.SignatureExts {
+			if _, err := fs.Stat(fsys, name+ext); err == nil {
+				sr.File = name + ext
+				break
+			}
+		}
+		switch {
+		case sr.File == "":
+			sr.Detail = "not signed"
+		case key == nil:
+			sr.Status = SignatureUnchecked
+			sr.Detail = "no trusted signing key to check it against; give one with -pubkey"
+		default:
+			sr.Status, sr.Detail = checkSignature(fsys, name, sr.File, key)
+		}
+		results = append(results, sr)
+	}
+	return results
+}
+
+// checkSignature checks the signature file sigFile of checksumFile.
+func checkSignature(fsys fs.FS, checksumFile, sigFile string, key ed25519.PublicKey) (SignatureStatus, string) {
+	sig, err := fs.ReadFile(fsys, sigFile)
+	if err != nil {
+		return SignatureUnchecked, fmt.Sprintf("could not read the signature: %v", err)
+	}
+	if len(sig) != ed25519.SignatureSize {
+		return SignatureUnchecked, "not an ed25519 signature; OpenPGP signatures are not checked"
+	}
+	data, err := fs.ReadFile(fsys, checksumFile)
+	if err != nil {
+		return SignatureUnchecked, fmt.Sprintf("could not read the checksum file: %v", err)
+	}
+	if !ed25519.Verify(key, data, sig) {
+		return SignatureInvalid, "not made by the trusted key, or the checksum file was changed"
+	}
+	return SignatureValid, "signed by the trusted key"
+}
@@ -0,0 +1,82 @@
+package verify
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"time"
+)
+
+// ErrNoStamp is returned by ReadStamp for a file that was never stamped.
+var ErrNoStamp = errors.New("no verification stamp")
+
+// Stamp records that a file was verified. It is kept with the file itself,
+// in an extended attribute (an alternate data stream on Windows), so the
+// file carries its verification state when it is copied by tools that keep
+// them, and it can be looked up without a history file.
+type Stamp struct {
+	Tool      string    `json:"tool"`
+	Version   string    `json:"version"`
+	Verified  time.Time `json:"verified"`
+	Algorithm string    `json:"algorithm"`
+	Hash      string    `json:"hash"`             // The hash the file matched
+	Source    string    `json:"source,omitempty"` // The checksum file the hash was listed in, if any
+	Size      int64     `json:"size"`
+	ModTime   time.Time `json:"mtime"`
+}
+
+// WriteStamp stamps the regular file at path with s, recording the file's
+// size and modification time so a later change to the file shows.
+func WriteStamp(path string, s Stamp) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("%s is not a regular file", path)
+	}
+	s.Size, s.ModTime = info.Size(), info.ModTime().UTC()
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	return setStamp(path, data, info.ModTime())
+}
+
+// RemoveStamp removes the stamp of the file at path, if it has one, as when
+// the file fails verification.
+func RemoveStamp(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	return removeStamp(path, info.ModTime())
+}
+
+// ReadStamp returns the stamp of the file at path, or ErrNoStamp.
+func ReadStamp(path string) (*Stamp, error) {
+	data, err := getStamp(path)
+	if err != nil {
+		return nil, err
+	}
+	var s Stamp
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("unreadable verification stamp on %s: %v", path, err)
+	}
+	return &s, nil
+}
+
+// Current reports whether the file, described by info, still has the size
+// and modification time it had when it was stamped. A file changed since
+// then has to be verified again.
+func (s *Stamp) Current(info fs.FileInfo) bool {
+	return info.Size() == s.Size && info.ModTime().Equal(s.ModTime)
+}
+
+// String describes the stamp, such as "verified OK by chkiso 2.0.0 on
+// 2026-01-02 15:04:05 against sha256 <hash>".
+func (s *Stamp) String() string {
+	return fmt.Sprintf("verified OK by %s %s on %s against %s %s", s.Tool, s.Version, s.Verified.Local().Format("2006-01-02 15:04:05"), s.Algorithm, s.Hash)
+}
@@ -0,0 +1,8 @@
+//go:build darwin || freebsd || netbsd
+
+package verify
+
+import "golang.org/x/sys/unix"
+
+// errNoAttr is the error getxattr returns for a missing attribute.
+const errNoAttr = unix.ENOATTR
@@ -0,0 +1,6 @@
+package verify
+
+import "golang.org/x/sys/unix"
+
+// errNoAttr is the error getxattr returns for a missing attribute.
+const errNoAttr = unix.ENODATA
@@ -0,0 +1,23 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !windows
+
+package verify
+
+import (
+	"errors"
+	"time"
+)
+
+// setStamp is not supported: there are no extended attributes to use.
+func setStamp(path string, data []byte, mtime time.Time) error {
+	return errors.ErrUnsupported
+}
+
+// removeStamp has nothing to remove.
+func removeStamp(path string, mtime time.Time) error {
+	return nil
+}
+
+// getStamp is not supported: there are no extended attributes to use.
+func getStamp(path string) ([]byte, error) {
+	return nil, errors.ErrUnsupported
+}
@@ -0,0 +1,44 @@
+package verify
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"time"
+)
+
+// stampStream is the NTFS alternate data stream a Stamp is kept in.
+const stampStream = ":chkiso.verified"
+
+// setStamp writes data to the stamp stream of path. Writing a stream
+// updates the file's modification time, so it is set back to mtime.
+func setStamp(path string, data []byte, mtime time.Time) error {
+	if err := os.WriteFile(path+stampStream, data, 0644); err != nil {
+		return err
+	}
+	return os.Chtimes(path, time.Time{}, mtime)
+}
+
+// removeStamp deletes the stamp stream of path, if there is one, and sets
+// the file's modification time back to mtime.
+func removeStamp(path string, mtime time.Time) error {
+	if err := os.Remove(path + stampStream); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	return os.Chtimes(path, time.Time{}, mtime)
+}
+
+// getStamp reads the stamp stream of path, or returns ErrNoStamp.
+func getStamp(path string) ([]byte, error) {
+	data, err := os.ReadFile(path + stampStream)
+	if errors.Is(err, fs.ErrNotExist) {
+		if _, statErr := os.Stat(path); statErr != nil {
+			return nil, statErr
+		}
+		return nil, ErrNoStamp
+	}
+	return data, err
+}
@@ -0,0 +1,49 @@
+//go:build linux || darwin || freebsd || netbsd
+
+package verify
+
+import (
+	"errors"
+	"io/fs"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// stampAttr is the extended attribute a Stamp is kept in.
+const stampAttr = "user.chkiso.verified"
+
+// setStamp stores data in the stamp attribute of path. Extended attributes
+// do not change the file's modification time.
+func setStamp(path string, data []byte, _ time.Time) error {
+	if err := unix.Setxattr(path, stampAttr, data, 0); err != nil {
+		return &fs.PathError{Op: "setxattr", Path: path, Err: err}
+	}
+	return nil
+}
+
+// removeStamp removes the stamp attribute of path, if there is one.
+func removeStamp(path string, _ time.Time) error {
+	if err := unix.Removexattr(path, stampAttr); err != nil && !errors.Is(err, errNoAttr) {
+		return &fs.PathError{Op: "removexattr", Path: path, Err: err}
+	}
+	return nil
+}
+
+// getStamp returns the stamp attribute of path, or ErrNoStamp.
+func getStamp(path string) ([]byte, error) {
+	buf := make([]byte, 1024)
+	for {
+		n, err := unix.Getxattr(path, stampAttr, buf)
+		switch {
+		case errors.Is(err, errNoAttr):
+			return nil, ErrNoStamp
+		case errors.Is(err, unix.ERANGE):
+			buf = make([]byte, 2*len(buf))
+			continue
+		case err != nil:
+			return nil, &fs.PathError{Op: "getxattr", Path: path, Err: err}
+		}
+		return buf[:n], nil
+	}
+}
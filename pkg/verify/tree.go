@@ -0,0 +1,163 @@
+package verify
+
+import (
+	"context"
+	"io/fs"
+	"sort"
+	"strings"
+
+	"github.com/pappasjfed/chkiso/pkg/manifest"
+)
+
+// TreeDiff is the outcome of comparing two file trees with CompareTrees.
+type TreeDiff struct {
+	Same      int        // Files with the same contents in both trees
+	Missing   []string   // Files only in the first tree
+	Extra     []string   // Files only in the second tree
+	Different []TreeFile // Files in both trees whose contents differ
+	Errors    []TreeFile // Files or directories that could not be read
+}
+
+// TreeFile is a file of both trees that differs, or one that could not be
+// compared.
+type TreeFile struct {
+	Name         string
+	SizeA, SizeB int64
+	HashA, HashB string // SHA256 of each side, unless the sizes already differ
+	Err          error
+}
+
+// OK reports whether the trees hold the same files with the same contents.
+func (d *TreeDiff) OK() bool {
+	return len(d.Missing)+len(d.Extra)+len(d.Different)+len(d.Errors) == 0
+}
+
+// CompareTrees compares the regular files of a and b by path, size and
+// SHA256, such as a master folder and the copy of it on a USB stick, or an
+// ISO image and the directory it was mastered from. Other kinds of files,
+// such as symlinks, and empty directories are not compared. A path found in
+// the other tree only in another case, as plain ISO 9660 names are upper
+// case, is the same file if no other path there differs from it only in
+// case. Each file is reported through progress before it is read. It
+// returns ctx.Err() if ctx is cancelled.
+func CompareTrees(ctx context.Context, a, b fs.FS, progress ProgressFunc) (*TreeDiff, error) {
+	if progress == nil {
+		progress = func(Progress) {}
+	}
+	diff := &TreeDiff{}
+	filesA, err := treeFiles(ctx, a, diff)
+	if err != nil {
+		return nil, err
+	}
+	filesB, err := treeFiles(ctx, b, diff)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(filesA))
+	for name := range filesA {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	matched := matchTreeNames(names, filesB)
+	for _, name := range names {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		nameB, ok := matched[name]
+		if !ok {
+			diff.Missing = append(diff.Missing, name)
+			continue
+		}
+		progress(Progress{Phase: "compare", Item: name})
+		f := TreeFile{Name: name, SizeA: filesA[name], SizeB: filesB[nameB]}
+		if f.SizeA != f.SizeB {
+			diff.Different = append(diff.Different, f)
+			continue
+		}
+		if f.HashA, f.Err = FSFileHash(ctx, a, name, manifest.SHA256); f.Err == nil {
+			f.HashB, f.Err = FSFileHash(ctx, b, nameB, manifest.SHA256)
+		}
+		switch {
+		case ctx.Err() != nil:
+			return nil, ctx.Err()
+		case f.Err != nil:
+			diff.Errors = append(diff.Errors, f)
+		case f.HashA != f.HashB:
+			diff.Different = append(diff.Different, f)
+		default:
+			diff.Same++
+		}
+	}
+	taken := make(map[string]bool)
+	for _, nameB := range matched {
+		taken[nameB] = true
+	}
+	for name := range filesB {
+		if !taken[name] {
+			diff.Extra = append(diff.Extra, name)
+		}
+	}
+	sort.Strings(diff.Extra)
+	return diff, nil
+}
+
+// matchTreeNames pairs each of names with the path of files naming the same
+// file: the same path, or else the only unpaired one differing in case.
+func matchTreeNames(names []string, files map[string]int64) map[string]string {
+	matched := make(map[string]string)
+	taken := make(map[string]bool)
+	for _, name := range names {
+		if _, ok := files[name]; ok {
+			matched[name] = name
+			taken[name] = true
+		}
+	}
+	folded := make(map[string][]string)
+	for name := range files {
+		if !taken[name] {
+			folded[strings.ToLower(name)] = append(folded[strings.ToLower(name)], name)
+		}
+	}
+	unmatched := make(map[string][]string)
+	for _, name := range names {
+		if _, ok := matched[name]; !ok {
+			unmatched[strings.ToLower(name)] = append(unmatched[strings.ToLower(name)], name)
+		}
+	}
+	for key, candidates := range folded {
+		if len(candidates) == 1 && len(unmatched[key]) == 1 {
+			matched[unmatched[key][0]] = candidates[0]
+		}
+	}
+	return matched
+}
+
+// treeFiles returns the size of every regular file in fsys by path. Entries
+// that cannot be read are added to diff.Errors.
+func treeFiles(ctx context.Context, fsys fs.FS, diff *TreeDiff) (map[string]int64, error) {
+	files := make(map[string]int64)
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		if err != nil {
+			diff.Errors = append(diff.Errors, TreeFile{Name: name, Err: err})
+			if d != nil && d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			diff.Errors = append(diff.Errors, TreeFile{Name: name, Err: err})
+			return nil
+		}
+		files[name] = info.Size()
+		return nil
+	})
+	return files, err
+}
@@ -0,0 +1,789 @@
+package verify
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"path"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/pappasjfed/chkiso/internal/ctxio"
+	"github.com/pappasjfed/chkiso/pkg/dmg"
+	"github.com/pappasjfed/chkiso/pkg/hashset"
+	"github.com/pappasjfed/chkiso/pkg/isomd5"
+	"github.com/pappasjfed/chkiso/pkg/jigdo"
+	"github.com/pappasjfed/chkiso/pkg/manifest"
+	"github.com/pappasjfed/chkiso/pkg/wim"
+)
+
+// Steps run by a Verifier, reported in "begin" and "end" progress events.
+const (
+	StepLabel    = "label"
+	StepSize     = "size"
+	StepSha256   = "sha256"
+	StepMD5      = "md5"
+	StepDMG      = "dmg"
+	StepWIM      = "wim"
+	StepJigdo    = "jigdo"
+	StepESP      = "esp"
+	StepBoot     = "bootconfig"
+	StepKernels  = "kernels"
+	StepContents = "contents"
+	StepHashSet  = "hashset"
+)
+
+// Options selects which checks a Verifier runs.
+type Options struct {
+	// ExpectLabel is the volume label the target's ISO 9660 volume must
+	// have, compared ignoring case before anything is hashed. A different
+	// label, as when the wrong disc is in the drive, fails the run and
+	// skips the remaining checks, unless LabelWarnOnly only warns about it.
+	ExpectLabel   string
+	LabelWarnOnly bool
+
+	// ExpectSize is the size in bytes the target must have as stored, which
+	// is checked before anything is hashed so that a truncated download
+	// fails at once, skipping the remaining checks.
+	ExpectSize int64
+
+	// ExpectedSha256 is compared against the target's hash. When empty the
+	// hash is still calculated and reported for information.
+	// ExpectedFromName says it was taken from the target's own file name,
+	// which whoever named the file chose, so a match proves no origin.
+	ExpectedSha256   string
+	ExpectedFromName bool
+
+	ImplantedMD5 bool // Check the MD5 implanted by implantisomd5
+	Contents     bool // Verify files on the media against its checksum files
+
+	// Manifests names checksum files (slash-separated, relative to the media
+	// root) to verify instead of searching for them.
+	Manifests []string
+	// RootOnly limits checksum file discovery to the media root, and
+	// MaxDepth (if non-zero) to that many directory levels below it.
+	RootOnly bool
+	MaxDepth int
+
+	// Strict fails content verification when there was nothing to verify:
+	// no checksum files were found, the contents could not be read, or the
+	// checksum files listed no files.
+	Strict bool
+
+	// WholeDevice hashes every byte of a drive instead of only the ISO data
+	// area its Primary Volume Descriptor declares.
+	WholeDevice bool
+
+	// Offset and Length, when either is set, hash only that byte range of
+	// the target (Length 0 reads to the end) instead of the whole image.
+	Offset int64
+	Length int64
+
+	// AlternateSha256 lists further accepted hashes, such as those of other
+	// respins of the same release. The target passes if it matches
+	// ExpectedSha256 or any of them.
+	AlternateSha256 []string
+
+	// ExpectedMD5 is an MD5 of the whole target, from a hash file that
+	// offers nothing stronger. It is calculated in the same pass as the
+	// SHA256.
+	ExpectedMD5 string
+
+	// Jigdo is a .jigdo file to verify the target against, with the
+	// template it names.
+	Jigdo string
+
+	// ScanDamage looks for long runs of zero bytes or of one sector
+	// repeated while the whole target is hashed, and reports where they are
+	// in Result.Damage: signs of a bad burn or a failing drive.
+	ScanDamage bool
+
+	// SkipImageHash skips hashing the whole target when no ExpectedSha256
+	// is given, since that hash is only informational.
+	SkipImageHash bool
+
+	// FIPS restricts verification to FIPS approved algorithms: checksum
+	// entries using other algorithms are skipped, and the implanted MD5
+	// check is refused.
+	FIPS bool
+
+	// MaxRate, if set, limits reading the target to that many bytes per
+	// second, so that verifying an image on a shared network drive does not
+	// take all of its bandwidth.
+	MaxRate int64
+
+	// FileTimeout, if set, fails hashing a file on the media that takes
+	// longer, so a file on a dying drive or a hung share is reported as an
+	// error instead of blocking the run.
+	FileTimeout time.Duration
+
+	// Jobs is how many files on the media are hashed at once; 0 or 1
+	// hashes them one after another. Results are reported in the order the
+	// checksum files list them, unless Unordered reports each file as soon
+	// as it is done. Result.Contents.Files is in listed order either way.
+	Jobs      int
+	Unordered bool
+
+	// ESP finds the EFI System Partition of an image, lists and hashes its
+	// files, and compares its EFI executables with those of the same paths
+	// in the ISO 9660 tree.
+	ESP bool
+
+	// BootConfig checks that the kernels, initrds and modules the boot
+	// loader configuration files on the media name are there, and match
+	// the checksum files listing them.
+	BootConfig bool
+
+	// Kernels lists the kernels and initrds on the media with their hashes,
+	// comparing them with KernelSums, a checksum file of published hashes,
+	// if given, or else with the checksum files on the media.
+	Kernels    bool
+	KernelSums string
+
+	// HashSet is a reference hash set of known software, such as the
+	// NSRL's RDS. Every file on the media is hashed in its algorithm and
+	// looked up there, to tell known files from the rest.
+	HashSet string
+
+	// SigningKey, if set, is the trusted ed25519 key the detached
+	// signatures of checksum files are checked against. It must come from
+	// outside the media, never from a key file on it. SigningKeyCreated is
+	// when it was made, if known.
+	SigningKey        ed25519.PublicKey
+	SigningKeyCreated time.Time
+
+	// Cache, if set, supplies the hashes of files unchanged since an earlier
+	// run and records the hashes calculated in this one. The caller saves it.
+	Cache *Cache
+
+	Progress ProgressFunc
+}
+
+// Errors reported by Result.Failures for checks that ran but did not pass.
+var (
+	ErrLabelMismatch    = errors.New("volume label does not match")
+	ErrSizeMismatch     = errors.New("size does not match")
+	ErrHashMismatch     = errors.New("SHA256 hash does not match")
+	ErrMD5Mismatch      = errors.New("implanted MD5 does not match")
+	ErrImageMD5Mismatch = errors.New("MD5 hash does not match")
+	ErrContentFailed    = errors.New("content verification failed")
+	ErrManifestConflict = errors.New("checksum files disagree")
+	ErrNothingToCheck   = errors.New("no files on the media could be verified")
+	ErrNotApproved      = errors.New("not available in FIPS mode")
+	ErrDMGChecksum      = errors.New("embedded DMG checksum does not match")
+	ErrWIMIntegrity     = errors.New("WIM integrity check failed")
+	ErrJigdoMismatch    = errors.New("image does not match its jigdo template")
+	ErrESPMismatch      = errors.New("EFI System Partition does not match the ISO 9660 tree")
+	ErrBootConfig       = errors.New("boot loader configuration names missing or damaged files")
+	ErrKernelMismatch   = errors.New("kernel or initrd does not match its checksum")
+)
+
+// StepError records a check that could not be completed.
+type StepError struct {
+	Step string
+	Err  error
+}
+
+func (e *StepError) Error() string { return fmt.Sprintf("%s: %v", e.Step, e.Err) }
+func (e *StepError) Unwrap() error { return e.Err }
+
+// Result is everything a verification run found out about a target.
+type Result struct {
+	Target     string
+	Label      *LabelResult   // Set when an expected volume label was given
+	Size       *SizeResult    // Set when an expected size was given
+	Sha256     string         // Calculated SHA256 of the whole target
+	Hash       *HashResult    // Set when an expected SHA256 was given
+	ImageMD5   *HashResult    // Set when an expected MD5 of the whole target was given
+	MD5        *isomd5.Result // Set when the implanted MD5 was checked
+	DMG        *dmg.Result    // Set when the checksums embedded in a DMG were checked
+	WIM        *wim.Result    // Set when a WIM's integrity table and resources were checked
+	Jigdo      *jigdo.Result  // Set when the target was checked against a jigdo template
+	ESP        *ESPResult     // Set when the EFI System Partition was found and read
+	Boot       *BootResult    // Set when boot loader configuration files were found
+	Kernels    *KernelResult  // Set when kernels or initrds were found
+	Contents   *ContentResult // Set when checksum files were processed
+	HashSet    *HashSetResult // Set when the files were looked up in a reference hash set
+	Damage     []DamageRun    // Suspicious runs found with ScanDamage
+	MountedISO bool           // An ISO we mounted could not be unmounted again
+	NeedsMount bool           // Contents were skipped; the ISO has to be mounted first
+	DataVolume *DataVolume    // Set when the target is a drive or device holding an ordinary file system
+	Warnings   []string
+	Errors     []*StepError
+
+	// CompressedSha256 is the SHA256 of a compressed image's file, while
+	// Sha256 is that of the image inside it.
+	CompressedSha256 string
+}
+
+// Err returns the error that stopped step, if any.
+func (r *Result) Err(step string) error {
+	for _, e := range r.Errors {
+		if e.Step == step {
+			return e.Err
+		}
+	}
+	return nil
+}
+
+// Failures returns one error per failed check: checks that could not run,
+// hash mismatches, and content files that failed verification. Each can be
+// matched with errors.Is against the Err* values.
+func (r *Result) Failures() []error {
+	var failures []error
+	for _, e := range r.Errors {
+		failures = append(failures, e)
+	}
+	if r.Hash != nil && !r.Hash.Match {
+		failures = append(failures, ErrHashMismatch)
+	}
+	if r.ImageMD5 != nil && !r.ImageMD5.Match {
+		failures = append(failures, ErrImageMD5Mismatch)
+	}
+	if r.MD5 != nil && !r.MD5.IsIntegrityOK {
+		failures = append(failures, ErrMD5Mismatch)
+	}
+	if r.DMG != nil && !r.DMG.OK() {
+		failures = append(failures, ErrDMGChecksum)
+	}
+	if r.WIM != nil && !r.WIM.OK() {
+		failures = append(failures, fmt.Errorf("%w: %s", ErrWIMIntegrity, r.WIM.Problems[0]))
+	}
+	if r.Jigdo != nil && !r.Jigdo.OK() {
+		failures = append(failures, ErrJigdoMismatch)
+	}
+	if r.ESP != nil && !r.ESP.OK() {
+		failures = append(failures, fmt.Errorf("%w: %s", ErrESPMismatch, r.ESP.Problems[0]))
+	}
+	if r.Boot != nil && !r.Boot.OK() {
+		failures = append(failures, fmt.Errorf("%w: %s", ErrBootConfig, r.Boot.Problems()[0]))
+	}
+	if r.Kernels != nil && !r.Kernels.OK() {
+		for _, b := range r.Kernels.Images {
+			if !b.Match() {
+				failures = append(failures, fmt.Errorf("%w: %s", ErrKernelMismatch, b.Path))
+			}
+		}
+	}
+	if r.Contents != nil {
+		for _, sig := range r.Contents.Signatures {
+			if sig.Status == SignatureInvalid {
+				failures = append(failures, fmt.Errorf("%w: %s", ErrBadSignature, sig.File))
+			}
+		}
+	}
+	if r.Contents != nil && r.Contents.Conflicts > 0 {
+		failures = append(failures, fmt.Errorf("%w: %d file(s) listed with different hashes", ErrManifestConflict, r.Contents.Conflicts))
+	}
+	if r.Contents != nil && r.Contents.Failed > r.Contents.conflictEntries {
+		failures = append(failures, fmt.Errorf("%w: %d out of %d files", ErrContentFailed, r.Contents.Failed-r.Contents.conflictEntries, r.Contents.Total))
+	}
+	return failures
+}
+
+// OK reports whether every check that ran succeeded.
+func (r *Result) OK() bool {
+	return len(r.Failures()) == 0
+}
+
+// Strength of the integrity evidence behind a result, from Result.Evidence.
+const (
+	EvidenceNone   = "none"
+	EvidenceWeak   = "weak"
+	EvidenceStrong = "strong"
+)
+
+// Evidence rates what the passing checks of a result prove. A matching
+// expected SHA256 that did not come from the file name, a WIM whose SHA-1
+// integrity table or resource hashes matched, a jigdo 2.x template's SHA256,
+// or a file verified with SHA-1 or stronger, is strong evidence. A valid
+// implanted MD5, a matching MD5 of the whole target, the CRC32s embedded in
+// a DMG, a jigdo 1.x template's MD5 and files verified with MD5 or CRC32
+// only detect accidental corruption, since collisions for them can be
+// constructed, and a SHA256 from the image's own file name authenticates
+// nothing, so when they are all there is the evidence is weak.
+func (r *Result) Evidence() string {
+	if r.Hash != nil && r.Hash.Match && !r.Hash.FromName {
+		return EvidenceStrong
+	}
+	if r.WIM != nil && r.WIM.OK() && (r.WIM.Integrity || r.WIM.ResourcesChecked > 0) {
+		return EvidenceStrong
+	}
+	if r.Jigdo != nil && r.Jigdo.OK() && r.Jigdo.Algorithm == "sha256" {
+		return EvidenceStrong
+	}
+	evidence := EvidenceNone
+	if r.Hash != nil && r.Hash.Match {
+		evidence = EvidenceWeak
+	}
+	if r.MD5 != nil && r.MD5.IsIntegrityOK {
+		evidence = EvidenceWeak
+	}
+	if r.ImageMD5 != nil && r.ImageMD5.Match {
+		evidence = EvidenceWeak
+	}
+	if r.DMG != nil && len(r.DMG.Checks) > 0 && r.DMG.OK() {
+		evidence = EvidenceWeak
+	}
+	if r.Jigdo != nil && r.Jigdo.OK() {
+		evidence = EvidenceWeak
+	}
+	if r.Contents != nil {
+		for _, f := range r.Contents.Files {
+			if f.Status != FileOK {
+				continue
+			}
+			if manifest.Strength(f.Algorithm) > manifest.Strength(manifest.MD5) {
+				return EvidenceStrong
+			}
+			evidence = EvidenceWeak
+		}
+	}
+	return evidence
+}
+
+// dismountTimeout bounds unmounting an ISO we mounted during cleanup.
+const dismountTimeout = time.Minute
+
+// Verifier runs the checks selected by its Options against a target.
+type Verifier struct {
+	opts Options
+}
+
+// New returns a Verifier for opts.
+func New(opts Options) *Verifier {
+	if opts.Progress == nil {
+		opts.Progress = func(Progress) {}
+	}
+	return &Verifier{opts: opts}
+}
+
+// Run verifies target. Failed checks are recorded in the Result rather than
+// returned; the error is only non-nil if ctx was cancelled, in which case the
+// partial Result is returned alongside it.
+func (v *Verifier) Run(ctx context.Context, target *Target) (*Result, error) {
+	ctx = ctxio.WithMaxRate(ctx, v.opts.MaxRate)
+	result := &Result{Target: target.String()}
+	progress := v.opts.Progress
+	warn := func(msg string) {
+		result.Warnings = append(result.Warnings, msg)
+		progress(Progress{Phase: "warning", Item: msg})
+	}
+	fail := func(step string, err error) {
+		result.Errors = append(result.Errors, &StepError{Step: step, Err: err})
+	}
+	// A step sets stop when the remaining ones are not worth running
+	stop := false
+
+	for _, w := range Plausibility(target) {
+		warn(w)
+	}
+	// A USB stick or disk holding files is verified through its file system
+	if result.DataVolume = target.DataVolume(); result.DataVolume != nil {
+		progress(Progress{Phase: "info", Item: fmt.Sprintf("%s holds %s rather than an ISO image; its files are verified, not its raw bytes.", target, result.DataVolume)})
+	}
+
+	steps := []struct {
+		name    string
+		enabled bool
+		run     func()
+	}{
+		{StepLabel, v.opts.ExpectLabel != "", func() {
+			label, err := VolumeLabel(target)
+			if err == nil {
+				result.Label = &LabelResult{
+					Expected: v.opts.ExpectLabel,
+					Found:    label,
+					Match:    sameLabel(label, v.opts.ExpectLabel),
+				}
+				if result.Label.Match {
+					return
+				}
+				err = fmt.Errorf("%w: the media is %q, not %q", ErrLabelMismatch, label, v.opts.ExpectLabel)
+			}
+			if v.opts.LabelWarnOnly {
+				warn(fmt.Sprintf("Volume label check: %v", err))
+				return
+			}
+			fail(StepLabel, err)
+			stop = true
+		}},
+		{StepSize, v.opts.ExpectSize > 0, func() {
+			size, err := target.RawSize()
+			if err != nil {
+				fail(StepSize, err)
+				stop = true
+				return
+			}
+			result.Size = &SizeResult{Expected: v.opts.ExpectSize, Found: size}
+			if !result.Size.Match() {
+				fail(StepSize, fmt.Errorf("%w: %d bytes, expected %d", ErrSizeMismatch, size, v.opts.ExpectSize))
+				stop = true
+			}
+		}},
+		{StepSha256, v.opts.ExpectedSha256 != "" || v.opts.ExpectedMD5 != "" || !(v.opts.SkipImageHash || target.IsDir || result.DataVolume != nil) || v.hashRange().partial() || v.scanDamage(target), func() {
+			var imageMD5 hash.Hash
+			var also []io.Writer
+			if v.opts.ExpectedMD5 != "" {
+				imageMD5 = md5.New()
+				also = append(also, imageMD5)
+			}
+			var damage *damageScanner
+			if v.scanDamage(target) {
+				damage = &damageScanner{}
+				also = append(also, damage)
+				// What was read before an error helps find the damage
+				defer func() { result.Damage = damage.runs }()
+			}
+			if v.opts.ExpectedSha256 != "" {
+				candidates := append([]string{v.opts.ExpectedSha256}, v.opts.AlternateSha256...)
+				hash, err := compareSha256(ctx, target, candidates, v.hashRange(), progress, also...)
+				if err != nil {
+					fail(StepSha256, err)
+					return
+				}
+				hash.FromName = v.opts.ExpectedFromName
+				result.Hash = hash
+				result.Sha256 = hash.Calculated
+				result.CompressedSha256 = hash.Compressed
+			} else {
+				sum, compressed, err := hashTarget(ctx, target, v.hashRange(), progress, also...)
+				if err != nil {
+					fail(StepSha256, err)
+					return
+				}
+				result.Sha256 = sum
+				result.CompressedSha256 = compressed
+			}
+			if imageMD5 != nil {
+				expected := strings.ToLower(strings.TrimSpace(v.opts.ExpectedMD5))
+				calculated := hex.EncodeToString(imageMD5.Sum(nil))
+				result.ImageMD5 = &HashResult{Expected: expected, Calculated: calculated, Match: calculated == expected}
+			}
+		}},
+		{StepMD5, v.opts.ImplantedMD5, func() {
+			if v.opts.FIPS {
+				fail(StepMD5, fmt.Errorf("implanted MD5 check %w", ErrNotApproved))
+				return
+			}
+			md5Result, err := ImplantedMD5(ctx, target)
+			if errors.Is(err, isomd5.ErrNoSignature) {
+				warn("No 'ISO MD5SUM' signature found.")
+				return
+			}
+			if err != nil {
+				fail(StepMD5, err)
+				return
+			}
+			result.MD5 = md5Result
+		}},
+		{StepDMG, target.IsDMG(), func() {
+			if v.opts.FIPS {
+				warn("Skipped the checksums embedded in the DMG, which are CRC32 and not approved in FIPS mode.")
+				return
+			}
+			dmgResult, err := DMGChecksums(ctx, target)
+			if err != nil {
+				fail(StepDMG, err)
+				return
+			}
+			result.DMG = dmgResult
+		}},
+		{StepWIM, target.IsWIM(), func() {
+			if v.opts.FIPS {
+				warn("Skipped the WIM integrity check, which uses SHA-1 and is not approved in FIPS mode.")
+				return
+			}
+			wimResult, err := WIMIntegrity(ctx, target)
+			if err != nil {
+				fail(StepWIM, err)
+				return
+			}
+			result.WIM = wimResult
+		}},
+		{StepJigdo, v.opts.Jigdo != "", func() {
+			jigdoResult, err := JigdoCheck(ctx, target, v.opts.Jigdo, v.opts.FIPS, progress)
+			if err != nil {
+				fail(StepJigdo, err)
+				return
+			}
+			result.Jigdo = jigdoResult
+		}},
+		{StepESP, v.opts.ESP, func() {
+			if !target.HasESP() {
+				warn(fmt.Sprintf("%s is not an image or device, so it has no EFI System Partition to check.", target))
+				return
+			}
+			espResult, err := ESP(ctx, target)
+			if errors.Is(err, ErrNoESP) {
+				warn("No EFI System Partition found; the image does not boot UEFI firmware.")
+				return
+			}
+			if err != nil {
+				fail(StepESP, err)
+				return
+			}
+			result.ESP = espResult
+			if len(espResult.BootLoaders()) == 0 {
+				warn("The EFI System Partition has no EFI/BOOT/BOOT<arch>.EFI, the boot loader firmware looks for on removable media.")
+			}
+		}},
+		{StepBoot, v.opts.BootConfig, func() {
+			fsys, closer, err := target.OpenFS()
+			if err != nil {
+				fail(StepBoot, err)
+				return
+			}
+			defer closer.Close()
+			boot, err := BootConfig(ctx, fsys, v.opts.FIPS)
+			if err != nil {
+				fail(StepBoot, err)
+				return
+			}
+			if boot == nil {
+				warn("No boot loader configuration (isolinux.cfg, syslinux.cfg, grub.cfg or BOOT.CFG) found on the media.")
+				return
+			}
+			result.Boot = boot
+		}},
+		{StepKernels, v.opts.Kernels, func() {
+			fsys, closer, err := target.OpenFS()
+			if err != nil {
+				fail(StepKernels, err)
+				return
+			}
+			defer closer.Close()
+			kernels, err := Kernels(ctx, fsys, v.opts.KernelSums, v.opts.FIPS)
+			if err != nil {
+				fail(StepKernels, err)
+				return
+			}
+			if kernels == nil {
+				warn("No kernels or initrds found on the media.")
+				return
+			}
+			result.Kernels = kernels
+		}},
+		{StepContents, v.opts.Contents, func() {
+			v.runContents(ctx, target, result, warn, fail)
+		}},
+		{StepHashSet, v.opts.HashSet != "", func() {
+			set, err := hashset.Open(v.opts.HashSet)
+			if err != nil {
+				fail(StepHashSet, err)
+				return
+			}
+			defer set.Close()
+			if v.opts.FIPS && !manifest.FIPSApproved(set.Algorithm) {
+				fail(StepHashSet, fmt.Errorf("%s hash set %w", strings.ToUpper(set.Algorithm), ErrNotApproved))
+				return
+			}
+			fsys, closer, err := target.OpenFS()
+			if err != nil {
+				fail(StepHashSet, err)
+				return
+			}
+			defer closer.Close()
+			hashSet, err := HashSet(ctx, fsys, set)
+			if err != nil {
+				fail(StepHashSet, err)
+				return
+			}
+			result.HashSet = hashSet
+		}},
+	}
+
+	for _, step := range steps {
+		if !step.enabled {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+		progress(Progress{Phase: "begin", Item: step.name, Result: result})
+		step.run()
+		progress(Progress{Phase: "end", Item: step.name, Result: result})
+		if stop {
+			break
+		}
+	}
+	return result, ctx.Err()
+}
+
+// scanDamage reports whether the whole of target is to be scanned for
+// damage; a partial hash does not read all of it.
+func (v *Verifier) scanDamage(target *Target) bool {
+	return v.opts.ScanDamage && !target.IsDir && !v.hashRange().partial()
+}
+
+func (v *Verifier) hashRange() hashRange {
+	return hashRange{WholeDevice: v.opts.WholeDevice, Offset: v.opts.Offset, Length: v.opts.Length}
+}
+
+// runContents opens the target's files, finds its checksum files, and
+// verifies the files they list. ISO images are read in-process; on Windows an
+// image that cannot be read that way is mounted with PowerShell instead.
+func (v *Verifier) runContents(ctx context.Context, target *Target, result *Result, warn func(string), fail func(string, error)) {
+	progress := v.opts.Progress
+	info := func(format string, args ...interface{}) {
+		progress(Progress{Phase: "info", Item: fmt.Sprintf(format, args...)})
+	}
+
+	if target.IsDrive && runtime.GOOS != "windows" {
+		fail(StepContents, fmt.Errorf("drive verification is only supported on Windows"))
+		return
+	}
+
+	if target.IsWIM() {
+		// A WIM is a file archive of its own, checked by its integrity step
+		info("WIM images hold no ISO 9660 file system; their contents are covered by the WIM integrity check.")
+		v.nothingToCheck(result, fail)
+		return
+	}
+
+	root := target.String()
+	fsys, closer, err := target.OpenFS()
+	switch {
+	case err == nil:
+		defer closer.Close()
+		switch {
+		case target.IsDrive:
+			root = target.Root()
+			info("Verifying contents of physical drive at: %s", root)
+		case target.IsDir:
+			root = target.Root()
+			info("Verifying contents of directory: %s", root)
+		case target.IsDevice && result.DataVolume != nil:
+			root = result.DataVolume.Root
+			info("Verifying contents of device %s, mounted at: %s", target.Path, root)
+		case target.IsDevice:
+			info("Reading contents of device: %s", target.Path)
+		default:
+			info("Reading contents of image: %s", target.ImagePath())
+		}
+	case target.isMedia() || target.IsDir:
+		fail(StepContents, err)
+		return
+	case runtime.GOOS != "windows" || len(target.Parts) > 0 || target.Compression != "" || target.IsDMG() || target.narrowed():
+		// Split, compressed, DMG and Nero images, and partitions, cannot be
+		// mounted either
+		warn(fmt.Sprintf("Could not read image contents: %v", err))
+		result.NeedsMount = true
+		v.nothingToCheck(result, fail)
+		return
+	default:
+		info("Mounting ISO: %s", target.Path)
+		driveLetter, err := MountISO(ctx, target.Path)
+		if err != nil {
+			warn(fmt.Sprintf("Failed to mount ISO automatically: %v", err))
+			result.NeedsMount = true
+			v.nothingToCheck(result, fail)
+			return
+		}
+		result.MountedISO = true
+		root = fmt.Sprintf("%s:\\", driveLetter)
+		fsys = RootFS(root)
+		info("Mounted to drive: %s:", driveLetter)
+
+		// Ensure cleanup happens even if verification fails or is cancelled,
+		// so it gets its own context rather than the caller's
+		defer func() {
+			info("Unmounting ISO...")
+			cleanupCtx, cancel := context.WithTimeout(context.Background(), dismountTimeout)
+			defer cancel()
+			if err := DismountISO(cleanupCtx, target.Path); err != nil {
+				warn(fmt.Sprintf("Failed to unmount ISO: %v", err))
+				info("Please dismount manually using: Dismount-DiskImage -ImagePath '%s'", target.Path)
+				return
+			}
+			info("ISO unmounted successfully.")
+			result.MountedISO = false
+		}()
+	}
+
+	checksumFiles, err := v.discover(ctx, fsys, root, warn)
+	if err != nil {
+		warn(fmt.Sprintf("Error finding checksum files: %v", err))
+		v.nothingToCheck(result, fail)
+		return
+	}
+	if len(checksumFiles) == 0 {
+		warn(fmt.Sprintf("Could not find any checksum files (%s) on the media.", manifest.Patterns))
+		v.nothingToCheck(result, fail)
+		return
+	}
+
+	result.Contents = &ContentResult{Root: root, ChecksumFiles: checksumFiles}
+	progress(Progress{Phase: "discovered", Item: root, Result: result})
+	cache, err := v.opts.Cache.scope(target)
+	if err != nil {
+		warn(fmt.Sprintf("%v; verifying all files", err))
+	}
+	copts := contentOptions{
+		cache:       cache,
+		fips:        v.opts.FIPS,
+		fileTimeout: v.opts.FileTimeout,
+		jobs:        v.opts.Jobs,
+		unordered:   v.opts.Unordered,
+		signingKey:  v.opts.SigningKey,
+		keyCreated:  v.opts.SigningKeyCreated,
+	}
+	if copts.jobs > 1 && target.readAhead() > 1 {
+		info("Optical drive: hashing one file at a time, as reading several at once would make it seek")
+		copts.jobs = 1
+	}
+	contents := verifyContents(ctx, fsys, checksumFiles, copts, progress)
+	contents.Root = root
+	result.Contents = contents
+	if contents.Total == 0 {
+		v.nothingToCheck(result, fail)
+	}
+}
+
+// nothingToCheck records a failure in strict mode when content verification
+// had nothing to verify; otherwise the preceding warning stands on its own.
+func (v *Verifier) nothingToCheck(result *Result, fail func(string, error)) {
+	if v.opts.Strict {
+		fail(StepContents, ErrNothingToCheck)
+	}
+}
+
+// discover returns the checksum files to verify: the explicitly named ones if
+// any were given, otherwise those found within the configured depth.
+func (v *Verifier) discover(ctx context.Context, fsys fs.FS, root string, warn func(string)) ([]string, error) {
+	progress := v.opts.Progress
+	if len(v.opts.Manifests) > 0 {
+		var checksumFiles []string
+		for _, name := range v.opts.Manifests {
+			name = strings.TrimPrefix(path.Clean(strings.ReplaceAll(name, "\\", "/")), "/")
+			if _, err := fs.Stat(fsys, name); err != nil {
+				warn(fmt.Sprintf("Checksum file not found on the media: %s", name))
+				continue
+			}
+			checksumFiles = append(checksumFiles, name)
+		}
+		return checksumFiles, nil
+	}
+
+	scope := "all directories"
+	if v.opts.RootOnly {
+		scope = "the root directory"
+	} else if v.opts.MaxDepth > 0 {
+		scope = fmt.Sprintf("up to %d directory level(s) deep", v.opts.MaxDepth)
+	}
+	progress(Progress{Phase: "info", Item: fmt.Sprintf("Searching for checksum files (%s) in %s, %s...", manifest.Patterns, root, scope)})
+	return manifest.FindFS(ctx, fsys, manifest.FindOptions{
+		RootOnly: v.opts.RootOnly,
+		MaxDepth: v.opts.MaxDepth,
+		Warn: func(path string, err error) {
+			warn(fmt.Sprintf("Could not access %s: %v", path, err))
+		},
+	})
+}
@@ -0,0 +1,1230 @@
+// Package verify orchestrates chkiso's checks: whole-image hashing, implanted
+// MD5 verification, and content verification against checksum files.
+package verify
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pappasjfed/chkiso/internal/ctxio"
+	"github.com/pappasjfed/chkiso/internal/decompress"
+	"github.com/pappasjfed/chkiso/internal/pipeline"
+	"github.com/pappasjfed/chkiso/pkg/isofs"
+	"github.com/pappasjfed/chkiso/pkg/isomd5"
+	"github.com/pappasjfed/chkiso/pkg/manifest"
+	"golang.org/x/text/unicode/norm"
+)
+
+var (
+	drivePattern  = regexp.MustCompile(`^([A-Za-z]):\\?$`)
+	sha256Pattern = regexp.MustCompile(`^[a-fA-F0-9]{64}$`)
+)
+
+// Target is the image file, drive or directory being verified.
+type Target struct {
+	Path        string // Absolute path of the image file or directory (empty for drives)
+	IsDrive     bool
+	DriveLetter string // Upper-case drive letter without colon, e.g. "E"
+
+	// IsDir marks a directory tree, such as an extracted ISO or a netboot
+	// tree. It has no image, so only its contents can be verified.
+	IsDir bool
+
+	// IsDevice marks a block or character device on Unix, such as /dev/sr0
+	// or /dev/sdb: a burned disc or written USB stick read directly. Like a
+	// drive, only its ISO data area is hashed by default.
+	IsDevice bool
+
+	// Parts lists every part of a split image (image.iso.001, ...) in
+	// order, and Joined is the name of the image they form. Path is then
+	// the part the user named.
+	Parts  []string
+	Joined string
+
+	// Compression is the format (decompress.Gzip, ...) of a compressed
+	// image, which is read through a decompressor, or "" if it is not.
+	Compression string
+
+	// Partition, if non-zero, selects that partition of a raw disk image
+	// (numbered as in PartitionTable): everything is then read from the
+	// partition instead of the whole image.
+	Partition int
+
+	imageSize int64 // Decompressed size of a compressed image, once known
+}
+
+// NewTarget validates path and resolves it to a Target.
+// Drive letters (E: or E:\) are only recognized on Windows; any other
+// directory, including a drive's root given as a path, is a directory tree.
+// Device files such as /dev/sr0 are read directly.
+func NewTarget(path string) (*Target, error) {
+	if runtime.GOOS == "windows" {
+		if matches := drivePattern.FindStringSubmatch(path); matches != nil {
+			return &Target{IsDrive: true, DriveLetter: strings.ToUpper(matches[1])}, nil
+		}
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("file not found: %s", path)
+	}
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve path: %v", err)
+	}
+	if info.IsDir() {
+		return &Target{Path: absPath, IsDir: true}, nil
+	}
+	if info.Mode()&os.ModeDevice != 0 {
+		return &Target{Path: absPath, IsDevice: true}, nil
+	}
+	t := &Target{Path: absPath}
+	t.Parts, t.Joined = isofs.SplitParts(absPath)
+	t.Compression = decompress.Format(t.ImagePath())
+	return t, nil
+}
+
+// ImagePath returns the path of the image: Path, or for a split image the
+// name of the joined image, which is what checksum files list.
+func (t *Target) ImagePath() string {
+	if len(t.Parts) > 0 {
+		return t.Joined
+	}
+	return t.Path
+}
+
+// open opens the target's image, or the part of it that is verified: the
+// data track of a Nero image or the selected partition. It returns it with
+// its size.
+func (t *Target) open() (isofs.Image, int64, error) {
+	if t.IsDir {
+		return nil, 0, fmt.Errorf("%s is a directory, which has no image to read", t.Path)
+	}
+	image, size, err := t.openImage()
+	if err != nil {
+		return nil, 0, err
+	}
+	if t.IsNRG() {
+		if image, size, err = openNRG(image, size); err != nil {
+			return nil, 0, err
+		}
+	}
+	if t.Partition > 0 {
+		return t.openPartition(image, size)
+	}
+	return image, size, nil
+}
+
+// narrowed reports whether open reads only part of the stored image.
+func (t *Target) narrowed() bool {
+	return t.Partition > 0 || t.IsNRG()
+}
+
+// openImage opens the target's whole image and returns it with its size.
+// The parts of a split image are read as one, and a compressed image is
+// decompressed as it is read. Finding the size of a compressed image means
+// reading all of it, unless hashing it already has.
+func (t *Target) openImage() (isofs.Image, int64, error) {
+	if t.Compression == "" {
+		return t.openRaw()
+	}
+	image := isofs.NewStreamImage(t.decompress)
+	if t.imageSize == 0 {
+		size, err := image.Size()
+		if err != nil {
+			image.Close()
+			return nil, 0, fmt.Errorf("could not decompress %s: %v", filepath.Base(t.ImagePath()), err)
+		}
+		t.imageSize = size
+	}
+	return image, t.imageSize, nil
+}
+
+// decompress returns the decompressed stream of a compressed image.
+func (t *Target) decompress() (io.ReadCloser, error) {
+	raw, _, err := t.openRaw()
+	if err != nil {
+		return nil, err
+	}
+	r, err := decompress.NewReader(t.Compression, raw)
+	if err != nil {
+		raw.Close()
+		return nil, fmt.Errorf("could not decompress %s: %v", filepath.Base(t.ImagePath()), err)
+	}
+	return readCloser{Reader: r, closers: []io.Closer{r, raw}}, nil
+}
+
+// readCloser closes several things at once.
+type readCloser struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (r readCloser) Close() error {
+	var first error
+	for _, c := range r.closers {
+		if err := c.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// openRaw opens the target's bytes as stored, without decompressing them.
+func (t *Target) openRaw() (isofs.Image, int64, error) {
+	if len(t.Parts) > 0 {
+		return isofs.OpenParts(t.Parts)
+	}
+	devicePath, err := t.DevicePath()
+	if err != nil {
+		return nil, 0, err
+	}
+	file, size, err := isofs.Open(devicePath)
+	if err != nil {
+		if t.IsDevice && errors.Is(err, fs.ErrPermission) {
+			return nil, 0, fmt.Errorf("%w (reading a device needs root or membership of the group that owns it, usually disk or cdrom)", err)
+		}
+		return nil, 0, err
+	}
+	return file, size, nil
+}
+
+// CheckAccess opens the target's raw bytes and closes them again, so that a
+// drive or device that needs more privileges is found before any check runs.
+func CheckAccess(t *Target) error {
+	file, _, err := t.openRaw()
+	if err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+// String returns the target as a user would type it. A split image is
+// named as the joined image, whichever part was given.
+func (t *Target) String() string {
+	if t.IsDrive {
+		return t.DriveLetter + ":"
+	}
+	return t.ImagePath()
+}
+
+// isMedia reports whether the target is a drive or device, which may hold
+// more than the ISO image written to it.
+func (t *Target) isMedia() bool {
+	return t.IsDrive || t.IsDevice
+}
+
+// opticalReadAhead is how many megabytes are read ahead of hashing from an
+// optical drive: a couple of seconds at DVD speeds, enough to keep the disc
+// spinning at full speed through hiccups in hashing.
+const opticalReadAhead = 32
+
+// readAhead returns how many buffers hashing may read ahead of the hash.
+func (t *Target) readAhead() int {
+	if !t.isMedia() {
+		return 1
+	}
+	devicePath, err := t.DevicePath()
+	if err != nil || !isofs.IsOptical(devicePath) {
+		return 1
+	}
+	return opticalReadAhead
+}
+
+// DevicePath returns the path used to read the target's raw bytes. On macOS
+// a disk named as /dev/diskN is read through /dev/rdiskN, which bypasses the
+// buffer cache and is several times faster.
+func (t *Target) DevicePath() (string, error) {
+	if t.IsDevice && runtime.GOOS == "darwin" {
+		if dir, name := filepath.Split(t.Path); dir == "/dev/" && strings.HasPrefix(name, "disk") {
+			return dir + "r" + name, nil
+		}
+	}
+	if !t.IsDrive {
+		return t.Path, nil
+	}
+	if runtime.GOOS != "windows" {
+		return "", fmt.Errorf("drive letters are only supported on Windows")
+	}
+	return fmt.Sprintf("\\\\.\\%s:", t.DriveLetter), nil
+}
+
+// OpenFS returns the target's files as an fs.FS: the drive's root directory
+// or the directory tree, the mount point of a device holding a DataVolume,
+// the entries of a .zip archive, or the contents of an ISO 9660 image, also
+// inside a .dmg, a .nrg or a disk image partition, read in-process without
+// mounting.
+// Close the returned Closer when done.
+func (t *Target) OpenFS() (fs.FS, io.Closer, error) {
+	if t.IsDrive || t.IsDir {
+		return RootFS(t.Root()), nopCloser{}, nil
+	}
+	if volume := t.DataVolume(); volume != nil && t.IsDevice {
+		if volume.Root == "" {
+			return nil, nil, fmt.Errorf("%s holds %s that is not mounted; mount it to verify its files", t.Path, volume)
+		}
+		return RootFS(volume.Root), nopCloser{}, nil
+	}
+	if t.Compression != "" && !t.narrowed() {
+		// Parsing an ISO needs only its descriptors and directories, so the
+		// stream is not read to the end to find its size first
+		image := isofs.NewStreamImage(t.decompress)
+		fsys, err := isofs.NewFS(image)
+		if err != nil {
+			image.Close()
+			return nil, nil, err
+		}
+		return fsys, image, nil
+	}
+	file, size, err := t.open()
+	if err != nil {
+		return nil, nil, err
+	}
+	if strings.EqualFold(filepath.Ext(t.ImagePath()), ".zip") {
+		archive, err := zip.NewReader(file, size)
+		if err != nil {
+			file.Close()
+			return nil, nil, err
+		}
+		return archive, file, nil
+	}
+	if t.IsDMG() {
+		fsys, err := dmgFS(file, size)
+		if err != nil {
+			file.Close()
+			return nil, nil, err
+		}
+		return fsys, file, nil
+	}
+	image, err := isofs.NewFS(file)
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+	return image, file, nil
+}
+
+// FileExtents returns the byte ranges within the target's image of each of
+// names, slash-separated paths on the media, leaving out those not found.
+// It returns nil for targets whose files are not read from an ISO 9660
+// image stored as is: directories, drives, archives, and compressed, Nero
+// and Apple images. Offsets in a partition are relative to its start.
+func FileExtents(t *Target, names []string) (map[string][][2]int64, error) {
+	if t.IsDir || t.IsDrive || t.Compression != "" || t.IsNRG() || t.IsDMG() || strings.EqualFold(filepath.Ext(t.ImagePath()), ".zip") {
+		return nil, nil
+	}
+	file, _, err := t.open()
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	fsys, err := isofs.NewFS(file)
+	if err != nil {
+		return nil, err
+	}
+	extents := make(map[string][][2]int64)
+	for _, name := range names {
+		if e, err := fsys.Extents(name); err == nil {
+			extents[name] = e
+		}
+	}
+	return extents, nil
+}
+
+type nopCloser struct{}
+
+func (nopCloser) Close() error { return nil }
+
+// Root returns the directory holding the target's files, for drives and
+// directory trees only.
+func (t *Target) Root() string {
+	if t.IsDrive {
+		return fmt.Sprintf("%s:\\", t.DriveLetter)
+	}
+	if t.IsDir {
+		return t.Path
+	}
+	return ""
+}
+
+// isoVolumeSize returns the size the ISO 9660 volume in r declares, or 0 if
+// r holds none.
+func isoVolumeSize(r io.ReaderAt) int64 {
+	pvd, err := isofs.ReadPVD(r)
+	if err != nil {
+		return 0
+	}
+	return isofs.VolumeSize(pvd)
+}
+
+// ProgressFunc receives progress events while a verification runs. Front-ends
+// render from these events instead of scraping console output.
+type ProgressFunc func(Progress)
+
+// Progress describes what a verification step is currently doing.
+//
+// Phases are "begin" and "end" around each Verifier step (Item is the step
+// name), "sha256" for bytes hashed, "discovered" once checksum files are
+// found, "manifest" and "contents" while files are verified, and "info" or
+// "warning" for messages (Item is the text).
+type Progress struct {
+	Phase  string
+	Item   string      // Step, file or checksum file being processed, or message text
+	Done   int64       // Bytes processed so far
+	Total  int64       // Total bytes, or 0 if unknown
+	File   *FileResult // Set when a single content file has finished verifying
+	Result *Result     // The run's result so far, on "begin", "end" and "discovered"
+}
+
+// HashResult is the outcome of comparing the target against an expected SHA256.
+// For a compressed image the expected hash may be that of the image or of the
+// compressed file, since distributors publish either.
+type HashResult struct {
+	Expected   string // The candidate that matched, or the first one
+	Calculated string
+	Compressed string   // SHA256 of the compressed file, for compressed images
+	Candidates []string // Every accepted hash, when more than one was given
+	Match      bool
+	FromName   bool // Expected came from the target's own file name
+}
+
+// FileStatus is the verdict for one file referenced by a checksum file.
+type FileStatus string
+
+const (
+	FileOK       FileStatus = "OK"
+	FileMismatch FileStatus = "FAILED"
+	FileSize     FileStatus = "SIZE MISMATCH"
+	FileMissing  FileStatus = "MISSING"
+	FileUnsafe   FileStatus = "UNSAFE"
+	FileError    FileStatus = "ERROR"
+	FileConflict FileStatus = "MANIFEST CONFLICT" // Listed with different hashes of the same algorithm
+)
+
+// FileResult is the outcome of verifying a single file on the media.
+type FileResult struct {
+	Name         string
+	ChecksumFile string
+	Algorithm    string
+	Status       FileStatus
+	Err          error
+	ExpectedSize int64  // Size listed in the checksum file, or -1
+	Size         int64  // Size found on the media, or -1 if not known
+	Cached       bool   // The hash was taken from the Cache instead of the file
+	Shared       bool   // The hash was calculated for an earlier entry naming the same file
+	Hash         string // Calculated hash, once the file was read
+}
+
+// ContentResult collects the outcome of verifying all checksum files on the media.
+type ContentResult struct {
+	Root          string // Directory the checksum files were searched in
+	ChecksumFiles []string
+	Files         []FileResult
+	Total         int
+	Failed        int
+	SizeMismatch  int // Failed files rejected by size alone, without hashing
+	Cached        int // Files whose hash was taken from the Cache
+	Shared        int // Files whose hash was calculated for an earlier entry
+	Conflicts     int // Files listed with different hashes of one algorithm, once each
+	Skipped       int // Entries skipped because their algorithm is not allowed
+
+	conflictEntries int // Entries that failed as FileConflict, counted in Failed
+
+	// Signatures has the outcome of checking each checksum file's detached
+	// signature, in the order of ChecksumFiles.
+	Signatures []SignatureResult
+
+	// Uncovered lists the files on the media that no checksum file lists,
+	// apart from the checksum files themselves: nothing vouches for them.
+	// MediaFiles and MediaBytes count all files on the media and their
+	// size, again without the checksum files.
+	Uncovered  []UncoveredFile
+	MediaFiles int
+	MediaBytes int64
+}
+
+// Coverage returns the percentage of the files on the media, and of their
+// bytes, that the checksum files list, rounded down to a tenth so that
+// media missing a byte never shows as fully covered. Media without files
+// are fully covered.
+func (c *ContentResult) Coverage() (files, bytes float64) {
+	files, bytes = 100, 100
+	var uncoveredBytes int64
+	for _, f := range c.Uncovered {
+		uncoveredBytes += f.Size
+	}
+	if c.MediaFiles > 0 {
+		files = 100 * float64(c.MediaFiles-len(c.Uncovered)) / float64(c.MediaFiles)
+	}
+	if c.MediaBytes > 0 {
+		bytes = 100 * float64(c.MediaBytes-uncoveredBytes) / float64(c.MediaBytes)
+	}
+	return math.Floor(files*10) / 10, math.Floor(bytes*10) / 10
+}
+
+// UncoveredFile is a file on the media that no checksum file lists.
+type UncoveredFile struct {
+	Name string // Slash-separated path on the media
+	Size int64
+}
+
+// progressReader reports bytes read through a ProgressFunc.
+type progressReader struct {
+	r        io.Reader
+	phase    string
+	item     string
+	done     int64
+	total    int64
+	progress ProgressFunc
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.done += int64(n)
+	if p.progress != nil && n > 0 {
+		p.progress(Progress{Phase: p.phase, Item: p.item, Done: p.done, Total: p.total})
+	}
+	return n, err
+}
+
+// IsValidSha256 reports whether s is a 64 character hexadecimal SHA256 digest.
+func IsValidSha256(s string) bool {
+	return sha256Pattern.MatchString(strings.TrimSpace(s))
+}
+
+// Sha256 returns the SHA256 of the target, reporting bytes read through
+// progress. Image files are hashed whole, and compressed images after
+// decompression. For drives only the ISO data area declared by the Primary
+// Volume Descriptor is hashed, so that a burned disc hashes the same as the
+// image it was burned from; see Sha256Device.
+func Sha256(ctx context.Context, t *Target, progress ProgressFunc) (string, error) {
+	sum, _, err := hashTarget(ctx, t, hashRange{}, progress)
+	return sum, err
+}
+
+// Sha256Device is Sha256, but hashes every byte of a drive, including
+// padding and run-out sectors after the ISO data area.
+func Sha256Device(ctx context.Context, t *Target, progress ProgressFunc) (string, error) {
+	sum, _, err := hashTarget(ctx, t, hashRange{WholeDevice: true}, progress)
+	return sum, err
+}
+
+// Sha256Range returns the SHA256 of length bytes of the target starting at
+// offset, counted from the start of the file or device. A length of 0 hashes
+// to the end. Offsets in a compressed image count decompressed bytes.
+func Sha256Range(ctx context.Context, t *Target, offset, length int64, progress ProgressFunc) (string, error) {
+	sum, _, err := hashTarget(ctx, t, hashRange{Offset: offset, Length: length}, progress)
+	return sum, err
+}
+
+// hashRange selects the bytes hashTarget reads.
+type hashRange struct {
+	WholeDevice bool
+	Offset      int64
+	Length      int64 // 0 means to the end
+}
+
+func (r hashRange) partial() bool { return r.Offset != 0 || r.Length != 0 }
+
+// hashTarget returns the SHA256 of the bytes of t that r selects, also
+// writing them to each of also. For a compressed image hashed whole it also
+// returns the SHA256 of the compressed file, calculated in the same pass.
+func hashTarget(ctx context.Context, t *Target, r hashRange, progress ProgressFunc, also ...io.Writer) (sum, compressed string, err error) {
+	if progress == nil {
+		progress = func(Progress) {}
+	}
+	if t.Compression != "" && !r.partial() && !t.narrowed() {
+		return hashCompressed(ctx, t, progress, also...)
+	}
+	file, size, err := t.open()
+	if err != nil {
+		return "", "", err
+	}
+	defer file.Close()
+
+	var data io.Reader = file
+	switch {
+	case r.partial():
+		if r.Offset < 0 || r.Length < 0 {
+			return "", "", fmt.Errorf("offset and length must not be negative")
+		}
+		if r.Offset >= size {
+			return "", "", fmt.Errorf("offset %d is beyond the end of the target (%d bytes)", r.Offset, size)
+		}
+		length := size - r.Offset
+		if r.Length > 0 {
+			if r.Length > length {
+				return "", "", fmt.Errorf("range %d+%d is beyond the end of the target (%d bytes)", r.Offset, r.Length, size)
+			}
+			length = r.Length
+		}
+		progress(Progress{Phase: "info", Item: fmt.Sprintf("Hashing %d bytes starting at offset %d", length, r.Offset)})
+		size = length
+		data = io.NewSectionReader(file, r.Offset, length)
+	case t.isMedia() && !r.WholeDevice:
+		volume := isoVolumeSize(file)
+		switch {
+		case volume == 0:
+			progress(Progress{Phase: "warning", Item: "No ISO 9660 volume found on the drive; hashing the whole device."})
+		case volume < size:
+			progress(Progress{Phase: "info", Item: fmt.Sprintf("Hashing the ISO data area only: %d of %d bytes (use -whole-device to hash everything)", volume, size)})
+			size = volume
+			data = io.NewSectionReader(file, 0, size)
+		}
+	}
+
+	ahead := t.readAhead()
+	if ahead > 1 {
+		progress(Progress{Phase: "info", Item: fmt.Sprintf("Optical drive: reading up to %d MiB ahead of hashing", ahead)})
+	}
+	reader := &progressReader{r: ctxio.NewReader(ctx, data), phase: "sha256", item: t.String(), total: size, progress: progress}
+	h := sha256.New()
+	if _, err := pipeline.CopyAhead(ctx, multiHash(h, also), reader, ahead); err != nil {
+		return "", "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), "", nil
+}
+
+// hashCompressed hashes a compressed image and its decompressed contents in
+// one read of the compressed file. Progress counts compressed bytes, since
+// the decompressed size is not known up front.
+func hashCompressed(ctx context.Context, t *Target, progress ProgressFunc, also ...io.Writer) (sum, compressed string, err error) {
+	raw, size, err := t.openRaw()
+	if err != nil {
+		return "", "", err
+	}
+	defer raw.Close()
+
+	reader := &progressReader{r: ctxio.NewReader(ctx, raw), phase: "sha256", item: t.String(), total: size, progress: progress}
+	rawHash := sha256.New()
+	tee := io.TeeReader(reader, rawHash)
+	stream, err := decompress.NewReader(t.Compression, tee)
+	if err != nil {
+		return "", "", fmt.Errorf("could not decompress %s: %v", filepath.Base(t.ImagePath()), err)
+	}
+	defer stream.Close()
+
+	h := sha256.New()
+	n, err := pipeline.Copy(ctx, multiHash(h, also), stream)
+	if err != nil {
+		return "", "", fmt.Errorf("could not decompress %s: %v", filepath.Base(t.ImagePath()), err)
+	}
+	// Trailing data the decompressor did not need still belongs to the file
+	if _, err := io.Copy(rawHash, reader); err != nil {
+		return "", "", err
+	}
+	t.imageSize = n
+	return hex.EncodeToString(h.Sum(nil)), hex.EncodeToString(rawHash.Sum(nil)), nil
+}
+
+// multiHash returns a writer feeding h and every writer in also.
+func multiHash(h hash.Hash, also []io.Writer) io.Writer {
+	if len(also) == 0 {
+		return h
+	}
+	writers := []io.Writer{h}
+	for _, a := range also {
+		writers = append(writers, a)
+	}
+	return io.MultiWriter(writers...)
+}
+
+// CompareSha256 hashes the target as Sha256 does and compares it with the
+// expected hash.
+func CompareSha256(ctx context.Context, t *Target, expected string, progress ProgressFunc) (*HashResult, error) {
+	return compareSha256(ctx, t, []string{expected}, hashRange{}, progress)
+}
+
+func compareSha256(ctx context.Context, t *Target, candidates []string, r hashRange, progress ProgressFunc, also ...io.Writer) (*HashResult, error) {
+	expected := make([]string, len(candidates))
+	for i, c := range candidates {
+		expected[i] = strings.ToLower(strings.TrimSpace(c))
+		if !IsValidSha256(expected[i]) {
+			return nil, fmt.Errorf("invalid SHA256 hash format. Expected 64 hexadecimal characters")
+		}
+	}
+
+	calculatedHash, compressedHash, err := hashTarget(ctx, t, r, progress, also...)
+	if err != nil {
+		return nil, fmt.Errorf("error calculating hash: %v", err)
+	}
+	result := &HashResult{
+		Expected:   expected[0],
+		Calculated: calculatedHash,
+		Compressed: compressedHash,
+	}
+	if len(expected) > 1 {
+		result.Candidates = expected
+	}
+	for _, e := range expected {
+		if calculatedHash == e || compressedHash == e {
+			result.Expected = e
+			result.Match = true
+			break
+		}
+	}
+	return result, nil
+}
+
+// HashFromFile returns the expected SHA256 for the target from a hash file.
+// It returns "" if the file holds no usable entry.
+func HashFromFile(t *Target, content string) string {
+	if t.isMedia() || t.IsDir {
+		return manifest.FindHash(content, "")
+	}
+	// Prefer an entry naming the image over the first hash in the file
+	if hash := ListedHash(t, content, manifest.SHA256); hash != "" {
+		return hash
+	}
+	return manifest.FindHash(content, filepath.Base(t.ImagePath()))
+}
+
+// ListedHash returns the hash using algorithm that content, a checksum
+// file, lists for the target's image by name, or "" if it lists none.
+// Unlike HashFromFile it never falls back to another entry, so it is safe
+// for files covering many images, such as SHA256SUMS. For a compressed
+// image an entry for the image inside is preferred to one for the file.
+func ListedHash(t *Target, content, algorithm string) string {
+	if t.isMedia() || t.IsDir {
+		return ""
+	}
+	entries, err := manifest.ParseNamed("", []byte(content))
+	if err != nil {
+		return ""
+	}
+	name := filepath.Base(t.ImagePath())
+	names := []string{name}
+	if t.Compression != "" {
+		names = []string{decompress.TrimExt(name), name}
+	}
+	for _, n := range names {
+		for _, entry := range entries {
+			if entry.Algorithm == algorithm && manifest.SameName(path.Base(entry.Path), n) {
+				return entry.Hash
+			}
+		}
+	}
+	return ""
+}
+
+// ImplantedMD5 checks the MD5 implanted into the target by implantisomd5.
+// It returns isomd5.ErrNoSignature if the target carries none.
+func ImplantedMD5(ctx context.Context, t *Target) (*isomd5.Result, error) {
+	if _, err := t.DevicePath(); err != nil {
+		return nil, err
+	}
+	file, size, err := t.open()
+	if err != nil {
+		if t.IsDrive {
+			// This typically happens with virtual/mounted drives (like mounted ISOs)
+			// which don't support device-level operations
+			return nil, fmt.Errorf("drive %s: does not support device-level access (likely a virtual/mounted drive).\n\n"+
+				"Implanted MD5 check requires direct access to the ISO file.\n"+
+				"To verify the implanted MD5, use the ISO file directly:\n"+
+				"  Example: chkiso path\\to\\image.iso -md5\n\n"+
+				"(Content verification will still work with the mounted drive)", t.DriveLetter)
+		}
+		return nil, err
+	}
+	defer file.Close()
+
+	// As checkisomd5 does, hash the ISO volume rather than the whole medium,
+	// which may be larger than the image written to it
+	if t.isMedia() {
+		if volume := isoVolumeSize(file); volume > 0 && volume < size {
+			size = volume
+		}
+	}
+	return isomd5.CheckAhead(ctx, file, size, t.readAhead())
+}
+
+// Contents verifies every file referenced by the given checksum files, which
+// are slash-separated paths within fsys. The same code serves a mounted drive
+// (RootFS), an ISO image read in-process (isofs.FS), or a zip archive.
+// Each finished file is reported through progress as it completes. If ctx is
+// cancelled the remaining files are skipped and the partial result returned.
+func Contents(ctx context.Context, fsys fs.FS, checksumFiles []string, progress ProgressFunc) *ContentResult {
+	return verifyContents(ctx, fsys, checksumFiles, contentOptions{}, progress)
+}
+
+// contentOptions adjust how verifyContents works.
+type contentOptions struct {
+	cache       *cacheScope       // Reuse the hashes of unchanged files, if set
+	fips        bool              // Skip entries using algorithms that are not FIPS approved
+	fileTimeout time.Duration     // Fail a file whose hash takes longer, if non-zero
+	jobs        int               // Files hashed at once; 0 or 1 hashes them in turn
+	unordered   bool              // With jobs, report files as they finish
+	hashes      *hashMemo         // Hashes calculated so far in this run
+	listings    listings          // Every hash the checksum files list for each file
+	signingKey  ed25519.PublicKey // Trusted key to check checksum file signatures against
+	keyCreated  time.Time         // When signingKey was created, if known
+}
+
+// verifyContents implements Contents. Files are reported in the order their
+// checksum files list them, also when several are hashed at once, so that
+// results and reports of the same media are always alike; opts.unordered
+// reports them as they finish instead, though Files is still in order.
+func verifyContents(ctx context.Context, fsys fs.FS, checksumFiles []string, opts contentOptions, progress ProgressFunc) *ContentResult {
+	if progress == nil {
+		progress = func(Progress) {}
+	}
+	result := &ContentResult{ChecksumFiles: checksumFiles}
+	// Checksum files often overlap (SHA256SUMS and MD5SUMS, or one per
+	// directory and one for the whole media); each file is read once per
+	// algorithm and the result attributed to every entry naming it
+	opts.hashes = newHashMemo()
+
+	// A file whose checksum files disagree fails in every entry listing it,
+	// but is one conflict
+	conflicted := make(map[hashKey]bool)
+	record := func(fr FileResult) {
+		result.Total++
+		if fr.Status != FileOK {
+			result.Failed++
+		}
+		if fr.Status == FileSize {
+			result.SizeMismatch++
+		}
+		if fr.Cached {
+			result.Cached++
+		}
+		if fr.Shared {
+			result.Shared++
+		}
+		if fr.Status == FileConflict {
+			result.conflictEntries++
+			if key := (hashKey{listedName(fr.ChecksumFile, fr.Name), fr.Algorithm}); !conflicted[key] {
+				conflicted[key] = true
+				result.Conflicts++
+			}
+		}
+		result.Files = append(result.Files, fr)
+	}
+	announce := func(fr FileResult) {
+		progress(Progress{Phase: "contents", Item: fr.Name, File: &fr})
+	}
+	// started announces a file about to be checked; missing and unsafe
+	// files are only reported
+	started := func(name string) {
+		progress(Progress{Phase: "contents", Item: name})
+	}
+	checked := func(fr FileResult) bool {
+		return fr.Status != FileMissing && fr.Status != FileUnsafe
+	}
+
+	// Every checksum file is read first, so an entry can be checked against
+	// what the others list for the same file
+	parsed := make([][]manifest.Entry, len(checksumFiles))
+	parseErrs := make([]error, len(checksumFiles))
+	opts.listings = make(listings)
+	result.Signatures = checkSignatures(fsys, checksumFiles, opts.signingKey, opts.keyCreated)
+	for i, checksumFile := range checksumFiles {
+		parsed[i], parseErrs[i] = manifest.ParseFS(fsys, checksumFile)
+		for _, entry := range parsed[i] {
+			if !opts.fips || manifest.FIPSApproved(entry.Algorithm) {
+				opts.listings.add(checksumFile, entry)
+			}
+		}
+	}
+
+	for i, checksumFile := range checksumFiles {
+		if ctx.Err() != nil {
+			break
+		}
+		progress(Progress{Phase: "manifest", Item: checksumFile})
+		baseDir := path.Dir(checksumFile)
+
+		if parseErrs[i] != nil {
+			progress(Progress{Phase: "warning", Item: fmt.Sprintf("Could not open checksum file: %v", parseErrs[i])})
+			continue
+		}
+
+		var skipped []string
+		var todo []manifest.Entry
+		for _, entry := range parsed[i] {
+			if opts.fips && !manifest.FIPSApproved(entry.Algorithm) {
+				skipped = append(skipped, entry.Algorithm)
+				result.Skipped++
+				continue
+			}
+			todo = append(todo, entry)
+		}
+
+		if opts.jobs <= 1 {
+			for _, entry := range todo {
+				if ctx.Err() != nil {
+					break
+				}
+				fr := checkEntry(ctx, fsys, checksumFile, baseDir, entry, opts, started)
+				record(fr)
+				announce(fr)
+			}
+		} else {
+			check := func(i int) FileResult {
+				return checkEntry(ctx, fsys, checksumFile, baseDir, todo[i], opts, nil)
+			}
+			results, done := parallelChecks(ctx, len(todo), opts.jobs, opts.unordered, check, func(fr FileResult) {
+				if checked(fr) {
+					started(fr.Name)
+				}
+				if !opts.unordered {
+					record(fr)
+				}
+				announce(fr)
+			})
+			if opts.unordered {
+				for i, fr := range results {
+					if done[i] {
+						record(fr)
+					}
+				}
+			}
+		}
+		if len(skipped) > 0 {
+			progress(Progress{Phase: "warning", Item: fmt.Sprintf("Skipped %d entry(ies) in %s that use algorithms not approved in FIPS mode (%s)", len(skipped), checksumFile, strings.Join(uniqueStrings(skipped), ", "))})
+		}
+	}
+
+	if ctx.Err() == nil {
+		result.Uncovered, result.MediaFiles, result.MediaBytes = uncoveredFiles(ctx, fsys, checksumFiles, opts.listings)
+	}
+	return result
+}
+
+// uncoveredFiles returns the regular files in fsys that are neither listed
+// nor one of checksumFiles, and how many files other than checksumFiles
+// there are and their size. Entries that cannot be read are left out.
+func uncoveredFiles(ctx context.Context, fsys fs.FS, checksumFiles []string, listed listings) (uncovered []UncoveredFile, count int, size int64) {
+	covered := make(map[string]bool)
+	for key := range listed {
+		covered[key.name] = true
+	}
+	isChecksumFile := make(map[string]bool)
+	for _, name := range checksumFiles {
+		isChecksumFile[norm.NFC.String(name)] = true
+		// Their signatures are not content either
+		for _, ext := range manifest.SignatureExts {
+			isChecksumFile[norm.NFC.String(name+ext)] = true
+		}
+	}
+	var files []UncoveredFile
+	present := make(map[string]bool)
+	fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		if err != nil {
+			if d != nil && d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		present[norm.NFC.String(name)] = true
+		if isChecksumFile[norm.NFC.String(name)] {
+			return nil
+		}
+		count++
+		size += info.Size()
+		files = append(files, UncoveredFile{Name: name, Size: info.Size()})
+		return nil
+	})
+
+	// Plain ISO 9660 names are upper case, and Windows drives ignore case,
+	// so a listed name that is not on the media as spelled was found in
+	// another case
+	folded := make(map[string]bool)
+	for name := range covered {
+		if !present[name] {
+			folded[strings.ToLower(name)] = true
+		}
+	}
+	for _, f := range files {
+		name := norm.NFC.String(f.Name)
+		if !covered[name] && !folded[strings.ToLower(name)] {
+			uncovered = append(uncovered, f)
+		}
+	}
+	return uncovered, count, size
+}
+
+// checkEntry verifies the file entry of checksumFile lists, resolved from
+// baseDir. started, if not nil, is called with the entry's path once the
+// file is found, before it is read.
+func checkEntry(ctx context.Context, fsys fs.FS, checksumFile, baseDir string, entry manifest.Entry, opts contentOptions, started func(string)) FileResult {
+	fr := FileResult{Name: entry.Path, ChecksumFile: checksumFile, Algorithm: entry.Algorithm, ExpectedSize: entry.Size, Size: -1}
+
+	// Resolve the entry relative to its checksum file; a path that
+	// climbs out of the media (e.g. "../x") is not a valid fs path
+	name := path.Join(baseDir, strings.ReplaceAll(entry.Path, "\\", "/"))
+	if !fs.ValidPath(name) {
+		fr.Status = FileUnsafe
+		return fr
+	}
+
+	name, info, err := statName(fsys, name)
+	if errors.Is(err, fs.ErrNotExist) {
+		fr.Status = FileMissing
+		return fr
+	}
+	if errors.Is(err, ErrOutsideRoot) {
+		fr.Status = FileUnsafe
+		fr.Err = err
+		return fr
+	}
+	if err == nil {
+		fr.Size = info.Size()
+	} else {
+		info = nil
+	}
+
+	if started != nil {
+		started(entry.Path)
+	}
+
+	// A size listed in the manifest settles a mismatch without
+	// reading the file
+	if entry.Size >= 0 && fr.Size >= 0 && entry.Size != fr.Size {
+		fr.Status = FileSize
+		return fr
+	}
+	calculatedHash, ok := opts.cache.lookup(name, entry.Algorithm, info)
+	if ok {
+		fr.Cached = true
+	} else {
+		calculatedHash, fr.Shared, err = opts.hashes.do(name, entry.Algorithm, func() (string, error) {
+			sum, err := fsFileHashTimeout(ctx, fsys, name, entry.Algorithm, opts.fileTimeout)
+			if err == nil {
+				opts.cache.store(name, entry.Algorithm, info, sum)
+			}
+			return sum, err
+		})
+		if err != nil {
+			fr.Status = FileError
+			fr.Err = err
+			return fr
+		}
+	}
+
+	fr.Hash = calculatedHash
+	if calculatedHash == entry.Hash {
+		fr.Status = FileOK
+	} else {
+		fr.Status = FileMismatch
+	}
+	if conflict := opts.listings.conflict(path.Join(baseDir, strings.ReplaceAll(entry.Path, "\\", "/")), entry.Algorithm, calculatedHash); conflict != nil {
+		fr.Status = FileConflict
+		fr.Err = conflict
+	}
+	return fr
+}
+
+// listings holds, for each file and algorithm, where the checksum files
+// list which hash.
+type listings map[hashKey][]listing
+
+type listing struct {
+	checksumFile string
+	hash         string
+}
+
+// add records entry of checksumFile, whose path is relative to it.
+func (l listings) add(checksumFile string, entry manifest.Entry) {
+	key := hashKey{listedName(checksumFile, entry.Path), entry.Algorithm}
+	l[key] = append(l[key], listing{checksumFile, entry.Hash})
+}
+
+// listedName returns the media path, in NFC, of the file entryPath names
+// in checksumFile.
+func listedName(checksumFile, entryPath string) string {
+	return norm.NFC.String(path.Join(path.Dir(checksumFile), strings.ReplaceAll(entryPath, "\\", "/")))
+}
+
+// conflict returns an error if name is listed with more than one algorithm
+// hash, which usually means the media was mastered from files that changed
+// between writing its checksum files. It says which checksum files list
+// which hash, and which of them the file's calculated hash matches.
+func (l listings) conflict(name, algorithm, calculated string) error {
+	found := l[hashKey{norm.NFC.String(name), algorithm}]
+	var hashes []string
+	where := make(map[string][]string)
+	for _, f := range found {
+		hashes = append(hashes, f.hash)
+		where[f.hash] = append(where[f.hash], f.checksumFile)
+	}
+	hashes = uniqueStrings(hashes)
+	if len(hashes) < 2 {
+		return nil
+	}
+	short := func(hash string) string {
+		if len(hash) > 12 {
+			return hash[:12] + "..."
+		}
+		return hash
+	}
+	var listed []string
+	matches := "none of them"
+	for _, h := range hashes {
+		listed = append(listed, fmt.Sprintf("%s (%s)", short(h), strings.Join(where[h], ", ")))
+		if h == calculated {
+			matches = short(h)
+		}
+	}
+	return fmt.Errorf("the checksum files list %d different %s hashes: %s; the file matches %s", len(hashes), strings.ToUpper(algorithm), strings.Join(listed, ", "), matches)
+}
+
+// parallelChecks runs check for 0 to n-1 on jobs goroutines and passes each
+// result to emit, in order of i, or as they finish if unordered. emit is
+// called from the calling goroutine only. Once ctx is done no more checks
+// start; it returns all results with which of them ran.
+func parallelChecks(ctx context.Context, n, jobs int, unordered bool, check func(int) FileResult, emit func(FileResult)) ([]FileResult, []bool) {
+	results := make([]FileResult, n)
+	done := make([]bool, n)
+	next := make(chan int)
+	finished := make(chan int)
+
+	go func() {
+		defer close(next)
+		for i := 0; i < n; i++ {
+			select {
+			case next <- i:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	var wg sync.WaitGroup
+	for w := 0; w < jobs; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				results[i] = check(i)
+				finished <- i
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(finished)
+	}()
+
+	emitted := 0
+	for i := range finished {
+		done[i] = true
+		if unordered {
+			emit(results[i])
+			continue
+		}
+		for emitted < n && done[emitted] {
+			emit(results[emitted])
+			emitted++
+		}
+	}
+	// After cancellation, files finished past one that never started
+	for ; !unordered && emitted < n; emitted++ {
+		if done[emitted] {
+			emit(results[emitted])
+		}
+	}
+	return results, done
+}
+
+// hashMemo remembers the hash of each file and algorithm calculated during a
+// content verification, so a file named by several entries is read once. It
+// is safe for concurrent use.
+type hashMemo struct {
+	mu     sync.Mutex
+	hashes map[hashKey]*memoHash
+}
+
+type hashKey struct{ name, algorithm string }
+
+// memoHash is a hash being calculated, or calculated once done is closed.
+type memoHash struct {
+	done chan struct{}
+	hash string
+	err  error
+}
+
+func newHashMemo() *hashMemo {
+	return &hashMemo{hashes: make(map[hashKey]*memoHash)}
+}
+
+// do returns the algorithm hash of name, calling calculate for it unless an
+// earlier call did, and reports whether it came from an earlier call. A call
+// made while another calculates the same hash waits for it. A nil memo
+// always calls calculate.
+func (m *hashMemo) do(name, algorithm string, calculate func() (string, error)) (hash string, shared bool, err error) {
+	if m == nil {
+		hash, err = calculate()
+		return hash, false, err
+	}
+	key := hashKey{name, algorithm}
+	m.mu.Lock()
+	if h, ok := m.hashes[key]; ok {
+		m.mu.Unlock()
+		<-h.done
+		return h.hash, true, h.err
+	}
+	h := &memoHash{done: make(chan struct{})}
+	m.hashes[key] = h
+	m.mu.Unlock()
+
+	h.hash, h.err = calculate()
+	close(h.done)
+	return h.hash, false, h.err
+}
+
+// statName stats name in fsys, falling back to its other Unicode
+// normalization forms when it does not exist as spelled, and returns the
+// spelling that was found.
+func statName(fsys fs.FS, name string) (string, fs.FileInfo, error) {
+	var firstErr error
+	for _, form := range manifest.NameForms(name) {
+		info, err := fs.Stat(fsys, form)
+		if err == nil || !errors.Is(err, fs.ErrNotExist) {
+			return form, info, err
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	return name, nil, firstErr
+}
+
+// uniqueStrings returns the distinct values of list in first-seen order.
+func uniqueStrings(list []string) []string {
+	seen := map[string]bool{}
+	var unique []string
+	for _, s := range list {
+		if !seen[s] {
+			seen[s] = true
+			unique = append(unique, s)
+		}
+	}
+	return unique
+}
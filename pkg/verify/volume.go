@@ -0,0 +1,59 @@
+package verify
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pappasjfed/chkiso/pkg/isofs"
+)
+
+// DataVolume is a drive or device that holds an ordinary file system, such
+// as a USB stick formatted FAT32, exFAT or NTFS, rather than an ISO image.
+// Its files are verified through the file system, and its raw bytes, which
+// change whenever a file is written, are not hashed unless asked to.
+type DataVolume struct {
+	FileSystem string // As the system names it, such as "exFAT" or "vfat"; "" if not known
+	Root       string // Where its files are read: the drive's root or the device's mount point; "" if not mounted
+}
+
+// discFileSystems are the names systems give the file systems of discs and
+// ISO images, which are verified as images.
+var discFileSystems = map[string]bool{"cdfs": true, "udf": true, "iso9660": true, "cd9660": true}
+
+// DataVolume returns the data volume t is, or nil if t is not a drive or
+// device, is an optical drive, or holds an ISO 9660 volume. A device whose
+// file system is not mounted is a data volume if it holds no ISO 9660
+// volume; one that cannot be read is assumed not to be.
+func (t *Target) DataVolume() *DataVolume {
+	if !t.isMedia() {
+		return nil
+	}
+	devicePath, err := t.DevicePath()
+	if err != nil || isofs.IsOptical(devicePath) {
+		return nil
+	}
+	fileSystem, root := mountedVolume(t)
+	if fileSystem != "" {
+		if discFileSystems[strings.ToLower(fileSystem)] {
+			return nil
+		}
+		return &DataVolume{FileSystem: fileSystem, Root: root}
+	}
+	file, _, err := t.openRaw()
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+	if isoVolumeSize(file) > 0 {
+		return nil
+	}
+	return &DataVolume{Root: root}
+}
+
+// String describes the volume for messages, such as "a file system (exfat)".
+func (d *DataVolume) String() string {
+	if d.FileSystem == "" {
+		return "a file system"
+	}
+	return fmt.Sprintf("a file system (%s)", d.FileSystem)
+}
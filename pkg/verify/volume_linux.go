@@ -0,0 +1,91 @@
+//go:build linux
+
+package verify
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// mountEntry is a mounted file system.
+type mountEntry struct {
+	source     string // Device, with symbolic links resolved
+	dir        string
+	fileSystem string
+}
+
+// mounts lists the mounted file systems of devices in /dev.
+func mounts() []mountEntry {
+	file, err := os.Open("/proc/self/mounts")
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+	var entries []mountEntry
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 3 || !strings.HasPrefix(fields[0], "/dev/") {
+			continue
+		}
+		source := fields[0]
+		if resolved, err := filepath.EvalSymlinks(source); err == nil {
+			source = resolved
+		}
+		entries = append(entries, mountEntry{source: source, dir: unescapeMount(fields[1]), fileSystem: fields[2]})
+	}
+	return entries
+}
+
+// unescapeMount decodes the octal escapes, such as \040 for a space, that
+// /proc/self/mounts writes in mount points.
+func unescapeMount(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+4 <= len(s) {
+			if n, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(n))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// isPartitionOf reports whether the block device named part, such as sdb1,
+// is a partition of the disk named disk, such as sdb.
+func isPartitionOf(part, disk string) bool {
+	_, err := os.Stat(filepath.Join("/sys/class/block", disk, part))
+	return part != disk && err == nil
+}
+
+// mountedVolume returns the file system of a device and where it is
+// mounted. For a whole disk whose only mounted file system is on one of
+// its partitions, as is usual for USB sticks, that one is returned.
+func mountedVolume(t *Target) (fileSystem, root string) {
+	if !t.IsDevice {
+		return "", ""
+	}
+	device := t.Path
+	if resolved, err := filepath.EvalSymlinks(device); err == nil {
+		device = resolved
+	}
+	var onPartitions []mountEntry
+	for _, m := range mounts() {
+		if m.source == device {
+			return m.fileSystem, m.dir
+		}
+		if isPartitionOf(filepath.Base(m.source), filepath.Base(device)) {
+			onPartitions = append(onPartitions, m)
+		}
+	}
+	if len(onPartitions) == 1 {
+		return onPartitions[0].fileSystem, onPartitions[0].dir
+	}
+	return "", ""
+}
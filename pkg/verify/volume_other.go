@@ -0,0 +1,50 @@
+//go:build !windows && !linux
+
+package verify
+
+import (
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// mountedVolume returns the file system of a device and where it is
+// mounted, from the output of mount(8), whose lines on macOS and the BSDs
+// read "/dev/disk4s1 on /Volumes/STICK (msdosfs, local, ...)". For a whole
+// disk whose only mounted file system is on one of its slices, as is usual
+// for USB sticks, that one is returned.
+func mountedVolume(t *Target) (fileSystem, root string) {
+	if !t.IsDevice {
+		return "", ""
+	}
+	out, err := exec.Command("mount").Output()
+	if err != nil {
+		return "", ""
+	}
+	// The raw device of a disk is mounted under its block device's name
+	dir, name := filepath.Split(t.Path)
+	if strings.HasPrefix(name, "rdisk") {
+		name = name[1:]
+	}
+	device := dir + name
+	var onSlices [][2]string
+	for _, line := range strings.Split(string(out), "\n") {
+		source, rest, ok := strings.Cut(line, " on ")
+		open := strings.LastIndex(rest, " (")
+		if !ok || open < 0 {
+			continue
+		}
+		mountPoint := rest[:open]
+		fileSystem, _, _ := strings.Cut(strings.TrimSuffix(rest[open+2:], ")"), ",")
+		if source == device {
+			return fileSystem, mountPoint
+		}
+		if slice := strings.TrimPrefix(source, device); slice != source && (strings.HasPrefix(slice, "s") || strings.HasPrefix(slice, "p")) {
+			onSlices = append(onSlices, [2]string{fileSystem, mountPoint})
+		}
+	}
+	if len(onSlices) == 1 {
+		return onSlices[0][0], onSlices[0][1]
+	}
+	return "", ""
+}
@@ -0,0 +1,26 @@
+//go:build windows
+
+package verify
+
+import (
+	"golang.org/x/sys/windows"
+)
+
+// mountedVolume returns the file system of a drive and its root, as
+// GetVolumeInformation reports it. Drives are read through their root, so
+// reading it needs no Administrator rights.
+func mountedVolume(t *Target) (fileSystem, root string) {
+	if !t.IsDrive {
+		return "", ""
+	}
+	root = t.Root()
+	path, err := windows.UTF16PtrFromString(root)
+	if err != nil {
+		return "", root
+	}
+	name := make([]uint16, windows.MAX_PATH+1)
+	if err := windows.GetVolumeInformation(path, nil, 0, nil, nil, nil, &name[0], uint32(len(name))); err != nil {
+		return "", root
+	}
+	return windows.UTF16ToString(name), root
+}
@@ -0,0 +1,46 @@
+package verify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"time"
+)
+
+// WaitForMedia polls the drive or device of t every interval until it holds
+// a readable ISO 9660 volume, such as a disc a burning application has just
+// finalized and ejected or reloaded, and returns the volume's label. While
+// the drive is empty, busy or holds a blank disc, reads fail and it waits
+// on; it gives up at once if the device may not be read. When label is not empty, a volume with another label, such as the disc
+// that was in the drive before, is waited past too, and other is called with
+// its label each time a different one appears.
+func WaitForMedia(ctx context.Context, t *Target, label string, interval time.Duration, other func(found string)) (string, error) {
+	if !t.IsDrive && !t.IsDevice {
+		return "", fmt.Errorf("%s is not a drive or device to wait for media in", t)
+	}
+	last := ""
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if found, err := VolumeLabel(t); err == nil {
+			if label == "" || sameLabel(found, label) {
+				return found, nil
+			}
+			if found != last && other != nil {
+				other(found)
+			}
+			last = found
+		} else if errors.Is(err, fs.ErrPermission) {
+			// Waiting will not help
+			return "", err
+		} else {
+			last = ""
+		}
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
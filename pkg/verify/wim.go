@@ -0,0 +1,33 @@
+package verify
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+
+	"github.com/pappasjfed/chkiso/pkg/wim"
+)
+
+// IsWIM reports whether the target is a Windows Imaging Format file (.wim,
+// .esd or a .swm part).
+func (t *Target) IsWIM() bool {
+	if t.IsDrive || t.IsDir {
+		return false
+	}
+	switch strings.ToLower(filepath.Ext(t.ImagePath())) {
+	case ".wim", ".esd", ".swm":
+		return true
+	}
+	return false
+}
+
+// WIMIntegrity checks the structure of a WIM target: its integrity table
+// and the SHA-1 hashes of its resources.
+func WIMIntegrity(ctx context.Context, t *Target) (*wim.Result, error) {
+	file, size, err := t.open()
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return wim.Check(ctx, file, size)
+}
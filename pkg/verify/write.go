@@ -0,0 +1,186 @@
+package verify
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"syscall"
+
+	"github.com/pappasjfed/chkiso/internal/ctxio"
+	"github.com/pappasjfed/chkiso/internal/pipeline"
+	"github.com/pappasjfed/chkiso/pkg/isofs"
+)
+
+const (
+	// writeBlock is the size of the writes to a device. Whole blocks keep
+	// every write aligned to sectors, which Windows requires of raw disks.
+	writeBlock = 1 << 20
+	// deviceSector is the sector size writes to a device are padded to.
+	deviceSector = 512
+)
+
+// WriteResult is the outcome of WriteImage.
+type WriteResult struct {
+	Size     int64  // Bytes of the image written
+	Sha256   string // Of the image, as read from the source
+	ReadBack string // SHA256 of the same bytes read back from the device
+}
+
+// Match reports whether the device holds the image.
+func (r *WriteResult) Match() bool {
+	return r.Sha256 == r.ReadBack
+}
+
+// CheckWriteDevice checks that device is a whole disk, such as /dev/sdX or
+// \\.\PhysicalDriveN, that an image may be written to: not a partition, an
+// optical drive, or a disk that is mounted or holds the running system. It
+// returns the size of the disk.
+func CheckWriteDevice(device string) (int64, error) {
+	if isofs.IsOptical(device) {
+		return 0, fmt.Errorf("%s is an optical drive; burn the image with a disc burning tool instead", device)
+	}
+	if err := checkDevice(device); err != nil {
+		return 0, err
+	}
+	file, size, err := isofs.Open(device)
+	if err != nil {
+		return 0, err
+	}
+	file.Close()
+	return size, nil
+}
+
+// WriteImage writes the image of t to device, replacing everything on it,
+// and then reads the written bytes back to check them against the SHA256
+// of the image, which is calculated from the same reads as the write. A
+// compressed image is decompressed as it is written. Bytes written are
+// reported through progress with the phase "write", and bytes read back
+// with the phase "read-back".
+func WriteImage(ctx context.Context, t *Target, device string, progress ProgressFunc) (*WriteResult, error) {
+	if t.IsDir {
+		return nil, fmt.Errorf("%s is a directory, which has no image to write", t.Path)
+	}
+	deviceSize, err := CheckWriteDevice(device)
+	if err != nil {
+		return nil, err
+	}
+	file, size, err := t.open()
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	if size > deviceSize {
+		return nil, fmt.Errorf("the image (%d bytes) does not fit on %s (%d bytes)", size, device, deviceSize)
+	}
+
+	path, release, err := prepareDevice(device)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	result := &WriteResult{Size: size}
+	sha := sha256.New()
+	out, err := os.OpenFile(path, os.O_WRONLY|exclusiveOpen, 0)
+	if errors.Is(err, syscall.EBUSY) {
+		return nil, fmt.Errorf("%s is in use by the system; unmount it and stop anything built on it first", device)
+	}
+	if err != nil {
+		return nil, err
+	}
+	blocks := &blockWriter{w: out, buf: make([]byte, 0, writeBlock)}
+	reader := &progressReader{r: ctxio.NewReader(ctx, io.NewSectionReader(file, 0, size)), phase: "write", item: t.String(), total: size, progress: progress}
+	n, err := pipeline.CopyAhead(ctx, io.MultiWriter(blocks, sha), reader, t.readAhead())
+	if err == nil && n < size {
+		err = io.ErrUnexpectedEOF
+	}
+	if err == nil {
+		err = blocks.flush()
+	}
+	if err == nil {
+		err = out.Sync()
+	}
+	if err == nil {
+		// Read back what is on the device, not what is in the cache
+		dropCache(out)
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not write %s: %v", device, err)
+	}
+	result.Sha256 = hex.EncodeToString(sha.Sum(nil))
+
+	written, _, err := isofs.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer written.Close()
+	// The last block was padded to a whole sector, so it is read whole too
+	padded := (size + deviceSector - 1) / deviceSector * deviceSector
+	readBack := sha256.New()
+	reader = &progressReader{r: ctxio.NewReader(ctx, io.NewSectionReader(written, 0, padded)), phase: "read-back", item: device, total: size, progress: progress}
+	if _, err := pipeline.Copy(ctx, &prefixWriter{w: readBack, left: size}, reader); err != nil {
+		return nil, fmt.Errorf("could not read back %s: %v", device, err)
+	}
+	result.ReadBack = hex.EncodeToString(readBack.Sum(nil))
+	return result, nil
+}
+
+// blockWriter writes to w in whole blocks of cap(buf) bytes.
+type blockWriter struct {
+	w   io.Writer
+	buf []byte
+}
+
+func (b *blockWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		k := copy(b.buf[len(b.buf):cap(b.buf)], p)
+		b.buf = b.buf[:len(b.buf)+k]
+		p = p[k:]
+		if len(b.buf) == cap(b.buf) {
+			if err := b.flush(); err != nil {
+				return n - len(p), err
+			}
+		}
+	}
+	return n, nil
+}
+
+// flush writes what is buffered, padded with zeros to a whole sector.
+func (b *blockWriter) flush() error {
+	if len(b.buf) == 0 {
+		return nil
+	}
+	for len(b.buf)%deviceSector != 0 {
+		b.buf = append(b.buf, 0)
+	}
+	_, err := b.w.Write(b.buf)
+	b.buf = b.buf[:0]
+	return err
+}
+
+// prefixWriter passes the first left bytes written to it on to w and
+// drops the rest.
+type prefixWriter struct {
+	w    io.Writer
+	left int64
+}
+
+func (p *prefixWriter) Write(b []byte) (int, error) {
+	n := len(b)
+	if int64(len(b)) > p.left {
+		b = b[:p.left]
+	}
+	if _, err := p.w.Write(b); err != nil {
+		return 0, err
+	}
+	p.left -= int64(len(b))
+	return n, nil
+}
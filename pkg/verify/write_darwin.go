@@ -0,0 +1,88 @@
+//go:build darwin
+
+package verify
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// wholeDiskPattern matches whole disks, such as /dev/disk4 or /dev/rdisk4,
+// and not their slices, such as /dev/disk4s1.
+var wholeDiskPattern = regexp.MustCompile(`^/dev/r?disk[0-9]+$`)
+
+// slicePattern matches a slice, such as disk0s2, and captures its whole
+// disk.
+var slicePattern = regexp.MustCompile(`^(disk[0-9]+)s[0-9]+$`)
+
+// checkDevice checks that device is a whole disk other than the one macOS
+// started from. On APFS the system volume's whole disk is a synthesized
+// container, such as disk3, so the physical disks under the container are
+// refused too.
+func checkDevice(device string) error {
+	if !wholeDiskPattern.MatchString(device) {
+		return fmt.Errorf("%s is not a whole disk such as /dev/disk4", device)
+	}
+	if _, err := os.Stat(device); err != nil {
+		return err
+	}
+	out, err := exec.Command("diskutil", "info", "/").Output()
+	if err != nil {
+		return fmt.Errorf("could not find the disk the running system is on: diskutil info failed: %v", err)
+	}
+	var system []string
+	for _, line := range strings.Split(string(out), "\n") {
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		switch key = strings.TrimSpace(key); {
+		case key == "Part of Whole":
+			system = append(system, strings.TrimSpace(value))
+		case strings.HasPrefix(key, "APFS Physical Store"):
+			// A Fusion Drive lists more than one
+			for _, store := range strings.Split(value, ",") {
+				store = strings.TrimSpace(store)
+				if m := slicePattern.FindStringSubmatch(store); m != nil {
+					store = m[1]
+				}
+				system = append(system, store)
+			}
+		}
+	}
+	if len(system) == 0 {
+		return fmt.Errorf("could not find the disk the running system is on in the output of diskutil info")
+	}
+	disk := strings.TrimPrefix(filepath.Base(device), "r")
+	for _, d := range system {
+		if d == disk {
+			return fmt.Errorf("%s holds the running system", device)
+		}
+	}
+	return nil
+}
+
+// prepareDevice unmounts the disk's volumes, which macOS mounts as soon as a
+// disk is attached, and returns its raw /dev/rdiskN device: writes to it
+// bypass the buffer cache, so reading it back reads the disk.
+func prepareDevice(device string) (string, func(), error) {
+	if out, err := exec.Command("diskutil", "unmountDisk", device).CombinedOutput(); err != nil {
+		return "", nil, fmt.Errorf("could not unmount %s: %s", device, strings.TrimSpace(string(out)))
+	}
+	dir, name := filepath.Split(device)
+	if !strings.HasPrefix(name, "r") {
+		name = "r" + name
+	}
+	return dir + name, func() {}, nil
+}
+
+// exclusiveOpen is not used: macOS has no exclusive open of disks, and
+// prepareDevice has unmounted the disk's volumes.
+const exclusiveOpen = 0
+
+// dropCache does nothing: the raw device is not cached.
+func dropCache(f *os.File) {}
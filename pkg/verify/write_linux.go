@@ -0,0 +1,128 @@
+//go:build linux
+
+package verify
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// checkDevice checks that device is a whole block device, and that neither
+// it nor any of its partitions is mounted, used as swap, or held by another
+// block device, as device-mapper, LVM, md RAID and dm-crypt hold theirs: a
+// root file system on /dev/mapper/vg-root is mounted as /dev/dm-0, not as a
+// partition of the disk under it.
+func checkDevice(device string) error {
+	resolved, err := filepath.EvalSymlinks(device)
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(resolved)
+	if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeDevice == 0 || info.Mode()&os.ModeCharDevice != 0 {
+		return fmt.Errorf("%s is not a block device", device)
+	}
+	name := filepath.Base(resolved)
+	if _, err := os.Stat(filepath.Join("/sys/class/block", name, "partition")); err == nil {
+		return fmt.Errorf("%s is a partition; write the image to the whole disk", device)
+	}
+
+	for _, m := range mounts() {
+		if m.source == resolved || isPartitionOf(filepath.Base(m.source), name) {
+			return fmt.Errorf("%s is mounted on %s; unmount it first", m.source, m.dir)
+		}
+	}
+	for _, swap := range swaps() {
+		if swap == resolved || isPartitionOf(filepath.Base(swap), name) {
+			return fmt.Errorf("%s is in use as swap; run swapoff first", swap)
+		}
+	}
+	devices := append([]string{name}, partitions(name)...)
+	for _, dev := range devices {
+		if holders := holders(dev); len(holders) > 0 {
+			return fmt.Errorf("/dev/%s is in use by %s (device-mapper, LVM, RAID or encryption); stop it first", dev, strings.Join(holders, ", "))
+		}
+	}
+	return nil
+}
+
+// partitions returns the names of the partitions of the disk named disk.
+func partitions(disk string) []string {
+	entries, err := os.ReadDir(filepath.Join("/sys/class/block", disk))
+	if err != nil {
+		return nil
+	}
+	var names []string
+	for _, e := range entries {
+		if _, err := os.Stat(filepath.Join("/sys/class/block", disk, e.Name(), "partition")); err == nil {
+			names = append(names, e.Name())
+		}
+	}
+	return names
+}
+
+// holders returns the block devices built on the one named dev, such as a
+// device-mapper volume on a partition, by their /dev/mapper names where
+// they have one.
+func holders(dev string) []string {
+	entries, err := os.ReadDir(filepath.Join("/sys/class/block", dev, "holders"))
+	if err != nil {
+		return nil
+	}
+	var names []string
+	for _, e := range entries {
+		name := "/dev/" + e.Name()
+		if mapped, err := os.ReadFile(filepath.Join("/sys/class/block", e.Name(), "dm", "name")); err == nil {
+			name = "/dev/mapper/" + strings.TrimSpace(string(mapped))
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+// swaps lists the devices in use as swap, with symbolic links resolved.
+func swaps() []string {
+	file, err := os.Open("/proc/swaps")
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+	var devices []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || fields[1] != "partition" {
+			continue
+		}
+		device := unescapeMount(fields[0])
+		if resolved, err := filepath.EvalSymlinks(device); err == nil {
+			device = resolved
+		}
+		devices = append(devices, device)
+	}
+	return devices
+}
+
+// exclusiveOpen makes opening the device fail with EBUSY while the kernel
+// has it claimed, by a mount, swap or another block device, closing the
+// window between checkDevice and the write.
+const exclusiveOpen = unix.O_EXCL
+
+// prepareDevice returns device as is: Linux lets an unmounted disk be
+// written without further preparation.
+func prepareDevice(device string) (string, func(), error) {
+	return device, func() {}, nil
+}
+
+// dropCache evicts the device's cached pages, so that reading it back reads
+// the disk.
+func dropCache(f *os.File) {
+	unix.Fadvise(int(f.Fd()), 0, 0, unix.FADV_DONTNEED)
+}
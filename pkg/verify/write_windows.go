@@ -0,0 +1,59 @@
+//go:build windows
+
+package verify
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+)
+
+// physicalDrivePattern matches whole disks, such as \\.\PhysicalDrive2.
+var physicalDrivePattern = regexp.MustCompile(`(?i)^\\\\\.\\PhysicalDrive([0-9]+)$`)
+
+// checkDevice checks that device is a \\.\PhysicalDriveN disk that Windows
+// neither started from nor runs from.
+func checkDevice(device string) error {
+	matches := physicalDrivePattern.FindStringSubmatch(device)
+	if matches == nil {
+		return fmt.Errorf(`%s is not a whole disk such as \\.\PhysicalDrive2 (see Get-Disk for the numbers)`, device)
+	}
+	psCommand := fmt.Sprintf("$d = Get-Disk -Number %s -ErrorAction Stop; $d.IsBoot -or $d.IsSystem", matches[1])
+	out, err := exec.Command("powershell", "-NoProfile", "-NonInteractive", "-Command", psCommand).Output()
+	if err != nil {
+		return fmt.Errorf("Get-Disk failed for disk %s: %v", matches[1], err)
+	}
+	if strings.TrimSpace(string(out)) != "False" {
+		return fmt.Errorf("%s holds the running system", device)
+	}
+	return nil
+}
+
+// prepareDevice takes the disk offline for the write: Windows refuses writes
+// to the sectors of a mounted volume, and an offline disk has none. The
+// returned function brings it back online, so that the written image's
+// volumes are mounted.
+func prepareDevice(device string) (string, func(), error) {
+	number := physicalDrivePattern.FindStringSubmatch(device)[1]
+	setOffline := func(offline bool) error {
+		psCommand := fmt.Sprintf("Set-Disk -Number %s -IsOffline $%t -ErrorAction Stop", number, offline)
+		out, err := exec.Command("powershell", "-NoProfile", "-NonInteractive", "-Command", psCommand).CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("Set-Disk failed: %s", strings.TrimSpace(string(out)))
+		}
+		return nil
+	}
+	if err := setOffline(true); err != nil {
+		return "", nil, fmt.Errorf("could not take %s offline: %v", device, err)
+	}
+	return device, func() { setOffline(false) }, nil
+}
+
+// exclusiveOpen is not used: Windows refuses writes to a disk that is
+// online, and prepareDevice takes it offline.
+const exclusiveOpen = 0
+
+// dropCache does nothing: Windows does not cache raw disk reads.
+func dropCache(f *os.File) {}
@@ -0,0 +1,275 @@
+// Package wim checks Windows Imaging Format files (.wim, .esd, .swm)
+// structurally: the header, the resource lookup table, the integrity table
+// of SHA-1 chunk hashes, and the SHA-1 of every resource that can be read
+// without decompression.
+package wim
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/pappasjfed/chkiso/internal/ctxio"
+)
+
+const (
+	headerSize      = 208
+	lookupEntrySize = 50
+)
+
+// ErrNotWIM is returned when the data does not start with a WIM header.
+var ErrNotWIM = errors.New("not a WIM image (no 'MSWIM' header)")
+
+// Header flags.
+const (
+	flagCompressed = 0x00000002
+	flagXpress     = 0x00020000
+	flagLZX        = 0x00040000
+	flagLZMS       = 0x00080000
+)
+
+// Resource flags.
+const (
+	resFree       = 0x01
+	resMetadata   = 0x02
+	resCompressed = 0x04
+	resSpanned    = 0x08
+	resSolid      = 0x10
+)
+
+// resource is a RESHDR_DISK_SHORT: where a resource is stored and how big
+// it is once decompressed.
+type resource struct {
+	Size     int64 // Stored size
+	Flags    byte
+	Offset   int64
+	Original int64 // Uncompressed size
+}
+
+func parseResource(b []byte) resource {
+	size := binary.LittleEndian.Uint64(b[0:8]) & 0x00ffffffffffffff
+	return resource{
+		Size:     int64(size),
+		Flags:    b[7],
+		Offset:   int64(binary.LittleEndian.Uint64(b[8:16])),
+		Original: int64(binary.LittleEndian.Uint64(b[16:24])),
+	}
+}
+
+// Header is the fixed header at the start of a WIM.
+type Header struct {
+	Version     uint32
+	Flags       uint32
+	Compression string // "none", "XPRESS", "LZX" or "LZMS"
+	PartNumber  int
+	TotalParts  int
+	ImageCount  int
+	lookup      resource
+	xml         resource
+	integrity   resource
+}
+
+// Result is the outcome of checking a WIM.
+type Result struct {
+	Header Header
+
+	// Integrity is the integrity table check: IntegrityChunks chunks of
+	// the file were hashed and IntegrityFailed of them did not match. It is
+	// false when the WIM was captured without /CheckIntegrity.
+	Integrity       bool
+	IntegrityChunks int
+	IntegrityFailed int
+
+	Resources        int // Resources listed in the lookup table for this part
+	ResourcesChecked int // Resources whose SHA-1 was verified
+	ResourcesFailed  int
+	// Problems lists structural errors: resources outside the file, hash
+	// mismatches, malformed tables.
+	Problems []string
+}
+
+// OK reports whether no problems were found.
+func (r *Result) OK() bool {
+	return len(r.Problems) == 0
+}
+
+// Check reads the WIM in r, which is size bytes long, and verifies its
+// integrity table and resource hashes. Resources compressed with LZX, LZMS
+// or XPRESS are not decompressed; the integrity table, when present, still
+// covers their stored bytes. It returns ErrNotWIM if r holds no WIM, and
+// stops early with ctx.Err() if ctx is cancelled.
+func Check(ctx context.Context, r io.ReaderAt, size int64) (*Result, error) {
+	b := make([]byte, headerSize)
+	if _, err := r.ReadAt(b, 0); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, ErrNotWIM
+		}
+		return nil, err
+	}
+	if string(b[0:8]) != "MSWIM\x00\x00\x00" {
+		return nil, ErrNotWIM
+	}
+	h := Header{
+		Version:    binary.LittleEndian.Uint32(b[12:16]),
+		Flags:      binary.LittleEndian.Uint32(b[16:20]),
+		PartNumber: int(binary.LittleEndian.Uint16(b[40:42])),
+		TotalParts: int(binary.LittleEndian.Uint16(b[42:44])),
+		ImageCount: int(binary.LittleEndian.Uint32(b[44:48])),
+		lookup:     parseResource(b[48:72]),
+		xml:        parseResource(b[72:96]),
+		integrity:  parseResource(b[124:148]),
+	}
+	h.Compression = "none"
+	if h.Flags&flagCompressed != 0 {
+		switch {
+		case h.Flags&flagLZMS != 0:
+			h.Compression = "LZMS"
+		case h.Flags&flagLZX != 0:
+			h.Compression = "LZX"
+		case h.Flags&flagXpress != 0:
+			h.Compression = "XPRESS"
+		default:
+			h.Compression = "unknown"
+		}
+	}
+
+	result := &Result{Header: h}
+	problem := func(format string, args ...interface{}) {
+		result.Problems = append(result.Problems, fmt.Sprintf(format, args...))
+	}
+	if size := binary.LittleEndian.Uint32(b[8:12]); size != headerSize {
+		problem("header size is %d bytes, expected %d", size, headerSize)
+	}
+	inFile := func(res resource) bool {
+		// By subtraction, which cannot overflow
+		return res.Offset >= headerSize && res.Size >= 0 && res.Size <= size-res.Offset
+	}
+	if !inFile(h.lookup) {
+		problem("lookup table lies outside the file")
+		return result, nil
+	}
+	if h.xml.Size > 0 && !inFile(h.xml) {
+		problem("XML data lies outside the file")
+	}
+
+	if h.integrity.Size > 0 {
+		if !inFile(h.integrity) {
+			problem("integrity table lies outside the file")
+		} else if err := checkIntegrity(ctx, r, h, result); err != nil {
+			if ctx.Err() != nil {
+				return result, ctx.Err()
+			}
+			problem("integrity table: %v", err)
+		}
+	}
+
+	table := make([]byte, h.lookup.Size)
+	if _, err := r.ReadAt(table, h.lookup.Offset); err != nil {
+		problem("could not read the lookup table: %v", err)
+		return result, nil
+	}
+	if len(table)%lookupEntrySize != 0 {
+		problem("lookup table size %d is not a multiple of %d", len(table), lookupEntrySize)
+	}
+	metadata := 0
+	for i := 0; i+lookupEntrySize <= len(table); i += lookupEntrySize {
+		e := table[i:]
+		res := parseResource(e[0:24])
+		part := int(binary.LittleEndian.Uint16(e[24:26]))
+		hash := hex.EncodeToString(e[30:50])
+		if part != h.PartNumber || res.Flags&resFree != 0 {
+			continue
+		}
+		result.Resources++
+		if res.Flags&resMetadata != 0 {
+			metadata++
+		}
+		if !inFile(res) {
+			problem("resource %s lies outside the file", hash)
+			result.ResourcesFailed++
+			continue
+		}
+		if res.Flags&(resCompressed|resSpanned|resSolid) != 0 || res.Size != res.Original {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+		sum := sha1.New()
+		if _, err := io.Copy(sum, ctxio.NewReader(ctx, io.NewSectionReader(r, res.Offset, res.Size))); err != nil {
+			if ctx.Err() != nil {
+				return result, ctx.Err()
+			}
+			problem("could not read resource %s: %v", hash, err)
+			result.ResourcesFailed++
+			continue
+		}
+		result.ResourcesChecked++
+		if got := hex.EncodeToString(sum.Sum(nil)); got != hash {
+			problem("resource at offset %d has SHA-1 %s, expected %s", res.Offset, got, hash)
+			result.ResourcesFailed++
+		}
+	}
+	if h.PartNumber == 1 && metadata != h.ImageCount {
+		problem("header declares %d image(s) but the lookup table has %d metadata resource(s)", h.ImageCount, metadata)
+	}
+	return result, nil
+}
+
+// checkIntegrity verifies the integrity table: SHA-1 hashes of fixed-size
+// chunks covering everything from the end of the header to the end of the
+// lookup table.
+func checkIntegrity(ctx context.Context, r io.ReaderAt, h Header, result *Result) error {
+	table := make([]byte, h.integrity.Size)
+	if _, err := r.ReadAt(table, h.integrity.Offset); err != nil {
+		return err
+	}
+	if len(table) < 12 {
+		return fmt.Errorf("truncated")
+	}
+	count := int(binary.LittleEndian.Uint32(table[4:8]))
+	chunkSize := int64(binary.LittleEndian.Uint32(table[8:12]))
+	if chunkSize <= 0 || count < 0 || 12+20*count > len(table) {
+		return fmt.Errorf("malformed header (%d chunks of %d bytes)", count, chunkSize)
+	}
+	end := h.lookup.Offset + h.lookup.Size
+	if want := (end - headerSize + chunkSize - 1) / chunkSize; int64(count) != want {
+		return fmt.Errorf("lists %d chunks, expected %d", count, want)
+	}
+
+	result.Integrity = true
+	// No chunk is larger than what the table covers
+	buf := make([]byte, min64(chunkSize, end-headerSize))
+	for i := 0; i < count; i++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		start := headerSize + int64(i)*chunkSize
+		n := chunkSize
+		if start+n > end {
+			n = end - start
+		}
+		if _, err := r.ReadAt(buf[:n], start); err != nil {
+			return err
+		}
+		sum := sha1.Sum(buf[:n])
+		result.IntegrityChunks++
+		if !bytes.Equal(sum[:], table[12+20*i:32+20*i]) {
+			result.IntegrityFailed++
+			result.Problems = append(result.Problems, fmt.Sprintf("integrity chunk %d (bytes %d-%d) does not match", i, start, start+n-1))
+		}
+	}
+	return nil
+}
+
+func min64(a, b int64) int64 {
+	if a < b {
+		return a
+	}
+	return b
+}
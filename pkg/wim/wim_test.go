@@ -0,0 +1,194 @@
+package wim
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/binary"
+	"errors"
+	"math"
+	"strings"
+	"testing"
+)
+
+// testWIM describes a WIM to build: a file resource, a metadata resource,
+// the lookup table listing both, and an integrity table over them in chunks
+// of chunkSize bytes (none if zero).
+type testWIM struct {
+	chunkSize uint32
+	// edit changes the built file; offsets are in the layout it gets
+	edit func(b []byte, l layout)
+}
+
+// layout locates the parts of a built WIM.
+type layout struct {
+	file, metadata, lookup, integrity int
+}
+
+func putResource(b []byte, size uint64, flags byte, offset, original uint64) {
+	binary.LittleEndian.PutUint64(b[0:8], size)
+	b[7] = flags
+	binary.LittleEndian.PutUint64(b[8:16], offset)
+	binary.LittleEndian.PutUint64(b[16:24], original)
+}
+
+func (w testWIM) build() []byte {
+	file := []byte("file resource data")
+	metadata := []byte("metadata resource")
+	var l layout
+	b := make([]byte, headerSize)
+	copy(b, "MSWIM\x00\x00\x00")
+	binary.LittleEndian.PutUint32(b[8:12], headerSize)
+	binary.LittleEndian.PutUint32(b[12:16], 0x10d00)
+	binary.LittleEndian.PutUint16(b[40:42], 1)
+	binary.LittleEndian.PutUint16(b[42:44], 1)
+	binary.LittleEndian.PutUint32(b[44:48], 1)
+
+	l.file = len(b)
+	b = append(b, file...)
+	l.metadata = len(b)
+	b = append(b, metadata...)
+
+	l.lookup = len(b)
+	for _, res := range []struct {
+		data   []byte
+		offset int
+		flags  byte
+	}{{file, l.file, 0}, {metadata, l.metadata, resMetadata}} {
+		e := make([]byte, lookupEntrySize)
+		putResource(e, uint64(len(res.data)), res.flags, uint64(res.offset), uint64(len(res.data)))
+		binary.LittleEndian.PutUint16(e[24:26], 1)
+		binary.LittleEndian.PutUint32(e[26:30], 1)
+		sum := sha1.Sum(res.data)
+		copy(e[30:50], sum[:])
+		b = append(b, e...)
+	}
+	putResource(b[48:72], uint64(len(b)-l.lookup), 0, uint64(l.lookup), uint64(len(b)-l.lookup))
+
+	if w.chunkSize > 0 {
+		covered := b[headerSize:]
+		var hashes []byte
+		count := 0
+		for start := 0; start < len(covered); start += int(w.chunkSize) {
+			end := start + int(w.chunkSize)
+			if end > len(covered) {
+				end = len(covered)
+			}
+			sum := sha1.Sum(covered[start:end])
+			hashes = append(hashes, sum[:]...)
+			count++
+		}
+		table := make([]byte, 12)
+		binary.LittleEndian.PutUint32(table[0:4], uint32(12+len(hashes)))
+		binary.LittleEndian.PutUint32(table[4:8], uint32(count))
+		binary.LittleEndian.PutUint32(table[8:12], w.chunkSize)
+		table = append(table, hashes...)
+		l.integrity = len(b)
+		putResource(b[124:148], uint64(len(table)), 0, uint64(l.integrity), uint64(len(table)))
+		b = append(b, table...)
+	}
+	if w.edit != nil {
+		w.edit(b, l)
+	}
+	return b
+}
+
+func check(t *testing.T, data []byte) *Result {
+	t.Helper()
+	result, err := Check(context.Background(), bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+func TestCheck(t *testing.T) {
+	for _, chunkSize := range []uint32{0, 16, 1000, math.MaxUint32} {
+		result := check(t, testWIM{chunkSize: chunkSize}.build())
+		if !result.OK() {
+			t.Errorf("chunks of %d: problems %q", chunkSize, result.Problems)
+		}
+		if result.Resources != 2 || result.ResourcesChecked != 2 {
+			t.Errorf("chunks of %d: checked %d of %d resources, want 2 of 2", chunkSize, result.ResourcesChecked, result.Resources)
+		}
+		if result.Integrity != (chunkSize > 0) {
+			t.Errorf("chunks of %d: Integrity = %v", chunkSize, result.Integrity)
+		}
+	}
+}
+
+func TestNotWIM(t *testing.T) {
+	for _, data := range [][]byte{nil, make([]byte, 100), make([]byte, 1000), testWIM{}.build()[:headerSize-1]} {
+		if _, err := Check(context.Background(), bytes.NewReader(data), int64(len(data))); !errors.Is(err, ErrNotWIM) {
+			t.Errorf("Check(%d bytes) = %v, want ErrNotWIM", len(data), err)
+		}
+	}
+}
+
+func TestProblems(t *testing.T) {
+	tests := []struct {
+		name      string
+		chunkSize uint32
+		edit      func(b []byte, l layout)
+		want      string // Expected among the problems
+	}{
+		{"damaged resource", 16, func(b []byte, l layout) { b[l.file] ^= 1 }, "has SHA-1"},
+		{"damaged resource, integrity", 16, func(b []byte, l layout) { b[l.file] ^= 1 }, "integrity chunk 0"},
+		{"header size", 0, func(b []byte, l layout) { binary.LittleEndian.PutUint32(b[8:12], 200) }, "header size is 200 bytes"},
+		{"lookup table past the end", 0, func(b []byte, l layout) { binary.LittleEndian.PutUint64(b[56:64], 1<<40) }, "lookup table lies outside"},
+		{"lookup table offset overflow", 0, func(b []byte, l layout) {
+			putResource(b[48:72], 1<<55, 0, math.MaxInt64-10, 1<<55)
+		}, "lookup table lies outside"},
+		{"lookup table inside the header", 0, func(b []byte, l layout) { binary.LittleEndian.PutUint64(b[56:64], 10) }, "lookup table lies outside"},
+		{"lookup table size", 0, func(b []byte, l layout) { b[48]-- }, "not a multiple of 50"},
+		{"resource past the end", 0, func(b []byte, l layout) {
+			binary.LittleEndian.PutUint64(b[l.lookup+8:], 1<<40)
+		}, "lies outside the file"},
+		{"resource offset overflow", 0, func(b []byte, l layout) {
+			putResource(b[l.lookup:], 1<<55, 0, math.MaxInt64-10, 1<<55)
+		}, "lies outside the file"},
+		{"image count", 0, func(b []byte, l layout) { binary.LittleEndian.PutUint32(b[44:48], 2) }, "declares 2 image(s)"},
+		{"XML past the end", 0, func(b []byte, l layout) { putResource(b[72:96], 100, 0, 1<<40, 100) }, "XML data lies outside"},
+		{"integrity table past the end", 16, func(b []byte, l layout) {
+			binary.LittleEndian.PutUint64(b[132:140], 1<<40)
+		}, "integrity table lies outside"},
+		{"integrity table truncated", 16, func(b []byte, l layout) { putResource(b[124:148], 8, 0, uint64(l.integrity), 8) }, "truncated"},
+		{"integrity chunk count past the table", 16, func(b []byte, l layout) {
+			binary.LittleEndian.PutUint32(b[l.integrity+4:], 1<<30)
+		}, "malformed header"},
+		{"integrity chunk size zero", 16, func(b []byte, l layout) {
+			binary.LittleEndian.PutUint32(b[l.integrity+8:], 0)
+		}, "malformed header"},
+		{"integrity chunk count wrong", 16, func(b []byte, l layout) {
+			binary.LittleEndian.PutUint32(b[l.integrity+8:], 32)
+		}, "expected"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := check(t, testWIM{chunkSize: tt.chunkSize, edit: tt.edit}.build())
+			if problems := strings.Join(result.Problems, "; "); !strings.Contains(problems, tt.want) {
+				t.Errorf("problems %q, want %q", problems, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompressedResourcesSkipped(t *testing.T) {
+	data := testWIM{edit: func(b []byte, l layout) {
+		b[l.lookup+7] |= resCompressed
+		b[l.file] ^= 1 // Not noticed without an integrity table
+	}}.build()
+	result := check(t, data)
+	if !result.OK() || result.ResourcesChecked != 1 {
+		t.Errorf("checked %d resources, problems %q; want 1 and none", result.ResourcesChecked, result.Problems)
+	}
+}
+
+func TestCancel(t *testing.T) {
+	data := testWIM{chunkSize: 16}.build()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := Check(ctx, bytes.NewReader(data), int64(len(data))); !errors.Is(err, context.Canceled) {
+		t.Errorf("Check = %v, want context.Canceled", err)
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"embed"
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/template"
+)
+
+// powershellFiles holds the PowerShell module wrapping `chkiso -json`.
+//
+//go:embed powershell/ChkIso.psm1 powershell/ChkIso.psd1.tmpl
+var powershellFiles embed.FS
+
+// writePowerShellModule implements `chkiso powershell-module <dir>`, which
+// the build uses to generate the ChkIso module with a matching version.
+func writePowerShellModule(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	psm1, err := powershellFiles.ReadFile("powershell/ChkIso.psm1")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, "ChkIso.psm1"), psm1, 0644); err != nil {
+		return err
+	}
+
+	tmpl, err := template.ParseFS(powershellFiles, "powershell/ChkIso.psd1.tmpl")
+	if err != nil {
+		return err
+	}
+	psd1, err := os.Create(filepath.Join(dir, "ChkIso.psd1"))
+	if err != nil {
+		return err
+	}
+	defer psd1.Close()
+	if err := tmpl.Execute(psd1, struct{ Version string }{VERSION}); err != nil {
+		return err
+	}
+
+	fmt.Printf("PowerShell module written to: %s\n", dir)
+	return nil
+}
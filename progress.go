@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pappasjfed/chkiso/pkg/verify"
+)
+
+// progressInterval is how often -progress json reports bytes read.
+const progressInterval = 500 * time.Millisecond
+
+// progressRecord is one line of -progress json output.
+type progressRecord struct {
+	Time    time.Time `json:"time"`
+	Phase   string    `json:"phase"`
+	Item    string    `json:"item,omitempty"`
+	Bytes   int64     `json:"bytes,omitempty"`
+	Total   int64     `json:"total,omitempty"`
+	Percent float64   `json:"percent,omitempty"`
+	Rate    int64     `json:"rate,omitempty"`   // Bytes per second since the phase started
+	Status  string    `json:"status,omitempty"` // Verdict of a verified file
+}
+
+// jsonProgress writes progress events as JSON lines for wrappers that render
+// their own progress: step begin and end, bytes read by the hashing phases
+// every progressInterval and when they finish, files as they are verified,
+// and warnings.
+type jsonProgress struct {
+	mu      sync.Mutex
+	enc     *json.Encoder
+	phase   string    // Byte-counting phase in progress
+	started time.Time // When it started
+	last    time.Time // When it was last reported
+}
+
+func newJSONProgress(w io.Writer) *jsonProgress {
+	return &jsonProgress{enc: json.NewEncoder(w)}
+}
+
+func (p *jsonProgress) event(ev verify.Progress) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now()
+	rec := progressRecord{Time: now, Phase: ev.Phase, Item: ev.Item}
+	switch ev.Phase {
+	case "begin", "end", "warning", "manifest":
+		p.phase = ""
+	case "contents":
+		if ev.File != nil {
+			rec.Status = string(ev.File.Status)
+		}
+	case "info", "discovered":
+		return
+	default:
+		// Bytes read while hashing
+		if ev.Phase != p.phase {
+			p.phase, p.started, p.last = ev.Phase, now, time.Time{}
+		}
+		finished := ev.Total > 0 && ev.Done >= ev.Total
+		if !finished && now.Sub(p.last) < progressInterval {
+			return
+		}
+		p.last = now
+		rec.Bytes, rec.Total = ev.Done, ev.Total
+		if ev.Total > 0 {
+			rec.Percent = float64(ev.Done*1000/ev.Total) / 10
+		}
+		if elapsed := now.Sub(p.started).Seconds(); elapsed > 0 {
+			rec.Rate = int64(float64(ev.Done) / elapsed)
+		}
+	}
+	p.enc.Encode(rec)
+}
+
+// openProgressOutput returns where -progress records go: stderr, or the
+// file descriptor given with -progress-fd (a handle on Windows), which the
+// wrapper must have opened for chkiso.
+func openProgressOutput(fd int) (io.Writer, error) {
+	if fd <= 0 || fd == 2 {
+		return os.Stderr, nil
+	}
+	if fd == 1 {
+		return os.Stdout, nil
+	}
+	f := os.NewFile(uintptr(fd), fmt.Sprintf("fd %d", fd))
+	if _, err := f.Stat(); err != nil {
+		return nil, fmt.Errorf("-progress-fd %d is not open: %v", fd, err)
+	}
+	return f, nil
+}
@@ -0,0 +1,583 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/pappasjfed/chkiso/internal/i18n"
+	"github.com/pappasjfed/chkiso/internal/rfc3161"
+	"github.com/pappasjfed/chkiso/pkg/verify"
+)
+
+// tsaTimeout bounds the request to a time stamping authority.
+const tsaTimeout = 30 * time.Second
+
+// Report is the record of one verification run, saved by -report and printed
+// by -json. Field names are a stable interface for scripts; only add fields.
+type Report struct {
+	Tool           string           `json:"tool"`
+	Version        string           `json:"version"`
+	Generated      time.Time        `json:"generated"`
+	Target         string           `json:"target"`
+	Operator       string           `json:"operator,omitempty"`
+	Host           string           `json:"host,omitempty"`
+	Result         string           `json:"result"`             // PASSED, FAILED, or WEAK with -weak-evidence warn
+	Evidence       string           `json:"evidence,omitempty"` // none, weak, or strong
+	Label          *ReportLabel     `json:"volume_label,omitempty"`
+	Size           *ReportFileSize  `json:"size,omitempty"`
+	SHA256         string           `json:"sha256,omitempty"`
+	Partition      *ReportPartition `json:"partition,omitempty"`         // Set when one partition of a disk image was verified
+	Range          *ReportRange     `json:"range,omitempty"`             // Set when sha256 covers only part of the target
+	Compressed     string           `json:"compressed_sha256,omitempty"` // SHA256 of a compressed image's file; sha256 is the image inside
+	DataVolume     *ReportVolume    `json:"data_volume,omitempty"`       // Set when the target holds an ordinary file system rather than an image
+	ExpectedSHA256 string           `json:"expected_sha256,omitempty"`
+	Candidates     []string         `json:"candidate_sha256,omitempty"`
+	Matched        string           `json:"matched_sha256,omitempty"`
+	FIPS           bool             `json:"fips,omitempty"` // Only FIPS approved algorithms were used
+	ImplantedMD5   *ReportMD5       `json:"implanted_md5,omitempty"`
+	HashFile       string           `json:"hash_file,omitempty"` // Hash file found next to the image
+	ImageMD5       *ReportHash      `json:"image_md5,omitempty"` // MD5 of the image, from a hash file listing no SHA256
+	HashInName     bool             `json:"hash_in_name,omitempty"`
+	Release        string           `json:"release,omitempty"`
+	KnownGood      []catalogEntry   `json:"known_good,omitempty"` // Known-good catalog entries matching sha256
+	VirusTotal     *virusTotal      `json:"virustotal,omitempty"` // What VirusTotal knows about sha256, with -vt
+	ChecksumURL    string           `json:"checksum_url,omitempty"`
+	DMG            *ReportDMG       `json:"dmg,omitempty"`
+	WIM            *ReportWIM       `json:"wim,omitempty"`
+	Jigdo          *ReportJigdo     `json:"jigdo,omitempty"`
+	ESP            *ReportESP       `json:"esp,omitempty"`
+	BootConfig     *ReportBoot      `json:"boot_config,omitempty"`
+	Kernels        *ReportKernels   `json:"kernels,omitempty"`
+	Contents       *ReportContents  `json:"contents,omitempty"`
+	HashSet        *ReportHashSet   `json:"hash_set,omitempty"`
+	Damage         []ReportDamage   `json:"damage,omitempty"`
+	Warnings       []string         `json:"warnings,omitempty"`
+	Failures       []string         `json:"failures,omitempty"`
+}
+
+// ReportPartition is the disk image partition a Report covers.
+type ReportPartition struct {
+	Index  int    `json:"index"`
+	Type   string `json:"type"`
+	Name   string `json:"name,omitempty"`
+	Offset int64  `json:"offset"`
+	Size   int64  `json:"size"`
+}
+
+// ReportVolume is the file system of a drive or device whose files were
+// verified through it.
+type ReportVolume struct {
+	FileSystem string `json:"file_system,omitempty"`
+	MountPoint string `json:"mount_point,omitempty"`
+}
+
+// ReportLabel is the volume label of the target compared with the expected
+// one.
+type ReportLabel struct {
+	Expected string `json:"expected"`
+	Found    string `json:"found"`
+	Match    bool   `json:"match"`
+}
+
+// ReportFileSize is the size of the target compared with the expected one.
+type ReportFileSize struct {
+	Expected int64 `json:"expected"`
+	Found    int64 `json:"found"`
+	Match    bool  `json:"match"`
+}
+
+// ReportDamage is a suspicious region found with -scan-damage.
+type ReportDamage struct {
+	Offset int64  `json:"offset"`
+	Length int64  `json:"length"`
+	Kind   string `json:"kind"` // "zeros" or "repeated"
+}
+
+// ReportRange is the byte range of the target a partial sha256 covers.
+type ReportRange struct {
+	Offset int64 `json:"offset"`
+	Length int64 `json:"length"` // 0 means to the end
+}
+
+// ReportHash is a hash of the whole target compared with an expected one.
+type ReportHash struct {
+	Expected   string `json:"expected"`
+	Calculated string `json:"calculated"`
+	Valid      bool   `json:"valid"`
+}
+
+// ReportMD5 is the implanted MD5 check in a Report.
+type ReportMD5 struct {
+	Stored     string `json:"stored"`
+	Calculated string `json:"calculated"`
+	Valid      bool   `json:"valid"`
+}
+
+// ReportDMG is the check of the checksums embedded in a DMG in a Report.
+type ReportDMG struct {
+	Checks  []ReportDMGCheck `json:"checks"`
+	Skipped int              `json:"skipped,omitempty"` // Empty or non-CRC32 checksums
+}
+
+// ReportDMGCheck is one embedded DMG checksum in a Report.
+type ReportDMGCheck struct {
+	Name       string `json:"name"`
+	Expected   string `json:"expected"`
+	Calculated string `json:"calculated,omitempty"`
+	Valid      bool   `json:"valid"`
+	Error      string `json:"error,omitempty"`
+}
+
+// ReportWIM is the WIM integrity check in a Report.
+type ReportWIM struct {
+	Compression      string   `json:"compression"`
+	Integrity        bool     `json:"integrity_table"`
+	IntegrityChunks  int      `json:"integrity_chunks"`
+	IntegrityFailed  int      `json:"integrity_failed"`
+	Resources        int      `json:"resources"`
+	ResourcesChecked int      `json:"resources_checked"`
+	ResourcesFailed  int      `json:"resources_failed"`
+	Problems         []string `json:"problems,omitempty"`
+}
+
+// ReportESP is the EFI System Partition of the image in a Report.
+type ReportESP struct {
+	Source     string          `json:"source"` // "El Torito" or "partition N"
+	ISOFile    string          `json:"iso_file,omitempty"`
+	Offset     int64           `json:"offset"`
+	Size       int64           `json:"size"`
+	Sha256     string          `json:"sha256"`
+	FileSystem string          `json:"file_system"`
+	Label      string          `json:"label,omitempty"`
+	Files      []ReportESPFile `json:"files"`
+	Valid      bool            `json:"valid"`
+	Problems   []string        `json:"problems,omitempty"`
+}
+
+// ReportESPFile is a file in the EFI System Partition. ISOSha256 is that of
+// the file of the same path in the ISO 9660 tree, if there is one.
+type ReportESPFile struct {
+	Path       string `json:"path"`
+	Size       int64  `json:"size"`
+	Sha256     string `json:"sha256"`
+	BootLoader bool   `json:"boot_loader,omitempty"`
+	ISOSha256  string `json:"iso_sha256,omitempty"`
+}
+
+// ReportBoot is the boot loader configuration check in a Report.
+type ReportBoot struct {
+	Configs    []string        `json:"configs"`
+	References []ReportBootRef `json:"references"`
+	Valid      bool            `json:"valid"`
+}
+
+// ReportBootRef is a file a boot loader configuration file names.
+type ReportBootRef struct {
+	Config       string `json:"config"`
+	Line         int    `json:"line"`
+	Keyword      string `json:"keyword"`
+	Path         string `json:"path"`
+	Status       string `json:"status"`
+	ChecksumFile string `json:"checksum_file,omitempty"`
+	Algorithm    string `json:"algorithm,omitempty"`
+	Expected     string `json:"expected,omitempty"`
+	Calculated   string `json:"calculated,omitempty"`
+}
+
+// ReportKernels lists the kernels and initrds on the media in a Report.
+type ReportKernels struct {
+	Images []ReportBootImage `json:"images"`
+	Valid  bool              `json:"valid"`
+}
+
+// ReportBootImage is a kernel or initrd in a Report. Expected is the hash
+// a checksum file lists for it, if any.
+type ReportBootImage struct {
+	Path         string `json:"path"`
+	Kind         string `json:"kind"`
+	Size         int64  `json:"size"`
+	Sha256       string `json:"sha256"`
+	Format       string `json:"format,omitempty"`
+	Version      string `json:"version,omitempty"`
+	ChecksumFile string `json:"checksum_file,omitempty"`
+	Algorithm    string `json:"algorithm,omitempty"`
+	Expected     string `json:"expected,omitempty"`
+	Calculated   string `json:"calculated,omitempty"`
+}
+
+// ReportHashSet tells which files on the media a reference hash set lists
+// as known software.
+type ReportHashSet struct {
+	HashSet    string              `json:"hash_set"`
+	Format     string              `json:"format"`
+	Algorithm  string              `json:"algorithm"`
+	Known      int                 `json:"known"`
+	KnownBytes int64               `json:"known_bytes"`
+	Files      []ReportHashSetFile `json:"files"`
+}
+
+// ReportHashSetFile is a file on the media looked up in a hash set.
+type ReportHashSetFile struct {
+	Path  string `json:"path"`
+	Size  int64  `json:"size"`
+	Hash  string `json:"hash"`
+	Known bool   `json:"known"`
+	Name  string `json:"name,omitempty"` // File name the hash set lists for the hash
+}
+
+// ReportJigdo is the check against a jigdo template in a Report.
+type ReportJigdo struct {
+	Algorithm    string   `json:"algorithm"`
+	Expected     string   `json:"expected"`
+	Calculated   string   `json:"calculated"`
+	ExpectedSize int64    `json:"expected_size"`
+	Size         int64    `json:"size"`
+	Packages     int      `json:"packages_checked"`
+	Failed       []string `json:"packages_failed,omitempty"`
+	Template     string   `json:"template,omitempty"` // PASSED or FAILED when the template's own hash was checked
+	Valid        bool     `json:"valid"`
+}
+
+// ReportContents is the content verification in a Report.
+type ReportContents struct {
+	Root          string       `json:"root"`
+	ChecksumFiles []string     `json:"checksum_files"`
+	Total         int          `json:"total"`
+	Failed        int          `json:"failed"`
+	Skipped       int          `json:"skipped,omitempty"` // Entries skipped in FIPS mode
+	Files         []ReportFile `json:"files"`
+	Uncovered     []ReportSize `json:"uncovered,omitempty"` // Files no checksum file lists
+	// Signatures of the checksum files, checked against the trusted key
+	Signatures []ReportSignature `json:"signatures,omitempty"`
+	// Percentages of the files on the media, and of their bytes, that the
+	// checksum files list
+	FileCoverage float64 `json:"file_coverage_percent"`
+	ByteCoverage float64 `json:"byte_coverage_percent"`
+}
+
+// ReportFile is one verified file in a Report.
+type ReportFile struct {
+	Path         string `json:"path"`
+	ChecksumFile string `json:"checksum_file"`
+	Algorithm    string `json:"algorithm"`
+	Status       string `json:"status"`
+	Error        string `json:"error,omitempty"`
+}
+
+// ReportSignature is the signature of a checksum file in a Report.
+type ReportSignature struct {
+	ChecksumFile string `json:"checksum_file"`
+	File         string `json:"file,omitempty"`
+	Status       string `json:"status"`
+	Detail       string `json:"detail"`
+}
+
+// ReportSize is a file on the media, with its size, in a Report.
+type ReportSize struct {
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+}
+
+// ReportTimestamp is an RFC 3161 timestamp over a saved report.
+type ReportTimestamp struct {
+	TSA          string    `json:"tsa"`
+	ReportSHA256 string    `json:"report_sha256"` // SHA256 of the compact JSON of "report"
+	Time         time.Time `json:"time"`
+	Token        string    `json:"token"` // Base64 DER TimeStampToken
+}
+
+// reportFile is the layout of a -report file. The timestamp sits beside the
+// report it covers so the report's bytes are not changed by adding it.
+type reportFile struct {
+	Report    json.RawMessage  `json:"report"`
+	Timestamp *ReportTimestamp `json:"timestamp,omitempty"`
+}
+
+// newReport assembles the Report for a finished run.
+func newReport(config *Config, result *verify.Result, failures []error) *Report {
+	host, _ := os.Hostname()
+	report := &Report{
+		Tool:           "chkiso",
+		Version:        VERSION,
+		Generated:      time.Now().UTC(),
+		Target:         config.target.String(),
+		Operator:       operator(),
+		Host:           host,
+		Result:         passFail(len(failures) == 0),
+		ExpectedSHA256: config.Sha256Hash,
+		HashFile:       config.sidecar,
+		HashInName:     config.hashInName,
+		Release:        config.release,
+		KnownGood:      config.knownGood,
+		VirusTotal:     config.virusTotal,
+		ChecksumURL:    config.checksumURL,
+		SHA256:         result.Sha256,
+		Compressed:     result.CompressedSha256,
+		FIPS:           config.FIPS,
+		Evidence:       result.Evidence(),
+		Warnings:       result.Warnings,
+	}
+	if p := config.partition; p != nil {
+		report.Partition = &ReportPartition{Index: p.Index, Type: p.Type, Name: p.Name, Offset: p.Offset, Size: p.Size}
+	}
+	if v := result.DataVolume; v != nil {
+		report.DataVolume = &ReportVolume{FileSystem: v.FileSystem, MountPoint: v.Root}
+	}
+	if config.Offset != 0 || config.Length != 0 {
+		report.Range = &ReportRange{Offset: config.Offset, Length: config.Length}
+	}
+	if config.weak && len(failures) == 0 {
+		report.Result = "WEAK"
+	}
+	if h := result.Hash; h != nil && len(h.Candidates) > 1 {
+		report.Candidates = h.Candidates
+		if h.Match {
+			report.Matched = h.Expected
+		}
+	}
+	if l := result.Label; l != nil {
+		report.Label = &ReportLabel{Expected: l.Expected, Found: l.Found, Match: l.Match}
+	}
+	for _, run := range result.Damage {
+		kind := "repeated"
+		if run.Zeros {
+			kind = "zeros"
+		}
+		report.Damage = append(report.Damage, ReportDamage{Offset: run.Offset, Length: run.Length, Kind: kind})
+	}
+	if sz := result.Size; sz != nil {
+		report.Size = &ReportFileSize{Expected: sz.Expected, Found: sz.Found, Match: sz.Match()}
+	}
+	if m := result.ImageMD5; m != nil {
+		report.ImageMD5 = &ReportHash{Expected: m.Expected, Calculated: m.Calculated, Valid: m.Match}
+	}
+	if result.MD5 != nil {
+		report.ImplantedMD5 = &ReportMD5{
+			Stored:     result.MD5.StoredMD5,
+			Calculated: result.MD5.CalculatedMD5,
+			Valid:      result.MD5.IsIntegrityOK,
+		}
+	}
+	if result.DMG != nil {
+		report.DMG = &ReportDMG{Checks: []ReportDMGCheck{}, Skipped: result.DMG.Skipped}
+		for _, c := range result.DMG.Checks {
+			rc := ReportDMGCheck{Name: c.Name, Expected: c.Expected, Calculated: c.Calculated, Valid: c.OK}
+			if c.Err != nil {
+				rc.Error = c.Err.Error()
+			}
+			report.DMG.Checks = append(report.DMG.Checks, rc)
+		}
+	}
+	if w := result.WIM; w != nil {
+		report.WIM = &ReportWIM{
+			Compression:      w.Header.Compression,
+			Integrity:        w.Integrity,
+			IntegrityChunks:  w.IntegrityChunks,
+			IntegrityFailed:  w.IntegrityFailed,
+			Resources:        w.Resources,
+			ResourcesChecked: w.ResourcesChecked,
+			ResourcesFailed:  w.ResourcesFailed,
+			Problems:         w.Problems,
+		}
+	}
+	if e := result.ESP; e != nil {
+		report.ESP = &ReportESP{
+			Source:     e.Source,
+			ISOFile:    e.ISOFile,
+			Offset:     e.Offset,
+			Size:       e.Size,
+			Sha256:     e.Sha256,
+			FileSystem: e.FileSystem,
+			Label:      e.Label,
+			Files:      []ReportESPFile{},
+			Valid:      e.OK(),
+			Problems:   e.Problems,
+		}
+		for _, f := range e.Files {
+			report.ESP.Files = append(report.ESP.Files, ReportESPFile{
+				Path:       f.Path,
+				Size:       f.Size,
+				Sha256:     f.Sha256,
+				BootLoader: f.BootLoader,
+				ISOSha256:  f.ISOSha256,
+			})
+		}
+	}
+	if b := result.Boot; b != nil {
+		report.BootConfig = &ReportBoot{Configs: b.Configs, References: []ReportBootRef{}, Valid: b.OK()}
+		for _, ref := range b.References {
+			report.BootConfig.References = append(report.BootConfig.References, ReportBootRef{
+				Config:       ref.Config,
+				Line:         ref.Line,
+				Keyword:      ref.Keyword,
+				Path:         ref.Path,
+				Status:       ref.Status,
+				ChecksumFile: ref.ChecksumFile,
+				Algorithm:    ref.Algorithm,
+				Expected:     ref.Expected,
+				Calculated:   ref.Calculated,
+			})
+		}
+	}
+	if k := result.Kernels; k != nil {
+		report.Kernels = &ReportKernels{Images: []ReportBootImage{}, Valid: k.OK()}
+		for _, b := range k.Images {
+			report.Kernels.Images = append(report.Kernels.Images, ReportBootImage{
+				Path:         b.Path,
+				Kind:         b.Kind,
+				Size:         b.Size,
+				Sha256:       b.Sha256,
+				Format:       b.Format,
+				Version:      b.Version,
+				ChecksumFile: b.ChecksumFile,
+				Algorithm:    b.Algorithm,
+				Expected:     b.Expected,
+				Calculated:   b.Calculated,
+			})
+		}
+	}
+	if h := result.HashSet; h != nil {
+		known, knownBytes := h.Known()
+		report.HashSet = &ReportHashSet{
+			HashSet:    h.HashSet,
+			Format:     h.Format,
+			Algorithm:  h.Algorithm,
+			Known:      known,
+			KnownBytes: knownBytes,
+			Files:      []ReportHashSetFile{},
+		}
+		for _, f := range h.Files {
+			report.HashSet.Files = append(report.HashSet.Files, ReportHashSetFile{Path: f.Path, Size: f.Size, Hash: f.Hash, Known: f.Known, Name: f.Name})
+		}
+	}
+	if j := result.Jigdo; j != nil {
+		report.Jigdo = &ReportJigdo{
+			Algorithm:    j.Algorithm,
+			Expected:     j.Expected,
+			Calculated:   j.Calculated,
+			ExpectedSize: j.ExpectedSize,
+			Size:         j.Size,
+			Packages:     j.Components,
+			Valid:        j.OK(),
+		}
+		for _, f := range j.Failures {
+			name := f.Name
+			if name == "" {
+				name = f.Hash
+			}
+			report.Jigdo.Failed = append(report.Jigdo.Failed, name)
+		}
+		if j.TemplateChecked {
+			report.Jigdo.Template = passFail(!j.TemplateHashFailed)
+		}
+	}
+	if c := result.Contents; c != nil {
+		report.Contents = &ReportContents{
+			Root:          c.Root,
+			ChecksumFiles: c.ChecksumFiles,
+			Total:         c.Total,
+			Failed:        c.Failed,
+			Skipped:       c.Skipped,
+			Files:         []ReportFile{},
+		}
+		for _, f := range c.Files {
+			rf := ReportFile{Path: f.Name, ChecksumFile: f.ChecksumFile, Algorithm: f.Algorithm, Status: string(f.Status)}
+			if f.Err != nil {
+				rf.Error = f.Err.Error()
+			}
+			report.Contents.Files = append(report.Contents.Files, rf)
+		}
+		for _, f := range c.Uncovered {
+			report.Contents.Uncovered = append(report.Contents.Uncovered, ReportSize{Path: f.Name, Size: f.Size})
+		}
+		for _, sig := range c.Signatures {
+			report.Contents.Signatures = append(report.Contents.Signatures, ReportSignature{ChecksumFile: sig.ChecksumFile, File: sig.File, Status: string(sig.Status), Detail: sig.Detail})
+		}
+		report.Contents.FileCoverage, report.Contents.ByteCoverage = c.Coverage()
+	}
+	for _, err := range failures {
+		report.Failures = append(report.Failures, err.Error())
+	}
+	return report
+}
+
+// writeReport saves report to path, timestamped by the TSA at tsaURL if one
+// is given.
+func writeReport(path string, report *Report, tsaURL string) error {
+	body, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+	file := reportFile{Report: body}
+
+	if tsaURL != "" {
+		digest := sha256.Sum256(body)
+		ctx, cancel := context.WithTimeout(context.Background(), tsaTimeout)
+		defer cancel()
+		token, info, err := rfc3161.Timestamp(ctx, tsaURL, digest[:])
+		if err != nil {
+			return fmt.Errorf("could not timestamp report: %v", err)
+		}
+		file.Timestamp = &ReportTimestamp{
+			TSA:          tsaURL,
+			ReportSHA256: hex.EncodeToString(digest[:]),
+			Time:         info.Time,
+			Token:        base64.StdEncoding.EncodeToString(token),
+		}
+	}
+
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// checkReport implements `chkiso check-report`: it confirms that a saved
+// report is unmodified since it was timestamped and prints the attested time.
+func checkReport(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("could not read report: %v", err)
+	}
+	var file reportFile
+	if err := json.Unmarshal(data, &file); err != nil || file.Report == nil {
+		return fmt.Errorf("%s is not a chkiso report", path)
+	}
+	if file.Timestamp == nil {
+		return fmt.Errorf("report %s is not timestamped", path)
+	}
+
+	var body bytes.Buffer
+	if err := json.Compact(&body, file.Report); err != nil {
+		return err
+	}
+	digest := sha256.Sum256(body.Bytes())
+	token, err := base64.StdEncoding.DecodeString(file.Timestamp.Token)
+	if err != nil {
+		return fmt.Errorf("invalid timestamp token: %v", err)
+	}
+	info, err := rfc3161.Parse(token)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Report:         %s\n", path)
+	fmt.Printf("Report SHA256:  %s\n", hex.EncodeToString(digest[:]))
+	fmt.Printf("Timestamped by: %s\n", file.Timestamp.TSA)
+	fmt.Printf("Timestamp:      %s\n", info.Time.UTC().Format(time.RFC3339))
+	if !bytes.Equal(info.SHA256, digest[:]) {
+		fmt.Printf("\033[31m%s\033[0m\n", i18n.T("Result: FAILURE - The report was modified after it was timestamped."))
+		return fmt.Errorf("report does not match its timestamp")
+	}
+	fmt.Printf("\033[32m%s\033[0m\n", i18n.T("Result: SUCCESS - The report is unchanged since it was timestamped."))
+	fmt.Println("Note: The TSA signature is not checked; use 'openssl ts -verify' with the TSA certificate for that.")
+	return nil
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/pappasjfed/chkiso/internal/i18n"
+	"github.com/pappasjfed/chkiso/pkg/verify"
+)
+
+// runRip copies a disc to an ISO file and verifies it in the same pass:
+// the SHA256, MD5 and implanted MD5 are calculated from the bytes read for
+// the copy, so archiving a disc and checking it take one read. The copy is
+// written under a temporary name and only renamed to output once it is
+// complete. It reports whether the checks passed.
+func runRip(args []string) (bool, error) {
+	var paths []string
+	expected := ""
+	force := false
+	for i := 0; i < len(args); i++ {
+		switch arg := args[i]; arg {
+		case "-sha256", "--sha256":
+			if i+1 >= len(args) {
+				return false, fmt.Errorf("%s requires a value", arg)
+			}
+			i++
+			expected = strings.ToLower(strings.TrimSpace(args[i]))
+			if !verify.IsValidSha256(expected) {
+				return false, fmt.Errorf("invalid SHA256 hash format. Expected 64 hexadecimal characters")
+			}
+		case "-force", "--force":
+			force = true
+		default:
+			if strings.HasPrefix(arg, "-") && len(arg) > 1 {
+				return false, fmt.Errorf("unknown rip option: %s", arg)
+			}
+			paths = append(paths, arg)
+		}
+	}
+	if len(paths) != 2 {
+		return false, fmt.Errorf("usage: chkiso rip <drive|device|image> <output.iso> [-sha256 <hash>] [-force]")
+	}
+	source, output := paths[0], paths[1]
+	target, err := verify.NewTarget(source)
+	if err != nil {
+		return false, err
+	}
+	if target.IsDir {
+		return false, fmt.Errorf("%s is a directory; rip copies a drive, device or image", source)
+	}
+	if _, err := os.Stat(output); err == nil && !force {
+		return false, fmt.Errorf("%s already exists (use -force to overwrite it)", output)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	partial := output + ".part"
+	file, err := os.Create(partial)
+	if err != nil {
+		return false, err
+	}
+	fmt.Printf("Copying %s to %s...\n", target, output)
+	result, err := verify.Rip(ctx, target, file, nil)
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(partial, output)
+	}
+	if err != nil {
+		os.Remove(partial)
+		return false, fmt.Errorf("could not copy %s: %v", target, err)
+	}
+
+	if result.Size < result.MediaSize {
+		fmt.Printf("Copied the ISO data area: %d of %d bytes on the medium\n", result.Size, result.MediaSize)
+	} else {
+		fmt.Printf("Copied %d bytes (%s)\n", result.Size, formatBytes(result.Size))
+	}
+	fmt.Printf("SHA256: %s\n", result.Sha256)
+	fmt.Printf("MD5:    %s\n", result.MD5)
+
+	ok := true
+	if expected != "" {
+		fmt.Printf("  - Expected:   %s\n", expected)
+		if result.Sha256 == expected {
+			fmt.Printf("\033[32m%s\033[0m\n", i18n.T("Result: SUCCESS - Hashes match."))
+		} else {
+			fmt.Printf("\033[31m%s\033[0m\n", i18n.T("Result: FAILURE - Hashes DO NOT match."))
+			ok = false
+		}
+	}
+	if m := result.Implanted; m != nil {
+		fmt.Printf("Implanted MD5: %s, calculated %s\n", m.StoredMD5, m.CalculatedMD5)
+		if m.IsIntegrityOK {
+			fmt.Printf("\033[32m%s\033[0m\n", i18n.T("Result: SUCCESS - Implanted MD5 is valid."))
+		} else {
+			fmt.Printf("\033[31m%s\033[0m\n", i18n.T("Result: FAILURE - Implanted MD5 does not match calculated hash."))
+			ok = false
+		}
+	} else {
+		fmt.Println("No implanted MD5 to check.")
+	}
+	if expected == "" && result.Implanted == nil {
+		fmt.Println("\033[33mNothing to verify the copy against; compare the SHA256 with the published one.\033[0m")
+	}
+	return ok, nil
+}
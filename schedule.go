@@ -0,0 +1,440 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/smtp"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pappasjfed/chkiso/pkg/manifest"
+)
+
+// notifyTimeout bounds delivering the result of a scheduled check.
+const notifyTimeout = 30 * time.Second
+
+// smtpPasswordVar names the environment variable holding the SMTP password
+// of a check run by hand with -run.
+const smtpPasswordVar = "CHKISO_SMTP_PASSWORD"
+
+// scheduleOptions are the arguments of `chkiso schedule`.
+type scheduleOptions struct {
+	Dir              string
+	Name             string // Task name, also marks the cron entry
+	Every            string // hourly, daily or weekly
+	At               string // HH:MM
+	Webhook          string // URL to POST the JSON result to
+	SMTP             string // host:port of the mail server
+	SMTPUser         string // Password comes from SMTPPasswordFile or CHKISO_SMTP_PASSWORD
+	SMTPPasswordFile string // File only its owner can read, holding the SMTP password
+	MailFrom         string
+	MailTo           string
+	Install          bool
+	Run              bool
+
+	Background bool // Run the checks at low CPU and I/O priority
+}
+
+// ScheduledResult is the outcome of a scheduled check, as posted to the
+// webhook.
+type ScheduledResult struct {
+	Directory string                `json:"directory"`
+	Host      string                `json:"host"`
+	Time      time.Time             `json:"time"`
+	Result    string                `json:"result"`
+	Files     []ScheduledFileResult `json:"files"`
+	Errors    []string              `json:"errors,omitempty"`
+}
+
+// ScheduledFileResult is one checked image in a ScheduledResult.
+type ScheduledFileResult struct {
+	ChecksumFile string   `json:"checksum_file"`
+	File         string   `json:"file"`
+	Result       string   `json:"result"`
+	Failures     []string `json:"failures,omitempty"`
+}
+
+// runSchedule implements `chkiso schedule`. It prints or installs a
+// Scheduled Task (Windows) or cron entry that re-runs it with -run, which
+// verifies the images listed in the checksum files of a directory and
+// reports the result.
+func runSchedule(args []string) error {
+	opts := scheduleOptions{Name: "chkiso-verify", Every: "daily", At: "02:00"}
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		value := func() string {
+			if i+1 >= len(args) {
+				fmt.Fprintf(os.Stderr, "Error: %s requires a value\n", arg)
+				os.Exit(1)
+			}
+			i++
+			return args[i]
+		}
+		switch arg {
+		case "-name", "--name":
+			opts.Name = value()
+		case "-every", "--every":
+			opts.Every = value()
+		case "-at", "--at":
+			opts.At = value()
+		case "-webhook", "--webhook":
+			opts.Webhook = value()
+		case "-smtp", "--smtp":
+			opts.SMTP = value()
+		case "-smtp-user", "--smtp-user":
+			opts.SMTPUser = value()
+		case "-smtp-password-file", "--smtp-password-file":
+			opts.SMTPPasswordFile = value()
+		case "-mail-from", "--mail-from":
+			opts.MailFrom = value()
+		case "-mail-to", "--mail-to":
+			opts.MailTo = value()
+		case "-install", "--install":
+			opts.Install = true
+		case "-background", "--background":
+			opts.Background = true
+		case "-run", "--run":
+			opts.Run = true
+		default:
+			if strings.HasPrefix(arg, "-") || opts.Dir != "" {
+				return fmt.Errorf("unknown schedule option: %s", arg)
+			}
+			opts.Dir = arg
+		}
+	}
+
+	if opts.Dir == "" {
+		return errors.New("usage: chkiso schedule <directory> [-every hourly|daily|weekly] [-at HH:MM] [-webhook <url>] [-smtp <host:port> -mail-from <addr> -mail-to <addr> [-smtp-user <user> -smtp-password-file <file>]] [-background] [-install]")
+	}
+	dir, err := filepath.Abs(opts.Dir)
+	if err != nil {
+		return err
+	}
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return fmt.Errorf("not a directory: %s", opts.Dir)
+	}
+	opts.Dir = dir
+	if opts.SMTP != "" && (opts.MailFrom == "" || opts.MailTo == "") {
+		return errors.New("-smtp requires -mail-from and -mail-to")
+	}
+	if opts.SMTPPasswordFile != "" {
+		if opts.SMTPPasswordFile, err = filepath.Abs(opts.SMTPPasswordFile); err != nil {
+			return err
+		}
+		if _, err := readSMTPPassword(opts.SMTPPasswordFile); err != nil {
+			return err
+		}
+	} else if opts.SMTPUser != "" && !opts.Run {
+		// Cron and the Task Scheduler start the job without the environment
+		// of this shell, so CHKISO_SMTP_PASSWORD would not reach it
+		return fmt.Errorf("-smtp-user requires -smtp-password-file: the scheduled job does not see %s", smtpPasswordVar)
+	}
+
+	if opts.Run {
+		if opts.Background {
+			enterBackground()
+		}
+		return runScheduledCheck(opts)
+	}
+	return installSchedule(opts)
+}
+
+// runScheduledCheck verifies every checksum file in the root of opts.Dir
+// and delivers the result to the configured webhook and mail recipient.
+func runScheduledCheck(opts scheduleOptions) error {
+	host, _ := os.Hostname()
+	result := ScheduledResult{Directory: opts.Dir, Host: host, Time: time.Now().UTC(), Result: "PASSED", Files: []ScheduledFileResult{}}
+
+	dirEntries, err := os.ReadDir(opts.Dir)
+	if err != nil {
+		return err
+	}
+	var checksumFiles []string
+	for _, e := range dirEntries {
+		if !e.IsDir() && manifest.IsChecksumFile(e.Name()) {
+			checksumFiles = append(checksumFiles, e.Name())
+		}
+	}
+	sort.Strings(checksumFiles)
+	if len(checksumFiles) == 0 {
+		result.Result = "FAILED"
+		result.Errors = append(result.Errors, fmt.Sprintf("no checksum files (%s) found in %s", manifest.Patterns, opts.Dir))
+	}
+
+	for _, name := range checksumFiles {
+		config := &Config{Path: filepath.Join(opts.Dir, name), started: time.Now()}
+		outcomes, failures := verifyListedFiles(config)
+		if len(failures) > 0 {
+			result.Result = "FAILED"
+		}
+		if len(outcomes) == 0 {
+			for _, err := range failures {
+				result.Errors = append(result.Errors, fmt.Sprintf("%s: %v", name, err))
+			}
+		}
+		for _, o := range outcomes {
+			fr := ScheduledFileResult{ChecksumFile: name, File: o.Name, Result: passFail(len(o.Failures) == 0)}
+			for _, err := range o.Failures {
+				fr.Failures = append(fr.Failures, err.Error())
+			}
+			result.Files = append(result.Files, fr)
+		}
+	}
+
+	fmt.Printf("\nScheduled check of %s: %s\n", opts.Dir, result.Result)
+	var notifyErrs []string
+	if opts.Webhook != "" {
+		if err := postWebhook(opts.Webhook, result); err != nil {
+			notifyErrs = append(notifyErrs, fmt.Sprintf("webhook: %v", err))
+		}
+	}
+	if opts.SMTP != "" {
+		if err := sendResultMail(opts, result); err != nil {
+			notifyErrs = append(notifyErrs, fmt.Sprintf("mail: %v", err))
+		}
+	}
+	if len(notifyErrs) > 0 {
+		return fmt.Errorf("could not deliver result: %s", strings.Join(notifyErrs, "; "))
+	}
+	if result.Result != "PASSED" {
+		return errors.New("scheduled verification failed")
+	}
+	return nil
+}
+
+func postWebhook(url string, result ScheduledResult) error {
+	body, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+func sendResultMail(opts scheduleOptions, result ScheduledResult) error {
+	var body strings.Builder
+	fmt.Fprintf(&body, "From: %s\r\n", opts.MailFrom)
+	fmt.Fprintf(&body, "To: %s\r\n", opts.MailTo)
+	fmt.Fprintf(&body, "Subject: chkiso: %s on %s (%s)\r\n", result.Result, result.Host, result.Directory)
+	fmt.Fprintf(&body, "Date: %s\r\n", result.Time.Format(time.RFC1123Z))
+	fmt.Fprintf(&body, "Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	fmt.Fprintf(&body, "Scheduled verification of %s on %s: %s\r\n\r\n", result.Directory, result.Host, result.Result)
+	for _, f := range result.Files {
+		fmt.Fprintf(&body, "%-6s  %s (%s)\r\n", f.Result, f.File, f.ChecksumFile)
+		for _, failure := range f.Failures {
+			fmt.Fprintf(&body, "        %s\r\n", failure)
+		}
+	}
+	for _, e := range result.Errors {
+		fmt.Fprintf(&body, "Error: %s\r\n", e)
+	}
+
+	var auth smtp.Auth
+	if opts.SMTPUser != "" {
+		host := opts.SMTP
+		if i := strings.LastIndex(host, ":"); i >= 0 {
+			host = host[:i]
+		}
+		password := os.Getenv(smtpPasswordVar)
+		if opts.SMTPPasswordFile != "" {
+			var err error
+			if password, err = readSMTPPassword(opts.SMTPPasswordFile); err != nil {
+				return err
+			}
+		}
+		auth = smtp.PlainAuth("", opts.SMTPUser, password, host)
+	}
+	return smtp.SendMail(opts.SMTP, auth, opts.MailFrom, strings.Split(opts.MailTo, ","), []byte(body.String()))
+}
+
+// readSMTPPassword reads the SMTP password from the first line of path. The
+// file must not be readable by other users, as an SSH key must not; Windows
+// files are protected by their ACLs instead, which are not checked.
+func readSMTPPassword(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	if runtime.GOOS != "windows" && info.Mode().Perm()&0o077 != 0 {
+		return "", fmt.Errorf("%s can be read by other users; restrict it with chmod 600", path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	password, _, _ := strings.Cut(string(data), "\n")
+	password = strings.TrimSuffix(password, "\r")
+	if password == "" {
+		return "", fmt.Errorf("%s holds no password", path)
+	}
+	return password, nil
+}
+
+// installSchedule prints the Scheduled Task or cron entry for opts, and
+// installs it with -install.
+func installSchedule(opts scheduleOptions) error {
+	hour, minute, err := parseClock(opts.At)
+	if err != nil {
+		return err
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	command := []string{exe, "schedule", opts.Dir, "-run"}
+	for _, f := range [][2]string{
+		{"-webhook", opts.Webhook}, {"-smtp", opts.SMTP}, {"-smtp-user", opts.SMTPUser},
+		{"-smtp-password-file", opts.SMTPPasswordFile}, {"-mail-from", opts.MailFrom}, {"-mail-to", opts.MailTo},
+	} {
+		if f[1] != "" {
+			command = append(command, f[0], f[1])
+		}
+	}
+	if opts.Background {
+		command = append(command, "-background")
+	}
+
+	if runtime.GOOS == "windows" {
+		args := []string{"/Create", "/TN", opts.Name, "/TR", windowsCommandLine(command), "/F"}
+		switch opts.Every {
+		case "hourly":
+			args = append(args, "/SC", "HOURLY", "/ST", opts.At)
+		case "daily":
+			args = append(args, "/SC", "DAILY", "/ST", opts.At)
+		case "weekly":
+			args = append(args, "/SC", "WEEKLY", "/D", "SUN", "/ST", opts.At)
+		default:
+			return fmt.Errorf("invalid -every value: %s (use hourly, daily or weekly)", opts.Every)
+		}
+		if !opts.Install {
+			fmt.Println("Run this command to register the scheduled task (or use -install):")
+			fmt.Printf("  schtasks %s\n", windowsCommandLine(args))
+			return nil
+		}
+		out, err := exec.Command("schtasks", args...).CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("schtasks failed: %v: %s", err, strings.TrimSpace(string(out)))
+		}
+		fmt.Printf("Registered scheduled task '%s'.\n", opts.Name)
+		return nil
+	}
+
+	var spec string
+	switch opts.Every {
+	case "hourly":
+		spec = fmt.Sprintf("%d * * * *", minute)
+	case "daily":
+		spec = fmt.Sprintf("%d %d * * *", minute, hour)
+	case "weekly":
+		spec = fmt.Sprintf("%d %d * * 0", minute, hour)
+	default:
+		return fmt.Errorf("invalid -every value: %s (use hourly, daily or weekly)", opts.Every)
+	}
+	marker := "# chkiso:" + opts.Name
+	line := fmt.Sprintf("%s %s %s", spec, cronCommandLine(command), marker)
+	if !opts.Install {
+		fmt.Println("Add this line to your crontab (crontab -e), or use -install:")
+		fmt.Printf("  %s\n", line)
+		return nil
+	}
+
+	// Replace an earlier entry with the same name rather than adding another.
+	// The table is only rewritten once the current one has been read, so a
+	// failure to read it can never wipe it
+	current, err := readCrontab()
+	if err != nil {
+		return err
+	}
+	var lines []string
+	for _, l := range strings.Split(strings.TrimRight(current, "\n"), "\n") {
+		if l != "" && !strings.HasSuffix(l, marker) {
+			lines = append(lines, l)
+		}
+	}
+	lines = append(lines, line)
+	cmd := exec.Command("crontab", "-")
+	cmd.Stdin = strings.NewReader(strings.Join(lines, "\n") + "\n")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("crontab failed: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+	fmt.Printf("Installed cron entry '%s'.\n", opts.Name)
+	return nil
+}
+
+// readCrontab returns the user's crontab. A user without one has an empty
+// table; any other failure is an error.
+func readCrontab() (string, error) {
+	cmd := exec.Command("crontab", "-l")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && strings.Contains(strings.ToLower(stderr.String()), "no crontab") {
+			return "", nil
+		}
+		return "", fmt.Errorf("could not read the current crontab, so it was left unchanged: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return string(out), nil
+}
+
+// parseClock parses an HH:MM time of day.
+func parseClock(s string) (int, int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid -at value: %s (use HH:MM)", s)
+	}
+	return t.Hour(), t.Minute(), nil
+}
+
+// shellCommandLine quotes args for a POSIX shell.
+func shellCommandLine(args []string) string {
+	quoted := make([]string, len(args))
+	for i, a := range args {
+		quoted[i] = "'" + strings.ReplaceAll(a, "'", `'\''`) + "'"
+	}
+	return strings.Join(quoted, " ")
+}
+
+// cronCommandLine quotes args for the command field of a crontab line.
+// Cron turns an unescaped % into a newline even inside quotes, so each one
+// is escaped as \%, which cron passes to the shell as a plain %.
+func cronCommandLine(args []string) string {
+	return strings.ReplaceAll(shellCommandLine(args), "%", `\%`)
+}
+
+// windowsCommandLine quotes args that contain spaces or quotes the way
+// Windows programs parse their command line.
+func windowsCommandLine(args []string) string {
+	quoted := make([]string, len(args))
+	for i, a := range args {
+		if strings.ContainsAny(a, " \t\"") {
+			a = `"` + strings.ReplaceAll(a, `"`, `\"`) + `"`
+		}
+		quoted[i] = a
+	}
+	return strings.Join(quoted, " ")
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pappasjfed/chkiso/internal/selfcheck"
+)
+
+// signingPublicKey is the hex ed25519 key release binaries are signed with.
+// Release builds set it with -ldflags "-X main.signingPublicKey=<hex>";
+// development builds leave it empty and skip the startup check.
+var signingPublicKey string
+
+// signingKeyCreated is the date, as YYYY-MM-DD, signingPublicKey was made.
+// Release builds set it with -ldflags "-X main.signingKeyCreated=<date>",
+// so that policies can limit the age of the key checksum files are signed
+// with.
+var signingKeyCreated string
+
+// runSelfCheck implements `chkiso self-check`, which verifies the running
+// executable against the signature appended to it at release.
+func runSelfCheck() error {
+	if signingPublicKey == "" {
+		return errors.New("this build of chkiso has no signing key; only release builds can check themselves")
+	}
+	key, err := selfcheck.ParsePublicKey(signingPublicKey)
+	if err != nil {
+		return err
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	result, err := selfcheck.Check(exe, key)
+	if result == nil {
+		return err
+	}
+
+	fmt.Printf("Executable: %s\n", result.Path)
+	fmt.Printf("SHA256:     %s\n", result.SHA256)
+	fmt.Printf("Signed by:  %s\n", signingPublicKey)
+	if err != nil {
+		fmt.Printf("\033[31mResult: FAILURE - %s.\033[0m\n", selfcheck.Describe(err))
+		return err
+	}
+	fmt.Printf("\033[32mResult: SUCCESS - %s.\033[0m\n", selfcheck.Describe(err))
+	return nil
+}
+
+// warnIfTampered runs the self-check quietly at startup of signed builds and
+// warns when the executable does not match its signature.
+func warnIfTampered() {
+	if signingPublicKey == "" {
+		return
+	}
+	key, err := selfcheck.ParsePublicKey(signingPublicKey)
+	if err != nil {
+		return
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return
+	}
+	if _, err := selfcheck.Check(exe, key); err != nil {
+		fmt.Fprintf(os.Stderr, "\033[31mWarning: Self-check failed: %s. Results from this copy of chkiso cannot be trusted; run 'chkiso self-check' for details.\033[0m\n", selfcheck.Describe(err))
+	}
+}
+
+// trustedSigningKey returns the key signatures of checksum files are checked
+// against, and when it was made, if known: the key given with -pubkey, or
+// else the one release builds carry. A key on the media is never used, as
+// whoever could change the checksum files could replace it too.
+func trustedSigningKey(config *Config) (ed25519.PublicKey, time.Time, error) {
+	value, createdText := config.PublicKey, config.PublicKeyCreated
+	if value == "" {
+		value = signingPublicKey
+		if createdText == "" {
+			createdText = signingKeyCreated
+		}
+	}
+	if value == "" {
+		if createdText != "" {
+			return nil, time.Time{}, errors.New("-pubkey-created requires -pubkey")
+		}
+		return nil, time.Time{}, nil
+	}
+	key, err := parseTrustedKey(value)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	var created time.Time
+	if createdText != "" {
+		if created, err = time.Parse("2006-01-02", createdText); err != nil {
+			return nil, time.Time{}, fmt.Errorf("invalid signing key date %q (use YYYY-MM-DD)", createdText)
+		}
+	}
+	return key, created, nil
+}
+
+// parseTrustedKey reads an ed25519 public key given as hex, or as a file
+// holding the hex or a PEM public key, as "openssl pkey -pubout" writes.
+func parseTrustedKey(value string) (ed25519.PublicKey, error) {
+	data, err := os.ReadFile(value)
+	if err != nil {
+		// Not a file, so the key itself
+		key, keyErr := selfcheck.ParsePublicKey(value)
+		if keyErr != nil {
+			return nil, fmt.Errorf("%s is neither a key file nor a hex ed25519 public key", value)
+		}
+		return key, nil
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return selfcheck.ParsePublicKey(strings.TrimSpace(string(data)))
+	}
+	parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("could not read the key in %s: %v", value, err)
+	}
+	key, ok := parsed.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("the key in %s is not an ed25519 key", value)
+	}
+	return key, nil
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"os"
+)
+
+// maxReportFailures is how many failures of a target the -show-report page
+// lists; the rest are counted.
+const maxReportFailures = 5
+
+// reportPage is the page -show-report opens: the verdict of each target
+// with its SHA256 and failures, and where the report was saved.
+var reportPage = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>chkiso: {{.Result}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+h2 { font-size: 1.1em; margin-bottom: 0.3em; word-break: break-all; }
+.PASSED { color: #1a7f37; }
+.FAILED { color: #cf222e; }
+code { word-break: break-all; }
+</style>
+</head>
+<body>
+<h1 class="{{.Result}}">chkiso: {{.Result}}</h1>
+{{range .Targets}}
+<h2>{{.Path}}: <span class="{{.Result}}">{{.Result}}</span></h2>
+{{if .SHA256}}<p>SHA256: <code>{{.SHA256}}</code></p>{{end}}
+{{if .Failures}}<ul>{{range .Failures}}<li>{{.}}</li>{{end}}</ul>{{end}}
+{{end}}
+{{if .ReportFile}}<p>Report saved to: <code>{{.ReportFile}}</code></p>{{end}}
+</body>
+</html>
+`))
+
+// reportTarget is one target on the -show-report page.
+type reportTarget struct {
+	Path     string
+	Result   string
+	SHA256   string
+	Failures []string
+}
+
+// showReport shows the verdict of the run for -show-report, so a run
+// started from a script or shortcut leaves a visible result. The verdict is
+// written to an HTML page in the temporary directory, which is opened with
+// the program the desktop uses for web pages.
+func showReport(config *Config, failures []error) error {
+	page := struct {
+		Result     string
+		Targets    []reportTarget
+		ReportFile string
+	}{Result: passFail(len(failures) == 0), ReportFile: config.ReportFile}
+	if len(*config.verdicts) == 0 {
+		// The run stopped before any target was verified
+		target := reportTarget{Path: config.Path, Result: page.Result}
+		for _, err := range failures {
+			target.Failures = append(target.Failures, err.Error())
+		}
+		page.Targets = append(page.Targets, target)
+	}
+	for _, tv := range *config.verdicts {
+		target := reportTarget{Path: tv.Path, Result: tv.Result, SHA256: tv.SHA256}
+		for j, failure := range tv.Failures {
+			if j == maxReportFailures {
+				target.Failures = append(target.Failures, fmt.Sprintf("... and %d more", len(tv.Failures)-j))
+				break
+			}
+			target.Failures = append(target.Failures, failure)
+		}
+		page.Targets = append(page.Targets, target)
+	}
+
+	// The page is left behind, as the browser may read it after chkiso exits
+	file, err := os.CreateTemp("", "chkiso-report-*.html")
+	if err != nil {
+		return err
+	}
+	if err := reportPage.Execute(file, page); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	fmt.Printf("\nReport page: %s\n", file.Name())
+	return openDefault(file.Name())
+}
@@ -0,0 +1,8 @@
+package main
+
+import "os/exec"
+
+// openDefault opens path with the application macOS associates with it.
+func openDefault(path string) error {
+	return exec.Command("open", path).Run()
+}
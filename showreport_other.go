@@ -0,0 +1,21 @@
+//go:build !windows && !darwin
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+)
+
+// openDefault opens path with the application the desktop associates with
+// it, through xdg-open.
+func openDefault(path string) error {
+	if os.Getenv("DISPLAY") == "" && os.Getenv("WAYLAND_DISPLAY") == "" {
+		return fmt.Errorf("there is no graphical session to show it in")
+	}
+	if _, err := exec.LookPath("xdg-open"); err != nil {
+		return fmt.Errorf("xdg-open is not installed")
+	}
+	return exec.Command("xdg-open", path).Run()
+}
@@ -0,0 +1,10 @@
+package main
+
+import "os/exec"
+
+// openDefault opens path with the program Windows associates with it. The
+// URL handler of url.dll is used rather than "cmd /c start", which would
+// need the path quoted for cmd.
+func openDefault(path string) error {
+	return exec.Command("rundll32", "url.dll,FileProtocolHandler", path).Run()
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/pappasjfed/chkiso/internal/decompress"
+	"github.com/pappasjfed/chkiso/pkg/manifest"
+	"github.com/pappasjfed/chkiso/pkg/verify"
+)
+
+// Hash files published next to an image. Files named after the image may
+// hold a bare hash; directory-wide ones must list the image by name.
+var (
+	sha256Sidecars = []string{".sha256", ".sha256sum", ".sha256.txt"}
+	sha256Lists    = []string{"SHA256SUMS", "SHA256SUMS.txt", "sha256sum.txt", "sha256sums.txt"}
+	md5Sidecars    = []string{".md5", ".md5sum", ".md5.txt"}
+	md5Lists       = []string{"MD5SUMS", "MD5SUMS.txt", "md5sum.txt", "md5sums.txt"}
+)
+
+// sidecar is a hash file found next to the image.
+type sidecar struct {
+	Path      string
+	Algorithm string // manifest.SHA256 or manifest.MD5
+	Hash      string
+}
+
+// useSidecar looks for a hash file next to the image when no expected hash
+// was given, so the common download layout needs no extra flags. A found
+// SHA256 becomes the expected hash; an MD5 is only used when nothing
+// stronger was published. Without a hash file, a SHA256 in the image's
+// name, as CI pipelines produce, is used instead.
+func useSidecar(config *Config) {
+	t := config.target
+	if t.IsDrive || t.IsDir || t.IsDevice || t.IsNRG() || config.Partition > 0 || config.Offset != 0 || config.Length != 0 {
+		// Published hashes cover the whole file
+		return
+	}
+	found := findSidecar(t, config.FIPS)
+	if found == nil {
+		if hash := filenameHash(filepath.Base(t.ImagePath())); hash != "" {
+			fmt.Printf("\nUsing the SHA256 embedded in the file name: %s\n", hash)
+			config.Sha256Hash = hash
+			config.hashInName = true
+		}
+		return
+	}
+	fmt.Printf("\nUsing hash file found next to the image: %s\n", found.Path)
+	if found.Algorithm == manifest.SHA256 {
+		config.Sha256Hash = found.Hash
+	} else {
+		fmt.Println("It only lists an MD5, which detects damage but not tampering.")
+		config.expectedMD5 = found.Hash
+	}
+	config.sidecar = found.Path
+	signed := false
+	if content, err := os.ReadFile(found.Path); err == nil && strings.HasPrefix(string(content), "-----BEGIN PGP SIGNED MESSAGE-----") {
+		fmt.Println("The hash file carries an inline OpenPGP signature.")
+		signed = true
+	}
+	for _, sig := range findSignatures(t, found.Path) {
+		fmt.Printf("Signature found: %s\n", sig)
+		signed = true
+	}
+	if signed {
+		fmt.Println("chkiso does not check OpenPGP signatures; verify them with gpg --verify to")
+		fmt.Println("confirm the hash file itself was published by the distributor.")
+	}
+}
+
+// namedHashPattern finds a SHA256 that is a word of a file name, as in
+// image-<hash>.iso or build-sha256-<hash>.iso.
+var namedHashPattern = regexp.MustCompile(`(?i)(?:^|[^0-9a-z])([0-9a-f]{64})(?:[^0-9a-z]|$)`)
+
+// filenameHash returns the SHA256 embedded in name, or "" if there is none
+// or more than one.
+func filenameHash(name string) string {
+	matches := namedHashPattern.FindAllStringSubmatch(name, -1)
+	if len(matches) != 1 {
+		return ""
+	}
+	return strings.ToLower(matches[0][1])
+}
+
+// findSidecar returns the first hash file next to t that lists it, trying
+// SHA256 files before MD5 ones, or nil. MD5 files are skipped under FIPS
+// and for compressed images, whose published MD5 may be of either form.
+func findSidecar(t *verify.Target, fips bool) *sidecar {
+	dir, names := filepath.Dir(t.ImagePath()), imageNames(t)
+	if s := findHashFile(t, dir, names, sha256Sidecars, sha256Lists, manifest.SHA256); s != nil {
+		return s
+	}
+	if fips || t.Compression != "" {
+		return nil
+	}
+	return findHashFile(t, dir, names, md5Sidecars, md5Lists, manifest.MD5)
+}
+
+// imageNames returns the names a hash file may be called after: the image's
+// own, and for compressed images also the decompressed one.
+func imageNames(t *verify.Target) []string {
+	name := filepath.Base(t.ImagePath())
+	if t.Compression != "" {
+		return []string{name, decompress.TrimExt(name)}
+	}
+	return []string{name}
+}
+
+func findHashFile(t *verify.Target, dir string, names, sidecars, lists []string, algorithm string) *sidecar {
+	for _, name := range names {
+		for _, ext := range sidecars {
+			path := filepath.Join(dir, name+ext)
+			content, err := os.ReadFile(path)
+			if err != nil {
+				continue
+			}
+			// A file named after the image may omit the name or use another
+			if hash := verify.ListedHash(t, string(content), algorithm); hash != "" {
+				return &sidecar{Path: path, Algorithm: algorithm, Hash: hash}
+			}
+			if hash := singleHash(string(content), algorithm); hash != "" {
+				return &sidecar{Path: path, Algorithm: algorithm, Hash: hash}
+			}
+		}
+	}
+
+	candidates := existing(dir, lists)
+	if algorithm == manifest.SHA256 {
+		// Fedora publishes <release>-CHECKSUM files
+		matches, _ := filepath.Glob(filepath.Join(dir, "*CHECKSUM"))
+		candidates = append(candidates, matches...)
+	}
+	for _, path := range candidates {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		if hash := verify.ListedHash(t, string(content), algorithm); hash != "" {
+			return &sidecar{Path: path, Algorithm: algorithm, Hash: hash}
+		}
+	}
+	return nil
+}
+
+// singleHash returns the hash in content when it is the only one of
+// algorithm there, listed under any name or as a bare digest.
+func singleHash(content, algorithm string) string {
+	entries, err := manifest.ParseNamed("", []byte(content))
+	if err == nil && len(entries) > 0 {
+		hash := ""
+		for _, e := range entries {
+			if e.Algorithm != algorithm {
+				continue
+			}
+			if hash != "" {
+				return ""
+			}
+			hash = e.Hash
+		}
+		return hash
+	}
+	fields := strings.Fields(content)
+	if len(fields) != 1 || manifest.AlgorithmForLength(len(fields[0])) != algorithm {
+		return ""
+	}
+	hash := strings.ToLower(fields[0])
+	if strings.Trim(hash, "0123456789abcdef") != "" {
+		return ""
+	}
+	return hash
+}
+
+// existing returns the files of dir with the given names, matched without
+// regard to case.
+func existing(dir string, names []string) []string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	var paths []string
+	for _, name := range names {
+		for _, e := range entries {
+			if !e.IsDir() && strings.EqualFold(e.Name(), name) {
+				paths = append(paths, filepath.Join(dir, e.Name()))
+				break
+			}
+		}
+	}
+	return paths
+}
+
+// findSignatures returns detached signatures of the image or of the hash
+// file at hashFile.
+func findSignatures(t *verify.Target, hashFile string) []string {
+	var found []string
+	for _, base := range []string{t.ImagePath(), hashFile} {
+		for _, ext := range manifest.SignatureExts {
+			if info, err := os.Stat(base + ext); err == nil && !info.IsDir() {
+				found = append(found, base+ext)
+			}
+		}
+	}
+	return found
+}
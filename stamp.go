@@ -0,0 +1,132 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pappasjfed/chkiso/pkg/verify"
+)
+
+// stampVerified records the run in the files it verified, for -stamp: the
+// image, when it matched an expected SHA256 as a whole, and each file of a
+// directory tree or drive that matched its checksum file. A file that
+// failed loses any stamp it had, so an old stamp cannot vouch for it.
+// Failures are reported as warnings; they never change the exit code.
+func stampVerified(config *Config, result *verify.Result) {
+	base := verify.Stamp{Tool: "chkiso", Version: VERSION, Verified: time.Now().UTC()}
+	stamped, failed := 0, 0
+	var firstErr error
+	note := func(err error) {
+		if err != nil {
+			failed++
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+
+	t := config.target
+	whole := !t.IsDir && !t.IsDrive && !t.IsDevice && len(t.Parts) == 0 &&
+		config.Partition == 0 && config.Offset == 0 && config.Length == 0
+	if h := result.Hash; h != nil && whole {
+		if h.Match {
+			stamp := base
+			stamp.Algorithm, stamp.Hash = "sha256", h.Expected
+			err := verify.WriteStamp(t.Path, stamp)
+			if err == nil {
+				stamped++
+			}
+			note(err)
+		} else {
+			note(verify.RemoveStamp(t.Path))
+		}
+	}
+
+	// Files inside an image cannot be stamped, only those of a file system
+	if c := result.Contents; c != nil && (t.IsDir || t.IsDrive || result.DataVolume != nil) {
+		for _, f := range c.Files {
+			path := filepath.Join(c.Root, filepath.FromSlash(f.Name))
+			switch {
+			case f.Status == verify.FileOK && f.Hash != "":
+				stamp := base
+				stamp.Algorithm, stamp.Hash, stamp.Source = f.Algorithm, f.Hash, f.ChecksumFile
+				err := verify.WriteStamp(path, stamp)
+				if err == nil {
+					stamped++
+				}
+				note(err)
+			case f.Status == verify.FileMismatch || f.Status == verify.FileSize:
+				note(verify.RemoveStamp(path))
+			}
+		}
+	}
+
+	if stamped > 0 {
+		fmt.Printf("Stamped %d verified file(s)\n", stamped)
+	}
+	if failed > 0 {
+		fmt.Fprintf(os.Stderr, "Warning: Could not update the stamp of %d file(s): %v\n", failed, firstErr)
+	}
+}
+
+// runStamps prints the stamps -stamp left on files, and on the files under
+// directories apart from checksum files, which are never stamped. It reports
+// whether every file has a stamp and has not changed since it was stamped.
+func runStamps(args []string) (bool, error) {
+	if len(args) == 0 {
+		return false, fmt.Errorf("usage: chkiso stamps <file|dir>...")
+	}
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "-") && len(arg) > 1 {
+			return false, fmt.Errorf("unknown stamps option: %s", arg)
+		}
+	}
+
+	ok := true
+	show := func(path string, info fs.FileInfo) {
+		stamp, err := verify.ReadStamp(path)
+		switch {
+		case errors.Is(err, verify.ErrNoStamp):
+			fmt.Printf("%s: \033[33mnot verified\033[0m\n", path)
+			ok = false
+		case err != nil:
+			fmt.Printf("%s: \033[31m%v\033[0m\n", path, err)
+			ok = false
+		case !stamp.Current(info):
+			fmt.Printf("%s: \033[31mchanged since it was %s\033[0m\n", path, stamp)
+			ok = false
+		default:
+			fmt.Printf("%s: \033[32m%s\033[0m\n", path, stamp)
+		}
+	}
+	for _, arg := range args {
+		info, err := os.Stat(arg)
+		if err != nil {
+			return false, err
+		}
+		if !info.IsDir() {
+			show(arg, info)
+			continue
+		}
+		err = filepath.WalkDir(arg, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || !d.Type().IsRegular() || verify.IsChecksumOrSignature(d.Name()) {
+				return err
+			}
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			show(path, info)
+			return nil
+		})
+		if err != nil {
+			return false, err
+		}
+	}
+	return ok, nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Verdict is the final outcome of a run, written by -result-file and
+// -result-fd for installers and kiosks that wrap chkiso. It is deliberately
+// small and independent of the console output and the report format. Field
+// names are a stable interface; only add fields.
+type Verdict struct {
+	Tool     string          `json:"tool"`
+	Version  string          `json:"version"`
+	Time     time.Time       `json:"time"`
+	Result   string          `json:"result"` // PASSED or FAILED
+	ExitCode int             `json:"exit_code"`
+	Targets  []TargetVerdict `json:"targets"`
+	Failures []string        `json:"failures,omitempty"`
+}
+
+// TargetVerdict is the outcome for one target; a checksum file given as
+// the target has one for each image it lists that was present.
+type TargetVerdict struct {
+	Path     string   `json:"path"`
+	SHA256   string   `json:"sha256,omitempty"`
+	Result   string   `json:"result"`
+	Failures []string `json:"failures,omitempty"`
+}
+
+// addVerdict records the outcome of verifying config's target for the
+// -result-file verdict.
+func addVerdict(config *Config, failures []error) {
+	if config.verdicts == nil {
+		return
+	}
+	tv := TargetVerdict{Path: config.Path, SHA256: config.calculatedSha256, Result: passFail(len(failures) == 0)}
+	for _, err := range failures {
+		tv.Failures = append(tv.Failures, err.Error())
+	}
+	*config.verdicts = append(*config.verdicts, tv)
+}
+
+// writeVerdict writes the verdict of the run to the -result-file or
+// -result-fd. A file is written under a temporary name and renamed into
+// place, so a wrapper never reads a partial verdict.
+func writeVerdict(config *Config, failures []error) error {
+	v := Verdict{
+		Tool:    "chkiso",
+		Version: VERSION,
+		Time:    time.Now().UTC(),
+		Result:  passFail(len(failures) == 0),
+		Targets: *config.verdicts,
+	}
+	if len(failures) > 0 {
+		v.ExitCode = 1
+	}
+	for _, err := range failures {
+		v.Failures = append(v.Failures, err.Error())
+	}
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	if config.ResultFD > 0 {
+		f := os.NewFile(uintptr(config.ResultFD), fmt.Sprintf("fd %d", config.ResultFD))
+		if _, err := f.Write(data); err != nil {
+			return fmt.Errorf("could not write the verdict to -result-fd %d: %v", config.ResultFD, err)
+		}
+		return nil
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(config.ResultFile), ".chkiso-result-*")
+	if err != nil {
+		return fmt.Errorf("could not write the verdict: %v", err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return fmt.Errorf("could not write the verdict: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("could not write the verdict: %v", err)
+	}
+	if err := os.Rename(tmp.Name(), config.ResultFile); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("could not write the verdict: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+)
+
+// virusTotalURL is the VirusTotal API endpoint describing a file by its hash.
+const virusTotalURL = "https://www.virustotal.com/api/v3/files/"
+
+// virusTotalKeyVar names the environment variable holding the VirusTotal
+// API key, which is kept off the command line like CHKISO_SMTP_PASSWORD.
+const virusTotalKeyVar = "CHKISO_VT_API_KEY"
+
+// virusTotal is what VirusTotal knows about an image's SHA256.
+type virusTotal struct {
+	Known        bool       `json:"known"`
+	Malicious    int        `json:"malicious"`
+	Suspicious   int        `json:"suspicious"`
+	Engines      int        `json:"engines,omitempty"` // Engines that took part in the last analysis
+	Name         string     `json:"name,omitempty"`
+	LastAnalysis *time.Time `json:"last_analysis,omitempty"`
+	Link         string     `json:"link,omitempty"`
+}
+
+// Flagged reports whether any engine considered the file malicious or
+// suspicious in its last analysis.
+func (v *virusTotal) Flagged() bool {
+	return v.Malicious+v.Suspicious > 0
+}
+
+// lookupVirusTotal asks VirusTotal about sha256. Only the hash is sent,
+// never the file, so an image VirusTotal has not seen stays unknown.
+func lookupVirusTotal(ctx context.Context, key, sha256 string) (*virusTotal, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, virusTotalURL+sha256, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("x-apikey", key)
+	req.Header.Set("User-Agent", "chkiso/"+VERSION)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return &virusTotal{}, nil
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return nil, fmt.Errorf("VirusTotal rejected the API key in %s", virusTotalKeyVar)
+	case http.StatusTooManyRequests:
+		return nil, fmt.Errorf("the VirusTotal API quota of the key is used up; try again later")
+	default:
+		return nil, fmt.Errorf("VirusTotal returned %s", resp.Status)
+	}
+
+	var body struct {
+		Data struct {
+			Attributes struct {
+				MeaningfulName    string         `json:"meaningful_name"`
+				LastAnalysisDate  int64          `json:"last_analysis_date"`
+				LastAnalysisStats map[string]int `json:"last_analysis_stats"`
+			} `json:"attributes"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 16<<20)).Decode(&body); err != nil {
+		return nil, fmt.Errorf("could not read the VirusTotal response: %v", err)
+	}
+	attrs := body.Data.Attributes
+	v := &virusTotal{
+		Known:      true,
+		Malicious:  attrs.LastAnalysisStats["malicious"],
+		Suspicious: attrs.LastAnalysisStats["suspicious"],
+		Name:       attrs.MeaningfulName,
+		Link:       "https://www.virustotal.com/gui/file/" + sha256,
+	}
+	for _, n := range attrs.LastAnalysisStats {
+		v.Engines += n
+	}
+	if attrs.LastAnalysisDate != 0 {
+		t := time.Unix(attrs.LastAnalysisDate, 0).UTC()
+		v.LastAnalysis = &t
+	}
+	return v, nil
+}
+
+// showVirusTotal looks the image's SHA256 up on VirusTotal for -vt. A
+// failed lookup is a warning, and so is a flagged hash: engines disagree
+// about many legitimate tools, so the verdict is left to the user.
+func showVirusTotal(config *Config, sha256 string) {
+	if sha256 == "" || config.Offset != 0 || config.Length != 0 || config.Partition != 0 {
+		return
+	}
+	fmt.Println("\n--- VirusTotal ---")
+	fmt.Println("Looking up the SHA256 (only the hash is sent, never the image)...")
+	ctx, cancel := context.WithTimeout(context.Background(), fetchTimeout)
+	defer cancel()
+	v, err := lookupVirusTotal(ctx, os.Getenv(virusTotalKeyVar), sha256)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: Could not look the hash up on VirusTotal: %v\n", err)
+		return
+	}
+	config.virusTotal = v
+	if !v.Known {
+		fmt.Println("\033[33mVirusTotal does not know this hash: the image has not been submitted there.\033[0m")
+		return
+	}
+	if v.Name != "" {
+		fmt.Printf("Known as: %s\n", v.Name)
+	}
+	if v.LastAnalysis != nil {
+		fmt.Printf("Last analyzed: %s\n", v.LastAnalysis.Local().Format("2006-01-02 15:04"))
+	}
+	if v.Flagged() {
+		fmt.Printf("\033[31mFlagged by %d of %d engines (%d malicious, %d suspicious): %s\033[0m\n", v.Malicious+v.Suspicious, v.Engines, v.Malicious, v.Suspicious, v.Link)
+	} else {
+		fmt.Printf("\033[32mNot flagged by any of %d engines.\033[0m\n", v.Engines)
+	}
+}
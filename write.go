@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/pappasjfed/chkiso/internal/i18n"
+	"github.com/pappasjfed/chkiso/pkg/verify"
+)
+
+// runWrite writes an image to a USB stick or other disk and reads it back
+// to check that the disk holds the image, which replaces writing with dd
+// and hashing the device by hand afterwards. It asks before overwriting the
+// disk unless -yes is given. It reports whether the checks passed.
+func runWrite(args []string) (bool, error) {
+	var paths []string
+	expected := ""
+	yes := false
+	for i := 0; i < len(args); i++ {
+		switch arg := args[i]; arg {
+		case "-sha256", "--sha256":
+			if i+1 >= len(args) {
+				return false, fmt.Errorf("%s requires a value", arg)
+			}
+			i++
+			expected = strings.ToLower(strings.TrimSpace(args[i]))
+			if !verify.IsValidSha256(expected) {
+				return false, fmt.Errorf("invalid SHA256 hash format. Expected 64 hexadecimal characters")
+			}
+		case "-yes", "--yes":
+			yes = true
+		default:
+			if strings.HasPrefix(arg, "-") && len(arg) > 1 {
+				return false, fmt.Errorf("unknown write option: %s", arg)
+			}
+			paths = append(paths, arg)
+		}
+	}
+	if len(paths) != 2 {
+		return false, fmt.Errorf(`usage: chkiso write <image> <device> [-sha256 <hash>] [-yes] (device: /dev/sdX, /dev/diskN or \\.\PhysicalDriveN)`)
+	}
+	source, device := paths[0], paths[1]
+	target, err := verify.NewTarget(source)
+	if err != nil {
+		return false, err
+	}
+	if target.IsDir || target.IsDrive || target.IsDevice {
+		return false, fmt.Errorf("%s is not an image file; write copies an image to a device", source)
+	}
+	deviceSize, err := verify.CheckWriteDevice(device)
+	if err != nil {
+		return false, err
+	}
+
+	if !yes {
+		if info, err := os.Stdin.Stat(); err != nil || info.Mode()&os.ModeCharDevice == 0 {
+			return false, fmt.Errorf("not asking to overwrite %s without a terminal; use -yes", device)
+		}
+		fmt.Fprintf(os.Stderr, "Everything on %s (%s) will be overwritten. Type 'yes' to continue: ", device, formatBytes(deviceSize))
+		answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		if strings.ToLower(strings.TrimSpace(answer)) != "yes" {
+			return false, fmt.Errorf("%s was not written", device)
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	fmt.Printf("Writing %s to %s...\n", target, device)
+	result, err := verify.WriteImage(ctx, target, device, nil)
+	if err != nil {
+		return false, err
+	}
+	fmt.Printf("Wrote %d bytes (%s), and read them back\n", result.Size, formatBytes(result.Size))
+	fmt.Printf("  - Image:      %s\n", result.Sha256)
+	fmt.Printf("  - Read back:  %s\n", result.ReadBack)
+
+	ok := true
+	if expected != "" {
+		fmt.Printf("  - Expected:   %s\n", expected)
+		if result.Sha256 == expected {
+			fmt.Printf("\033[32m%s\033[0m\n", i18n.T("Result: SUCCESS - Image hash matches."))
+		} else {
+			fmt.Printf("\033[31m%s\033[0m\n", i18n.T("Result: FAILURE - Image hash DOES NOT match; the image itself is not the published one."))
+			ok = false
+		}
+	}
+	if result.Match() {
+		fmt.Printf("\033[32m%s\033[0m\n", i18n.T("Result: SUCCESS - %s holds the image.", device))
+	} else {
+		fmt.Printf("\033[31m%s\033[0m\n", i18n.T("Result: FAILURE - %s does not hold the image; the write failed or the device is faulty.", device))
+		ok = false
+	}
+	return ok, nil
+}